@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/datatype/annotation"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Annotation provides access to an annotation data instance at a particular version.
+type Annotation struct {
+	c    *Client
+	uuid dvid.UUID
+	name dvid.InstanceName
+}
+
+// Annotation returns a handle to the annotation instance with the given name at the given version.
+func (c *Client) Annotation(uuid dvid.UUID, name dvid.InstanceName) *Annotation {
+	return &Annotation{c: c, uuid: uuid, name: name}
+}
+
+func (a *Annotation) url(query url.Values, endpoint string, args ...string) string {
+	return a.c.apiURL(nodePath(a.uuid, a.name, endpoint, args...), query)
+}
+
+func relsQuery(relationships bool) url.Values {
+	if relationships {
+		return url.Values{"relationships": []string{"true"}}
+	}
+	return nil
+}
+
+// PostElements stores the given elements, replacing any elements at the same positions.
+func (a *Annotation) PostElements(elems annotation.Elements) error {
+	return a.c.requestJSON("POST", a.url(nil, "elements"), elems, nil)
+}
+
+// GetElements returns the elements within the given subvolume.
+func (a *Annotation) GetElements(size, offset dvid.Point3d) (annotation.Elements, error) {
+	var elems annotation.Elements
+	urlStr := a.url(nil, "elements", coordString(size), coordString(offset))
+	if err := a.c.requestJSON("GET", urlStr, nil, &elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// LabelElements returns the elements within the given label of a synced label instance.
+// If relationships is false, the returned elements will have no relationships.
+func (a *Annotation) LabelElements(label uint64, relationships bool) (annotation.Elements, error) {
+	var elems annotation.Elements
+	urlStr := a.url(relsQuery(relationships), "label", strconv.FormatUint(label, 10))
+	if err := a.c.requestJSON("GET", urlStr, nil, &elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// TagElements returns the elements with the given tag.  If relationships is false, the
+// returned elements will have no relationships.
+func (a *Annotation) TagElements(tag annotation.Tag, relationships bool) (annotation.Elements, error) {
+	var elems annotation.Elements
+	urlStr := a.url(relsQuery(relationships), "tag", url.PathEscape(string(tag)))
+	if err := a.c.requestJSON("GET", urlStr, nil, &elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// DeleteElement deletes the element at the given position along with any relationships
+// pointing to it.
+func (a *Annotation) DeleteElement(pt dvid.Point3d) error {
+	_, err := a.c.request("DELETE", a.url(nil, "element", coordString(pt)), "", nil)
+	return err
+}
@@ -0,0 +1,279 @@
+/*
+Package client provides a Go client for the DVID HTTP API.  It covers repo and version
+management as well as typed access to labelarray, annotation, roi, and keyvalue data
+instances, using the same encoders and decoders as the DVID server.
+
+Example:
+
+	c := client.New("http://emdata.janelia.org:8000")
+	uuid, err := c.NewRepo("my repo", "a test repo")
+	...
+	seg := c.Labelarray(uuid, "segmentation")
+	rles, err := seg.SparseVol(23, labelarray.FormatStreamingRLE, 0)
+*/
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// StatusError is returned when the DVID server responds to a request with a
+// status other than 200 (OK).
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("DVID server returned status %d for %s %s: %s", e.StatusCode, e.Method, e.URL,
+		strings.TrimSpace(e.Message))
+}
+
+// IsNotFound returns true if the error is a StatusError with a 404 (Not Found) status.
+func IsNotFound(err error) bool {
+	serr, ok := err.(StatusError)
+	return ok && serr.StatusCode == http.StatusNotFound
+}
+
+// Client issues requests to a DVID server.
+type Client struct {
+	server string // scheme and host, e.g., "http://localhost:8000"
+	http   *http.Client
+}
+
+// New returns a Client for the DVID server at the given address, e.g., "localhost:8000"
+// or "http://localhost:8000".
+func New(serverAddr string) *Client {
+	return NewWithHTTPClient(serverAddr, http.DefaultClient)
+}
+
+// NewWithHTTPClient returns a Client that uses the given http.Client, e.g., one with
+// custom timeouts or transport.
+func NewWithHTTPClient(serverAddr string, hc *http.Client) *Client {
+	if !strings.HasPrefix(serverAddr, "http://") && !strings.HasPrefix(serverAddr, "https://") {
+		serverAddr = "http://" + serverAddr
+	}
+	return &Client{
+		server: strings.TrimSuffix(serverAddr, "/"),
+		http:   hc,
+	}
+}
+
+// Server returns the scheme and host of the DVID server used by this client.
+func (c *Client) Server() string {
+	return c.server
+}
+
+// apiURL returns the full URL for a path relative to the DVID API, e.g., "repos/info".
+func (c *Client) apiURL(path string, query url.Values) string {
+	urlStr := c.server + server.WebAPIPath + path
+	if len(query) != 0 {
+		urlStr += "?" + query.Encode()
+	}
+	return urlStr
+}
+
+func nodePath(uuid dvid.UUID, name dvid.InstanceName, endpoint string, args ...string) string {
+	path := fmt.Sprintf("node/%s/%s/%s", uuid, name, endpoint)
+	if len(args) != 0 {
+		path += "/" + strings.Join(args, "/")
+	}
+	return path
+}
+
+// do sends a request and returns the response if it has status OK.  The caller must close
+// the response body.
+func (c *Client) do(method, urlStr, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, StatusError{Method: method, URL: urlStr, StatusCode: resp.StatusCode, Message: string(msg)}
+	}
+	return resp, nil
+}
+
+// request sends a request and returns the response body.
+func (c *Client) request(method, urlStr, contentType string, body io.Reader) ([]byte, error) {
+	resp, err := c.do(method, urlStr, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// requestJSON sends the JSON encoding of in, if non-nil, and decodes any JSON response into out,
+// if non-nil.
+func (c *Client) requestJSON(method, urlStr string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	}
+	data, err := c.request(method, urlStr, "application/json", body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unable to decode JSON response from %s %s: %v", method, urlStr, err)
+	}
+	return nil
+}
+
+// ---- Server and repo management
+
+// ServerInfo returns the JSON server information as a map.
+func (c *Client) ServerInfo() (map[string]interface{}, error) {
+	var info map[string]interface{}
+	if err := c.requestJSON("GET", c.apiURL("server/info", nil), nil, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// NewRepo creates a new repo and returns the UUID of its root node.
+func (c *Client) NewRepo(alias, description string) (dvid.UUID, error) {
+	in := map[string]string{"alias": alias, "description": description}
+	var out struct {
+		Root dvid.UUID `json:"root"`
+	}
+	if err := c.requestJSON("POST", c.apiURL("repos", nil), in, &out); err != nil {
+		return dvid.NilUUID, err
+	}
+	return out.Root, nil
+}
+
+// RepoInfo returns the JSON information for the repo containing the given node.
+func (c *Client) RepoInfo(uuid dvid.UUID) (map[string]interface{}, error) {
+	var info map[string]interface{}
+	if err := c.requestJSON("GET", c.apiURL(fmt.Sprintf("repo/%s/info", uuid), nil), nil, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// NewInstance creates a data instance of the given type name in the repo containing the
+// given node.  Type-specific settings, e.g., "BlockSize" or "VoxelSize", can be passed via
+// the config.
+func (c *Client) NewInstance(uuid dvid.UUID, typename dvid.TypeString, name dvid.InstanceName, config dvid.Config) error {
+	config.Set("typename", string(typename))
+	config.Set("dataname", string(name))
+	data, err := config.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = c.request("POST", c.apiURL(fmt.Sprintf("repo/%s/instance", uuid), nil), "application/json", bytes.NewBuffer(data))
+	return err
+}
+
+// SetSync establishes syncs from a data instance to other data instances.  If replace is true,
+// any existing syncs are replaced instead of being appended to.
+func (c *Client) SetSync(uuid dvid.UUID, name dvid.InstanceName, replace bool, syncs ...dvid.InstanceName) error {
+	names := make([]string, len(syncs))
+	for i, s := range syncs {
+		names[i] = string(s)
+	}
+	var query url.Values
+	if replace {
+		query = url.Values{"replace": []string{"true"}}
+	}
+	in := map[string]string{"sync": strings.Join(names, ",")}
+	return c.requestJSON("POST", c.apiURL(nodePath(uuid, name, "sync"), query), in, nil)
+}
+
+// Commit locks the given node with a note and log entries.
+func (c *Client) Commit(uuid dvid.UUID, note string, log []string) error {
+	in := struct {
+		Note string   `json:"note"`
+		Log  []string `json:"log"`
+	}{note, log}
+	return c.requestJSON("POST", c.apiURL(fmt.Sprintf("node/%s/commit", uuid), nil), in, nil)
+}
+
+// Committed returns true if the given node has been committed (locked).
+func (c *Client) Committed(uuid dvid.UUID) (bool, error) {
+	var out struct {
+		Locked bool
+	}
+	if err := c.requestJSON("GET", c.apiURL(fmt.Sprintf("node/%s/commit", uuid), nil), nil, &out); err != nil {
+		return false, err
+	}
+	return out.Locked, nil
+}
+
+type childResponse struct {
+	Child dvid.UUID `json:"child"`
+}
+
+// NewVersion creates a child version of a committed node on the same branch.
+func (c *Client) NewVersion(uuid dvid.UUID, note string) (dvid.UUID, error) {
+	in := map[string]string{"note": note}
+	var out childResponse
+	if err := c.requestJSON("POST", c.apiURL(fmt.Sprintf("node/%s/newversion", uuid), nil), in, &out); err != nil {
+		return dvid.NilUUID, err
+	}
+	return out.Child, nil
+}
+
+// Branch creates a child version of a committed node on a new, named branch.
+func (c *Client) Branch(uuid dvid.UUID, branch, note string) (dvid.UUID, error) {
+	in := map[string]string{"branch": branch, "note": note}
+	var out childResponse
+	if err := c.requestJSON("POST", c.apiURL(fmt.Sprintf("node/%s/branch", uuid), nil), in, &out); err != nil {
+		return dvid.NilUUID, err
+	}
+	return out.Child, nil
+}
+
+// Merge creates a conflict-free merge of the given committed parent nodes and returns
+// the UUID of the new child node.
+func (c *Client) Merge(parents []dvid.UUID, note string) (dvid.UUID, error) {
+	if len(parents) < 2 {
+		return dvid.NilUUID, fmt.Errorf("merge requires at least two parents, got %d", len(parents))
+	}
+	root := parents[0]
+	in := struct {
+		MergeType string      `json:"mergeType"`
+		Note      string      `json:"note"`
+		Parents   []dvid.UUID `json:"parents"`
+	}{"conflict-free", note, parents}
+	var out childResponse
+	if err := c.requestJSON("POST", c.apiURL(fmt.Sprintf("repo/%s/merge", root), nil), in, &out); err != nil {
+		return dvid.NilUUID, err
+	}
+	return out.Child, nil
+}
+
+// coordString returns the underscore-separated form of a point used in DVID endpoints.
+func coordString(p dvid.Point3d) string {
+	return fmt.Sprintf("%d_%d_%d", p[0], p[1], p[2])
+}
@@ -0,0 +1,347 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/annotation"
+	"github.com/janelia-flyem/dvid/datatype/labelarray"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+
+	_ "github.com/janelia-flyem/dvid/datatype/keyvalue"
+	_ "github.com/janelia-flyem/dvid/datatype/roi"
+)
+
+// openTestClient opens a test server and returns a client connected to it along with a
+// function that closes both.
+func openTestClient(t *testing.T) (*Client, func()) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(server.ServeSingleHTTP))
+	return New(ts.URL), func() {
+		ts.Close()
+		server.CloseTest()
+	}
+}
+
+func TestRepoManagement(t *testing.T) {
+	c, closeFunc := openTestClient(t)
+	defer closeFunc()
+
+	root, err := c.NewRepo("client test", "repo created by client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.RepoInfo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info["Alias"] != "client test" {
+		t.Errorf("expected repo alias %q, got %v\n", "client test", info["Alias"])
+	}
+	if err := c.NewInstance(root, "keyvalue", "kv", dvid.NewConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.NewVersion(root, "uncommitted"); err == nil {
+		t.Errorf("expected error creating version off uncommitted node\n")
+	}
+	if err := c.Commit(root, "root commit", []string{"first entry"}); err != nil {
+		t.Fatal(err)
+	}
+	locked, err := c.Committed(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Errorf("expected root %s to be committed\n", root)
+	}
+
+	master, err := c.NewVersion(root, "master child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch, err := c.Branch(root, "alt", "alternate child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master == branch {
+		t.Fatalf("expected different UUIDs for new version and branch, got %s\n", master)
+	}
+	if err := c.Commit(master, "master commit", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Commit(branch, "branch commit", nil); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := c.Merge([]dvid.UUID{master, branch}, "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged == dvid.NilUUID || merged == master || merged == branch {
+		t.Errorf("bad merged UUID %s\n", merged)
+	}
+
+	_, err = c.RepoInfo(dvid.UUID("deadbeef"))
+	if _, ok := err.(StatusError); !ok {
+		t.Errorf("expected StatusError for bad UUID, got %v\n", err)
+	}
+}
+
+// makeTwoBodies returns a 64^3 volume with label 1 in z < 32 and label 2 in z >= 32.
+func makeTwoBodies() []byte {
+	data := make([]byte, 64*64*64*8)
+	for z := 0; z < 64; z++ {
+		label := uint64(1)
+		if z >= 32 {
+			label = 2
+		}
+		for i := z * 64 * 64; i < (z+1)*64*64; i++ {
+			binary.LittleEndian.PutUint64(data[i*8:i*8+8], label)
+		}
+	}
+	return data
+}
+
+func slabRLEs(z0, z1 int32) dvid.RLEs {
+	var rles dvid.RLEs
+	for z := z0; z < z1; z++ {
+		for y := int32(0); y < 64; y++ {
+			rles = append(rles, dvid.NewRLE(dvid.Point3d{0, y, z}, 64))
+		}
+	}
+	return rles
+}
+
+func TestLabelarray(t *testing.T) {
+	c, closeFunc := openTestClient(t)
+	defer closeFunc()
+
+	uuid, err := c.NewRepo("labels", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := dvid.NewConfig()
+	config.Set("BlockSize", "32,32,32")
+	for _, name := range []dvid.InstanceName{"labels", "copy"} {
+		if err := c.NewInstance(uuid, "labelarray", name, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seg := c.Labelarray(uuid, "labels")
+
+	size := dvid.Point3d{64, 64, 64}
+	offset := dvid.Point3d{0, 0, 0}
+	data := makeTwoBodies()
+	if err := seg.PutRaw(size, offset, data, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := seg.GetRaw(size, offset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("raw labels retrieved differ from those stored\n")
+	}
+	if label, err := seg.Label(dvid.Point3d{10, 20, 40}); err != nil || label != 2 {
+		t.Fatalf("expected label 2, got %d (err %v)\n", label, err)
+	}
+
+	expected := slabRLEs(0, 32).Normalize()
+	for _, format := range []labelarray.SparseVolFormat{labelarray.FormatLegacyRLE, labelarray.FormatStreamingRLE, labelarray.FormatBinaryBlocks} {
+		rles, err := seg.SparseVol(1, format, 0)
+		if err != nil {
+			t.Fatalf("sparsevol format %d: %v\n", format, err)
+		}
+		if !reflect.DeepEqual(rles.Normalize(), expected) {
+			t.Errorf("sparsevol format %d: got %d RLEs, expected %d\n", format, len(rles.Normalize()), len(expected))
+		}
+	}
+	if _, err := seg.SparseVol(9, labelarray.FormatStreamingRLE, 0); !IsNotFound(err) {
+		t.Errorf("expected not found error for missing label, got %v\n", err)
+	}
+
+	// Copy blocks to another instance.
+	blocks, err := seg.GetBlocks(size, offset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 8 {
+		t.Fatalf("expected 8 blocks, got %d\n", len(blocks))
+	}
+	cp := c.Labelarray(uuid, "copy")
+	if err := cp.PutBlocks(blocks, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "copy"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = cp.GetRaw(size, offset, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("labels copied via blocks differ from original\n")
+	}
+
+	// Merge then split.
+	if err := seg.Merge(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatal(err)
+	}
+	if label, err := seg.Label(dvid.Point3d{10, 20, 40}); err != nil || label != 1 {
+		t.Fatalf("expected label 1 after merge, got %d (err %v)\n", label, err)
+	}
+	newLabel, err := seg.Split(1, slabRLEs(0, 8), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatal(err)
+	}
+	if newLabel == 0 || newLabel == 1 {
+		t.Fatalf("bad split label %d\n", newLabel)
+	}
+	if label, err := seg.Label(dvid.Point3d{5, 5, 5}); err != nil || label != newLabel {
+		t.Errorf("expected split label %d, got %d (err %v)\n", newLabel, label, err)
+	}
+	rles, err := seg.SparseVol(newLabel, labelarray.FormatStreamingRLE, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rles.Normalize(), slabRLEs(0, 8).Normalize()) {
+		t.Errorf("split body has unexpected sparse volume with %d RLEs\n", len(rles))
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	c, closeFunc := openTestClient(t)
+	defer closeFunc()
+
+	uuid, err := c.NewRepo("annotations", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NewInstance(uuid, "annotation", "synapses", dvid.NewConfig()); err != nil {
+		t.Fatal(err)
+	}
+	syn := c.Annotation(uuid, "synapses")
+	elems := annotation.Elements{
+		{ElementNR: annotation.ElementNR{Pos: dvid.Point3d{10, 20, 30}, Kind: annotation.PreSyn, Tags: annotation.Tags{"good"}}},
+		{ElementNR: annotation.ElementNR{Pos: dvid.Point3d{15, 25, 35}, Kind: annotation.PostSyn, Tags: annotation.Tags{"good", "new"}}},
+		{ElementNR: annotation.ElementNR{Pos: dvid.Point3d{90, 90, 90}, Kind: annotation.Note}},
+	}
+	if err := syn.PostElements(elems); err != nil {
+		t.Fatal(err)
+	}
+	got, err := syn.GetElements(dvid.Point3d{50, 50, 50}, dvid.Point3d{0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Normalize(), elems[:2].Normalize()) {
+		t.Errorf("expected %v, got %v\n", elems[:2], got)
+	}
+	got, err = syn.TagElements("new", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Pos.Equals(dvid.Point3d{15, 25, 35}) {
+		t.Errorf("bad tag query result: %v\n", got)
+	}
+	if err := syn.DeleteElement(dvid.Point3d{10, 20, 30}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = syn.TagElements("good", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("expected 1 element tagged after deletion, got %v\n", got)
+	}
+}
+
+func TestROIAndKeyValue(t *testing.T) {
+	c, closeFunc := openTestClient(t)
+	defer closeFunc()
+
+	uuid, err := c.NewRepo("roi and kv", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NewInstance(uuid, "roi", "roi", dvid.NewConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NewInstance(uuid, "keyvalue", "kv", dvid.NewConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	roi := c.ROI(uuid, "roi")
+	spans := []dvid.Span{{1, 2, 3, 5}, {2, 2, 0, 1}}
+	if err := roi.PutSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	gotSpans, err := roi.GetSpans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSpans, spans) {
+		t.Errorf("expected spans %v, got %v\n", spans, gotSpans)
+	}
+	// Default ROI block size is 32.
+	inclusions, err := roi.PointQuery([]dvid.Point3d{{100, 70, 40}, {0, 0, 0}, {40, 70, 70}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inclusions, []bool{true, false, true}) {
+		t.Errorf("bad point query result: %v\n", inclusions)
+	}
+	if err := roi.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if gotSpans, err = roi.GetSpans(); err != nil || len(gotSpans) != 0 {
+		t.Errorf("expected no spans after delete, got %v (err %v)\n", gotSpans, err)
+	}
+
+	kv := c.KeyValue(uuid, "kv")
+	for _, key := range []string{"a", "b", "c"} {
+		if err := kv.Put(key, []byte("value "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value, found, err := kv.Get("b")
+	if err != nil || !found || string(value) != "value b" {
+		t.Errorf("bad Get: value %q, found %t, err %v\n", value, found, err)
+	}
+	keys, err := kv.KeyRange("b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"b", "c"}) {
+		t.Errorf("bad key range: %v\n", keys)
+	}
+	if err := kv.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err = kv.Get("a"); err != nil || found {
+		t.Errorf("expected deleted key to be missing, found %t, err %v\n", found, err)
+	}
+	keys, err = kv.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"b", "c"}) {
+		t.Errorf("bad keys after delete: %v\n", keys)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"net/url"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// KeyValue provides access to a keyvalue data instance at a particular version.
+type KeyValue struct {
+	c    *Client
+	uuid dvid.UUID
+	name dvid.InstanceName
+}
+
+// KeyValue returns a handle to the keyvalue instance with the given name at the given version.
+func (c *Client) KeyValue(uuid dvid.UUID, name dvid.InstanceName) *KeyValue {
+	return &KeyValue{c: c, uuid: uuid, name: name}
+}
+
+func (kv *KeyValue) url(endpoint string, args ...string) string {
+	return kv.c.apiURL(nodePath(kv.uuid, kv.name, endpoint, args...), nil)
+}
+
+// Get returns the value for the given key.  If the key does not exist, found is false.
+func (kv *KeyValue) Get(key string) (value []byte, found bool, err error) {
+	value, err = kv.c.request("GET", kv.url("key", url.PathEscape(key)), "", nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Put stores the value for the given key.
+func (kv *KeyValue) Put(key string, value []byte) error {
+	_, err := kv.c.request("POST", kv.url("key", url.PathEscape(key)), "application/octet-stream", bytes.NewBuffer(value))
+	return err
+}
+
+// Delete removes the given key.
+func (kv *KeyValue) Delete(key string) error {
+	_, err := kv.c.request("DELETE", kv.url("key", url.PathEscape(key)), "", nil)
+	return err
+}
+
+// Keys returns all keys for this instance in sorted order.
+func (kv *KeyValue) Keys() ([]string, error) {
+	var keys []string
+	if err := kv.c.requestJSON("GET", kv.url("keys"), nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// KeyRange returns all keys between the begin and end keys, inclusive, in sorted order.
+func (kv *KeyValue) KeyRange(begKey, endKey string) ([]string, error) {
+	var keys []string
+	urlStr := kv.url("keyrange", url.PathEscape(begKey), url.PathEscape(endKey))
+	if err := kv.c.requestJSON("GET", urlStr, nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,304 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/labelarray"
+	"github.com/janelia-flyem/dvid/dvid"
+
+	lz4 "github.com/janelia-flyem/go/golz4"
+)
+
+// Labelarray provides access to a labelarray data instance at a particular version.
+type Labelarray struct {
+	c    *Client
+	uuid dvid.UUID
+	name dvid.InstanceName
+}
+
+// Labelarray returns a handle to the labelarray instance with the given name at the given version.
+func (c *Client) Labelarray(uuid dvid.UUID, name dvid.InstanceName) *Labelarray {
+	return &Labelarray{c: c, uuid: uuid, name: name}
+}
+
+func (l *Labelarray) url(query url.Values, endpoint string, args ...string) string {
+	return l.c.apiURL(nodePath(l.uuid, l.name, endpoint, args...), query)
+}
+
+func scaleQuery(scale uint8) url.Values {
+	query := url.Values{}
+	if scale != 0 {
+		query.Set("scale", strconv.Itoa(int(scale)))
+	}
+	return query
+}
+
+// GetRaw returns the little-endian uint64 labels for the given subvolume at the given scale.
+// Data is transferred using lz4 compression.
+func (l *Labelarray) GetRaw(size, offset dvid.Point3d, scale uint8) ([]byte, error) {
+	query := scaleQuery(scale)
+	query.Set("compression", "lz4")
+	urlStr := l.url(query, "raw", "0_1_2", coordString(size), coordString(offset))
+	resp, err := l.c.do("GET", urlStr, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return labelarray.GetBinaryData("lz4", resp.Body, size.Prod()*8)
+}
+
+// PutRaw stores little-endian uint64 labels into the given subvolume.  If mutate is true,
+// the write is handled as a mutation of previously stored labels, with appropriate
+// index and sync updates for changed blocks.
+func (l *Labelarray) PutRaw(size, offset dvid.Point3d, data []byte, mutate bool) error {
+	if int64(len(data)) != size.Prod()*8 {
+		return fmt.Errorf("expected %d bytes for %s subvolume of labels, got %d bytes", size.Prod()*8, size, len(data))
+	}
+	compressed := make([]byte, lz4.CompressBound(data))
+	outSize, err := lz4.Compress(data, compressed)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"compression": []string{"lz4"}}
+	if mutate {
+		query.Set("mutate", "true")
+	}
+	urlStr := l.url(query, "raw", "0_1_2", coordString(size), coordString(offset))
+	_, err = l.c.request("POST", urlStr, "application/octet-stream", bytes.NewBuffer(compressed[:outSize]))
+	return err
+}
+
+// LabelBlock is a label block with its block coordinate.
+type LabelBlock struct {
+	Coord dvid.ChunkPoint3d
+	Block *labels.Block
+}
+
+// GetBlocks returns the stored label blocks within a block-aligned subvolume at the given scale.
+// Unset blocks are not returned.
+func (l *Labelarray) GetBlocks(size, offset dvid.Point3d, scale uint8) ([]LabelBlock, error) {
+	query := scaleQuery(scale)
+	query.Set("compression", "blocks")
+	urlStr := l.url(query, "blocks", coordString(size), coordString(offset))
+	resp, err := l.c.do("GET", urlStr, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var blocks []LabelBlock
+	hdr := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(resp.Body, hdr); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading block header: %v", err)
+		}
+		bx := int32(binary.LittleEndian.Uint32(hdr[0:4]))
+		by := int32(binary.LittleEndian.Uint32(hdr[4:8]))
+		bz := int32(binary.LittleEndian.Uint32(hdr[8:12]))
+		numBytes := int(binary.LittleEndian.Uint32(hdr[12:16]))
+		data := make([]byte, numBytes)
+		if _, err := io.ReadFull(resp.Body, data); err != nil {
+			return nil, fmt.Errorf("error reading %d bytes for block (%d,%d,%d): %v", numBytes, bx, by, bz, err)
+		}
+		// Native blocks are sent in their stored compression, which is gzip by default.
+		if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+			zr, err := gzip.NewReader(bytes.NewBuffer(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				return nil, err
+			}
+			zr.Close()
+		}
+		var block labels.Block
+		if err := block.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("unable to deserialize block (%d,%d,%d): %v", bx, by, bz, err)
+		}
+		blocks = append(blocks, LabelBlock{dvid.ChunkPoint3d{bx, by, bz}, &block})
+	}
+	return blocks, nil
+}
+
+// PutBlocks stores label blocks at the given scale.  If downres is true, lower-resolution
+// scales are computed from the stored blocks; this is only allowed for scale 0.
+func (l *Labelarray) PutBlocks(blocks []LabelBlock, scale uint8, downres bool) error {
+	var buf bytes.Buffer
+	hdr := make([]byte, 16)
+	for _, lb := range blocks {
+		serialization, err := lb.Block.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		var gzipOut bytes.Buffer
+		zw := gzip.NewWriter(&gzipOut)
+		if _, err = zw.Write(serialization); err != nil {
+			return err
+		}
+		if err = zw.Close(); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(hdr[0:4], uint32(lb.Coord[0]))
+		binary.LittleEndian.PutUint32(hdr[4:8], uint32(lb.Coord[1]))
+		binary.LittleEndian.PutUint32(hdr[8:12], uint32(lb.Coord[2]))
+		binary.LittleEndian.PutUint32(hdr[12:16], uint32(gzipOut.Len()))
+		buf.Write(hdr)
+		buf.Write(gzipOut.Bytes())
+	}
+	query := scaleQuery(scale)
+	if downres {
+		query.Set("downres", "true")
+	}
+	_, err := l.c.request("POST", l.url(query, "blocks"), "application/octet-stream", &buf)
+	return err
+}
+
+// SparseVolBlocks returns the binary blocks for the given label at the given scale.
+func (l *Labelarray) SparseVolBlocks(label uint64, scale uint8) ([]labels.BinaryBlock, error) {
+	query := scaleQuery(scale)
+	query.Set("format", "blocks")
+	resp, err := l.c.do("GET", l.url(query, "sparsevol", strconv.FormatUint(label, 10)), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return labels.ReceiveBinaryBlocks(resp.Body)
+}
+
+// SparseVol returns the RLEs for the given label at the given scale, retrieving them using
+// the given sparse volume format.  A StatusError with 404 status is returned if the label
+// has no voxels.
+func (l *Labelarray) SparseVol(label uint64, format labelarray.SparseVolFormat, scale uint8) (dvid.RLEs, error) {
+	if format == labelarray.FormatBinaryBlocks {
+		blocks, err := l.SparseVolBlocks(label, scale)
+		if err != nil {
+			return nil, err
+		}
+		return binaryBlocksToRLEs(blocks), nil
+	}
+
+	query := scaleQuery(scale)
+	switch format {
+	case labelarray.FormatLegacyRLE:
+		query.Set("format", "rles")
+	case labelarray.FormatStreamingRLE:
+		query.Set("format", "srles")
+	default:
+		return nil, fmt.Errorf("unknown sparse volume format %d", format)
+	}
+	data, err := l.c.request("GET", l.url(query, "sparsevol", strconv.FormatUint(label, 10)), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if format == labelarray.FormatLegacyRLE {
+		return dvid.ReadRLEs(bytes.NewBuffer(data))
+	}
+	var rles dvid.RLEs
+	if err := rles.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return rles, nil
+}
+
+// binaryBlocksToRLEs converts binary blocks into RLEs with runs along X.
+func binaryBlocksToRLEs(blocks []labels.BinaryBlock) dvid.RLEs {
+	var rles dvid.RLEs
+	for _, block := range blocks {
+		nx, ny, nz := block.Size[0], block.Size[1], block.Size[2]
+		i := 0
+		for z := int32(0); z < nz; z++ {
+			for y := int32(0); y < ny; y++ {
+				var runStart, runLength int32
+				for x := int32(0); x < nx; x++ {
+					if block.Voxels[i] {
+						if runLength == 0 {
+							runStart = x
+						}
+						runLength++
+					} else if runLength != 0 {
+						start := dvid.Point3d{block.Offset[0] + runStart, block.Offset[1] + y, block.Offset[2] + z}
+						rles = append(rles, dvid.NewRLE(start, runLength))
+						runLength = 0
+					}
+					i++
+				}
+				if runLength != 0 {
+					start := dvid.Point3d{block.Offset[0] + runStart, block.Offset[1] + y, block.Offset[2] + z}
+					rles = append(rles, dvid.NewRLE(start, runLength))
+				}
+			}
+		}
+	}
+	return rles.Normalize()
+}
+
+// Label returns the label at the given point.
+func (l *Labelarray) Label(pt dvid.Point3d) (uint64, error) {
+	var out struct {
+		Label uint64
+	}
+	if err := l.c.requestJSON("GET", l.url(nil, "label", coordString(pt)), nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Label, nil
+}
+
+// Merge merges the given labels into the target label.
+func (l *Labelarray) Merge(target uint64, merged ...uint64) error {
+	if len(merged) == 0 {
+		return fmt.Errorf("at least one label must be merged into label %d", target)
+	}
+	in := append([]uint64{target}, merged...)
+	return l.c.requestJSON("POST", l.url(nil, "merge"), in, nil)
+}
+
+// Split removes the voxels given by the RLEs from the label and assigns them to a new label,
+// which is returned.  If splitLabel is non-zero, it is used as the new label.
+func (l *Labelarray) Split(label uint64, rles dvid.RLEs, splitLabel uint64) (uint64, error) {
+	body, err := encodeLegacyRLEs(rles)
+	if err != nil {
+		return 0, err
+	}
+	var query url.Values
+	if splitLabel != 0 {
+		query = url.Values{"splitlabel": []string{strconv.FormatUint(splitLabel, 10)}}
+	}
+	urlStr := l.url(query, "split", strconv.FormatUint(label, 10))
+	data, err := l.c.request("POST", urlStr, "application/octet-stream", bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Label uint64 `json:"label"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return 0, fmt.Errorf("unable to decode split response %q: %v", string(data), err)
+	}
+	return out.Label, nil
+}
+
+// encodeLegacyRLEs returns the legacy binary sparse volume encoding used for split requests.
+func encodeLegacyRLEs(rles dvid.RLEs) ([]byte, error) {
+	spans, err := rles.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 12, 12+len(spans))
+	buf[0] = dvid.EncodingBinary
+	buf[1] = 3 // # of dimensions
+	buf[2] = 0 // dimension of run (X)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(rles)))
+	return append(buf, spans...), nil
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ROI provides access to a roi data instance at a particular version.
+type ROI struct {
+	c    *Client
+	uuid dvid.UUID
+	name dvid.InstanceName
+}
+
+// ROI returns a handle to the roi instance with the given name at the given version.
+func (c *Client) ROI(uuid dvid.UUID, name dvid.InstanceName) *ROI {
+	return &ROI{c: c, uuid: uuid, name: name}
+}
+
+func (roi *ROI) url(endpoint string) string {
+	return roi.c.apiURL(nodePath(roi.uuid, roi.name, endpoint), nil)
+}
+
+// PutSpans adds the given block spans, each [z, y, x0, x1] in block coordinates, to the ROI.
+func (roi *ROI) PutSpans(spans []dvid.Span) error {
+	return roi.c.requestJSON("POST", roi.url("roi"), spans, nil)
+}
+
+// GetSpans returns the block spans, each [z, y, x0, x1], of the ROI.
+func (roi *ROI) GetSpans() ([]dvid.Span, error) {
+	var spans []dvid.Span
+	if err := roi.c.requestJSON("GET", roi.url("roi"), nil, &spans); err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+// Delete removes all spans from the ROI.
+func (roi *ROI) Delete() error {
+	_, err := roi.c.request("DELETE", roi.url("roi"), "", nil)
+	return err
+}
+
+// PointQuery returns whether each of the given voxel coordinates is within the ROI.
+func (roi *ROI) PointQuery(pts []dvid.Point3d) ([]bool, error) {
+	var inclusions []bool
+	if err := roi.c.requestJSON("POST", roi.url("ptquery"), pts, &inclusions); err != nil {
+		return nil, err
+	}
+	return inclusions, nil
+}
@@ -31,7 +31,8 @@ var (
 )
 
 const helpMessage = `
-dvid-backup does a cold backup of a local leveldb storage engine.
+dvid-backup does a cold backup of a local leveldb storage engine.  For a hot backup of a
+running server, use the "dvid backup" command or POST /api/server/backup.
 
 Usage: dvid-backup [options] <database directory> <backup directory>
 
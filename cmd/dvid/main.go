@@ -36,6 +36,7 @@ import (
 	_ "github.com/janelia-flyem/dvid/datatype/labelsz"
 	_ "github.com/janelia-flyem/dvid/datatype/labelvol"
 	_ "github.com/janelia-flyem/dvid/datatype/multichan16"
+	_ "github.com/janelia-flyem/dvid/datatype/precomputed"
 	_ "github.com/janelia-flyem/dvid/datatype/roi"
 )
 
@@ -98,6 +99,14 @@ For storage engines that have repair ability (e.g., basholeveldb):
         The <engine name> refers to the name of the engine: "basholeveldb", "kvautobus", etc.
         The <database path> is the file path to the directory.
 
+To restore an online backup made with the "backup" server command or POST /api/server/backup:
+
+    restore <configuration path> <backup directory> [overwrite=true]
+
+        The server must not be running.  Each store in the backup is restored into the store
+        with the same name in the configuration, which must be empty unless overwrite=true,
+        in which case all existing keys in the store are deleted first.
+
 To get help for a remote DVID server:
 
     help server
@@ -204,6 +213,8 @@ func DoCommand(cmd dvid.Command) error {
 		return DoServe(cmd)
 	case "repair":
 		return DoRepair(cmd)
+	case "restore":
+		return DoRestore(cmd)
 	case "about":
 		fmt.Println(server.About())
 	// Send everything else to server via DVID terminal
@@ -235,6 +246,43 @@ func DoRepair(cmd dvid.Command) error {
 	return nil
 }
 
+// DoRestore performs the "restore" command, writing a backup into the stores of a
+// configuration while the server is not running.
+func DoRestore(cmd dvid.Command) error {
+	configPath := cmd.Argument(1)
+	backupDir := cmd.Argument(2)
+	if backupDir == "" {
+		return fmt.Errorf("restore command must be followed by configuration path and backup directory")
+	}
+	overwrite, _, err := cmd.Settings().GetBool("overwrite")
+	if err != nil {
+		return err
+	}
+	_, logConfig, backend, _, err := server.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("Error loading configuration file %q: %v\n", configPath, err)
+	}
+	logConfig.SetLogger()
+
+	if _, err := storage.Initialize(cmd.Settings(), backend); err != nil {
+		return fmt.Errorf("Unable to initialize storage: %v\n", err)
+	}
+	defer storage.Close()
+
+	manifest, err := datastore.Restore(backupDir, overwrite)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup taken %s from %s:\n", manifest.Started, backupDir)
+	for alias, bf := range manifest.Stores {
+		fmt.Printf("  store %q: %d key-values\n", alias, bf.KeyValues)
+	}
+	for _, repo := range manifest.Repos {
+		fmt.Printf("  repo %s (%q): %d versions\n", repo.Root, repo.Alias, len(repo.Versions))
+	}
+	return nil
+}
+
 // DoServe opens a datastore then creates both web and rpc servers for the datastore
 func DoServe(cmd dvid.Command) error {
 	// Capture ctrl+c and other interrupts.  Then handle graceful shutdown.
@@ -0,0 +1,313 @@
+// +build !clustered,!gcloud
+
+/*
+	This file supports export of a repo to a self-describing archive file and import of
+	such an archive into another DVID server, allowing datasets to be moved on disk
+	without both servers being online.  Export reuses the push machinery, including
+	transmit modes and datatype-specific filters, while import reuses the receiving side
+	of a push to remap instance and version ids.
+*/
+
+package datastore
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/rpc"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	archiveFormat  = "dvid-repo-archive"
+	archiveVersion = 1
+
+	// maximum bytes of key-values to buffer into one archive record.
+	archiveRecordBytes = 4 * dvid.Mega
+)
+
+// archiveHeader starts every archive and holds the repo metadata.
+type archiveHeader struct {
+	Format   string
+	Version  int
+	Created  time.Time
+	Transmit rpc.Transmit
+	UUID     dvid.UUID // the version exported
+	Repo     []byte    // serialized repo including DAG and data instance configs
+}
+
+// archiveRecord follows the header and holds one of: the start of a data instance,
+// a batch of key-values for the current data instance, or its end.
+type archiveRecord struct {
+	Start *DataTxInit
+	KVs   []storage.KeyValue
+	End   bool
+}
+
+type archiveWriter struct {
+	f   *os.File
+	zw  *gzip.Writer
+	enc *gob.Encoder
+
+	kvs      []storage.KeyValue
+	kvsBytes int
+	err      error // first error encountered while writing key-values
+}
+
+func newArchiveWriter(filename string) (*archiveWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	zw := gzip.NewWriter(f)
+	return &archiveWriter{f: f, zw: zw, enc: gob.NewEncoder(zw)}, nil
+}
+
+func (a *archiveWriter) startData(d dvid.Data) error {
+	if a.err != nil {
+		return a.err
+	}
+	start := &DataTxInit{
+		DataName:   d.DataName(),
+		TypeName:   d.TypeName(),
+		InstanceID: d.InstanceID(),
+	}
+	a.err = a.enc.Encode(archiveRecord{Start: start})
+	return a.err
+}
+
+func (a *archiveWriter) flush() error {
+	if a.err == nil && len(a.kvs) != 0 {
+		a.err = a.enc.Encode(archiveRecord{KVs: a.kvs})
+	}
+	a.kvs = nil
+	a.kvsBytes = 0
+	return a.err
+}
+
+func (a *archiveWriter) putKV(kv *storage.KeyValue) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.kvs = append(a.kvs, *kv)
+	a.kvsBytes += len(kv.K) + len(kv.V)
+	if a.kvsBytes >= archiveRecordBytes {
+		return a.flush()
+	}
+	return nil
+}
+
+func (a *archiveWriter) endData() error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+	a.err = a.enc.Encode(archiveRecord{End: true})
+	return a.err
+}
+
+// Close finishes the archive and returns the first error encountered while writing.
+func (a *archiveWriter) Close() error {
+	err := a.zw.Close()
+	if a.err == nil {
+		a.err = err
+	}
+	err = a.f.Close()
+	if a.err == nil {
+		a.err = err
+	}
+	return a.err
+}
+
+// ExportRepo writes a repo to an archive file.  The config can use the same "data",
+// "filter", and "transmit" settings as PushRepo to limit the exported data instances,
+// apply datatype-specific filters, and choose whether all versions, the ancestor path
+// of the given version (branch), or just the flattened given version is exported.
+func ExportRepo(uuid dvid.UUID, filename string, config dvid.Config) error {
+	if manager == nil {
+		return ErrManagerNotInitialized
+	}
+	if filename == "" {
+		return fmt.Errorf("export requires a file name")
+	}
+	timedLog := dvid.NewTimeLog()
+
+	thisRepo, err := manager.repoFromUUID(uuid)
+	if err != nil {
+		return err
+	}
+	filter, _, err := config.GetString("filter")
+	if err != nil {
+		return err
+	}
+	v, err := manager.versionFromUUID(uuid)
+	if err != nil {
+		return err
+	}
+	txRepo, transmit, err := thisRepo.customize(v, config)
+	if err != nil {
+		return err
+	}
+	var versions map[dvid.VersionID]struct{}
+	switch transmit {
+	case rpc.TransmitFlatten:
+		versions = map[dvid.VersionID]struct{}{v: struct{}{}}
+	case rpc.TransmitBranch:
+		// Unlike a push, which leaves branch deltas to the remote, an exported branch
+		// only holds the given version and its ancestors.
+		branchRepo := txRepo
+		branchRepo.RLock()
+		versions, err = branchRepo.dag.ancestorSet(v)
+		if err == nil {
+			txRepo, err = branchRepo.duplicate(versions, nil)
+		}
+		branchRepo.RUnlock()
+		if err != nil {
+			return err
+		}
+	default:
+		versions = txRepo.versionSet()
+	}
+
+	repoSerialization, err := txRepo.GobEncode()
+	if err != nil {
+		return err
+	}
+	a, err := newArchiveWriter(filename)
+	if err != nil {
+		return err
+	}
+	hdr := archiveHeader{
+		Format:   archiveFormat,
+		Version:  archiveVersion,
+		Created:  time.Now(),
+		Transmit: transmit,
+		UUID:     uuid,
+		Repo:     repoSerialization,
+	}
+	if err := a.enc.Encode(hdr); err != nil {
+		a.Close()
+		return err
+	}
+
+	ps := &PushSession{
+		Filter:   storage.FilterSpec(filter),
+		Versions: versions,
+		t:        transmit,
+		archive:  a,
+	}
+	for _, d := range txRepo.data {
+		dvid.Infof("Exporting instance %q data to %s\n", d.DataName(), filename)
+		if err := d.PushData(ps); err != nil {
+			a.Close()
+			return fmt.Errorf("error exporting instance %q: %v", d.DataName(), err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		return fmt.Errorf("error writing archive %s: %v", filename, err)
+	}
+	timedLog.Infof("Exported repo %s with %d data instances and %d versions to %s", uuid, len(txRepo.data), len(versions), filename)
+	return nil
+}
+
+// ImportRepo adds a repo from an archive file written by ExportRepo, remapping the
+// archived instance and version ids to new local ids.  The UUIDs of the archived
+// versions are kept, so the repo must not already be present on this server.  The
+// root UUID of the imported repo is returned.
+func ImportRepo(filename string) (dvid.UUID, error) {
+	if manager == nil {
+		return dvid.NilUUID, ErrManagerNotInitialized
+	}
+	timedLog := dvid.NewTimeLog()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return dvid.NilUUID, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return dvid.NilUUID, fmt.Errorf("%s is not a DVID repo archive: %v", filename, err)
+	}
+	defer zr.Close()
+	dec := gob.NewDecoder(zr)
+
+	var hdr archiveHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return dvid.NilUUID, fmt.Errorf("unable to read archive header from %s: %v", filename, err)
+	}
+	if hdr.Format != archiveFormat {
+		return dvid.NilUUID, fmt.Errorf("%s is not a DVID repo archive", filename)
+	}
+	if hdr.Version > archiveVersion {
+		return dvid.NilUUID, fmt.Errorf("archive %s has version %d, newer than supported version %d", filename, hdr.Version, archiveVersion)
+	}
+
+	// An archived branch holds just the ancestor path, so it's received like a full repo.
+	transmit := hdr.Transmit
+	if transmit == rpc.TransmitBranch {
+		transmit = rpc.TransmitAll
+	}
+
+	// Check for existing versions before any local ids are allocated for the import.
+	archived := new(repoT)
+	if err := archived.GobDecode(hdr.Repo); err != nil {
+		return dvid.NilUUID, fmt.Errorf("unable to read repo from archive %s: %v", filename, err)
+	}
+	for _, node := range archived.dag.nodes {
+		if _, err := manager.versionFromUUID(node.uuid); err == nil {
+			return dvid.NilUUID, fmt.Errorf("version %s in archive %s already exists on this server", node.uuid, filename)
+		}
+	}
+
+	p := &pusher{startTime: time.Now()}
+	if _, err := p.readRepo(&repoTxMsg{Transmit: transmit, UUID: hdr.UUID, Repo: hdr.Repo}); err != nil {
+		return dvid.NilUUID, fmt.Errorf("unable to import repo from %s: %v", filename, err)
+	}
+
+	var numKV uint64
+	inData := false
+	for {
+		var rec archiveRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return dvid.NilUUID, fmt.Errorf("error reading archive %s after %d key-values: %v", filename, numKV, err)
+		}
+		switch {
+		case rec.Start != nil:
+			if err := p.startData(rec.Start); err != nil {
+				return dvid.NilUUID, err
+			}
+			inData = true
+		case rec.End:
+			if err := p.putData(&KVMessage{Terminate: true}); err != nil {
+				return dvid.NilUUID, err
+			}
+			inData = false
+		default:
+			if !inData {
+				return dvid.NilUUID, fmt.Errorf("archive %s has key-values outside a data instance", filename)
+			}
+			for i := range rec.KVs {
+				if err := p.putData(&KVMessage{KV: rec.KVs[i]}); err != nil {
+					return dvid.NilUUID, err
+				}
+				numKV++
+			}
+		}
+	}
+	if inData {
+		return dvid.NilUUID, fmt.Errorf("archive %s is truncated in data %q", filename, p.dname)
+	}
+	if err := p.Close(); err != nil {
+		return dvid.NilUUID, err
+	}
+	timedLog.Infof("Imported repo %s with %d data instances and %d key-values from %s", p.repo.uuid, len(p.repo.data), numKV, filename)
+	return p.repo.uuid, nil
+}
@@ -0,0 +1,93 @@
+// +build !clustered,!gcloud
+
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+func TestExportImport(t *testing.T) {
+	OpenTest()
+	defer CloseTest()
+
+	uuid, _ := NewTestRepo()
+	if err := Commit(uuid, "root version", nil); err != nil {
+		t.Fatal(err)
+	}
+	child, err := NewVersion(uuid, "child version", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sibling, err := NewVersion(uuid, "sibling version", "sibling", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dvid-archive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "repo.dvid")
+
+	if err := ExportRepo(child, filename, dvid.Config{}); err != nil {
+		t.Fatalf("couldn't export repo: %v\n", err)
+	}
+	branchname := filepath.Join(dir, "branch.dvid")
+	config := dvid.NewConfig()
+	config.Set("transmit", "branch")
+	if err := ExportRepo(child, branchname, config); err != nil {
+		t.Fatalf("couldn't export branch: %v\n", err)
+	}
+
+	repoID := manager.repoID
+	if _, err := ImportRepo(filename); err == nil {
+		t.Fatalf("expected error importing repo that already exists\n")
+	}
+	if manager.repoID != repoID {
+		t.Errorf("failed import allocated repo id: %d -> %d\n", repoID, manager.repoID)
+	}
+	if err := DeleteRepo(uuid, "foobar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetRepoRoot(child); err == nil {
+		t.Fatalf("expected deleted repo to be absent\n")
+	}
+
+	root, err := ImportRepo(filename)
+	if err != nil {
+		t.Fatalf("couldn't import repo: %v\n", err)
+	}
+	if root != uuid {
+		t.Errorf("expected imported repo root %s, got %s\n", uuid, root)
+	}
+	if r, err := GetRepoRoot(child); err != nil || r != uuid {
+		t.Errorf("couldn't get imported child version %s: %v\n", child, err)
+	}
+	if r, err := GetRepoRoot(sibling); err != nil || r != uuid {
+		t.Errorf("couldn't get imported sibling version %s: %v\n", sibling, err)
+	}
+
+	// An exported branch only holds the ancestor path of the exported version.
+	if err := DeleteRepo(uuid, "foobar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportRepo(branchname); err != nil {
+		t.Fatalf("couldn't import branch: %v\n", err)
+	}
+	if r, err := GetRepoRoot(child); err != nil || r != uuid {
+		t.Errorf("couldn't get imported branch version %s: %v\n", child, err)
+	}
+	if _, err := GetRepoRoot(sibling); err == nil {
+		t.Errorf("expected sibling version %s to be absent from imported branch\n", sibling)
+	}
+
+	if _, err := ImportRepo(filepath.Join(dir, "missing.dvid")); err == nil {
+		t.Errorf("expected error importing missing archive\n")
+	}
+}
@@ -0,0 +1,347 @@
+// +build !clustered,!gcloud
+
+/*
+	This file supports online hot backups of all stores into a local directory and the
+	matching restore of a backup into empty stores.
+*/
+
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// BackupManifestFilename is the name of the file in a backup directory that describes the
+// backup.  It is only written after all stores have been successfully backed up.
+const BackupManifestFilename = "manifest.json"
+
+// BackupFile describes the backup of a single store.
+type BackupFile struct {
+	Filename string
+	storage.BackupStats
+}
+
+// BackupRepo lists the versions of a repo that are covered by a backup.
+type BackupRepo struct {
+	Root     dvid.UUID
+	Alias    string
+	Versions []dvid.UUID
+}
+
+// BackupManifest describes a backup, including which repo versions it covers.
+type BackupManifest struct {
+	Directory string
+	Started   time.Time // time of the point-in-time snapshot
+	Finished  time.Time
+	Stores    map[storage.Alias]BackupFile
+	Skipped   []storage.Alias // stores that are not key-value stores, e.g., write logs
+	Repos     []BackupRepo
+}
+
+// BackupStatus gives the state of the current or most recent backup.
+type BackupStatus struct {
+	Running   bool
+	Directory string
+	Error     string          `json:",omitempty"`
+	Manifest  *BackupManifest `json:",omitempty"`
+}
+
+var (
+	backupMu     sync.Mutex
+	backupStatus BackupStatus
+)
+
+// GetBackupStatus returns the state of the current or most recent backup.
+func GetBackupStatus() BackupStatus {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	return backupStatus
+}
+
+type repoVersions []BackupRepo
+
+func (r repoVersions) Len() int           { return len(r) }
+func (r repoVersions) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r repoVersions) Less(i, j int) bool { return r[i].Root < r[j].Root }
+
+type uuidSlice []dvid.UUID
+
+func (u uuidSlice) Len() int           { return len(u) }
+func (u uuidSlice) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u uuidSlice) Less(i, j int) bool { return u[i] < u[j] }
+
+// backupRepos returns the repos and versions known to the repo manager, limited to versions
+// with local ids below the given id.
+func backupRepos(maxVersion dvid.VersionID) []BackupRepo {
+	manager.repoMutex.RLock()
+	repos := make(map[*repoT]struct{})
+	for _, r := range manager.repos {
+		repos[r] = struct{}{}
+	}
+	manager.repoMutex.RUnlock()
+
+	out := make(repoVersions, 0, len(repos))
+	for r := range repos {
+		r.RLock()
+		br := BackupRepo{Root: r.uuid, Alias: r.alias}
+		for v, node := range r.dag.nodes {
+			if v < maxVersion {
+				br.Versions = append(br.Versions, node.uuid)
+			}
+		}
+		r.RUnlock()
+		sort.Sort(uuidSlice(br.Versions))
+		out = append(out, br)
+	}
+	sort.Sort(out)
+	return out
+}
+
+// Backup starts an online backup of all stores into the given directory, which must not
+// exist or be empty.  Consistent point-in-time snapshots of all stores are taken before
+// returning, and the snapshots are then streamed to the directory in the background while
+// the server continues to handle reads and writes.  Use GetBackupStatus to monitor progress.
+func Backup(dir string) error {
+	if manager == nil {
+		return ErrManagerNotInitialized
+	}
+	if dir == "" {
+		return fmt.Errorf("backup requires a directory")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	if backupStatus.Running {
+		return fmt.Errorf("backup to %s is already running", backupStatus.Directory)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create backup directory %s: %v", dir, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) != 0 {
+		return fmt.Errorf("backup directory %s is not empty", dir)
+	}
+
+	stores, err := storage.AllStores()
+	if err != nil {
+		return err
+	}
+	for alias, store := range stores {
+		_, isKV := store.(storage.OrderedKeyValueDB)
+		if _, ok := store.(storage.SnapshotDB); isKV && !ok {
+			return fmt.Errorf("store %q (%s) does not support snapshots for online backup", alias, store)
+		}
+	}
+
+	// Hold the version id lock so no versions are created while taking the snapshots.
+	// The manifest then records the versions whose ids were allocated before the snapshots.
+	manifest := &BackupManifest{
+		Directory: dir,
+		Stores:    make(map[storage.Alias]BackupFile, len(stores)),
+	}
+	snapshots := make(map[storage.Alias]storage.Snapshot, len(stores))
+	manager.idMutex.RLock()
+	maxVersion := manager.versionID
+	manifest.Started = time.Now()
+	for alias, store := range stores {
+		sdb, ok := store.(storage.SnapshotDB)
+		if !ok {
+			manifest.Skipped = append(manifest.Skipped, alias)
+			continue
+		}
+		snap, err := sdb.NewSnapshot()
+		if err != nil {
+			manager.idMutex.RUnlock()
+			for _, s := range snapshots {
+				s.Release()
+			}
+			return fmt.Errorf("unable to snapshot store %q: %v", alias, err)
+		}
+		snapshots[alias] = snap
+	}
+	manager.idMutex.RUnlock()
+	manifest.Repos = backupRepos(maxVersion)
+
+	backupStatus = BackupStatus{Running: true, Directory: dir}
+	go func() {
+		err := writeBackup(manifest, snapshots)
+		backupMu.Lock()
+		backupStatus.Running = false
+		if err != nil {
+			dvid.Errorf("Backup to %s failed: %v\n", dir, err)
+			backupStatus.Error = err.Error()
+		} else {
+			dvid.Infof("Backup to %s finished in %s\n", dir, manifest.Finished.Sub(manifest.Started))
+			backupStatus.Manifest = manifest
+		}
+		backupMu.Unlock()
+	}()
+	dvid.Infof("Started backup of %d stores to %s\n", len(snapshots), dir)
+	return nil
+}
+
+// writeBackup streams each snapshot to a file in the backup directory, releasing the
+// snapshots as they are written, and then writes the manifest.
+func writeBackup(manifest *BackupManifest, snapshots map[storage.Alias]storage.Snapshot) error {
+	defer func() {
+		for _, snap := range snapshots {
+			snap.Release()
+		}
+	}()
+	for alias, snap := range snapshots {
+		timedLog := dvid.NewTimeLog()
+		filename := fmt.Sprintf("%s.dvidkv", alias)
+		f, err := os.Create(filepath.Join(manifest.Directory, filename))
+		if err != nil {
+			return err
+		}
+		stats, err := storage.WriteSnapshot(snap, f, nil)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("error writing backup of store %q: %v", alias, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		snap.Release()
+		delete(snapshots, alias)
+		manifest.Stores[alias] = BackupFile{Filename: filename, BackupStats: stats}
+		timedLog.Infof("Backed up store %q: %d key-values, %d bytes", alias, stats.KeyValues, stats.Bytes)
+	}
+	manifest.Finished = time.Now()
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(manifest.Directory, BackupManifestFilename), data, 0644)
+}
+
+// ReadBackupManifest returns the manifest of a completed backup in the given directory.
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, BackupManifestFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no manifest in %s; backup may be incomplete", dir)
+		}
+		return nil, err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("bad backup manifest in %s: %v", dir, err)
+	}
+	return &manifest, nil
+}
+
+// Restore writes a backup into the stores with the same aliases in the current storage
+// configuration.  It must be run after storage is initialized but before the datastore is
+// initialized, e.g., when the server is not running.  Unless overwrite is true, each
+// store must be empty; if overwrite is true, all existing keys are first deleted.
+func Restore(dir string, overwrite bool) (*BackupManifest, error) {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check all stores before writing anything.
+	dbs := make(map[storage.Alias]storage.OrderedKeyValueDB, len(manifest.Stores))
+	for alias := range manifest.Stores {
+		store, err := storage.GetStoreByAlias(alias)
+		if err != nil {
+			return nil, fmt.Errorf("backup store %q not in current configuration: %v", alias, err)
+		}
+		db, ok := store.(storage.OrderedKeyValueDB)
+		if !ok {
+			return nil, fmt.Errorf("store %q (%s) is not an ordered key-value store", alias, store)
+		}
+		if !overwrite {
+			empty, err := storeIsEmpty(db)
+			if err != nil {
+				return nil, err
+			}
+			if !empty {
+				return nil, fmt.Errorf("store %q (%s) is not empty", alias, store)
+			}
+		}
+		dbs[alias] = db
+	}
+
+	for alias, bf := range manifest.Stores {
+		timedLog := dvid.NewTimeLog()
+		db := dbs[alias]
+		if overwrite {
+			if err := deleteAllKeys(db); err != nil {
+				return nil, fmt.Errorf("unable to clear store %q: %v", alias, err)
+			}
+		}
+		f, err := os.Open(filepath.Join(dir, bf.Filename))
+		if err != nil {
+			return nil, err
+		}
+		stats, err := storage.ReadSnapshot(f, func(kv *storage.KeyValue) error {
+			return db.RawPut(kv.K, kv.V)
+		})
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error restoring store %q: %v", alias, err)
+		}
+		if stats != bf.BackupStats {
+			return nil, fmt.Errorf("restore of store %q doesn't match manifest: got %+v, expected %+v", alias, stats, bf.BackupStats)
+		}
+		timedLog.Infof("Restored store %q: %d key-values", alias, stats.KeyValues)
+	}
+	return manifest, nil
+}
+
+func storeIsEmpty(db storage.OrderedKeyValueDB) (bool, error) {
+	ch := make(chan *storage.KeyValue)
+	done := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		kStart, kEnd := storage.AllKeys()
+		errCh <- db.RawRangeQuery(kStart, kEnd, true, ch, done)
+	}()
+	kv := <-ch
+	close(done)
+	if kv != nil {
+		return false, nil
+	}
+	return true, <-errCh
+}
+
+func deleteAllKeys(db storage.OrderedKeyValueDB) error {
+	ch := make(chan *storage.KeyValue, 1000)
+	done := make(chan struct{})
+	defer close(done)
+	errCh := make(chan error, 1)
+	go func() {
+		kStart, kEnd := storage.AllKeys()
+		errCh <- db.RawRangeQuery(kStart, kEnd, true, ch, done)
+	}()
+	for kv := range ch {
+		if kv == nil {
+			break
+		}
+		if err := db.RawDelete(kv.K); err != nil {
+			return err
+		}
+	}
+	return <-errCh
+}
@@ -0,0 +1,106 @@
+// +build !clustered,!gcloud
+
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+func rawGet(db storage.OrderedKeyValueDB, k storage.Key) ([]byte, error) {
+	ch := make(chan *storage.KeyValue, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- db.RawRangeQuery(k, k, false, ch, nil)
+	}()
+	var value []byte
+	for kv := range ch {
+		if kv == nil {
+			break
+		}
+		value = kv.V
+	}
+	return value, <-errCh
+}
+
+func TestBackupRestore(t *testing.T) {
+	OpenTest()
+	defer CloseTest()
+
+	uuid, _ := NewTestRepo()
+	db, err := storage.DefaultOrderedKVDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		k := storage.ConstructBlobKey([]byte(fmt.Sprintf("backup-test-%d", i)))
+		if err := db.RawPut(k, bytes.Repeat([]byte{byte(i)}, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "dvid-backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Backup(dir); err != nil {
+		t.Fatalf("couldn't start backup: %v\n", err)
+	}
+
+	// Writes after the backup starts should not be in the backup.
+	afterKey := storage.ConstructBlobKey([]byte("after-backup"))
+	if err := db.RawPut(afterKey, []byte("some value")); err != nil {
+		t.Fatal(err)
+	}
+
+	var status BackupStatus
+	for i := 0; i < 100; i++ {
+		if status = GetBackupStatus(); !status.Running {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if status.Running || status.Error != "" || status.Manifest == nil {
+		t.Fatalf("backup didn't complete successfully: %+v\n", status)
+	}
+	repos := status.Manifest.Repos
+	if len(repos) != 1 || repos[0].Root != uuid || len(repos[0].Versions) != 1 || repos[0].Versions[0] != uuid {
+		t.Errorf("bad repos in backup manifest: %v\n", repos)
+	}
+	if err := Backup(dir); err == nil {
+		t.Errorf("expected error backing up into non-empty directory\n")
+	}
+
+	if _, err := Restore(dir, false); err == nil {
+		t.Fatalf("expected error restoring into non-empty stores\n")
+	}
+	manifest, err := Restore(dir, true)
+	if err != nil {
+		t.Fatalf("couldn't restore backup: %v\n", err)
+	}
+	if manifest.Started != status.Manifest.Started {
+		t.Errorf("restored manifest doesn't match backup: %v\n", manifest)
+	}
+	value, err := rawGet(db, afterKey)
+	if err != nil || value != nil {
+		t.Errorf("expected key written after backup to be absent after restore, got %v (%v)\n", value, err)
+	}
+	value, err = rawGet(db, storage.ConstructBlobKey([]byte("backup-test-7")))
+	if err != nil || !bytes.Equal(value, bytes.Repeat([]byte{7}, 100)) {
+		t.Errorf("bad restored value: %v (%v)\n", value, err)
+	}
+
+	// Metadata reloaded from the restored stores should have the repo.
+	CloseReopenTest()
+	if root, err := GetRepoRoot(uuid); err != nil || root != uuid {
+		t.Errorf("couldn't get repo %s after restore: %v\n", uuid, err)
+	}
+}
@@ -538,6 +538,17 @@ func (d *Data) NewMutationID() uint64 {
 	return atomic.AddUint64(&(d.mutID), 1)
 }
 
+// SetMinMutationID makes sure new mutation IDs are larger than the given ID.  Data types
+// that persist mutation IDs can use this on startup so IDs are not reused across restarts.
+func (d *Data) SetMinMutationID(mutID uint64) {
+	for {
+		cur := atomic.LoadUint64(&(d.mutID))
+		if cur >= mutID || atomic.CompareAndSwapUint64(&(d.mutID), cur, mutID) {
+			return
+		}
+	}
+}
+
 // ---- dvid.DataSetter implementation ----
 
 func (d *Data) SetInstanceID(id dvid.InstanceID) {
@@ -95,7 +95,7 @@ func PushRepo(uuid dvid.UUID, target string, config dvid.Config) error {
 	dvid.Debugf("Remote sent list of %d versions to send\n", len(versions))
 
 	// For each data instance, send the data with optional datatype-specific filtering.
-	ps := &PushSession{storage.FilterSpec(filter), versions, s, transmit}
+	ps := &PushSession{storage.FilterSpec(filter), versions, s, transmit, nil}
 	for _, d := range txRepo.data {
 		dvid.Infof("Sending instance %q data to %q\n", d.DataName(), target)
 		if err := d.PushData(ps); err != nil {
@@ -121,11 +121,17 @@ type PushSession struct {
 
 	s rpc.Session
 	t rpc.Transmit
+
+	// if non-nil, key-values are written to an archive file instead of a remote DVID.
+	archive *archiveWriter
 }
 
 // StartInstancePush initiates a data instance push.  After some number of Send
 // calls, the EndInstancePush must be called.
 func (p *PushSession) StartInstancePush(d dvid.Data) error {
+	if p.archive != nil {
+		return p.archive.startData(d)
+	}
 	dmsg := DataTxInit{
 		Session:    p.s.ID(),
 		DataName:   d.DataName(),
@@ -141,6 +147,9 @@ func (p *PushSession) StartInstancePush(d dvid.Data) error {
 // SendKV sends a key-value pair.  The key-values may be buffered before sending
 // for efficiency of transmission.
 func (p *PushSession) SendKV(kv *storage.KeyValue) error {
+	if p.archive != nil {
+		return p.archive.putKV(kv)
+	}
 	kvmsg := KVMessage{Session: p.s.ID(), KV: *kv, Terminate: false}
 	if _, err := p.s.Call()(PutKVMsg, kvmsg); err != nil {
 		return fmt.Errorf("error sending key-value to remote: %v", err)
@@ -150,6 +159,9 @@ func (p *PushSession) SendKV(kv *storage.KeyValue) error {
 
 // EndInstancePush terminates a data instance push.
 func (p *PushSession) EndInstancePush() error {
+	if p.archive != nil {
+		return p.archive.endData()
+	}
 	endmsg := KVMessage{Session: p.s.ID(), Terminate: true}
 	if _, err := p.s.Call()(PutKVMsg, endmsg); err != nil {
 		return fmt.Errorf("error sending terminate data to remote: %v", err)
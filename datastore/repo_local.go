@@ -848,6 +848,7 @@ func (m *repoManager) addRepo(r *repoT) error {
 		m.dataByUUID[dataservice.DataUUID()] = dataservice
 	}
 	for v, node := range r.dag.nodes {
+		m.repos[node.uuid] = r
 		m.versionToUUID[v] = node.uuid
 		m.uuidToVersion[node.uuid] = v
 	}
@@ -2525,6 +2526,26 @@ func (dag *dagT) getChildren(v dvid.VersionID) ([]dvid.VersionID, error) {
 	return children, nil
 }
 
+// ancestorSet returns a set of the given version and all its ancestors.
+func (dag *dagT) ancestorSet(v dvid.VersionID) (map[dvid.VersionID]struct{}, error) {
+	vset := make(map[dvid.VersionID]struct{})
+	toVisit := []dvid.VersionID{v}
+	for len(toVisit) != 0 {
+		cur := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if _, found := vset[cur]; found {
+			continue
+		}
+		node, found := dag.nodes[cur]
+		if !found {
+			return nil, fmt.Errorf("could not find version id %d", cur)
+		}
+		vset[cur] = struct{}{}
+		toVisit = append(toVisit, node.parents...)
+	}
+	return vset, nil
+}
+
 func (dag *dagT) getParents(v dvid.VersionID) ([]dvid.VersionID, error) {
 	node, found := dag.nodes[v]
 	if !found {
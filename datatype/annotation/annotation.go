@@ -157,9 +157,101 @@ GET <api URL>/node/<UUID>/<data name>/roi/<ROI specification>
 	a full UUID string, the current UUID of the request will be used.  Currently, this 
 	request will only work for ROIs that have same block size as the annotation data instance.
 
-	The returned point annotations will be an array of elements.
+	The returned point annotations will be an array of elements.  If the query string
+	"format=protobuf" is given or the Accept header is "application/x-protobuf", the
+	elements are streamed in the protobuf format described at the end of this documentation.
+
+POST <api URL>/node/<UUID>/<data name>/roi/<roi name>?<options>
+
+	Creates or replaces the given ROI with the blocks covering the convex region around
+	all point annotations with a given label or tag.  The region is the intersection of
+	the convex hulls of the annotations projected along each axis, so it contains the 3d
+	convex hull of the annotations.  If the ROI data instance doesn't exist, a new one is
+	created with default settings.  Exactly one of the "label" or "tag" options must be
+	given.
+
+	Returns JSON giving the number of ROI spans written:
+
+		{ "spans": <# of spans> }
+
+	POST Query-string Options:
+
+	label       Use annotations within this label of the synced labels.
+	tag         Use annotations with this tag.
+
+	Example:
+
+	POST http://foo.com/api/node/83af/myannotations/roi/alpha-lobe?tag=alpha
+
+GET <api URL>/node/<UUID>/<data name>/within/<radius>/<center>[?<options>]
+
+	Returns all point annotations within the given radius of a center point as an array
+	of elements sorted by increasing distance from the center.  The radius is in voxels
+	and the center should be given as voxel coordinates separated by underscore, e.g.,
+	"400_300_200".
+
+	GET Query-string Options:
+
+	kind        Comma-separated list of element kinds to return, e.g., "PreSyn,PostSyn".
+	tag         Comma-separated list of tags.  Only elements with at least one of the tags
+	              are returned.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/within/50/400_300_200?kind=PreSyn
+
+
+GET <api URL>/node/<UUID>/<data name>/nearest/<k>/<center>[?<options>]
+
+	Returns up to k point annotations nearest the center point as an array of elements
+	sorted by increasing distance from the center.  The center should be given as voxel
+	coordinates separated by underscore, e.g., "400_300_200".
+
+	GET Query-string Options:
+
+	kind        Comma-separated list of element kinds to return, e.g., "PreSyn,PostSyn".
+	tag         Comma-separated list of tags.  Only elements with at least one of the tags
+	              are returned.
+	maxdist     Maximum distance in voxels of returned elements from the center.
+	              Default is 2048 voxels.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/nearest/5/400_300_200?kind=PreSyn&maxdist=500
+
+
+GET  <api URL>/node/<UUID>/<data name>/connectome[?<options>]
+POST <api URL>/node/<UUID>/<data name>/connectome[?<options>]
+
+	Returns weighted body-to-body edges computed from the synaptic elements indexed
+	by label.  Each edge gives a pre-synaptic body, a post-synaptic body, and a weight
+	equal to the number of "PreSynTo" relationships from PreSyn elements in the first
+	body to elements in the second body.  Edges are sorted by decreasing weight.  This
+	endpoint is only available if the annotation data instance is synced with label data.
+
+	A POST expects a JSON array of body labels, e.g., [23, 45, 101], and restricts
+	the returned edges to those where both pre- and post-synaptic bodies are in the list.
+
+	Returned JSON format:
+
+	[{"Pre": 23, "Post": 45, "Weight": 12}, {"Pre": 45, "Post": 101, "Weight": 3}, ...]
+
+	If "format=csv" is specified, a CSV file with the header "pre,post,weight" is returned.
+
+	Query-string Options:
+
+	roi         Only count synapses whose PreSyn element is within the given ROI, specified
+	              as "roiname,uuid".  If just "roiname" is given, the request UUID is used.
+	bodies      Comma-separated list of bodies, e.g., "23,45,101", to use instead of POSTed JSON.
+	minweight   Only return edges with weight greater than or equal to this value.
+	format      Either "json" (default) or "csv".
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/connectome?roi=medulla&minweight=5&format=csv
 
-GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
+
+GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>[?<options>]
 
 	Returns all point annotations within subvolume of given size with upper left corner
 	at given offset.  The size and offset should be voxels separated by underscore, e.g.,
@@ -167,11 +259,21 @@ GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
 
 	The returned point annotations will be an array of elements.
 
+	GET Query-string Options:
+
+	format      Either "json" (default) or "protobuf".  The protobuf format can also be
+	              requested with an "application/x-protobuf" Accept header.
+
 POST <api URL>/node/<UUID>/<data name>/elements[?<options>]
 
 	Adds or modifies point annotations.  The POSTed content is an array of elements.
 	Note that deletes are handled via a separate API (see above).
 
+	If the query string "format=protobuf" is given or the Content-Type header is
+	"application/x-protobuf", the POSTed content is a stream of protobuf elements that
+	is stored in batches of 10,000 elements as it is read.  If an error occurs partway
+	through the stream, previously read batches remain stored.
+
 	Kafka JSON message generated by this request:
 		{ 
 			"Action": "element-post",
@@ -187,6 +289,7 @@ POST <api URL>/node/<UUID>/<data name>/elements[?<options>]
 	POST Query-string Options:
 
 	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
+	format      Either "json" (default) or "protobuf".
 
 
 POST <api URL>/node/<UUID>/<data name>/move/<from_coord>/<to_coord>[?<options>]
@@ -213,6 +316,38 @@ POST <api URL>/node/<UUID>/<data name>/reload
 	used to initialize a newly added sync.  Note that the annotation will be locked until
 	the denormalization is finished with a log message.
 
+GET  <api URL>/node/<UUID>/<data name>/fsck[?<options>]
+POST <api URL>/node/<UUID>/<data name>/fsck[?<options>]
+
+	Checks the elements denormalized by label against the labels of the synced label data
+	at each element's position and returns a JSON report of any discrepancies.  A POST
+	also repairs the label denormalization and notifies synced data like labelsz of the
+	changes.  This endpoint is only available if the annotation data instance is synced
+	with label data.
+
+	Example return:
+
+	{
+		"Labels": "segmentation",
+		"ElementsScanned": 120382,
+		"LabelsChecked": 2213,
+		"Problems": [
+			{ "Label": 23, "Missing": [[33, 30, 31]], "Extra": [[128, 62, 510]] },
+			{ "Label": 187, "Extra": [[15, 27, 35]] }
+		],
+		"Repaired": 0
+	}
+
+	"Missing" elements are at voxels with the label but aren't stored for the label, while
+	"Extra" elements are stored for the label but are not at voxels with the label.
+
+	Query-string Options:
+
+	minlabel    Only check labels equal to or larger than this label.
+	maxlabel    Only check labels equal to or smaller than this label.
+	roi         Only check elements within the given ROI, specified as "roiname,uuid".
+	              If just "roiname" is given, the request UUID is used.
+
 ------
 
 Example JSON Format of point annotation elements with ... marking omitted elements:
@@ -262,6 +397,27 @@ The "Rel" property can be one of "UnknownRelationship", "PostSynTo", "PreSynTo",
 The "Tags" property will be indexed and so can be costly if used for very large numbers of synapse elements.
 
 The "Prop" property is an arbitrary object with string values.  The "Prop" object's key are not indexed.
+
+------
+
+Protobuf Format of point annotation elements:
+
+The protobuf format is a stream of AnnotationElement messages, each preceded by its length
+in bytes encoded as a varint, i.e., the standard "delimited" protobuf stream.  The proto3
+schema, from datatype/common/proto/annotation.proto:
+
+message AnnotationRelationship {
+    uint32 rel = 1;                 // 0 = UnknownRelationship, 1 = PostSynTo, 2 = PreSynTo, 3 = ConvergentTo, 4 = GroupedWith
+    repeated sint32 to = 2;         // x, y, z of related element
+}
+
+message AnnotationElement {
+    repeated sint32 pos = 1;        // x, y, z
+    uint32 kind = 2;                // 0 = Unknown, 1 = PostSyn, 2 = PreSyn, 3 = Gap, 4 = Note
+    repeated AnnotationRelationship rels = 3;
+    repeated string tags = 4;
+    map<string, string> prop = 5;
+}
 `
 
 var (
@@ -1490,10 +1646,25 @@ func (d *Data) GetTagJSON(ctx *datastore.VersionedCtx, tag Tag, addRels bool) (j
 
 // GetRegionSynapses returns synapse elements for a given subvolume of image space.
 func (d *Data) GetRegionSynapses(ctx *datastore.VersionedCtx, ext *dvid.Extents3d) (Elements, error) {
-	store, err := datastore.GetOrderedKeyValueDB(d)
+	var elements Elements
+	err := d.ProcessRegionSynapses(ctx, ext, func(blockElems Elements) error {
+		elements = append(elements, blockElems...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return elements, nil
+}
+
+// ProcessRegionSynapses calls the given function with the synapse elements of each block
+// that lie within a subvolume of image space.  The data's read lock is only held while
+// each block is read, so the function can write the elements to a network connection.
+func (d *Data) ProcessRegionSynapses(ctx *datastore.VersionedCtx, ext *dvid.Extents3d, f func(Elements) error) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
 
 	// Setup block bounds for synapse element query in supplied Z range.
 	blockSize := d.blockSize()
@@ -1503,29 +1674,46 @@ func (d *Data) GetRegionSynapses(ctx *datastore.VersionedCtx, ext *dvid.Extents3
 	endTKey := NewBlockTKey(endBlockCoord)
 
 	d.RLock()
-	defer d.RUnlock()
+	tkeys, err := store.KeysInRange(ctx, begTKey, endTKey)
+	d.RUnlock()
+	if err != nil {
+		return err
+	}
 
-	// Iterate through all synapse elements block k/v, making sure the elements are also within the given subvolume.
-	var elements Elements
-	err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
-		bcoord, err := DecodeBlockTKey(chunk.K)
+	// Iterate through all synapse element blocks, making sure the elements are also within the given subvolume.
+	for _, tk := range tkeys {
+		bcoord, err := DecodeBlockTKey(tk)
 		if err != nil {
 			return err
 		}
 		if !ext.BlockWithin(blockSize, bcoord) {
-			return nil
+			continue
 		}
-		// Deserialize the JSON value into a slice of elements
-		var blockElems Elements
-		if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+		blockElems, err := d.getBlockElements(ctx, tk)
+		if err != nil {
 			return err
 		}
-		// Iterate through elements, screening on extents before adding to region elements.
+		var regionElems Elements
 		for _, elem := range blockElems {
 			if ext.VoxelWithin(elem.Pos) {
-				elements = append(elements, elem)
+				regionElems = append(regionElems, elem)
 			}
 		}
+		if len(regionElems) == 0 {
+			continue
+		}
+		if err := f(regionElems); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetROISynapses returns synapse elements for a given ROI.
+func (d *Data) GetROISynapses(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec) (Elements, error) {
+	var elements Elements
+	err := d.ProcessROISynapses(ctx, roiSpec, func(blockElems Elements) error {
+		elements = append(elements, blockElems...)
 		return nil
 	})
 	if err != nil {
@@ -1534,50 +1722,62 @@ func (d *Data) GetRegionSynapses(ctx *datastore.VersionedCtx, ext *dvid.Extents3
 	return elements, nil
 }
 
-// GetROISynapses returns synapse elements for a given ROI.
-func (d *Data) GetROISynapses(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec) (Elements, error) {
+// ProcessROISynapses calls the given function with the synapse elements of each block
+// within an ROI.  The data's read lock is only held while each block is read, so the
+// function can write the elements to a network connection.
+func (d *Data) ProcessROISynapses(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec, f func(Elements) error) error {
 	roidata, roiV, roiFound, err := roi.DataByFilter(roiSpec)
 	if err != nil {
-		return nil, fmt.Errorf("ROI specification was not parsable (%s): %v\n", roiSpec, err)
+		return fmt.Errorf("ROI specification was not parsable (%s): %v\n", roiSpec, err)
 	}
 	if !roiFound {
-		return nil, fmt.Errorf("No ROI found that matches specification %q", roiSpec)
+		return fmt.Errorf("No ROI found that matches specification %q", roiSpec)
 	}
 	roiSpans, err := roidata.GetSpans(roiV)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to get ROI spans for %q: %v\n", roiSpec, err)
+		return fmt.Errorf("Unable to get ROI spans for %q: %v\n", roiSpec, err)
 	}
 	if !d.blockSize().Equals(roidata.BlockSize) {
-		return nil, fmt.Errorf("/roi endpoint currently requires ROI %q to have same block size as annotation %q", roidata.DataName(), d.DataName())
+		return fmt.Errorf("/roi endpoint currently requires ROI %q to have same block size as annotation %q", roidata.DataName(), d.DataName())
 	}
 
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	d.RLock()
-	defer d.RUnlock()
-
-	var elements Elements
 	for _, span := range roiSpans {
 		begBlockCoord := dvid.ChunkPoint3d{span[2], span[1], span[0]}
 		endBlockCoord := dvid.ChunkPoint3d{span[3], span[1], span[0]}
 		begTKey := NewBlockTKey(begBlockCoord)
 		endTKey := NewBlockTKey(endBlockCoord)
-		err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
-			var blockElems Elements
-			if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+		d.RLock()
+		tkeys, err := store.KeysInRange(ctx, begTKey, endTKey)
+		d.RUnlock()
+		if err != nil {
+			return fmt.Errorf("error retrieving annotations from %s -> %s: %v\n", begBlockCoord, endBlockCoord, err)
+		}
+		for _, tk := range tkeys {
+			blockElems, err := d.getBlockElements(ctx, tk)
+			if err != nil {
+				return fmt.Errorf("error retrieving annotations from %s -> %s: %v\n", begBlockCoord, endBlockCoord, err)
+			}
+			if len(blockElems) == 0 {
+				continue
+			}
+			if err := f(blockElems); err != nil {
 				return err
 			}
-			elements = append(elements, blockElems...)
-			return nil
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error retrieving annotations from %s -> %s: %v\n", begBlockCoord, endBlockCoord, err)
 		}
 	}
-	return elements, nil
+	return nil
+}
+
+// getBlockElements returns the elements of a block while holding the data's read lock.
+func (d *Data) getBlockElements(ctx *datastore.VersionedCtx, tk storage.TKey) (Elements, error) {
+	d.RLock()
+	defer d.RUnlock()
+	return getElements(ctx, tk)
 }
 
 // StoreSynapses performs a synchronous store of synapses in JSON format, not
@@ -1591,12 +1791,50 @@ func (d *Data) StoreSynapses(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	if err := json.Unmarshal(jsonBytes, &elems); err != nil {
 		return err
 	}
+	dvid.Infof("%d synaptic elements received via POST", len(elems))
+	return d.storeElements(ctx, elems, jsonBytes, kafkaOff)
+}
+
+// StoreSynapsesProtobuf performs a synchronous store of synapses sent as a stream of
+// length-delimited protobuf elements.  Elements are stored in batches of StreamBatchSize
+// as they are read, so an error partway through the stream leaves earlier batches stored.
+func (d *Data) StoreSynapsesProtobuf(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff bool) error {
+	er := NewElementReader(r)
+	var numElems int
+	elems := make(Elements, 0, StreamBatchSize)
+	for {
+		elem, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		elems = append(elems, *elem)
+		if len(elems) == StreamBatchSize {
+			if err := d.storeElements(ctx, elems, nil, kafkaOff); err != nil {
+				return err
+			}
+			numElems += len(elems)
+			elems = make(Elements, 0, StreamBatchSize)
+		}
+	}
+	if len(elems) != 0 {
+		if err := d.storeElements(ctx, elems, nil, kafkaOff); err != nil {
+			return err
+		}
+		numElems += len(elems)
+	}
+	dvid.Infof("%d synaptic elements received via protobuf stream", numElems)
+	return nil
+}
 
+// stores elements and their denormalizations in a single batch.  The JSON representation
+// of the elements is used for the kafka message and is computed if not supplied.
+func (d *Data) storeElements(ctx *datastore.VersionedCtx, elems Elements, jsonBytes []byte, kafkaOff bool) error {
 	d.Lock()
 	defer d.Unlock()
 
-	dvid.Infof("%d synaptic elements received via POST", len(elems))
-
 	blockSize := d.blockSize()
 	blockE := make(blockElements)
 	tagE := make(tagElements)
@@ -1649,6 +1887,12 @@ func (d *Data) StoreSynapses(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	}
 
 	if !kafkaOff {
+		if jsonBytes == nil {
+			if jsonBytes, err = json.Marshal(elems); err != nil {
+				return err
+			}
+		}
+
 		// store synapse info into blob store for kakfa reference
 		var postRef string
 		if postRef, err = d.PutBlob(jsonBytes); err != nil {
@@ -1863,15 +2107,16 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		dvid.Errorf("Annotation %q had error initializing store: %v\n", d.DataName(), err)
+		d.StopUpdate()
 		return
 	}
 	batcher, ok := store.(storage.KeyValueBatcher)
 	if !ok {
 		dvid.Errorf("Data type annotation requires batch-enabled store, which %q is not\n", store)
+		d.StopUpdate()
 		return
 	}
 
-	d.StartUpdate()
 	d.Lock()
 
 	minLabelTKey := storage.MinTKey(keyLabel)
@@ -1978,8 +2223,12 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 	timedLog.Infof("Completed asynchronous annotation %q reload of %d block and %d tag elements.", d.DataName(), totBlockE, totTagE)
 }
 
+// ReloadData asynchronously rebuilds the label and tag indices.  The reload uses its own
+// context since any request context is cancelled when the handler returns.  The data is
+// marked as updating before returning so callers can wait on its completion.
 func (d *Data) ReloadData(ctx *datastore.VersionedCtx) {
-	go d.resync(ctx)
+	d.StartUpdate()
+	go d.resync(datastore.NewVersionedCtx(d, ctx.VersionID()))
 	dvid.Infof("Started reload of annotations %q...\n", d.DataName())
 }
 
@@ -2198,6 +2447,33 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, "Bad ROI specification: %q", parts[4])
 				return
 			}
+			format, err := formatFromRequest(r)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if format == FormatProtobuf3 {
+				w.Header().Set("Content-type", ProtobufContentType)
+				ew := NewElementWriter(w)
+				flusher, _ := w.(http.Flusher)
+				err := d.ProcessROISynapses(ctx, storage.FilterSpec(roiSpec), func(blockElems Elements) error {
+					for _, elem := range blockElems {
+						if err := ew.Write(elem); err != nil {
+							return err
+						}
+					}
+					if flusher != nil {
+						flusher.Flush()
+					}
+					return nil
+				})
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				timedLog.Infof("HTTP %s: streamed synapse elements in ROI (%s) (%s)", r.Method, parts[4], r.URL)
+				return
+			}
 			elements, err := d.GetROISynapses(ctx, storage.FilterSpec(roiSpec))
 			if err != nil {
 				server.BadRequest(w, r, err)
@@ -2215,10 +2491,214 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 			timedLog.Infof("HTTP %s: synapse elements in ROI (%s) (%s)", r.Method, parts[4], r.URL)
 
+		case "post":
+			// POST <api URL>/node/<UUID>/<data name>/roi/<roi name>?label=<label>|tag=<tag>
+			if len(parts) < 5 {
+				server.BadRequest(w, r, "Expect ROI name to follow 'roi' in POST request")
+				return
+			}
+			queryStrings := r.URL.Query()
+			labelStr := queryStrings.Get("label")
+			tag := Tag(queryStrings.Get("tag"))
+			if (labelStr == "") == (tag == "") {
+				server.BadRequest(w, r, "POST on 'roi' endpoint requires either 'label' or 'tag' query string")
+				return
+			}
+			var label uint64
+			if labelStr != "" {
+				var err error
+				if label, err = strconv.ParseUint(labelStr, 10, 64); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if label == 0 {
+					server.BadRequest(w, r, "Label 0 is protected background value and cannot be used for ROI.")
+					return
+				}
+			}
+			dest, err := roi.GetOrCreateByUUIDName(uuid, dvid.InstanceName(parts[4]))
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			numSpans, err := d.PutConvexROI(ctx, label, tag, dest)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			fmt.Fprintf(w, `{"spans": %d}`, numSpans)
+			timedLog.Infof("HTTP %s: convex ROI %q from annotations (%s)", r.Method, parts[4], r.URL)
+
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'roi' endpoint.")
+			return
+		}
+
+	case "within":
+		// GET <api URL>/node/<UUID>/<data name>/within/<radius>/<center>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'within' endpoint.")
+			return
+		}
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "Must include radius and center point after 'within' endpoint.")
+			return
+		}
+		radius, err := strconv.ParseInt(parts[4], 10, 32)
+		if err != nil {
+			server.BadRequest(w, r, fmt.Errorf("bad radius %q: %v", parts[4], err))
+			return
+		}
+		center, err := dvid.StringToPoint3d(parts[5], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		queryStrings := r.URL.Query()
+		filter, err := NewElementFilter(queryStrings.Get("kind"), queryStrings.Get("tag"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		elements, err := d.GetElementsWithin(ctx, center, int32(radius), filter)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(elements)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d synapse elements within %d of %s (%s)", r.Method, len(elements), radius, center, r.URL)
+
+	case "nearest":
+		// GET <api URL>/node/<UUID>/<data name>/nearest/<k>/<center>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'nearest' endpoint.")
+			return
+		}
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "Must include number of elements and center point after 'nearest' endpoint.")
+			return
+		}
+		k, err := strconv.Atoi(parts[4])
+		if err != nil {
+			server.BadRequest(w, r, fmt.Errorf("bad number of nearest elements %q: %v", parts[4], err))
+			return
+		}
+		center, err := dvid.StringToPoint3d(parts[5], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		queryStrings := r.URL.Query()
+		filter, err := NewElementFilter(queryStrings.Get("kind"), queryStrings.Get("tag"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		maxDist := int64(DefaultNearestMaxDist)
+		if maxDistStr := queryStrings.Get("maxdist"); maxDistStr != "" {
+			if maxDist, err = strconv.ParseInt(maxDistStr, 10, 32); err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad maxdist specified in query string (%q)", maxDistStr))
+				return
+			}
+		}
+		elements, err := d.GetNearestElements(ctx, center, k, int32(maxDist), filter)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(elements)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d synapse elements nearest %s (%s)", r.Method, len(elements), center, r.URL)
+
+	case "connectome":
+		// GET  <api URL>/node/<UUID>/<data name>/connectome
+		// POST <api URL>/node/<UUID>/<data name>/connectome
+		if action != "get" && action != "post" {
+			server.BadRequest(w, r, "Only GET or POST action is available on 'connectome' endpoint.")
+			return
+		}
+		queryStrings := r.URL.Query()
+		var filter ConnectomeFilter
+		if roiStr := queryStrings.Get("roi"); roiStr != "" {
+			switch len(strings.Split(roiStr, ",")) {
+			case 1:
+				filter.ROI = roiStr + "," + string(uuid)
+			case 2:
+				filter.ROI = roiStr
+			default:
+				server.BadRequest(w, r, "Bad ROI specification: %q", roiStr)
+				return
+			}
+		}
+		if minStr := queryStrings.Get("minweight"); minStr != "" {
+			minWeight, err := strconv.ParseUint(minStr, 10, 32)
+			if err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad minweight specified in query string (%q)", minStr))
+				return
+			}
+			filter.MinWeight = uint32(minWeight)
+		}
+		if bodiesStr := queryStrings.Get("bodies"); bodiesStr != "" {
+			for _, bodyStr := range strings.Split(bodiesStr, ",") {
+				body, err := strconv.ParseUint(strings.TrimSpace(bodyStr), 10, 64)
+				if err != nil {
+					server.BadRequest(w, r, fmt.Errorf("bad body in 'bodies' query string (%q)", bodyStr))
+					return
+				}
+				filter.Bodies = append(filter.Bodies, body)
+			}
+		}
+		if action == "post" {
+			var bodies []uint64
+			if err := json.NewDecoder(r.Body).Decode(&bodies); err != nil {
+				server.BadRequest(w, r, "expected JSON array of bodies in POST: %v", err)
+				return
+			}
+			filter.Bodies = append(filter.Bodies, bodies...)
+		}
+		edges, err := d.GetConnectome(ctx, filter)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		var outBytes []byte
+		switch queryStrings.Get("format") {
+		case "csv":
+			w.Header().Set("Content-type", "text/csv")
+			outBytes = edges.CSV()
+		case "", "json":
+			w.Header().Set("Content-type", "application/json")
+			if outBytes, err = json.Marshal(edges); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
 		default:
-			server.BadRequest(w, r, "Only GET action is available on 'roi' endpoint.")
+			server.BadRequest(w, r, "unknown format %q requested for connectome", queryStrings.Get("format"))
+			return
+		}
+		if _, err := w.Write(outBytes); err != nil {
+			server.BadRequest(w, r, err)
 			return
 		}
+		timedLog.Infof("HTTP %s: connectome with %d edges (%s)", r.Method, len(edges), r.URL)
 
 	case "elements":
 		switch action {
@@ -2234,6 +2714,33 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
+			format, err := formatFromRequest(r)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if format == FormatProtobuf3 {
+				w.Header().Set("Content-type", ProtobufContentType)
+				ew := NewElementWriter(w)
+				flusher, _ := w.(http.Flusher)
+				err := d.ProcessRegionSynapses(ctx, ext3d, func(blockElems Elements) error {
+					for _, elem := range blockElems {
+						if err := ew.Write(elem); err != nil {
+							return err
+						}
+					}
+					if flusher != nil {
+						flusher.Flush()
+					}
+					return nil
+				})
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				timedLog.Infof("HTTP %s: streamed synapse elements in subvolume (size %s, offset %s) (%s)", r.Method, sizeStr, offsetStr, r.URL)
+				return
+			}
 			elements, err := d.GetRegionSynapses(ctx, ext3d)
 			if err != nil {
 				server.BadRequest(w, r, err)
@@ -2253,7 +2760,17 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 
 		case "post":
 			kafkaOff := r.URL.Query().Get("kafkalog") == "off"
-			if err := d.StoreSynapses(ctx, r.Body, kafkaOff); err != nil {
+			format, err := formatFromRequest(r)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if format == FormatProtobuf3 {
+				err = d.StoreSynapsesProtobuf(ctx, r.Body, kafkaOff)
+			} else {
+				err = d.StoreSynapses(ctx, r.Body, kafkaOff)
+			}
+			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -2319,6 +2836,54 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		d.ReloadData(ctx)
 
+	case "fsck":
+		// GET  <api URL>/node/<UUID>/<data name>/fsck
+		// POST <api URL>/node/<UUID>/<data name>/fsck
+		if action != "get" && action != "post" {
+			server.BadRequest(w, r, "Only GET or POST action is available on 'fsck' endpoint.")
+			return
+		}
+		opts := FsckOptions{Repair: action == "post"}
+		queryStrings := r.URL.Query()
+		var err error
+		if s := queryStrings.Get("minlabel"); s != "" {
+			if opts.MinLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad minlabel specified in query string (%q)", s))
+				return
+			}
+		}
+		if s := queryStrings.Get("maxlabel"); s != "" {
+			if opts.MaxLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad maxlabel specified in query string (%q)", s))
+				return
+			}
+		}
+		if roiStr := queryStrings.Get("roi"); roiStr != "" {
+			if len(strings.Split(roiStr, ",")) == 1 {
+				roiStr += "," + string(uuid)
+			}
+			if opts.ROI, err = roi.ImmutableBySpec(roiStr); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		}
+		report, err := d.Fsck(ctx.VersionID(), opts)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(report)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: fsck found %d problems in %d labels (%s)", r.Method, len(report.Problems), report.LabelsChecked, r.URL)
+
 	default:
 		server.BadAPIRequest(w, r, d)
 	}
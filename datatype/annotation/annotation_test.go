@@ -2,9 +2,11 @@ package annotation
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"reflect"
 	"runtime"
@@ -877,6 +879,55 @@ func TestTagRequests(t *testing.T) {
 	testResponse(t, expected, "%snode/%s/%s/tag/Synapse1?relationships=true", server.WebAPIPath, uuid, data.DataName())
 }
 
+func TestConvexROI(t *testing.T) {
+	spans, err := ConvexSpans([]dvid.Point3d{{0, 0, 0}, {100, 0, 0}, {50, 0, 0}}, dvid.Point3d{32, 32, 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (dvid.Spans{{0, 0, 0, 3}}); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected convex spans %v for line of points, got %v\n", expected, spans)
+	}
+
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+
+	config := dvid.NewConfig()
+	dataservice, err := datastore.NewData(uuid, syntype, "mysynapses", config)
+	if err != nil {
+		t.Fatalf("Error creating new data instance: %v\n", err)
+	}
+	data, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not synapse.Data\n")
+	}
+	testJSON, err := json.Marshal(testTagData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/%s/elements", server.WebAPIPath, uuid, data.DataName())
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+
+	apiStr := fmt.Sprintf("%snode/%s/%s/roi/zroi?tag=Zlt90", server.WebAPIPath, uuid, data.DataName())
+	server.TestHTTP(t, "POST", apiStr, nil)
+
+	apiStr = fmt.Sprintf("%snode/%s/zroi/roi", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &spans); err != nil {
+		t.Fatalf("couldn't decode ROI spans: %v\n", err)
+	}
+	if expected := (dvid.Spans{{0, 0, 1, 1}, {1, 0, 0, 0}}); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected convex ROI spans %v, got %v\n", expected, spans)
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/%s/roi/zroi?tag=NoSuchTag", server.WebAPIPath, uuid, data.DataName())
+	server.TestBadHTTP(t, "POST", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/%s/roi/zroi", server.WebAPIPath, uuid, data.DataName())
+	server.TestBadHTTP(t, "POST", apiStr, nil)
+}
+
 func getBytesRLE(t *testing.T, rles dvid.RLEs) *bytes.Buffer {
 	n := len(rles)
 	buf := new(bytes.Buffer)
@@ -1228,6 +1279,301 @@ func TestLabelsReload(t *testing.T) {
 	testLabelsReload(t, uuid, "labels", "labels")
 }
 
+// Reloads started by a request must finish even though the request's context is cancelled
+// once the handler returns.
+func TestReloadCancelledRequest(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	_ = createLabelTestVolume(t, uuid, "labels")
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+	server.CreateTestSync(t, uuid, "mysynapses", "labels")
+
+	d, err := GetByUUIDName(uuid, "mysynapses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqCtx, cancel := context.WithCancel(context.Background())
+	ctx := datastore.NewVersionedCtx(d, v)
+	ctx.SetRequestContext(reqCtx)
+	d.ReloadData(ctx)
+	cancel()
+
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of annotations: %v\n", err)
+	}
+	testLabelsReload(t, uuid, "labels", "labels")
+}
+
+func getFsckReport(t *testing.T, method string, uuid dvid.UUID) FsckReport {
+	url := fmt.Sprintf("%snode/%s/mysynapses/fsck", server.WebAPIPath, uuid)
+	var report FsckReport
+	if err := json.Unmarshal(server.TestHTTP(t, method, url, nil), &report); err != nil {
+		t.Fatalf("couldn't decode fsck report: %v\n", err)
+	}
+	return report
+}
+
+func TestFsck(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	_ = createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "labels")
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+
+	report := getFsckReport(t, "GET", uuid)
+	if len(report.Problems) != 0 || report.LabelsChecked == 0 || report.ElementsScanned != uint64(len(testData)) {
+		t.Fatalf("expected consistent annotations, got fsck report %v\n", report)
+	}
+
+	// Corrupt label 3's elements by dropping one and adding one that isn't in the label.
+	d, err := GetByUUIDName(uuid, "mysynapses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append(ElementsNR{{Pos: dvid.Point3d{1, 1, 1}, Kind: PostSyn}}, expectedLabel3NoRel[1:]...)
+	ctx := datastore.NewVersionedCtx(d, v)
+	if err := putElements(ctx, NewLabelTKey(3), corrupted); err != nil {
+		t.Fatal(err)
+	}
+	report = getFsckReport(t, "GET", uuid)
+	if len(report.Problems) != 1 || report.Repaired != 0 {
+		t.Fatalf("expected one problem and no repair, got fsck report %v\n", report)
+	}
+	problem := report.Problems[0]
+	if problem.Label != 3 || len(problem.Missing) != 1 || !problem.Missing[0].Equals(expectedLabel3NoRel[0].Pos) ||
+		len(problem.Extra) != 1 || !problem.Extra[0].Equals(dvid.Point3d{1, 1, 1}) {
+		t.Fatalf("bad fsck problem for corrupted label 3: %v\n", problem)
+	}
+	testResponseLabel(t, corrupted, "%snode/%s/mysynapses/label/3", server.WebAPIPath, uuid)
+
+	// Repair and make sure label 3 is restored.
+	report = getFsckReport(t, "POST", uuid)
+	if len(report.Problems) != 1 || report.Repaired != 1 {
+		t.Fatalf("expected one repaired problem, got fsck report %v\n", report)
+	}
+	testResponseLabel(t, expectedLabel3NoRel, "%snode/%s/mysynapses/label/3", server.WebAPIPath, uuid)
+	report = getFsckReport(t, "GET", uuid)
+	if len(report.Problems) != 0 {
+		t.Fatalf("expected no problems after repair, got fsck report %v\n", report)
+	}
+}
+
+func TestProtobufElements(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", dvid.Config{})
+
+	var buf bytes.Buffer
+	ew := NewElementWriter(&buf)
+	for _, elem := range testData {
+		if err := ew.Write(elem); err != nil {
+			t.Fatalf("couldn't write protobuf element: %v\n", err)
+		}
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements?format=protobuf", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, &buf)
+
+	// Check the protobuf-stored elements are returned by the JSON API.
+	testResponse(t, testData, "%snode/%s/mysynapses/elements/1000_1000_1000/0_0_0", server.WebAPIPath, uuid)
+
+	// Check the streamed protobuf GET.
+	url = fmt.Sprintf("%snode/%s/mysynapses/elements/1000_1000_1000/0_0_0?format=protobuf", server.WebAPIPath, uuid)
+	er := NewElementReader(bytes.NewBuffer(server.TestHTTP(t, "GET", url, nil)))
+	var got Elements
+	for {
+		elem, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading protobuf stream: %v\n", err)
+		}
+		got = append(got, *elem)
+	}
+	if !reflect.DeepEqual(testData.Normalize(), got.Normalize()) {
+		t.Fatalf("Expected protobuf elements:\n%v\nGot:\n%v\n", testData.Normalize(), got.Normalize())
+	}
+
+	// Check a truncated stream is rejected.
+	var badbuf bytes.Buffer
+	ew = NewElementWriter(&badbuf)
+	if err := ew.Write(testData[0]); err != nil {
+		t.Fatal(err)
+	}
+	url = fmt.Sprintf("%snode/%s/mysynapses/elements?format=protobuf", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", url, bytes.NewBuffer(badbuf.Bytes()[:badbuf.Len()-3]))
+}
+
+func testPositions(t *testing.T, expected []dvid.Point3d, template string, args ...interface{}) {
+	url := fmt.Sprintf(template, args...)
+	var got Elements
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d elements for %s, got %d: %v\n", len(expected), url, len(got), got)
+	}
+	for i, elem := range got {
+		if !elem.Pos.Equals(expected[i]) {
+			t.Fatalf("Expected element %d for %s to be at %s, got %s\n", i, url, expected[i], elem.Pos)
+		}
+	}
+}
+
+func TestSpatialQueries(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+
+	config := dvid.NewConfig()
+	dataservice, err := datastore.NewData(uuid, syntype, "mysynapses", config)
+	if err != nil {
+		t.Fatalf("Error creating new data instance: %v\n", err)
+	}
+	data, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not synapse.Data\n")
+	}
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/%s/elements", server.WebAPIPath, uuid, data.DataName())
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+
+	expected := []dvid.Point3d{{20, 30, 40}, {15, 27, 35}, {14, 25, 37}}
+	testPositions(t, expected, "%snode/%s/%s/within/10/20_30_40", server.WebAPIPath, uuid, data.DataName())
+
+	expected = []dvid.Point3d{{20, 30, 40}, {14, 25, 37}}
+	testPositions(t, expected, "%snode/%s/%s/within/10/20_30_40?kind=PostSyn", server.WebAPIPath, uuid, data.DataName())
+
+	expected = []dvid.Point3d{{15, 27, 35}, {14, 25, 37}}
+	testPositions(t, expected, "%snode/%s/%s/within/10/20_30_40?tag=Zlt90", server.WebAPIPath, uuid, data.DataName())
+
+	expected = []dvid.Point3d{{127, 63, 99}}
+	testPositions(t, expected, "%snode/%s/%s/nearest/1/125_65_99?kind=PreSyn", server.WebAPIPath, uuid, data.DataName())
+
+	expected = []dvid.Point3d{{15, 27, 35}, {127, 63, 99}}
+	testPositions(t, expected, "%snode/%s/%s/nearest/2/0_0_0?kind=PreSyn", server.WebAPIPath, uuid, data.DataName())
+
+	expected = []dvid.Point3d{{15, 27, 35}}
+	testPositions(t, expected, "%snode/%s/%s/nearest/2/0_0_0?kind=PreSyn&maxdist=50", server.WebAPIPath, uuid, data.DataName())
+
+	badurl := fmt.Sprintf("%snode/%s/%s/nearest/2/0_0_0?kind=Foo", server.WebAPIPath, uuid, data.DataName())
+	server.TestBadHTTP(t, "GET", badurl, nil)
+}
+
+func TestConnectome(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	_ = createLabelTestVolume(t, uuid, "labels")
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "labels")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectome", server.WebAPIPath, uuid)
+	var edges ConnectionEdges
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &edges); err != nil {
+		t.Fatalf("couldn't unmarshal connectome: %v\n", err)
+	}
+	expected := ConnectionEdges{{Pre: 1, Post: 2, Weight: 1}, {Pre: 1, Post: 3, Weight: 1}, {Pre: 3, Post: 4, Weight: 1}}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Fatalf("expected connectome %v, got %v\n", expected, edges)
+	}
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectome?bodies=1,3", server.WebAPIPath, uuid)
+	edges = nil
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &edges); err != nil {
+		t.Fatalf("couldn't unmarshal connectome: %v\n", err)
+	}
+	expected = ConnectionEdges{{Pre: 1, Post: 3, Weight: 1}}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Fatalf("expected connectome %v, got %v\n", expected, edges)
+	}
+
+	// Duplicate bodies in query string or POSTed list should not inflate weights.
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectome?bodies=1,3,1", server.WebAPIPath, uuid)
+	edges = nil
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", url, strings.NewReader("[3,1]")), &edges); err != nil {
+		t.Fatalf("couldn't unmarshal connectome: %v\n", err)
+	}
+	if !reflect.DeepEqual(edges, expected) {
+		t.Fatalf("expected connectome %v with duplicate bodies, got %v\n", expected, edges)
+	}
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectome?minweight=2", server.WebAPIPath, uuid)
+	edges = nil
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &edges); err != nil {
+		t.Fatalf("couldn't unmarshal connectome: %v\n", err)
+	}
+	if len(edges) != 0 {
+		t.Fatalf("expected no edges with minweight=2, got %v\n", edges)
+	}
+
+	url = fmt.Sprintf("%snode/%s/mysynapses/connectome?format=csv", server.WebAPIPath, uuid)
+	csv := string(server.TestHTTP(t, "GET", url, nil))
+	if csv != "pre,post,weight\n1,2,1\n1,3,1\n3,4,1\n" {
+		t.Fatalf("unexpected connectome CSV:\n%s\n", csv)
+	}
+}
+
 // A single label block within the volume
 type testBody struct {
 	label        uint64
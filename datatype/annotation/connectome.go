@@ -0,0 +1,199 @@
+/*
+	This file supports computation of body-to-body synaptic connectivity from
+	label-indexed annotation elements.
+*/
+
+package annotation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ConnectionEdge is a directed, weighted edge from a pre-synaptic body to a
+// post-synaptic body.  The weight is the number of PreSynTo relationships
+// between elements of the two bodies.
+type ConnectionEdge struct {
+	Pre    uint64
+	Post   uint64
+	Weight uint32
+}
+
+// ConnectionEdges is a slice of edges sorted by decreasing weight, then by
+// increasing pre and post body.
+type ConnectionEdges []ConnectionEdge
+
+func (e ConnectionEdges) Len() int {
+	return len(e)
+}
+
+func (e ConnectionEdges) Less(i, j int) bool {
+	if e[i].Weight != e[j].Weight {
+		return e[i].Weight > e[j].Weight
+	}
+	if e[i].Pre != e[j].Pre {
+		return e[i].Pre < e[j].Pre
+	}
+	return e[i].Post < e[j].Post
+}
+
+func (e ConnectionEdges) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+// CSV returns a comma-separated representation of the edges with a header line.
+func (e ConnectionEdges) CSV() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("pre,post,weight\n")
+	for _, edge := range e {
+		fmt.Fprintf(&buf, "%d,%d,%d\n", edge.Pre, edge.Post, edge.Weight)
+	}
+	return buf.Bytes()
+}
+
+// ConnectomeFilter restricts the edges returned by GetConnectome.
+type ConnectomeFilter struct {
+	// ROI is an optional ROI specification of the form "<roiname>,<uuid>".  If supplied,
+	// only synapses whose pre-synaptic element lies within the ROI are counted.
+	ROI string
+
+	// Bodies optionally restricts edges to those whose pre- and post-synaptic
+	// bodies are both in this set.
+	Bodies []uint64
+
+	// MinWeight is the minimum weight of a returned edge.
+	MinWeight uint32
+}
+
+// GetConnectome returns the weighted body-to-body edges computed from the label-indexed
+// synaptic elements.  It requires a sync with label data so element labels are known.
+func (d *Data) GetConnectome(ctx *datastore.VersionedCtx, filter ConnectomeFilter) (ConnectionEdges, error) {
+	if d.GetSyncedLabels() == nil && d.GetSyncedLabelvol() == nil {
+		return nil, fmt.Errorf("annotation %q must be synced with label data to compute connectivity", d.DataName())
+	}
+
+	var roiMask *roi.Immutable
+	if filter.ROI != "" {
+		var err error
+		if roiMask, err = roi.ImmutableBySpec(filter.ROI); err != nil {
+			return nil, fmt.Errorf("ROI specification was not parsable (%s): %v", filter.ROI, err)
+		}
+		if roiMask == nil {
+			return nil, fmt.Errorf("no ROI found that matches specification %q", filter.ROI)
+		}
+	}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove duplicate bodies so their edges aren't counted more than once.
+	if len(filter.Bodies) != 0 {
+		bodySet := make(map[uint64]struct{}, len(filter.Bodies))
+		bodies := make([]uint64, 0, len(filter.Bodies))
+		for _, label := range filter.Bodies {
+			if _, found := bodySet[label]; !found {
+				bodySet[label] = struct{}{}
+				bodies = append(bodies, label)
+			}
+		}
+		filter.Bodies = bodies
+	}
+
+	d.RLock()
+	defer d.RUnlock()
+
+	// Map each labeled element position to its label.
+	posLabel := make(map[string]uint64)
+	if len(filter.Bodies) != 0 {
+		for _, label := range filter.Bodies {
+			elems, err := getElementsNR(ctx, NewLabelTKey(label))
+			if err != nil {
+				return nil, fmt.Errorf("err getting elements for label %d: %v", label, err)
+			}
+			for _, elem := range elems {
+				posLabel[elem.Pos.MapKey()] = label
+			}
+		}
+	} else {
+		err = d.ProcessLabelAnnotations(ctx.VersionID(), func(label uint64, elems ElementsNR) {
+			for _, elem := range elems {
+				posLabel[elem.Pos.MapKey()] = label
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Accumulate weights using the relationships of pre-synaptic elements.
+	weights := make(map[[2]uint64]uint32)
+	addConnections := func(elems Elements) {
+		for _, elem := range elems {
+			if elem.Kind != PreSyn {
+				continue
+			}
+			if roiMask != nil && !roiMask.VoxelWithin(elem.Pos) {
+				continue
+			}
+			pre, found := posLabel[elem.Pos.MapKey()]
+			if !found {
+				continue
+			}
+			for _, rel := range elem.Rels {
+				if rel.Rel != PreSynTo {
+					continue
+				}
+				post, found := posLabel[rel.To.MapKey()]
+				if !found {
+					continue
+				}
+				weights[[2]uint64{pre, post}]++
+			}
+		}
+	}
+
+	if len(filter.Bodies) != 0 {
+		for _, label := range filter.Bodies {
+			elems, err := d.getExpandedElements(ctx, NewLabelTKey(label))
+			if err != nil {
+				return nil, err
+			}
+			addConnections(elems)
+		}
+	} else {
+		minTKey := storage.MinTKey(keyBlock)
+		maxTKey := storage.MaxTKey(keyBlock)
+		err = store.ProcessRange(ctx, minTKey, maxTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+			if c == nil || c.V == nil {
+				return nil
+			}
+			var elems Elements
+			if err := json.Unmarshal(c.V, &elems); err != nil {
+				return fmt.Errorf("couldn't unmarshal block elements for data %q: %v", d.DataName(), err)
+			}
+			addConnections(elems)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	edges := make(ConnectionEdges, 0, len(weights))
+	for pair, weight := range weights {
+		if weight < filter.MinWeight {
+			continue
+		}
+		edges = append(edges, ConnectionEdge{Pre: pair[0], Post: pair[1], Weight: weight})
+	}
+	sort.Sort(edges)
+	return edges, nil
+}
@@ -0,0 +1,222 @@
+/*
+	This file supports consistency checks of the label denormalization against the
+	block-indexed elements and synced label data.
+*/
+
+package annotation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// LabelProblem describes a label's denormalized elements that disagree with the elements
+// found at that label's voxels.
+type LabelProblem struct {
+	Label   uint64
+	Missing []dvid.Point3d `json:",omitempty"` // elements in label but not in label's elements
+	Extra   []dvid.Point3d `json:",omitempty"` // label's elements not within label
+}
+
+type labelProblems []LabelProblem
+
+func (p labelProblems) Len() int           { return len(p) }
+func (p labelProblems) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p labelProblems) Less(i, j int) bool { return p[i].Label < p[j].Label }
+
+// FsckOptions limit the scope of a consistency check and specify whether problems are repaired.
+type FsckOptions struct {
+	MinLabel uint64
+	MaxLabel uint64
+	ROI      *roi.Immutable // if non-nil, only elements within the ROI are checked.
+	Repair   bool
+}
+
+// FsckReport gives the results of a consistency check of label denormalizations.
+type FsckReport struct {
+	Labels          dvid.InstanceName // synced label data used for check
+	ElementsScanned uint64
+	LabelsChecked   uint64
+	Problems        []LabelProblem
+	Repaired        uint64 // number of labels whose elements were rewritten or deleted
+}
+
+// elementsByLabel returns the block-indexed elements grouped by the label at each element's
+// position in the synced label data.
+func (d *Data) elementsByLabel(ctx *datastore.VersionedCtx, labelData labelType, opts FsckOptions) (LabelElements, uint64, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, 0, err
+	}
+	blockSize := d.blockSize()
+	bX := blockSize[0] * 8
+	bY := blockSize[1] * bX
+	blockBytes := int(blockSize[0] * blockSize[1] * blockSize[2] * 8)
+
+	expected := make(LabelElements)
+	var numElems uint64
+	err = store.ProcessRange(ctx, storage.MinTKey(keyBlock), storage.MaxTKey(keyBlock), &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || c.V == nil {
+			return nil
+		}
+		chunkPt, err := DecodeBlockTKey(c.K)
+		if err != nil {
+			return err
+		}
+		var elems Elements
+		if err := json.Unmarshal(c.V, &elems); err != nil {
+			return fmt.Errorf("couldn't unmarshal elements in block %s of data %q: %v", chunkPt, d.DataName(), err)
+		}
+		if len(elems) == 0 {
+			return nil
+		}
+		lbls, err := labelData.GetLabelBytes(ctx.VersionID(), chunkPt)
+		if err != nil {
+			return err
+		}
+		if len(lbls) != 0 && len(lbls) != blockBytes {
+			return fmt.Errorf("expected %d bytes in %q label block, got %d", blockBytes, labelData.DataName(), len(lbls))
+		}
+		for _, elem := range elems {
+			if opts.ROI != nil && !opts.ROI.VoxelWithin(elem.Pos) {
+				continue
+			}
+			numElems++
+			if len(lbls) == 0 {
+				continue
+			}
+			pt := elem.Pos.Point3dInChunk(blockSize)
+			i := pt[2]*bY + pt[1]*bX + pt[0]*8
+			label := binary.LittleEndian.Uint64(lbls[i : i+8])
+			if label >= opts.MinLabel && label <= opts.MaxLabel {
+				expected.add(label, elem.ElementNR)
+			}
+		}
+		return nil
+	})
+	return expected, numElems, err
+}
+
+// Fsck checks the elements stored for each label against the labels at the positions of
+// the block-indexed elements, reporting any discrepancies and, if requested, repairing them.
+// Repairs are sent to subscribers like labelsz as element modifications.
+func (d *Data) Fsck(v dvid.VersionID, opts FsckOptions) (*FsckReport, error) {
+	labelData := d.GetSyncedLabels()
+	if labelData == nil {
+		return nil, fmt.Errorf("annotation %q has no synced labels to check against", d.DataName())
+	}
+	if opts.MaxLabel == 0 {
+		opts.MaxLabel = math.MaxUint64
+	}
+	if opts.MinLabel > opts.MaxLabel {
+		return nil, fmt.Errorf("minimum label %d is greater than maximum label %d", opts.MinLabel, opts.MaxLabel)
+	}
+	timedLog := dvid.NewTimeLog()
+
+	if opts.Repair {
+		d.Lock()
+		defer d.Unlock()
+	} else {
+		d.RLock()
+		defer d.RUnlock()
+	}
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	expected, numElems, err := d.elementsByLabel(ctx, labelData, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &FsckReport{Labels: labelData.DataName(), ElementsScanned: numElems}
+
+	repairs := make(LabelElements)
+	var delta DeltaModifyElements
+	check := func(label uint64, stored ElementsNR) {
+		want := expected[label]
+		delete(expected, label)
+
+		wantPos := make(map[string]struct{}, len(want))
+		for _, elem := range want {
+			wantPos[elem.Pos.MapKey()] = struct{}{}
+		}
+		var problem LabelProblem
+		var kept ElementsNR
+		var numChecked int
+		storedPos := make(map[string]struct{}, len(stored))
+		for _, elem := range stored {
+			if opts.ROI != nil && !opts.ROI.VoxelWithin(elem.Pos) {
+				kept = append(kept, elem)
+				continue
+			}
+			numChecked++
+			storedPos[elem.Pos.MapKey()] = struct{}{}
+			if _, found := wantPos[elem.Pos.MapKey()]; found {
+				kept = append(kept, elem)
+			} else {
+				problem.Extra = append(problem.Extra, elem.Pos)
+				delta.Del = append(delta.Del, ElementPos{Label: label, Kind: elem.Kind, Pos: elem.Pos})
+			}
+		}
+		for _, elem := range want {
+			if _, found := storedPos[elem.Pos.MapKey()]; !found {
+				problem.Missing = append(problem.Missing, elem.Pos)
+				delta.Add = append(delta.Add, ElementPos{Label: label, Kind: elem.Kind, Pos: elem.Pos})
+				kept = append(kept, elem)
+			}
+		}
+		if numChecked == 0 && len(want) == 0 {
+			return
+		}
+		report.LabelsChecked++
+		if len(problem.Missing) != 0 || len(problem.Extra) != 0 {
+			problem.Label = label
+			report.Problems = append(report.Problems, problem)
+			repairs[label] = kept
+		}
+	}
+	err = d.ProcessLabelAnnotations(v, func(label uint64, elems ElementsNR) {
+		if label >= opts.MinLabel && label <= opts.MaxLabel {
+			check(label, elems)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for label := range expected {
+		check(label, nil)
+	}
+	sort.Sort(labelProblems(report.Problems))
+
+	if opts.Repair && len(repairs) != 0 {
+		store, err := datastore.GetOrderedKeyValueDB(d)
+		if err != nil {
+			return nil, err
+		}
+		for label, elems := range repairs {
+			tk := NewLabelTKey(label)
+			if len(elems) == 0 {
+				err = store.Delete(ctx, tk)
+			} else {
+				err = putElements(ctx, tk, elems)
+			}
+			if err != nil {
+				return report, fmt.Errorf("unable to repair elements for label %d: %v", label, err)
+			}
+			report.Repaired++
+		}
+		evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
+		msg := datastore.SyncMessage{Event: ModifyElementsEvent, Version: v, Delta: delta}
+		if err := datastore.NotifySubscribers(evt, msg); err != nil {
+			return report, err
+		}
+	}
+	timedLog.Infof("Fsck of annotation %q labels %d-%d: %d elements, %d labels, %d problems, %d repaired", d.DataName(), opts.MinLabel, opts.MaxLabel, report.ElementsScanned, report.LabelsChecked, len(report.Problems), report.Repaired)
+	return report, nil
+}
@@ -0,0 +1,216 @@
+/*
+	This file supports generation of ROIs from the convex region around a set of elements.
+*/
+
+package annotation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// 2d points for convex hull computation, sorted by first then second coordinate.
+type hullPoints [][2]float64
+
+func (h hullPoints) Len() int      { return len(h) }
+func (h hullPoints) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h hullPoints) Less(i, j int) bool {
+	if h[i][0] == h[j][0] {
+		return h[i][1] < h[j][1]
+	}
+	return h[i][0] < h[j][0]
+}
+
+// cross product of vectors oa and ob.  Positive if o->a->b makes a counter-clockwise turn.
+func cross(o, a, b [2]float64) float64 {
+	return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+}
+
+// convexHull returns the convex hull of the points in counter-clockwise order using
+// Andrew's monotone chain algorithm.  Degenerate hulls of one or two points are possible.
+func convexHull(pts hullPoints) hullPoints {
+	sorted := make(hullPoints, len(pts))
+	copy(sorted, pts)
+	sort.Sort(sorted)
+
+	// remove duplicates
+	n := 0
+	for i, pt := range sorted {
+		if i == 0 || pt != sorted[n-1] {
+			sorted[n] = pt
+			n++
+		}
+	}
+	sorted = sorted[:n]
+	if n < 3 {
+		return sorted
+	}
+
+	hull := make(hullPoints, 0, 2*n)
+	for _, pt := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], pt) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pt)
+	}
+	lower := len(hull) + 1
+	for i := n - 2; i >= 0; i-- {
+		pt := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], pt) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pt)
+	}
+	return hull[:len(hull)-1]
+}
+
+// bandExtent returns the range of the first coordinate over the part of a convex hull
+// whose second coordinate is within [lo, hi].  If the hull doesn't intersect the band,
+// ok is false.
+func (h hullPoints) bandExtent(lo, hi float64) (min, max float64, ok bool) {
+	min, max = math.Inf(1), math.Inf(-1)
+	add := func(v float64) {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+		ok = true
+	}
+	if len(h) == 1 {
+		if h[0][1] >= lo && h[0][1] <= hi {
+			add(h[0][0])
+		}
+		return
+	}
+	// The extent of a convex polygon clipped by the band is reached on its boundary.
+	for i, a := range h {
+		b := h[(i+1)%len(h)]
+		if a[1] == b[1] {
+			if a[1] >= lo && a[1] <= hi {
+				add(a[0])
+				add(b[0])
+			}
+			continue
+		}
+		t0 := (lo - a[1]) / (b[1] - a[1])
+		t1 := (hi - a[1]) / (b[1] - a[1])
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		t0 = math.Max(t0, 0)
+		t1 = math.Min(t1, 1)
+		if t0 > t1 {
+			continue
+		}
+		add(a[0] + t0*(b[0]-a[0]))
+		add(a[0] + t1*(b[0]-a[0]))
+	}
+	return
+}
+
+// ConvexSpans returns spans of blocks with the given block size that cover the convex
+// region around the given points.  The region is the intersection of the convex hulls of
+// the points projected along each axis, which contains the 3d convex hull of the points.
+func ConvexSpans(pts []dvid.Point3d, blockSize dvid.Point3d) (dvid.Spans, error) {
+	if len(pts) == 0 {
+		return nil, fmt.Errorf("no points given for convex region")
+	}
+	xy := make(hullPoints, len(pts))
+	xz := make(hullPoints, len(pts))
+	zy := make(hullPoints, len(pts))
+	minPt, maxPt := pts[0], pts[0]
+	for i, pt := range pts {
+		x, y, z := float64(pt[0]), float64(pt[1]), float64(pt[2])
+		xy[i] = [2]float64{x, y}
+		xz[i] = [2]float64{x, z}
+		zy[i] = [2]float64{z, y}
+		for dim := 0; dim < 3; dim++ {
+			if pt[dim] < minPt[dim] {
+				minPt[dim] = pt[dim]
+			}
+			if pt[dim] > maxPt[dim] {
+				maxPt[dim] = pt[dim]
+			}
+		}
+	}
+	xy = convexHull(xy)
+	xz = convexHull(xz)
+	zy = convexHull(zy)
+
+	bx, by, bz := float64(blockSize[0]), float64(blockSize[1]), float64(blockSize[2])
+	minBlock := minPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+	maxBlock := maxPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+	var spans dvid.Spans
+	for z := minBlock[2]; z <= maxBlock[2]; z++ {
+		z0 := float64(z) * bz
+		z1 := z0 + bz - 1
+		for y := minBlock[1]; y <= maxBlock[1]; y++ {
+			y0 := float64(y) * by
+			y1 := y0 + by - 1
+			zmin, zmax, ok := zy.bandExtent(y0, y1)
+			if !ok || zmax < z0 || zmin > z1 {
+				continue
+			}
+			xmin, xmax, ok := xy.bandExtent(y0, y1)
+			if !ok {
+				continue
+			}
+			xmin2, xmax2, ok := xz.bandExtent(z0, z1)
+			if !ok {
+				continue
+			}
+			xmin = math.Max(xmin, xmin2)
+			xmax = math.Min(xmax, xmax2)
+			if xmin > xmax {
+				continue
+			}
+			x0 := int32(math.Floor(xmin / bx))
+			x1 := int32(math.Floor(xmax / bx))
+			spans = append(spans, dvid.Span{z, y, x0, x1})
+		}
+	}
+	return spans, nil
+}
+
+// PutConvexROI stores the blocks covering the convex region around the elements with the
+// given label or tag into an ROI, replacing any previous ROI for that version, and returns
+// the number of ROI spans.  If the label is zero, the tag is used.
+func (d *Data) PutConvexROI(ctx *datastore.VersionedCtx, label uint64, tag Tag, dest *roi.Data) (int, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var tk storage.TKey
+	var err error
+	if label != 0 {
+		tk = NewLabelTKey(label)
+	} else if tk, err = NewTagTKey(tag); err != nil {
+		return 0, err
+	}
+	elems, err := getElementsNR(ctx, tk)
+	if err != nil {
+		return 0, err
+	}
+	if len(elems) == 0 {
+		return 0, fmt.Errorf("no elements found in data %q for label %d or tag %q", d.DataName(), label, tag)
+	}
+	pts := make([]dvid.Point3d, len(elems))
+	for i, elem := range elems {
+		pts[i] = elem.Pos
+	}
+	spans, err := ConvexSpans(pts, dest.BlockSize)
+	if err != nil {
+		return 0, err
+	}
+	if err := dest.PutSpans(ctx.VersionID(), spans, true); err != nil {
+		return 0, err
+	}
+	return len(spans), nil
+}
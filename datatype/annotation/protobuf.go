@@ -0,0 +1,194 @@
+/*
+	This file supports a streaming protobuf encoding of elements.  The schema is given in
+	datatype/common/proto/annotation.proto, and the generated code is used for each element.
+	Elements are sent as a sequence of varint length-delimited messages so very large POSTed
+	sets can be stored in batches as they are read.
+*/
+
+package annotation
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ProtobufContentType is the MIME type for a stream of length-delimited protobuf elements.
+const ProtobufContentType = "application/x-protobuf"
+
+// StreamBatchSize is the number of streamed elements stored per batch.
+const StreamBatchSize = 10000
+
+// maximum size of a single encoded element, to guard against corrupt streams.
+const maxElementBytes = 64 * dvid.Mega
+
+// returns the format requested for elements via query string "format" or,
+// for POST, the Content-Type header and for GET, the Accept header.
+func formatFromRequest(r *http.Request) (formatType, error) {
+	switch r.URL.Query().Get("format") {
+	case "protobuf":
+		return FormatProtobuf3, nil
+	case "json":
+		return FormatJSON, nil
+	case "":
+	default:
+		return FormatJSON, fmt.Errorf("unknown format %q requested", r.URL.Query().Get("format"))
+	}
+	header := r.Header.Get("Accept")
+	if strings.ToLower(r.Method) == "post" {
+		header = r.Header.Get("Content-Type")
+	}
+	if strings.Contains(header, ProtobufContentType) {
+		return FormatProtobuf3, nil
+	}
+	return FormatJSON, nil
+}
+
+// toProto returns the generated protobuf message for an element.
+func (e Element) toProto() *proto.AnnotationElement {
+	pe := &proto.AnnotationElement{
+		Pos:  []int32{e.Pos[0], e.Pos[1], e.Pos[2]},
+		Kind: uint32(e.Kind),
+	}
+	if len(e.Rels) != 0 {
+		pe.Rels = make([]*proto.AnnotationRelationship, len(e.Rels))
+		for i, rel := range e.Rels {
+			pe.Rels[i] = &proto.AnnotationRelationship{
+				Rel: uint32(rel.Rel),
+				To:  []int32{rel.To[0], rel.To[1], rel.To[2]},
+			}
+		}
+	}
+	if len(e.Tags) != 0 {
+		pe.Tags = make([]string, len(e.Tags))
+		for i, tag := range e.Tags {
+			pe.Tags[i] = string(tag)
+		}
+	}
+	if len(e.Prop) != 0 {
+		pe.Prop = e.Prop
+	}
+	return pe
+}
+
+func toPoint3d(coords []int32) (dvid.Point3d, error) {
+	if len(coords) != 3 {
+		return dvid.Point3d{}, fmt.Errorf("expected 3 coordinates in protobuf point, got %d", len(coords))
+	}
+	return dvid.Point3d{coords[0], coords[1], coords[2]}, nil
+}
+
+// MarshalProtobuf returns the protobuf encoding of an element.
+func (e Element) MarshalProtobuf() ([]byte, error) {
+	return e.toProto().Marshal()
+}
+
+// UnmarshalProtobuf decodes an element from its protobuf encoding.
+func (e *Element) UnmarshalProtobuf(b []byte) error {
+	var pe proto.AnnotationElement
+	if err := pe.Unmarshal(b); err != nil {
+		return err
+	}
+	pos, err := toPoint3d(pe.Pos)
+	if err != nil {
+		return err
+	}
+	*e = Element{
+		ElementNR: ElementNR{
+			Pos:  pos,
+			Kind: ElementType(pe.Kind),
+		},
+	}
+	if len(pe.Rels) != 0 {
+		e.Rels = make(Relationships, len(pe.Rels))
+		for i, rel := range pe.Rels {
+			if rel == nil {
+				return fmt.Errorf("empty relationship in protobuf element")
+			}
+			to, err := toPoint3d(rel.To)
+			if err != nil {
+				return err
+			}
+			e.Rels[i] = Relationship{Rel: RelationType(rel.Rel), To: to}
+		}
+	}
+	if len(pe.Tags) != 0 {
+		e.Tags = make(Tags, len(pe.Tags))
+		for i, tag := range pe.Tags {
+			e.Tags[i] = Tag(tag)
+		}
+	}
+	if len(pe.Prop) != 0 {
+		e.Prop = pe.Prop
+	}
+	return nil
+}
+
+// ElementWriter writes a stream of length-delimited protobuf elements.
+type ElementWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewElementWriter returns an ElementWriter that writes to w.
+func NewElementWriter(w io.Writer) *ElementWriter {
+	return &ElementWriter{w: w}
+}
+
+// Write writes a single element to the stream.
+func (ew *ElementWriter) Write(elem Element) error {
+	pe := elem.toProto()
+	size := pe.Size()
+	if cap(ew.buf) < size+binary.MaxVarintLen64 {
+		ew.buf = make([]byte, size+binary.MaxVarintLen64)
+	}
+	n := binary.PutUvarint(ew.buf[:cap(ew.buf)], uint64(size))
+	if _, err := pe.MarshalTo(ew.buf[n : n+size]); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(ew.buf[:n+size])
+	return err
+}
+
+// ElementReader reads a stream of length-delimited protobuf elements.
+type ElementReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewElementReader returns an ElementReader that reads from r.
+func NewElementReader(r io.Reader) *ElementReader {
+	return &ElementReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next element in the stream or io.EOF if there are no more elements.
+func (er *ElementReader) Next() (*Element, error) {
+	n, err := binary.ReadUvarint(er.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("bad element length in protobuf stream: %v", err)
+	}
+	if n > maxElementBytes {
+		return nil, fmt.Errorf("protobuf element of %d bytes exceeds maximum of %d bytes", n, maxElementBytes)
+	}
+	if uint64(cap(er.buf)) < n {
+		er.buf = make([]byte, n)
+	}
+	er.buf = er.buf[:n]
+	if _, err := io.ReadFull(er.r, er.buf); err != nil {
+		return nil, fmt.Errorf("truncated element in protobuf stream: %v", err)
+	}
+	elem := new(Element)
+	if err := elem.UnmarshalProtobuf(er.buf); err != nil {
+		return nil, err
+	}
+	return elem, nil
+}
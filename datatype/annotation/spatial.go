@@ -0,0 +1,240 @@
+/*
+	This file supports radius and nearest-neighbor queries on the block-indexed elements.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// DefaultNearestMaxDist is the maximum distance in voxels searched by a nearest-neighbor
+// query if no maximum distance is specified.
+const DefaultNearestMaxDist = 2048
+
+// ElementFilter selects elements by kind and tag.  Empty Kinds or Tags match all elements.
+type ElementFilter struct {
+	Kinds []ElementType
+	Tags  []Tag
+}
+
+// NewElementFilter returns an ElementFilter given comma-separated kind and tag strings.
+func NewElementFilter(kindStr, tagStr string) (ElementFilter, error) {
+	var f ElementFilter
+	if kindStr != "" {
+		for _, s := range strings.Split(kindStr, ",") {
+			kind := StringToElementType(s)
+			if kind == UnknownElem && s != "Unknown" {
+				return f, fmt.Errorf("unknown element kind %q", s)
+			}
+			f.Kinds = append(f.Kinds, kind)
+		}
+	}
+	if tagStr != "" {
+		for _, s := range strings.Split(tagStr, ",") {
+			f.Tags = append(f.Tags, Tag(s))
+		}
+	}
+	return f, nil
+}
+
+func (f ElementFilter) matches(elem ElementNR) bool {
+	if len(f.Kinds) != 0 {
+		var found bool
+		for _, kind := range f.Kinds {
+			if elem.Kind == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Tags) != 0 {
+		for _, tag := range f.Tags {
+			for _, etag := range elem.Tags {
+				if tag == etag {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func distSquared(a, b dvid.Point3d) int64 {
+	dx := int64(a[0] - b[0])
+	dy := int64(a[1] - b[1])
+	dz := int64(a[2] - b[2])
+	return dx*dx + dy*dy + dz*dz
+}
+
+// elements paired with their squared distance to a query point, sortable by distance.
+type distElements struct {
+	elems Elements
+	dist  []int64
+}
+
+func (de *distElements) add(elem Element, dist int64) {
+	de.elems = append(de.elems, elem)
+	de.dist = append(de.dist, dist)
+}
+
+func (de *distElements) Len() int {
+	return len(de.elems)
+}
+
+func (de *distElements) Less(i, j int) bool {
+	if de.dist[i] != de.dist[j] {
+		return de.dist[i] < de.dist[j]
+	}
+	return de.elems[i].Pos.Less(de.elems[j].Pos)
+}
+
+func (de *distElements) Swap(i, j int) {
+	de.elems[i], de.elems[j] = de.elems[j], de.elems[i]
+	de.dist[i], de.dist[j] = de.dist[j], de.dist[i]
+}
+
+// calls the given function for the elements in each stored block within the given block
+// bounds, using one range query per row of blocks along X.  Assumes outer locking.
+func (d *Data) processBlocksInBox(ctx *datastore.VersionedCtx, minBlock, maxBlock dvid.ChunkPoint3d, f func(Elements)) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	for z := minBlock[2]; z <= maxBlock[2]; z++ {
+		for y := minBlock[1]; y <= maxBlock[1]; y++ {
+			begTKey := NewBlockTKey(dvid.ChunkPoint3d{minBlock[0], y, z})
+			endTKey := NewBlockTKey(dvid.ChunkPoint3d{maxBlock[0], y, z})
+			err = store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
+				if chunk == nil || chunk.V == nil {
+					return nil
+				}
+				var blockElems Elements
+				if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+					return err
+				}
+				f(blockElems)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetElementsWithin returns the elements passing the filter that are within the given
+// radius in voxels of a point, sorted by increasing distance.
+func (d *Data) GetElementsWithin(ctx *datastore.VersionedCtx, center dvid.Point3d, radius int32, filter ElementFilter) (Elements, error) {
+	if radius < 0 {
+		return nil, fmt.Errorf("radius must be non-negative, got %d", radius)
+	}
+	blockSize := d.blockSize()
+	offset := dvid.Point3d{radius, radius, radius}
+	minBlock := center.Sub(offset).(dvid.Point3d).Chunk(blockSize).(dvid.ChunkPoint3d)
+	maxBlock := center.Add(offset).(dvid.Point3d).Chunk(blockSize).(dvid.ChunkPoint3d)
+
+	d.RLock()
+	defer d.RUnlock()
+
+	maxDist := int64(radius) * int64(radius)
+	found := new(distElements)
+	err := d.processBlocksInBox(ctx, minBlock, maxBlock, func(elems Elements) {
+		for _, elem := range elems {
+			if !filter.matches(elem.ElementNR) {
+				continue
+			}
+			if dist := distSquared(center, elem.Pos); dist <= maxDist {
+				found.add(elem, dist)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(found)
+	if found.elems == nil {
+		return Elements{}, nil
+	}
+	return found.elems, nil
+}
+
+// GetNearestElements returns up to k elements passing the filter that are nearest a point
+// and within a maximum distance in voxels, sorted by increasing distance.  The search
+// examines cubes of blocks of doubling size around the point until the k nearest
+// elements are guaranteed to have been found.
+func (d *Data) GetNearestElements(ctx *datastore.VersionedCtx, center dvid.Point3d, k int, maxDist int32, filter ElementFilter) (Elements, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("number of nearest elements must be positive, got %d", k)
+	}
+	if maxDist < 0 {
+		return nil, fmt.Errorf("maximum distance must be non-negative, got %d", maxDist)
+	}
+	blockSize := d.blockSize()
+	centerBlock := center.Chunk(blockSize).(dvid.ChunkPoint3d)
+	maxDistSq := int64(maxDist) * int64(maxDist)
+
+	d.RLock()
+	defer d.RUnlock()
+
+	var r int32
+	for {
+		minBlock := dvid.ChunkPoint3d{centerBlock[0] - r, centerBlock[1] - r, centerBlock[2] - r}
+		maxBlock := dvid.ChunkPoint3d{centerBlock[0] + r, centerBlock[1] + r, centerBlock[2] + r}
+
+		found := new(distElements)
+		err := d.processBlocksInBox(ctx, minBlock, maxBlock, func(elems Elements) {
+			for _, elem := range elems {
+				if !filter.matches(elem.ElementNR) {
+					continue
+				}
+				if dist := distSquared(center, elem.Pos); dist <= maxDistSq {
+					found.add(elem, dist)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(found)
+
+		// Any element within the covered distance of the center must be in the examined blocks.
+		covered := int64(-1)
+		for i := 0; i < 3; i++ {
+			lo := int64(center[i]) - int64(minBlock[i])*int64(blockSize[i])
+			hi := int64(maxBlock[i]+1)*int64(blockSize[i]) - 1 - int64(center[i])
+			if covered < 0 || lo < covered {
+				covered = lo
+			}
+			if hi < covered {
+				covered = hi
+			}
+		}
+		if (found.Len() >= k && found.dist[k-1] <= covered*covered) || covered >= int64(maxDist) {
+			if found.Len() > k {
+				return found.elems[:k], nil
+			}
+			if found.elems == nil {
+				return Elements{}, nil
+			}
+			return found.elems, nil
+		}
+		if r == 0 {
+			r = 1
+		} else {
+			r *= 2
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DefaultCheckoutLease is the lease on checked out labels if none is specified.
+const DefaultCheckoutLease = 10 * time.Minute
+
+var checkouts checkoutCache
+
+// LabelCheckout describes a label checked out by a user until the lease expires.
+type LabelCheckout struct {
+	Label   uint64
+	User    string
+	Expires time.Time
+}
+
+// LabelCheckouts is a slice of checked out labels sortable by label.
+type LabelCheckouts []LabelCheckout
+
+func (lc LabelCheckouts) Len() int           { return len(lc) }
+func (lc LabelCheckouts) Swap(i, j int)      { lc[i], lc[j] = lc[j], lc[i] }
+func (lc LabelCheckouts) Less(i, j int) bool { return lc[i].Label < lc[j].Label }
+
+// Checkout checks out the given labels for a user so merges and splits on those labels by
+// other users are rejected until the labels are released or the lease expires.  Checking
+// out labels already held by the same user renews their lease.  Either all labels are
+// checked out or none are.
+func Checkout(iv dvid.InstanceVersion, user string, lbls []uint64, lease time.Duration) (LabelCheckouts, error) {
+	return checkouts.checkout(iv, user, lbls, lease, time.Now())
+}
+
+// Release releases the given labels checked out by a user.  If force is true, labels
+// checked out by other users are also released.  Labels that aren't checked out are ignored.
+func Release(iv dvid.InstanceVersion, user string, lbls []uint64, force bool) error {
+	return checkouts.release(iv, user, lbls, force, time.Now())
+}
+
+// Checkouts returns the current checked out labels for a version of a data instance.
+func Checkouts(iv dvid.InstanceVersion) LabelCheckouts {
+	return checkouts.list(iv, time.Now())
+}
+
+// CheckoutConflict returns an error if any of the given labels is checked out by a user
+// other than the given user.
+func CheckoutConflict(iv dvid.InstanceVersion, user string, lbls ...uint64) error {
+	return checkouts.conflict(iv, user, lbls, time.Now())
+}
+
+// checkoutCache is a thread-safe cache of label checkouts across versions.  Expired
+// checkouts are removed lazily as the cache is accessed.
+type checkoutCache struct {
+	sync.Mutex
+	m map[dvid.InstanceVersion]map[uint64]LabelCheckout
+}
+
+// expire removes expired checkouts for the given InstanceVersion.  Lock must be held.
+func (cc *checkoutCache) expire(iv dvid.InstanceVersion, now time.Time) map[uint64]LabelCheckout {
+	held, found := cc.m[iv]
+	if !found {
+		return nil
+	}
+	for label, co := range held {
+		if !now.Before(co.Expires) {
+			delete(held, label)
+		}
+	}
+	if len(held) == 0 {
+		delete(cc.m, iv)
+		return nil
+	}
+	return held
+}
+
+func (cc *checkoutCache) checkout(iv dvid.InstanceVersion, user string, lbls []uint64, lease time.Duration, now time.Time) (LabelCheckouts, error) {
+	if user == "" {
+		return nil, fmt.Errorf("a user must be specified to check out labels")
+	}
+	if lease <= 0 {
+		lease = DefaultCheckoutLease
+	}
+	cc.Lock()
+	defer cc.Unlock()
+
+	held := cc.expire(iv, now)
+	for _, label := range lbls {
+		if label == 0 {
+			return nil, fmt.Errorf("label 0 is protected background value and cannot be checked out")
+		}
+		if co, found := held[label]; found && co.User != user {
+			return nil, fmt.Errorf("label %d is checked out by user %q until %s", label, co.User, co.Expires.Format(time.RFC3339))
+		}
+	}
+	if held == nil {
+		if cc.m == nil {
+			cc.m = make(map[dvid.InstanceVersion]map[uint64]LabelCheckout)
+		}
+		held = make(map[uint64]LabelCheckout, len(lbls))
+		cc.m[iv] = held
+	}
+	granted := make(LabelCheckouts, 0, len(lbls))
+	expires := now.Add(lease)
+	for _, label := range lbls {
+		co := LabelCheckout{Label: label, User: user, Expires: expires}
+		held[label] = co
+		granted = append(granted, co)
+	}
+	sort.Sort(granted)
+	return granted, nil
+}
+
+func (cc *checkoutCache) release(iv dvid.InstanceVersion, user string, lbls []uint64, force bool, now time.Time) error {
+	cc.Lock()
+	defer cc.Unlock()
+
+	held := cc.expire(iv, now)
+	if !force {
+		for _, label := range lbls {
+			if co, found := held[label]; found && co.User != user {
+				return fmt.Errorf("label %d is checked out by user %q, not %q", label, co.User, user)
+			}
+		}
+	}
+	for _, label := range lbls {
+		delete(held, label)
+	}
+	if held != nil && len(held) == 0 {
+		delete(cc.m, iv)
+	}
+	return nil
+}
+
+func (cc *checkoutCache) list(iv dvid.InstanceVersion, now time.Time) LabelCheckouts {
+	cc.Lock()
+	defer cc.Unlock()
+
+	held := cc.expire(iv, now)
+	lc := make(LabelCheckouts, 0, len(held))
+	for _, co := range held {
+		lc = append(lc, co)
+	}
+	sort.Sort(lc)
+	return lc
+}
+
+func (cc *checkoutCache) conflict(iv dvid.InstanceVersion, user string, lbls []uint64, now time.Time) error {
+	cc.Lock()
+	defer cc.Unlock()
+
+	held := cc.expire(iv, now)
+	for _, label := range lbls {
+		if co, found := held[label]; found && co.User != user {
+			return fmt.Errorf("label %d is checked out by user %q until %s", label, co.User, co.Expires.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package labels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+func TestCheckouts(t *testing.T) {
+	var cc checkoutCache
+	iv := dvid.InstanceVersion{"foobar", 23}
+	now := time.Now()
+
+	if _, err := cc.checkout(iv, "", []uint64{1}, time.Minute, now); err == nil {
+		t.Errorf("expected error checking out label without user\n")
+	}
+	if _, err := cc.checkout(iv, "alice", []uint64{0}, time.Minute, now); err == nil {
+		t.Errorf("expected error checking out label 0\n")
+	}
+	granted, err := cc.checkout(iv, "alice", []uint64{8, 3}, time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(granted) != 2 || granted[0].Label != 3 || granted[1].Label != 8 || granted[0].User != "alice" {
+		t.Fatalf("bad checkout granted: %v\n", granted)
+	}
+
+	// Other users can't check out or mutate the labels, but the owner can.
+	if _, err := cc.checkout(iv, "bob", []uint64{5, 8}, time.Minute, now); err == nil {
+		t.Errorf("expected error when bob checks out label held by alice\n")
+	}
+	if lc := cc.list(iv, now); len(lc) != 2 {
+		t.Errorf("failed checkout should not have added labels, got %v\n", lc)
+	}
+	if err := cc.conflict(iv, "bob", []uint64{1, 3}, now); err == nil {
+		t.Errorf("expected conflict for bob on label 3\n")
+	}
+	if err := cc.conflict(iv, "alice", []uint64{1, 3}, now); err != nil {
+		t.Errorf("unexpected conflict for alice: %v\n", err)
+	}
+	if err := cc.conflict(dvid.InstanceVersion{"foobar", 24}, "bob", []uint64{3}, now); err != nil {
+		t.Errorf("checkouts should be specific to a version: %v\n", err)
+	}
+
+	// Renew the lease and check expiration.
+	if _, err := cc.checkout(iv, "alice", []uint64{3}, 3*time.Minute, now.Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(2 * time.Minute)
+	lc := cc.list(iv, later)
+	if len(lc) != 1 || lc[0].Label != 3 {
+		t.Fatalf("expected only renewed label 3 to be checked out, got %v\n", lc)
+	}
+	if err := cc.conflict(iv, "bob", []uint64{8}, later); err != nil {
+		t.Errorf("expired checkout should not conflict: %v\n", err)
+	}
+
+	// Release labels.
+	if err := cc.release(iv, "bob", []uint64{3}, false, later); err == nil {
+		t.Errorf("expected error when bob releases label held by alice\n")
+	}
+	if err := cc.release(iv, "bob", []uint64{3}, true, later); err != nil {
+		t.Errorf("unexpected error on forced release: %v\n", err)
+	}
+	if lc := cc.list(iv, later); len(lc) != 0 {
+		t.Errorf("expected no checkouts after release, got %v\n", lc)
+	}
+	if len(cc.m) != 0 {
+		t.Errorf("expected empty checkout cache, got %v\n", cc.m)
+	}
+}
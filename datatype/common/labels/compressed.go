@@ -663,6 +663,25 @@ func (b *Block) ReplaceLabel(target, newLabel uint64) (replace *Block, replaceSi
 	return
 }
 
+// MapLabels returns a new block where each label is replaced by its final mapped label, if any.
+// Since many labels can be mapped to one label, the returned block may have duplicate labels
+// and is meant for reading voxels rather than storage.
+func (b *Block) MapLabels(m *Mapping) (mapped *Block, err error) {
+	mapped = new(Block)
+	mapped.data = dvid.New8ByteAlignBytes(uint32(len(b.data)))
+	copy(mapped.data, b.data)
+	if err = mapped.setExportedVars(); err != nil {
+		mapped = nil
+		return
+	}
+	for i, label := range mapped.Labels {
+		if final, found := m.FinalLabel(label); found {
+			mapped.Labels[i] = final
+		}
+	}
+	return
+}
+
 // sub-block data after downres.
 type sbData struct {
 	indices []uint32
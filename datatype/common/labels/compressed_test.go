@@ -515,6 +515,48 @@ func TestBlockMerge(t *testing.T) {
 	}
 }
 
+func TestBlockMapLabels(t *testing.T) {
+	numVoxels := 64 * 64 * 64
+	testvol := make([]uint64, numVoxels)
+	for i := 0; i < numVoxels; i++ {
+		testvol[i] = uint64(i%4) + 1
+	}
+	block, err := MakeBlock(dvid.Uint64ToByte(testvol), dvid.Point3d{64, 64, 64})
+	if err != nil {
+		t.Fatalf("error making block: %v\n", err)
+	}
+	var m Mapping
+	m.Set(2, 10)
+	m.Set(3, 10)
+	m.Set(4, 1)
+	mapped, err := block.MapLabels(&m)
+	if err != nil {
+		t.Fatalf("error mapping block: %v\n", err)
+	}
+	volbytes, _ := mapped.MakeLabelVolume()
+	uint64arr, err := dvid.ByteToUint64(volbytes)
+	if err != nil {
+		t.Fatalf("error converting label byte array: %v\n", err)
+	}
+	expected := []uint64{1, 10, 10, 1}
+	for i := 0; i < numVoxels; i++ {
+		if uint64arr[i] != expected[i%4] {
+			t.Fatalf("expected voxel %d to have label %d, got %d\n", i, expected[i%4], uint64arr[i])
+		}
+	}
+
+	// Original block should be unchanged.
+	volbytes, _ = block.MakeLabelVolume()
+	if uint64arr, err = dvid.ByteToUint64(volbytes); err != nil {
+		t.Fatalf("error converting label byte array: %v\n", err)
+	}
+	for i := 0; i < numVoxels; i++ {
+		if uint64arr[i] != testvol[i] {
+			t.Fatalf("mapping altered original block at voxel %d: %d -> %d\n", i, testvol[i], uint64arr[i])
+		}
+	}
+}
+
 func TestBlockReplaceLabel(t *testing.T) {
 	numVoxels := 64 * 64 * 64
 	testvol := make([]uint64, numVoxels)
@@ -109,6 +109,20 @@ func SplitStop(iv dvid.InstanceVersion, op DeltaSplitEnd) {
 	labelsSplitting.Decr(iv, op.OldLabel)
 }
 
+// MutationConflict returns an error if any of the given labels is involved in an ongoing
+// merge or split, i.e., between MergeStart and MergeStop or SplitStart and SplitStop.
+func MutationConflict(iv dvid.InstanceVersion, lbls ...uint64) error {
+	for _, label := range lbls {
+		if labelsMerging.IsDirty(iv, label) {
+			return fmt.Errorf("label %d is currently involved in a merge", label)
+		}
+		if labelsSplitting.IsDirty(iv, label) {
+			return fmt.Errorf("label %d has an ongoing split", label)
+		}
+	}
+	return nil
+}
+
 type mergeCache struct {
 	sync.RWMutex
 	m map[dvid.InstanceVersion]*Mapping
@@ -204,7 +218,8 @@ func (mc *mergeCache) DeleteMap(iv dvid.InstanceVersion) {
 }
 
 // Mapping is a thread-safe, mapping of labels to labels in both forward and backward direction.
-// Mutation of a Mapping instance can only be done through labels.MergeCache.
+// Mappings used for merges can only be mutated through labels.MergeCache, while other
+// mappings can be modified via Set and Delete.
 type Mapping struct {
 	sync.RWMutex
 	f map[uint64]uint64
@@ -307,6 +322,32 @@ func (m *Mapping) set(a, b uint64) error {
 	return nil
 }
 
+// Set maps label a to label b, replacing any previous mapping of a.  Unlike mappings
+// added during merges, chained mappings are not checked.
+func (m *Mapping) Set(a, b uint64) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.f == nil {
+		m.f = make(map[uint64]uint64)
+		m.r = make(map[uint64]Set)
+	} else if prev, found := m.f[a]; found {
+		delete(m.r[prev], a)
+	}
+	m.f[a] = b
+	s, found := m.r[b]
+	if found {
+		s[a] = struct{}{}
+	} else {
+		m.r[b] = Set{a: struct{}{}}
+	}
+}
+
+// Delete removes any mapping of the given label.
+func (m *Mapping) Delete(label uint64) {
+	m.delete(label)
+}
+
 func (m *Mapping) delete(label uint64) {
 	m.Lock()
 	defer m.Unlock()
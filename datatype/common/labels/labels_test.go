@@ -50,6 +50,30 @@ func TestMapping(t *testing.T) {
 	}
 }
 
+func TestMappingSet(t *testing.T) {
+	var m Mapping
+	m.Set(1, 10)
+	m.Set(2, 10)
+	m.Set(3, 11)
+	m.Set(2, 11)
+	if v, ok := m.Get(2); v != 11 || !ok {
+		t.Errorf("Incorrect mapping after resetting label 2.  Got %d, %t\n", v, ok)
+	}
+	if c := m.ConstituentLabels(10); len(c) != 2 || !c.Exists(1) {
+		t.Errorf("Expected labels 1 and 10 mapped to 10, got %s\n", c)
+	}
+	if c := m.ConstituentLabels(11); len(c) != 3 || !c.Exists(2) || !c.Exists(3) {
+		t.Errorf("Expected labels 2, 3, and 11 mapped to 11, got %s\n", c)
+	}
+	m.Delete(3)
+	if v, ok := m.Get(3); ok {
+		t.Errorf("Got mapping for 3 after deletion.  Received %d, %t\n", v, ok)
+	}
+	if c := m.ConstituentLabels(11); len(c) != 2 || c.Exists(3) {
+		t.Errorf("Expected labels 2 and 11 mapped to 11, got %s\n", c)
+	}
+}
+
 func TestCounts(t *testing.T) {
 	var c Counts
 	if !c.Empty() {
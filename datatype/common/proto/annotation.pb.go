@@ -0,0 +1,1149 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: annotation.proto
+
+package proto
+
+import (
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	github_com_gogo_protobuf_sortkeys "github.com/gogo/protobuf/sortkeys"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+	reflect "reflect"
+	strings "strings"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+type AnnotationRelationship struct {
+	Rel uint32  `protobuf:"varint,1,opt,name=rel,proto3" json:"rel,omitempty"`
+	To  []int32 `protobuf:"zigzag32,2,rep,packed,name=to,proto3" json:"to,omitempty"`
+}
+
+func (m *AnnotationRelationship) Reset()      { *m = AnnotationRelationship{} }
+func (*AnnotationRelationship) ProtoMessage() {}
+func (*AnnotationRelationship) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26610d0577ad2d1a, []int{0}
+}
+func (m *AnnotationRelationship) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *AnnotationRelationship) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_AnnotationRelationship.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *AnnotationRelationship) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AnnotationRelationship.Merge(m, src)
+}
+func (m *AnnotationRelationship) XXX_Size() int {
+	return m.Size()
+}
+func (m *AnnotationRelationship) XXX_DiscardUnknown() {
+	xxx_messageInfo_AnnotationRelationship.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AnnotationRelationship proto.InternalMessageInfo
+
+func (m *AnnotationRelationship) GetRel() uint32 {
+	if m != nil {
+		return m.Rel
+	}
+	return 0
+}
+
+func (m *AnnotationRelationship) GetTo() []int32 {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+type AnnotationElement struct {
+	Pos  []int32                   `protobuf:"zigzag32,1,rep,packed,name=pos,proto3" json:"pos,omitempty"`
+	Kind uint32                    `protobuf:"varint,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Rels []*AnnotationRelationship `protobuf:"bytes,3,rep,name=rels,proto3" json:"rels,omitempty"`
+	Tags []string                  `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	Prop map[string]string         `protobuf:"bytes,5,rep,name=prop,proto3" json:"prop,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *AnnotationElement) Reset()      { *m = AnnotationElement{} }
+func (*AnnotationElement) ProtoMessage() {}
+func (*AnnotationElement) Descriptor() ([]byte, []int) {
+	return fileDescriptor_26610d0577ad2d1a, []int{1}
+}
+func (m *AnnotationElement) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *AnnotationElement) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_AnnotationElement.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *AnnotationElement) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AnnotationElement.Merge(m, src)
+}
+func (m *AnnotationElement) XXX_Size() int {
+	return m.Size()
+}
+func (m *AnnotationElement) XXX_DiscardUnknown() {
+	xxx_messageInfo_AnnotationElement.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AnnotationElement proto.InternalMessageInfo
+
+func (m *AnnotationElement) GetPos() []int32 {
+	if m != nil {
+		return m.Pos
+	}
+	return nil
+}
+
+func (m *AnnotationElement) GetKind() uint32 {
+	if m != nil {
+		return m.Kind
+	}
+	return 0
+}
+
+func (m *AnnotationElement) GetRels() []*AnnotationRelationship {
+	if m != nil {
+		return m.Rels
+	}
+	return nil
+}
+
+func (m *AnnotationElement) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *AnnotationElement) GetProp() map[string]string {
+	if m != nil {
+		return m.Prop
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*AnnotationRelationship)(nil), "proto.AnnotationRelationship")
+	proto.RegisterType((*AnnotationElement)(nil), "proto.AnnotationElement")
+	proto.RegisterMapType((map[string]string)(nil), "proto.AnnotationElement.PropEntry")
+}
+
+func init() { proto.RegisterFile("annotation.proto", fileDescriptor_26610d0577ad2d1a) }
+
+var fileDescriptor_26610d0577ad2d1a = []byte{
+	// 290 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x8f, 0xcd, 0x4a, 0x33, 0x31,
+	0x14, 0x86, 0xe7, 0xcc, 0x4c, 0x3f, 0x98, 0x7c, 0x28, 0x6d, 0x10, 0x09, 0x82, 0x87, 0xa1, 0xab,
+	0x59, 0x15, 0xfc, 0x41, 0xa5, 0x3b, 0x85, 0xee, 0x25, 0x77, 0x30, 0x62, 0xd0, 0xd2, 0x31, 0x09,
+	0x99, 0x28, 0x74, 0xe7, 0x25, 0x78, 0x19, 0x5e, 0x8a, 0xcb, 0x2e, 0xbb, 0xb4, 0x99, 0x8d, 0xcb,
+	0x7a, 0x07, 0x92, 0x53, 0xa9, 0x0b, 0x5d, 0x9d, 0x27, 0xc9, 0x7b, 0x5e, 0x9e, 0xb0, 0x7e, 0xad,
+	0xb5, 0xf1, 0xb5, 0x9f, 0x1a, 0x3d, 0xb2, 0xce, 0x78, 0xc3, 0x7b, 0x34, 0x86, 0x63, 0xb6, 0x7f,
+	0xb9, 0x7d, 0x92, 0xaa, 0xa1, 0xd9, 0xde, 0x4f, 0x2d, 0xef, 0xb3, 0xcc, 0xa9, 0x46, 0x40, 0x09,
+	0xd5, 0x8e, 0x8c, 0xc8, 0x77, 0x59, 0xea, 0x8d, 0x48, 0xcb, 0xac, 0x1a, 0xc8, 0xd4, 0x9b, 0xe1,
+	0x27, 0xb0, 0xc1, 0xcf, 0xf2, 0xa4, 0x51, 0x0f, 0x4a, 0xfb, 0xb8, 0x67, 0x4d, 0x2b, 0x80, 0x62,
+	0x11, 0x39, 0x67, 0xf9, 0x6c, 0xaa, 0x6f, 0x45, 0x4a, 0x55, 0xc4, 0xfc, 0x88, 0xe5, 0x4e, 0x35,
+	0xad, 0xc8, 0xca, 0xac, 0xfa, 0x7f, 0x7c, 0xb8, 0x91, 0x1a, 0xfd, 0xad, 0x22, 0x29, 0x1a, 0x6b,
+	0x7c, 0x7d, 0xd7, 0x8a, 0xbc, 0xcc, 0xaa, 0x42, 0x12, 0xf3, 0x33, 0x96, 0x5b, 0x67, 0xac, 0xe8,
+	0x51, 0xcd, 0xf0, 0x57, 0xcd, 0xb7, 0xd4, 0xe8, 0xda, 0x19, 0x3b, 0xd1, 0xde, 0xcd, 0x25, 0xe5,
+	0x0f, 0xce, 0x59, 0xb1, 0xbd, 0x8a, 0xc6, 0x33, 0x35, 0xa7, 0x9f, 0x16, 0x32, 0x22, 0xdf, 0x63,
+	0xbd, 0xa7, 0xba, 0x79, 0x54, 0xa4, 0x5c, 0xc8, 0xcd, 0x61, 0x9c, 0x5e, 0xc0, 0xd5, 0xe9, 0x62,
+	0x85, 0xc9, 0x72, 0x85, 0xc9, 0x7a, 0x85, 0xf0, 0x1c, 0x10, 0x5e, 0x03, 0xc2, 0x5b, 0x40, 0x58,
+	0x04, 0x84, 0xf7, 0x80, 0xf0, 0x11, 0x30, 0x59, 0x07, 0x84, 0x97, 0x0e, 0x93, 0x45, 0x87, 0xc9,
+	0xb2, 0xc3, 0xe4, 0xe6, 0x1f, 0x79, 0x9d, 0x7c, 0x0d, 0x00, 0x8e, 0x2c, 0x10, 0xb8, 0x87, 0x01,
+	0x00, 0x00,
+}
+
+func (this *AnnotationRelationship) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*AnnotationRelationship)
+	if !ok {
+		that2, ok := that.(AnnotationRelationship)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Rel != that1.Rel {
+		return false
+	}
+	if len(this.To) != len(that1.To) {
+		return false
+	}
+	for i := range this.To {
+		if this.To[i] != that1.To[i] {
+			return false
+		}
+	}
+	return true
+}
+func (this *AnnotationElement) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*AnnotationElement)
+	if !ok {
+		that2, ok := that.(AnnotationElement)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if len(this.Pos) != len(that1.Pos) {
+		return false
+	}
+	for i := range this.Pos {
+		if this.Pos[i] != that1.Pos[i] {
+			return false
+		}
+	}
+	if this.Kind != that1.Kind {
+		return false
+	}
+	if len(this.Rels) != len(that1.Rels) {
+		return false
+	}
+	for i := range this.Rels {
+		if !this.Rels[i].Equal(that1.Rels[i]) {
+			return false
+		}
+	}
+	if len(this.Tags) != len(that1.Tags) {
+		return false
+	}
+	for i := range this.Tags {
+		if this.Tags[i] != that1.Tags[i] {
+			return false
+		}
+	}
+	if len(this.Prop) != len(that1.Prop) {
+		return false
+	}
+	for i := range this.Prop {
+		if this.Prop[i] != that1.Prop[i] {
+			return false
+		}
+	}
+	return true
+}
+func (this *AnnotationRelationship) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 6)
+	s = append(s, "&proto.AnnotationRelationship{")
+	s = append(s, "Rel: "+fmt.Sprintf("%#v", this.Rel)+",\n")
+	s = append(s, "To: "+fmt.Sprintf("%#v", this.To)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *AnnotationElement) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 9)
+	s = append(s, "&proto.AnnotationElement{")
+	s = append(s, "Pos: "+fmt.Sprintf("%#v", this.Pos)+",\n")
+	s = append(s, "Kind: "+fmt.Sprintf("%#v", this.Kind)+",\n")
+	if this.Rels != nil {
+		s = append(s, "Rels: "+fmt.Sprintf("%#v", this.Rels)+",\n")
+	}
+	s = append(s, "Tags: "+fmt.Sprintf("%#v", this.Tags)+",\n")
+	keysForProp := make([]string, 0, len(this.Prop))
+	for k, _ := range this.Prop {
+		keysForProp = append(keysForProp, k)
+	}
+	github_com_gogo_protobuf_sortkeys.Strings(keysForProp)
+	mapStringForProp := "map[string]string{"
+	for _, k := range keysForProp {
+		mapStringForProp += fmt.Sprintf("%#v: %#v,", k, this.Prop[k])
+	}
+	mapStringForProp += "}"
+	if this.Prop != nil {
+		s = append(s, "Prop: "+mapStringForProp+",\n")
+	}
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func valueToGoStringAnnotation(v interface{}, typ string) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("func(v %v) *%v { return &v } ( %#v )", typ, typ, pv)
+}
+func (m *AnnotationRelationship) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *AnnotationRelationship) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *AnnotationRelationship) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.To) > 0 {
+		dAtA1 := make([]byte, len(m.To)*5)
+		var j2 int
+		for _, num := range m.To {
+			x3 := (uint32(num) << 1) ^ uint32((num >> 31))
+			for x3 >= 1<<7 {
+				dAtA1[j2] = uint8(uint64(x3)&0x7f | 0x80)
+				j2++
+				x3 >>= 7
+			}
+			dAtA1[j2] = uint8(x3)
+			j2++
+		}
+		i -= j2
+		copy(dAtA[i:], dAtA1[:j2])
+		i = encodeVarintAnnotation(dAtA, i, uint64(j2))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.Rel != 0 {
+		i = encodeVarintAnnotation(dAtA, i, uint64(m.Rel))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *AnnotationElement) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *AnnotationElement) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *AnnotationElement) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Prop) > 0 {
+		for k := range m.Prop {
+			v := m.Prop[k]
+			baseI := i
+			i -= len(v)
+			copy(dAtA[i:], v)
+			i = encodeVarintAnnotation(dAtA, i, uint64(len(v)))
+			i--
+			dAtA[i] = 0x12
+			i -= len(k)
+			copy(dAtA[i:], k)
+			i = encodeVarintAnnotation(dAtA, i, uint64(len(k)))
+			i--
+			dAtA[i] = 0xa
+			i = encodeVarintAnnotation(dAtA, i, uint64(baseI-i))
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
+	if len(m.Tags) > 0 {
+		for iNdEx := len(m.Tags) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Tags[iNdEx])
+			copy(dAtA[i:], m.Tags[iNdEx])
+			i = encodeVarintAnnotation(dAtA, i, uint64(len(m.Tags[iNdEx])))
+			i--
+			dAtA[i] = 0x22
+		}
+	}
+	if len(m.Rels) > 0 {
+		for iNdEx := len(m.Rels) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Rels[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintAnnotation(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.Kind != 0 {
+		i = encodeVarintAnnotation(dAtA, i, uint64(m.Kind))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Pos) > 0 {
+		dAtA4 := make([]byte, len(m.Pos)*5)
+		var j5 int
+		for _, num := range m.Pos {
+			x6 := (uint32(num) << 1) ^ uint32((num >> 31))
+			for x6 >= 1<<7 {
+				dAtA4[j5] = uint8(uint64(x6)&0x7f | 0x80)
+				j5++
+				x6 >>= 7
+			}
+			dAtA4[j5] = uint8(x6)
+			j5++
+		}
+		i -= j5
+		copy(dAtA[i:], dAtA4[:j5])
+		i = encodeVarintAnnotation(dAtA, i, uint64(j5))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintAnnotation(dAtA []byte, offset int, v uint64) int {
+	offset -= sovAnnotation(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *AnnotationRelationship) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Rel != 0 {
+		n += 1 + sovAnnotation(uint64(m.Rel))
+	}
+	if len(m.To) > 0 {
+		l = 0
+		for _, e := range m.To {
+			l += sozAnnotation(uint64(e))
+		}
+		n += 1 + sovAnnotation(uint64(l)) + l
+	}
+	return n
+}
+
+func (m *AnnotationElement) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Pos) > 0 {
+		l = 0
+		for _, e := range m.Pos {
+			l += sozAnnotation(uint64(e))
+		}
+		n += 1 + sovAnnotation(uint64(l)) + l
+	}
+	if m.Kind != 0 {
+		n += 1 + sovAnnotation(uint64(m.Kind))
+	}
+	if len(m.Rels) > 0 {
+		for _, e := range m.Rels {
+			l = e.Size()
+			n += 1 + l + sovAnnotation(uint64(l))
+		}
+	}
+	if len(m.Tags) > 0 {
+		for _, s := range m.Tags {
+			l = len(s)
+			n += 1 + l + sovAnnotation(uint64(l))
+		}
+	}
+	if len(m.Prop) > 0 {
+		for k, v := range m.Prop {
+			_ = k
+			_ = v
+			mapEntrySize := 1 + len(k) + sovAnnotation(uint64(len(k))) + 1 + len(v) + sovAnnotation(uint64(len(v)))
+			n += mapEntrySize + 1 + sovAnnotation(uint64(mapEntrySize))
+		}
+	}
+	return n
+}
+
+func sovAnnotation(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozAnnotation(x uint64) (n int) {
+	return sovAnnotation(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (this *AnnotationRelationship) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&AnnotationRelationship{`,
+		`Rel:` + fmt.Sprintf("%v", this.Rel) + `,`,
+		`To:` + fmt.Sprintf("%v", this.To) + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *AnnotationElement) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForRels := "[]*AnnotationRelationship{"
+	for _, f := range this.Rels {
+		repeatedStringForRels += strings.Replace(f.String(), "AnnotationRelationship", "AnnotationRelationship", 1) + ","
+	}
+	repeatedStringForRels += "}"
+	keysForProp := make([]string, 0, len(this.Prop))
+	for k, _ := range this.Prop {
+		keysForProp = append(keysForProp, k)
+	}
+	github_com_gogo_protobuf_sortkeys.Strings(keysForProp)
+	mapStringForProp := "map[string]string{"
+	for _, k := range keysForProp {
+		mapStringForProp += fmt.Sprintf("%v: %v,", k, this.Prop[k])
+	}
+	mapStringForProp += "}"
+	s := strings.Join([]string{`&AnnotationElement{`,
+		`Pos:` + fmt.Sprintf("%v", this.Pos) + `,`,
+		`Kind:` + fmt.Sprintf("%v", this.Kind) + `,`,
+		`Rels:` + repeatedStringForRels + `,`,
+		`Tags:` + fmt.Sprintf("%v", this.Tags) + `,`,
+		`Prop:` + mapStringForProp + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func valueToStringAnnotation(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("*%v", pv)
+}
+func (m *AnnotationRelationship) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowAnnotation
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: AnnotationRelationship: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: AnnotationRelationship: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rel", wireType)
+			}
+			m.Rel = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Rel |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType == 0 {
+				var v int32
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowAnnotation
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= int32(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				v = int32((uint32(v) >> 1) ^ uint32(((v&1)<<31)>>31))
+				m.To = append(m.To, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowAnnotation
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthAnnotation
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthAnnotation
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.To) == 0 {
+					m.To = make([]int32, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v int32
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowAnnotation
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= int32(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					v = int32((uint32(v) >> 1) ^ uint32(((v&1)<<31)>>31))
+					m.To = append(m.To, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field To", wireType)
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipAnnotation(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *AnnotationElement) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowAnnotation
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: AnnotationElement: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: AnnotationElement: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType == 0 {
+				var v int32
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowAnnotation
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= int32(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				v = int32((uint32(v) >> 1) ^ uint32(((v&1)<<31)>>31))
+				m.Pos = append(m.Pos, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowAnnotation
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthAnnotation
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthAnnotation
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.Pos) == 0 {
+					m.Pos = make([]int32, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v int32
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowAnnotation
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= int32(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					v = int32((uint32(v) >> 1) ^ uint32(((v&1)<<31)>>31))
+					m.Pos = append(m.Pos, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Pos", wireType)
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Kind", wireType)
+			}
+			m.Kind = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Kind |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rels = append(m.Rels, &AnnotationRelationship{})
+			if err := m.Rels[len(m.Rels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Tags", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Tags = append(m.Tags, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Prop", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Prop == nil {
+				m.Prop = make(map[string]string)
+			}
+			var mapkey string
+			var mapvalue string
+			for iNdEx < postIndex {
+				entryPreIndex := iNdEx
+				var wire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowAnnotation
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					wire |= uint64(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				fieldNum := int32(wire >> 3)
+				if fieldNum == 1 {
+					var stringLenmapkey uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowAnnotation
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapkey |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapkey := int(stringLenmapkey)
+					if intStringLenmapkey < 0 {
+						return ErrInvalidLengthAnnotation
+					}
+					postStringIndexmapkey := iNdEx + intStringLenmapkey
+					if postStringIndexmapkey < 0 {
+						return ErrInvalidLengthAnnotation
+					}
+					if postStringIndexmapkey > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapkey = string(dAtA[iNdEx:postStringIndexmapkey])
+					iNdEx = postStringIndexmapkey
+				} else if fieldNum == 2 {
+					var stringLenmapvalue uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowAnnotation
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapvalue |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapvalue := int(stringLenmapvalue)
+					if intStringLenmapvalue < 0 {
+						return ErrInvalidLengthAnnotation
+					}
+					postStringIndexmapvalue := iNdEx + intStringLenmapvalue
+					if postStringIndexmapvalue < 0 {
+						return ErrInvalidLengthAnnotation
+					}
+					if postStringIndexmapvalue > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapvalue = string(dAtA[iNdEx:postStringIndexmapvalue])
+					iNdEx = postStringIndexmapvalue
+				} else {
+					iNdEx = entryPreIndex
+					skippy, err := skipAnnotation(dAtA[iNdEx:])
+					if err != nil {
+						return err
+					}
+					if (skippy < 0) || (iNdEx+skippy) < 0 {
+						return ErrInvalidLengthAnnotation
+					}
+					if (iNdEx + skippy) > postIndex {
+						return io.ErrUnexpectedEOF
+					}
+					iNdEx += skippy
+				}
+			}
+			m.Prop[mapkey] = mapvalue
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipAnnotation(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthAnnotation
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipAnnotation(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowAnnotation
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowAnnotation
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthAnnotation
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupAnnotation
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthAnnotation
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthAnnotation        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowAnnotation          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupAnnotation = fmt.Errorf("proto: unexpected end of group")
+)
@@ -0,0 +1,288 @@
+/*
+	Package proxy provides a read-through cache for data types that proxy requests to remote
+	volume services.  Fetched blocks and tiles are stored in the data instance's assigned store
+	and served locally thereafter, subject to a time-to-live and a total size budget.
+*/
+package proxy
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// keyUnknown should never be used and is a check for corrupt or incorrectly set keys
+	keyUnknown storage.TKeyClass = iota
+
+	// the byte id for the cached data of a remote request
+	keyCacheData = 221
+
+	// the byte id for the fetch time and size of a cached remote request
+	keyCacheIndex = 222
+)
+
+// DefaultMaxBytes is the default size budget in bytes for all cached data of an instance.
+const DefaultMaxBytes int64 = 1 << 30
+
+func newDataTKey(key string) storage.TKey {
+	return storage.NewTKey(keyCacheData, append([]byte(key), 0))
+}
+
+func newIndexTKey(key string) storage.TKey {
+	return storage.NewTKey(keyCacheIndex, append([]byte(key), 0))
+}
+
+func decodeIndexTKey(tk storage.TKey) (string, error) {
+	ibytes, err := tk.ClassBytes(keyCacheIndex)
+	if err != nil {
+		return "", err
+	}
+	sz := len(ibytes) - 1
+	if sz <= 0 {
+		return "", fmt.Errorf("empty cache key")
+	}
+	if ibytes[sz] != 0 {
+		return "", fmt.Errorf("expected 0 byte ending cache key, got %d", ibytes[sz])
+	}
+	return string(ibytes[:sz]), nil
+}
+
+// FetchFunc retrieves data from the remote service on a cache miss.  Any returned error
+// is passed to the caller of Fetch and nothing is cached.
+type FetchFunc func() ([]byte, error)
+
+// Stats describes the current state of a Cache.
+type Stats struct {
+	Entries  int
+	Bytes    int64
+	MaxBytes int64
+	TTL      string
+	Hits     uint64
+	Misses   uint64
+}
+
+type entry struct {
+	key     string
+	size    int64
+	fetched time.Time
+}
+
+// byFetchTime sorts entries from oldest to newest fetch.
+type byFetchTime []*entry
+
+func (e byFetchTime) Len() int           { return len(e) }
+func (e byFetchTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byFetchTime) Less(i, j int) bool { return e[i].fetched.Before(e[j].fetched) }
+
+// Cache is a read-through cache of remote data keyed by a string, typically the URL of the
+// remote request.  Data is stored in the root version of the owning data instance since
+// remote data is not versioned by DVID.  When the total size of cached data exceeds the
+// budget, the least recently used entries are deleted.
+type Cache struct {
+	data     dvid.Data
+	ttl      time.Duration
+	maxBytes int64
+
+	mu      sync.Mutex
+	loaded  bool
+	lru     *list.List // most recently used entries are at front
+	entries map[string]*list.Element
+	bytes   int64
+	hits    uint64
+	misses  uint64
+}
+
+// NewCache returns a cache that stores data in the store assigned to the given data instance.
+// A zero ttl means cached data never expires, and a non-positive maxBytes disables caching.
+func NewCache(data dvid.Data, ttl time.Duration, maxBytes int64) *Cache {
+	return &Cache{
+		data:     data,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Enabled returns true if fetched data will be cached.
+func (c *Cache) Enabled() bool {
+	return c != nil && c.maxBytes > 0
+}
+
+// Stats returns the number of entries, bytes used, and hit rate of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := Stats{
+		Entries:  c.lru.Len(),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+	if c.ttl != 0 {
+		stats.TTL = c.ttl.String()
+	}
+	return stats
+}
+
+// Fetch returns the data for the given key, using the cached copy if present and not
+// expired, or else calling fetch and caching its result.
+func (c *Cache) Fetch(key string, fetch FetchFunc) ([]byte, error) {
+	if !c.Enabled() {
+		return fetch()
+	}
+	db, ctx, err := c.store()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.loadIndex(db, ctx); err != nil {
+		return nil, err
+	}
+
+	if c.lookup(key) {
+		data, err := db.Get(ctx, newDataTKey(key))
+		if err != nil {
+			dvid.Errorf("Unable to get cached data for %q, refetching: %v\n", c.data.DataName(), err)
+		} else if data != nil {
+			return data, nil
+		}
+	}
+
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return data, nil
+	}
+	fetched := time.Now()
+	if err := db.Put(ctx, newDataTKey(key), data); err != nil {
+		dvid.Errorf("Unable to cache remote data for %q: %v\n", c.data.DataName(), err)
+		return data, nil
+	}
+	if err := db.Put(ctx, newIndexTKey(key), encodeIndex(fetched, size)); err != nil {
+		dvid.Errorf("Unable to index cached remote data for %q: %v\n", c.data.DataName(), err)
+		return data, nil
+	}
+	evicted := c.add(entry{key: key, size: size, fetched: fetched})
+	for _, evictKey := range evicted {
+		if err := db.Delete(ctx, newDataTKey(evictKey)); err != nil {
+			dvid.Errorf("Unable to evict cached data for %q: %v\n", c.data.DataName(), err)
+		}
+		if err := db.Delete(ctx, newIndexTKey(evictKey)); err != nil {
+			dvid.Errorf("Unable to evict cache index for %q: %v\n", c.data.DataName(), err)
+		}
+	}
+	return data, nil
+}
+
+// lookup returns true if there is an unexpired entry for the key, marking it as recently used.
+func (c *Cache) lookup(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[key]
+	if found {
+		e := elem.Value.(*entry)
+		if c.ttl == 0 || time.Since(e.fetched) < c.ttl {
+			c.lru.MoveToFront(elem)
+			c.hits++
+			return true
+		}
+	}
+	c.misses++
+	return false
+}
+
+// add records a newly cached entry and returns the keys of any entries that must be
+// evicted to stay within the size budget.
+func (c *Cache) add(e entry) (evicted []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[e.key]; found {
+		c.bytes -= elem.Value.(*entry).size
+		c.lru.Remove(elem)
+	}
+	c.entries[e.key] = c.lru.PushFront(&e)
+	c.bytes += e.size
+	for c.bytes > c.maxBytes {
+		elem := c.lru.Back()
+		old := elem.Value.(*entry)
+		c.lru.Remove(elem)
+		delete(c.entries, old.key)
+		c.bytes -= old.size
+		evicted = append(evicted, old.key)
+	}
+	return
+}
+
+func (c *Cache) store() (storage.OrderedKeyValueDB, *datastore.VersionedCtx, error) {
+	db, err := datastore.GetOrderedKeyValueDB(c.data)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := c.data.RootVersionID()
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, datastore.NewVersionedCtx(c.data, v), nil
+}
+
+// loadIndex reads the index of previously cached data, e.g., after a server restart, with
+// the oldest fetched entries treated as least recently used.
+func (c *Cache) loadIndex(db storage.OrderedKeyValueDB, ctx *datastore.VersionedCtx) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded {
+		return nil
+	}
+	kvs, err := db.GetRange(ctx, storage.MinTKey(keyCacheIndex), storage.MaxTKey(keyCacheIndex))
+	if err != nil {
+		return fmt.Errorf("unable to load cache index for %q: %v", c.data.DataName(), err)
+	}
+	var loaded byFetchTime
+	for _, kv := range kvs {
+		key, err := decodeIndexTKey(kv.K)
+		if err != nil {
+			return err
+		}
+		fetched, size, err := decodeIndex(kv.V)
+		if err != nil {
+			return fmt.Errorf("bad cache index for key %q: %v", key, err)
+		}
+		loaded = append(loaded, &entry{key: key, size: size, fetched: fetched})
+	}
+	sort.Sort(loaded)
+	for _, e := range loaded {
+		c.entries[e.key] = c.lru.PushFront(e)
+		c.bytes += e.size
+	}
+	c.loaded = true
+	return nil
+}
+
+func encodeIndex(fetched time.Time, size int64) []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(fetched.UnixNano()))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(size))
+	return buf
+}
+
+func decodeIndex(buf []byte) (fetched time.Time, size int64, err error) {
+	if len(buf) != 16 {
+		err = fmt.Errorf("expected 16 bytes, got %d bytes", len(buf))
+		return
+	}
+	fetched = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[0:8])))
+	size = int64(binary.LittleEndian.Uint64(buf[8:16]))
+	return
+}
@@ -10,13 +10,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/proxy"
 	"github.com/janelia-flyem/dvid/datatype/imagetile"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
@@ -65,6 +67,11 @@ $ dvid repo <UUID> new googlevoxels <data name> <settings...>
     Optional Configuration Settings (case-insensitive keys)
 
     tilesize       Default size in pixels along one dimension of square tile.  If unspecified, 512.
+    cachesize      Size budget in MB for tiles and subvolumes cached in the instance's assigned store.
+                   Once exceeded, the least recently used data is deleted.  If unspecified, 1024.
+                   A size of 0 disables caching so every request is sent to Google.
+    cachettl       Time after which cached data is refetched from Google, e.g., "1h30m" or "72h".
+                   If unspecified, cached data never expires.
 
 
 $ dvid googlevoxels volumes <jwtfile>
@@ -106,10 +113,26 @@ GET  <api URL>/node/<UUID>/<data name>/info
     data name     Name of googlevoxels data.
 
 
+GET  <api URL>/node/<UUID>/<data name>/cache
+
+    Returns JSON describing the cache of data fetched from Google: the number of cached
+    responses, the total and maximum bytes, the time-to-live, and the hits and misses since
+    the server was started.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/grayscale/cache
+
+    Returns:
+
+    { "Entries": 20, "Bytes": 5242880, "MaxBytes": 1073741824, "TTL": "72h0m0s", "Hits": 7, "Misses": 20 }
+
+
 GET  <api URL>/node/<UUID>/<data name>/tile/<dims>/<scaling>/<tile coord>[?options]
 
     Retrieves a tile of named data within a version node.  The default tile size is used unless
-    the query string "tilesize" is provided.
+    the query string "tilesize" is provided.  Tiles are cached after the first request, so
+    subsequent requests are served from DVID's store until evicted or expired.
 
     Example: 
 
@@ -138,7 +161,8 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
 
     Retrieves either 2d images (PNG by default) or 3d binary data, depending on the dims parameter.  
     The 3d binary data response has "Content-type" set to "application/octet-stream" and is an array of 
-    voxel values in ZYX order (X iterates most rapidly).
+    voxel values in ZYX order (X iterates most rapidly).  As with tiles, the data returned from
+    Google is cached.
 
     Example: 
 
@@ -190,8 +214,20 @@ var (
 	DefaultTileSize   int32  = 512
 	DefaultTileFormat string = "png"
 	bmapsPrefix       string = "https://brainmaps.googleapis.com/v1beta2"
+
+	// DefaultCacheSize is the default size budget in MB for cached Google data.
+	DefaultCacheSize int64 = 1024
 )
 
+// newClient returns a client authorized for the Google BrainMaps API using a JSON Web Token.
+var newClient = func(jwtdata []byte) (*http.Client, error) {
+	conf, err := google.JWTConfigFromJSON(jwtdata, "https://www.googleapis.com/auth/brainmaps")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot establish JWT Config file from Google: %v", err)
+	}
+	return conf.Client(oauth2.NoContext), nil
+}
+
 // Type embeds the datastore's Type to create a unique type with tile functions.
 // Refinements of general tile types can be implemented by embedding this type,
 // choosing appropriate # of channels and bytes/voxel, overriding functions as
@@ -242,11 +278,32 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	if err != nil {
 		return nil, fmt.Errorf("Cannot load JSON Web Token file (%s): %v", jwtfile, err)
 	}
-	conf, err := google.JWTConfigFromJSON(jwtdata, "https://www.googleapis.com/auth/brainmaps")
+	client, err := newClient(jwtdata)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot establish JWT Config file from Google: %v", err)
+		return nil, err
+	}
+
+	// Get the cache settings.
+	cacheSize := DefaultCacheSize
+	cacheSizeStr, found, err := c.GetString("cachesize")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if cacheSize, err = strconv.ParseInt(cacheSizeStr, 10, 64); err != nil {
+			return nil, fmt.Errorf("Bad 'cachesize' setting (%s): %v", cacheSizeStr, err)
+		}
+	}
+	var cacheTTL time.Duration
+	cacheTTLStr, found, err := c.GetString("cachettl")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if cacheTTL, err = time.ParseDuration(cacheTTLStr); err != nil {
+			return nil, fmt.Errorf("Bad 'cachettl' setting (%s): %v", cacheTTLStr, err)
+		}
 	}
-	client := conf.Client(oauth2.NoContext)
 
 	// Make URL call to get the available scaled volumes.
 	url := fmt.Sprintf("%s/volumes/%s", bmapsPrefix, volumeid)
@@ -332,12 +389,14 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	data := &Data{
 		Data: basedata,
 		Properties: Properties{
-			VolumeID:     volumeid,
-			JWT:          string(jwtdata),
-			TileSize:     DefaultTileSize,
-			GeomMap:      geomMap,
-			Scales:       m.Geoms,
-			HighResIndex: highResIndex,
+			VolumeID:      volumeid,
+			JWT:           string(jwtdata),
+			TileSize:      DefaultTileSize,
+			GeomMap:       geomMap,
+			Scales:        m.Geoms,
+			HighResIndex:  highResIndex,
+			CacheMaxBytes: cacheSize << 20,
+			CacheTTL:      cacheTTL,
 		},
 		client: client,
 	}
@@ -353,11 +412,10 @@ func (dtype *Type) Do(cmd datastore.Request, reply *datastore.Response) error {
 		if err != nil {
 			return fmt.Errorf("Cannot load JSON Web Token file (%s): %v", cmd.Argument(2), err)
 		}
-		conf, err := google.JWTConfigFromJSON(jwtdata, "https://www.googleapis.com/auth/brainmaps")
+		client, err := newClient(jwtdata)
 		if err != nil {
-			return fmt.Errorf("Cannot establish JWT Config file from Google: %v", err)
+			return err
 		}
-		client := conf.Client(oauth2.NoContext)
 
 		// Make the call.
 		url := fmt.Sprintf("%s/volumes", bmapsPrefix)
@@ -759,6 +817,13 @@ type Properties struct {
 	// HighResIndex is the geometry that is the highest resolution among the available scaled volumes.
 	HighResIndex GeometryIndex
 
+	// CacheMaxBytes is the size budget for data from Google cached in this instance's store.
+	// If zero, no data is cached.
+	CacheMaxBytes int64
+
+	// CacheTTL is the time after which cached data is refetched.  If zero, cached data never expires.
+	CacheTTL time.Duration
+
 	// OAuth2 configuration
 	oa2conf *oauth2.Config
 }
@@ -777,6 +842,8 @@ func (d *Data) CopyPropertiesFrom(src datastore.DataService, fs storage.FilterSp
 	d.GeomMap = d2.GeomMap
 	d.Scales = d2.Scales
 	d.HighResIndex = d2.HighResIndex
+	d.CacheMaxBytes = d2.CacheMaxBytes
+	d.CacheTTL = d2.CacheTTL
 	d.oa2conf = d2.oa2conf
 
 	return nil
@@ -804,14 +871,16 @@ func (p Properties) MarshalJSON() ([]byte, error) {
 		maxTileCoord = dvid.Point3d{maxX, maxY, maxZ}
 	}
 	return json.Marshal(struct {
-		VolumeID     string
-		MinTileCoord dvid.Point3d
-		MaxTileCoord dvid.Point3d
-		TileSize     int32
-		GeomMap      GeometryMap
-		Scales       Geometries
-		HighResIndex GeometryIndex
-		Levels       imagetile.TileSpec
+		VolumeID      string
+		MinTileCoord  dvid.Point3d
+		MaxTileCoord  dvid.Point3d
+		TileSize      int32
+		GeomMap       GeometryMap
+		Scales        Geometries
+		HighResIndex  GeometryIndex
+		CacheMaxBytes int64
+		CacheTTL      string
+		Levels        imagetile.TileSpec
 	}{
 		p.VolumeID,
 		minTileCoord,
@@ -820,6 +889,8 @@ func (p Properties) MarshalJSON() ([]byte, error) {
 		p.GeomMap,
 		p.Scales,
 		p.HighResIndex,
+		p.CacheMaxBytes,
+		p.CacheTTL.String(),
 		getGSpec(p.TileSize, p.Scales[p.HighResIndex], p.GeomMap),
 	})
 }
@@ -859,6 +930,9 @@ type Data struct {
 	Properties
 
 	client *http.Client // HTTP client that provides Authorization headers
+
+	cache   *proxy.Cache // read-through cache of data fetched from Google
+	cacheMu sync.Mutex
 }
 
 // Returns a potentially cached client that handles authorization to Google.
@@ -870,15 +944,50 @@ func (d *Data) GetClient() (*http.Client, error) {
 	if d.Properties.JWT == "" {
 		return nil, fmt.Errorf("No JSON Web Token has been set for this data")
 	}
-	conf, err := google.JWTConfigFromJSON([]byte(d.Properties.JWT), "https://www.googleapis.com/auth/brainmaps")
+	client, err := newClient([]byte(d.Properties.JWT))
 	if err != nil {
-		return nil, fmt.Errorf("Cannot establish JWT Config file from Google: %v", err)
+		return nil, err
 	}
-	client := conf.Client(oauth2.NoContext)
 	d.client = client
 	return client, nil
 }
 
+// getCache returns the cache of data fetched from Google, creating it if necessary.
+func (d *Data) getCache() *proxy.Cache {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	if d.cache == nil {
+		d.cache = proxy.NewCache(d, d.CacheTTL, d.CacheMaxBytes)
+	}
+	return d.cache
+}
+
+// getRemote returns the data for a BrainMaps API URL, using cached data if available.
+func (d *Data) getRemote(url string) ([]byte, error) {
+	return d.getCache().Fetch(url, func() ([]byte, error) {
+		timedLog := dvid.NewTimeLog()
+		client, err := d.GetClient()
+		if err != nil {
+			dvid.Errorf("Can't get OAuth2 connection to Google: %v\n", err)
+			return nil, err
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unexpected status code %d on request (%q, volume id %q)", resp.StatusCode, d.DataName(), d.VolumeID)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		timedLog.Infof("PROXY HTTP to Google: %s, returned %d bytes", url, len(data))
+		return data, nil
+	})
+}
+
 func (d *Data) GetVoxelSize(ts *GSpec) (dvid.NdFloat32, error) {
 	if d.Scales == nil || len(d.Scales) == 0 {
 		return nil, fmt.Errorf("%s has no geometries and therefore no volumes for access", d.DataName())
@@ -966,24 +1075,15 @@ func (d *Data) serveTile(w http.ResponseWriter, r *http.Request, geom *GoogleSub
 		return dvid.WriteImageHttp(w, img, formatStr)
 	}
 
-	// If we are within volume, get data from Google.
+	// If we are within volume, get data from Google or the cache.
 	url, err := geom.GetURL(d.VolumeID, formatStr)
 	if err != nil {
 		return err
 	}
-
-	timedLog := dvid.NewTimeLog()
-	client, err := d.GetClient()
-	if err != nil {
-		dvid.Errorf("Can't get OAuth2 connection to Google: %v\n", err)
-		return err
-	}
-	resp, err := client.Get(url)
+	data, err := d.getRemote(url)
 	if err != nil {
 		return err
 	}
-	timedLog.Infof("PROXY HTTP to Google: %s, returned response %d", url, resp.StatusCode)
-	defer resp.Body.Close()
 
 	// Set the image header
 	if err := dvid.SetImageHeader(w, formatStr); err != nil {
@@ -992,12 +1092,6 @@ func (d *Data) serveTile(w http.ResponseWriter, r *http.Request, geom *GoogleSub
 
 	// If it's on edge, we need to pad the tile to the tile size.
 	if geom.edge {
-		// We need to read whole thing in to pad it.
-		data, err := ioutil.ReadAll(resp.Body)
-		timedLog.Infof("Got edge tile from Google, %d bytes\n", len(data))
-		if err != nil {
-			return err
-		}
 		paddedData, err := geom.padData(data)
 		if err != nil {
 			return err
@@ -1005,35 +1099,8 @@ func (d *Data) serveTile(w http.ResponseWriter, r *http.Request, geom *GoogleSub
 		_, err = w.Write(paddedData)
 		return err
 	}
-
-	// If we aren't on edge or outside, our return status should be OK.
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code %d on tile request (%q, volume id %q)", resp.StatusCode, d.DataName(), d.VolumeID)
-	}
-
-	// Just send the data as we get it from Google in chunks.
-	respBytes := 0
-	const BufferSize = 32 * 1024
-	buf := make([]byte, BufferSize)
-	for {
-		n, err := resp.Body.Read(buf)
-		respBytes += n
-		eof := (err == io.EOF)
-		if err != nil && !eof {
-			return err
-		}
-		if _, err = w.Write(buf[:n]); err != nil {
-			return err
-		}
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
-		}
-		if eof {
-			break
-		}
-	}
-	timedLog.Infof("Got non-edge tile from Google, %d bytes\n", respBytes)
-	return nil
+	_, err = w.Write(data)
+	return err
 }
 
 func (d *Data) serveVolume(w http.ResponseWriter, r *http.Request, geom *GoogleSubvolGeom, noblanks bool, formatstr string) error {
@@ -1046,34 +1113,21 @@ func (d *Data) serveVolume(w http.ResponseWriter, r *http.Request, geom *GoogleS
 		return nil
 	}
 
-	// If we are within volume, get data from Google.
-	url, err := geom.GetURL(d.VolumeID, formatstr)
-	if err != nil {
-		return err
+	// If it's on edge, we need to pad the subvolume to the requested size.
+	if geom.edge {
+		return fmt.Errorf("Googlevoxels subvolume GET does not pad data on edge at this time")
 	}
 
-	timedLog := dvid.NewTimeLog()
-	client, err := d.GetClient()
+	// If we are within volume, get data from Google or the cache.
+	url, err := geom.GetURL(d.VolumeID, formatstr)
 	if err != nil {
-		dvid.Errorf("Can't get OAuth2 connection to Google: %v\n", err)
 		return err
 	}
-	resp, err := client.Get(url)
+	timedLog := dvid.NewTimeLog()
+	sdata, err := d.getRemote(url)
 	if err != nil {
 		return err
 	}
-	timedLog.Infof("PROXY HTTP to Google: %s, returned response %d", url, resp.StatusCode)
-	defer resp.Body.Close()
-
-	// If it's on edge, we need to pad the subvolume to the requested size.
-	if geom.edge {
-		return fmt.Errorf("Googlevoxels subvolume GET does not pad data on edge at this time")
-	}
-
-	// If we aren't on edge or outside, our return status should be OK.
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected status code %d on volume request (%q, volume id %q)", resp.StatusCode, d.DataName(), d.VolumeID)
-	}
 
 	w.Header().Set("Content-type", "application/octet-stream")
 
@@ -1083,11 +1137,6 @@ func (d *Data) serveVolume(w http.ResponseWriter, r *http.Request, geom *GoogleS
 	switch compression {
 	case "lz4":
 		// Decompress snappy
-		sdata, err := ioutil.ReadAll(resp.Body)
-		timedLog.Infof("Got snappy-encoded subvolume from Google, %d bytes\n", len(sdata))
-		if err != nil {
-			return err
-		}
 		data, err := snappy.Decode(nil, sdata)
 		if err != nil {
 			return err
@@ -1104,28 +1153,10 @@ func (d *Data) serveVolume(w http.ResponseWriter, r *http.Request, geom *GoogleS
 		timedLog.Infof("Sent lz4-encoded subvolume from DVID, %d bytes\n", outSize)
 
 	default: // "snappy"
-		// Just stream data from Google
-		respBytes := 0
-		const BufferSize = 32 * 1024
-		buf := make([]byte, BufferSize)
-		for {
-			n, err := resp.Body.Read(buf)
-			respBytes += n
-			eof := (err == io.EOF)
-			if err != nil && !eof {
-				return err
-			}
-			if _, err = w.Write(buf[:n]); err != nil {
-				return err
-			}
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
-			}
-			if eof {
-				break
-			}
+		if _, err := w.Write(sdata); err != nil {
+			return err
 		}
-		timedLog.Infof("Proxied encoded subvolume from Google, %d bytes\n", respBytes)
+		timedLog.Infof("Sent snappy-encoded subvolume from DVID, %d bytes\n", len(sdata))
 	}
 
 	return nil
@@ -1332,6 +1363,15 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		w.Header().Set("Content-Type", "application/json")
 		fmt.Fprintf(w, string(jsonBytes))
 
+	case "cache":
+		jsonBytes, err := json.Marshal(d.getCache().Stats())
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+
 	case "tile":
 		if err := d.handleTileReq(w, r, parts); err != nil {
 			server.BadRequest(w, r, err)
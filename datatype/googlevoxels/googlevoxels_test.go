@@ -0,0 +1,247 @@
+package googlevoxels
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/proxy"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+var (
+	gvtype datastore.TypeService
+	testMu sync.Mutex
+)
+
+// Sets package-level testRepo and TestVersionID
+func initTestRepo() (dvid.UUID, dvid.VersionID) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	if gvtype == nil {
+		var err error
+		gvtype, err = datastore.TypeServiceByName(TypeName)
+		if err != nil {
+			log.Fatalf("Can't get googlevoxels type: %s\n", err)
+		}
+	}
+	return datastore.NewTestRepo()
+}
+
+const testVolumeJSON = `{
+	"geometry": [
+		{
+			"volumeSize": {"x": "256", "y": "256", "z": "64"},
+			"channelCount": "1",
+			"channelType": "UINT8",
+			"pixelSize": {"x": 8, "y": 8, "z": 8}
+		}
+	]
+}`
+
+// mockBrainMaps is a local stand-in for the Google BrainMaps API that counts requests
+// for binary data.
+type mockBrainMaps struct {
+	sync.Mutex
+	fetches map[string]int
+}
+
+func (m *mockBrainMaps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/volumes/testvol":
+		fmt.Fprint(w, testVolumeJSON)
+	case strings.HasPrefix(r.URL.Path, "/volumes/testvol/binary/"):
+		m.Lock()
+		m.fetches[r.URL.Path]++
+		m.Unlock()
+		fmt.Fprintf(w, "data for %s", r.URL.Path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *mockBrainMaps) numFetches() int {
+	m.Lock()
+	defer m.Unlock()
+	var total int
+	for _, n := range m.fetches {
+		total += n
+	}
+	return total
+}
+
+// startMockBrainMaps redirects BrainMaps API requests to a local stand-in server until the
+// returned function is called.
+func startMockBrainMaps(t *testing.T) (*mockBrainMaps, string, func()) {
+	mock := &mockBrainMaps{fetches: make(map[string]int)}
+	ts := httptest.NewServer(mock)
+	oldPrefix, oldClient := bmapsPrefix, newClient
+	bmapsPrefix = ts.URL
+	newClient = func(jwtdata []byte) (*http.Client, error) {
+		return http.DefaultClient, nil
+	}
+
+	f, err := ioutil.TempFile("", "googlevoxels-jwt")
+	if err != nil {
+		t.Fatalf("can't create JWT file: %v\n", err)
+	}
+	f.Close()
+	return mock, f.Name(), func() {
+		bmapsPrefix, newClient = oldPrefix, oldClient
+		ts.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func newTestData(t *testing.T, uuid dvid.UUID, name dvid.InstanceName, jwtfile string, settings map[string]string) *Data {
+	config := dvid.NewConfig()
+	config.Set("volumeid", "testvol")
+	config.Set("jwtfile", jwtfile)
+	for key, value := range settings {
+		config.Set(key, value)
+	}
+	dataservice, err := datastore.NewData(uuid, gvtype, name, config)
+	if err != nil {
+		t.Fatalf("Error creating googlevoxels instance: %v\n", err)
+	}
+	d, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Returned new data instance is not googlevoxels.Data\n")
+	}
+	return d
+}
+
+func getCacheStats(t *testing.T, uuid dvid.UUID, name dvid.InstanceName) proxy.Stats {
+	apiStr := fmt.Sprintf("%snode/%s/%s/cache", server.WebAPIPath, uuid, name)
+	var stats proxy.Stats
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &stats); err != nil {
+		t.Fatalf("Couldn't decode cache stats: %v\n", err)
+	}
+	return stats
+}
+
+func TestCachedTiles(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	mock, jwtfile, stop := startMockBrainMaps(t)
+	defer stop()
+
+	uuid, _ := initTestRepo()
+	d := newTestData(t, uuid, "grayscale", jwtfile, nil)
+	if d.CacheMaxBytes != DefaultCacheSize<<20 || d.CacheTTL != 0 {
+		t.Errorf("Bad default cache settings: %d bytes, ttl %s\n", d.CacheMaxBytes, d.CacheTTL)
+	}
+
+	tileReq := fmt.Sprintf("%snode/%s/grayscale/tile/xy/0/1_2_3?tilesize=64", server.WebAPIPath, uuid)
+	first := server.TestHTTP(t, "GET", tileReq, nil)
+	second := server.TestHTTP(t, "GET", tileReq, nil)
+	if string(first) != string(second) || !strings.Contains(string(first), "corner=64,128,3") {
+		t.Errorf("Bad tile data, first %q, then %q\n", first, second)
+	}
+	if n := mock.numFetches(); n != 1 {
+		t.Errorf("Expected 1 fetch from remote service after cached tile GET, got %d\n", n)
+	}
+
+	rawReq := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/32_32_32/0_0_0", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", rawReq, nil)
+	server.TestHTTP(t, "GET", rawReq, nil)
+	if n := mock.numFetches(); n != 2 {
+		t.Errorf("Expected 2 fetches from remote service after cached subvolume GET, got %d\n", n)
+	}
+
+	stats := getCacheStats(t, uuid, "grayscale")
+	if stats.Entries != 2 || stats.Hits != 2 || stats.Misses != 2 || stats.Bytes == 0 {
+		t.Errorf("Bad cache stats after GETs: %v\n", stats)
+	}
+
+	// Requests outside the volume should not be fetched or cached.
+	outsideReq := fmt.Sprintf("%snode/%s/grayscale/tile/xy/0/10_10_3?tilesize=64&noblanks=true", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", outsideReq, nil)
+	if n := mock.numFetches(); n != 2 {
+		t.Errorf("Expected no fetch for tile outside volume, got %d total fetches\n", n)
+	}
+
+	// A cache that is reloaded from the store, e.g., after restart, should still have the data.
+	d.cacheMu.Lock()
+	d.cache = nil
+	d.cacheMu.Unlock()
+	server.TestHTTP(t, "GET", tileReq, nil)
+	if n := mock.numFetches(); n != 2 {
+		t.Errorf("Expected no fetch after reloading cache, got %d total fetches\n", n)
+	}
+	if stats = getCacheStats(t, uuid, "grayscale"); stats.Entries != 2 || stats.Hits != 1 {
+		t.Errorf("Bad cache stats after reload: %v\n", stats)
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	mock, jwtfile, stop := startMockBrainMaps(t)
+	defer stop()
+
+	uuid, _ := initTestRepo()
+
+	// Use a budget that only holds a single tile.
+	d := newTestData(t, uuid, "small", jwtfile, nil)
+	d.CacheMaxBytes = 150
+	tile1 := fmt.Sprintf("%snode/%s/small/tile/xy/0/0_0_3?tilesize=64", server.WebAPIPath, uuid)
+	tile2 := fmt.Sprintf("%snode/%s/small/tile/xy/0/1_0_3?tilesize=64", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", tile1, nil)
+	server.TestHTTP(t, "GET", tile2, nil)
+	server.TestHTTP(t, "GET", tile2, nil)
+	server.TestHTTP(t, "GET", tile1, nil)
+	if n := mock.numFetches(); n != 3 {
+		t.Errorf("Expected 3 fetches after eviction of least recently used tile, got %d\n", n)
+	}
+	if stats := getCacheStats(t, uuid, "small"); stats.Entries != 1 || stats.Bytes > 150 {
+		t.Errorf("Cache exceeded budget: %v\n", stats)
+	}
+
+	// Cached tiles should be refetched after they expire.
+	newTestData(t, uuid, "expiring", jwtfile, map[string]string{"cachettl": "100ms"})
+	tile := fmt.Sprintf("%snode/%s/expiring/tile/xz/0/0_5_0?tilesize=64", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", tile, nil)
+	server.TestHTTP(t, "GET", tile, nil)
+	if n := mock.numFetches(); n != 4 {
+		t.Errorf("Expected 4 fetches before expiration, got %d\n", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	server.TestHTTP(t, "GET", tile, nil)
+	if n := mock.numFetches(); n != 5 {
+		t.Errorf("Expected 5 fetches after expiration, got %d\n", n)
+	}
+
+	// Caching can be turned off.
+	newTestData(t, uuid, "uncached", jwtfile, map[string]string{"cachesize": "0"})
+	tile = fmt.Sprintf("%snode/%s/uncached/tile/yz/0/0_0_0?tilesize=64", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", tile, nil)
+	server.TestHTTP(t, "GET", tile, nil)
+	if n := mock.numFetches(); n != 7 {
+		t.Errorf("Expected 7 fetches with caching disabled, got %d\n", n)
+	}
+
+	config := dvid.NewConfig()
+	config.Set("volumeid", "testvol")
+	config.Set("jwtfile", jwtfile)
+	config.Set("cachettl", "forever")
+	if _, err := datastore.NewData(uuid, gvtype, "badttl", config); err == nil {
+		t.Errorf("Expected error creating googlevoxels with bad cachettl setting\n")
+	}
+}
@@ -1,6 +1,7 @@
 package imageblk
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"strconv"
@@ -63,15 +64,35 @@ func (d *Data) NewArbSlice(topLeft, topRight, bottomLeft dvid.Vector3d, res floa
 	incrX := topRight.Subtract(topLeft).DivideScalar(nxFloat)
 	incrY := bottomLeft.Subtract(topLeft).DivideScalar(nyFloat)
 	size := dvid.Point2d{int32(nxFloat) + 1, int32(nyFloat) + 1}
-	bytesPerVoxel := d.Properties.Values.BytesPerElement()
-	arb := &ArbSlice{topLeft, topRight, bottomLeft, res, size, incrX, incrY, bytesPerVoxel, nil}
+	return d.newArbSlice(&ArbSlice{topLeft, topRight, bottomLeft, res, size, incrX, incrY, 0, nil})
+}
 
-	// Allocate the image buffer
-	numVoxels := size[0] * size[1]
+// NewArbSliceOfSize returns an image with arbitrary 3D orientation and the given size in
+// pixels, where the corner pixels are at the given 3d points in real world space.
+func (d *Data) NewArbSliceOfSize(topLeft, topRight, bottomLeft dvid.Vector3d, size dvid.Point2d) (*ArbSlice, error) {
+	if size[0] < 1 || size[1] < 1 {
+		return nil, fmt.Errorf("Bad arbitrary image size requested: %s", size)
+	}
+	var res float64
+	var incrX, incrY dvid.Vector3d
+	if size[0] > 1 {
+		incrX = topRight.Subtract(topLeft).DivideScalar(float64(size[0] - 1))
+		res = topRight.Distance(topLeft) / float64(size[0]-1)
+	}
+	if size[1] > 1 {
+		incrY = bottomLeft.Subtract(topLeft).DivideScalar(float64(size[1] - 1))
+	}
+	return d.newArbSlice(&ArbSlice{topLeft, topRight, bottomLeft, res, size, incrX, incrY, 0, nil})
+}
+
+// newArbSlice allocates the image buffer for an arbitrary slice with computed geometry.
+func (d *Data) newArbSlice(arb *ArbSlice) (*ArbSlice, error) {
+	arb.bytesPerVoxel = d.Properties.Values.BytesPerElement()
+	numVoxels := arb.size[0] * arb.size[1]
 	if numVoxels <= 0 {
 		return nil, fmt.Errorf("Bad arbitrary image size requested: %s", arb)
 	}
-	requestSize := int64(bytesPerVoxel) * int64(numVoxels)
+	requestSize := int64(arb.bytesPerVoxel) * int64(numVoxels)
 	if requestSize > server.MaxDataRequest {
 		return nil, fmt.Errorf("Requested payload (%d bytes) exceeds this DVID server's set limit (%d)",
 			requestSize, server.MaxDataRequest)
@@ -80,20 +101,83 @@ func (d *Data) NewArbSlice(topLeft, topRight, bottomLeft dvid.Vector3d, res floa
 	return arb, nil
 }
 
+// Size returns the size in pixels of the arbitrary slice.
+func (s ArbSlice) Size() dvid.Point2d {
+	return s.size
+}
+
+// Bytes returns the image buffer of the arbitrary slice.
+func (s ArbSlice) Bytes() []byte {
+	return s.data
+}
+
 func (s ArbSlice) String() string {
 	return fmt.Sprintf("Arbitrary %d x %d image: top left %q, top right %q, bottom left %q, res %f",
 		s.size[0], s.size[1], s.topLeft, s.topRight, s.bottomLeft, s.res)
 }
 
-func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resStr string) (*dvid.Image, error) {
+// GetArbitraryImage returns an image with arbitrary 3D orientation given string parameters
+// for the corner points and resolution.  If a size is given in the options, it is used
+// instead of the resolution to set the image size.
+func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resStr string, opts ArbOptions) (*dvid.Image, error) {
+	dtype, err := d.Properties.Values.ValueDataType()
+	if err != nil {
+		return nil, err
+	}
+	if dtype != dvid.T_uint8 && dtype != dvid.T_uint16 {
+		return nil, fmt.Errorf("DVID cannot retrieve images with arbitrary orientation for data %q: only uint8 and uint16 values are supported", d.DataName())
+	}
+	interp := opts.Interp
+	if interp == InterpDefault {
+		if d.Interpolable {
+			interp = InterpTrilinear
+		} else {
+			interp = InterpNearest
+		}
+	}
+
 	// Setup the image buffer
-	arb, err := d.NewArbSliceFromStrings(tlStr, trStr, blStr, resStr, "_")
+	var arb *ArbSlice
+	if opts.Size[0] != 0 || opts.Size[1] != 0 {
+		var topLeft, topRight, bottomLeft dvid.Vector3d
+		if topLeft, err = dvid.StringToVector3d(tlStr, "_"); err != nil {
+			return nil, err
+		}
+		if topRight, err = dvid.StringToVector3d(trStr, "_"); err != nil {
+			return nil, err
+		}
+		if bottomLeft, err = dvid.StringToVector3d(blStr, "_"); err != nil {
+			return nil, err
+		}
+		arb, err = d.NewArbSliceOfSize(topLeft, topRight, bottomLeft, opts.Size)
+	} else {
+		arb, err = d.NewArbSliceFromStrings(tlStr, trStr, blStr, resStr, "_")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Iterate across arbitrary image using res increments, retrieving trilinear interpolation
-	// at each point.
+	db, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	emptyBlock := d.BackgroundBlock()
+	populateF := func(key []byte) ([]byte, error) {
+		serializedData, err := db.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(serializedData) == 0 {
+			return emptyBlock, nil
+		}
+		deserializedData, _, err := dvid.DeserializeData(serializedData, true)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to deserialize block: %v", err)
+		}
+		return deserializedData, nil
+	}
+
+	// Iterate across arbitrary image using res increments, resampling at each point.
 	cache := NewValueCache(100)
 	keyF := func(pt dvid.Point3d) []byte {
 		chunkPt := pt.Chunk(d.BlockSize()).(dvid.ChunkPoint3d)
@@ -101,7 +185,6 @@ func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resSt
 		return NewTKey(&idx)
 	}
 
-	// TODO: Add concurrency.
 	leftPt := arb.topLeft
 	var i int32
 	var wg sync.WaitGroup
@@ -114,7 +197,7 @@ func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resSt
 				wg.Done()
 			}()
 			for x := int32(0); x < arb.size[0]; x++ {
-				value, err := d.computeValue(curPt, ctx, KeyFunc(keyF), cache)
+				value, err := d.computeValue(curPt, interp, KeyFunc(keyF), PopulateFunc(populateF), cache)
 				if err != nil {
 					dvid.Errorf("Error in concurrent arbitrary image calc: %v", err)
 					return
@@ -133,66 +216,165 @@ func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resSt
 	return dvid.ImageFromData(arb.size[0], arb.size[1], arb.data, d.Properties.Values, d.Properties.Interpolable)
 }
 
-type neighbors struct {
-	xd, yd, zd float64
-	coords     [8]dvid.Point3d
-	values     []byte
+// BlockBytesFunc returns the uncompressed voxel data of a block given its block coordinate.
+// An empty slice is returned for blocks that have not been stored.
+type BlockBytesFunc func(dvid.ChunkPoint3d) ([]byte, error)
+
+// GetArbitraryNearest fills the arbitrary slice using nearest-neighbor sampling of voxels
+// with the given voxel size, e.g., the voxel size of a lower-resolution scale.  Blocks
+// of voxel data are retrieved with the passed function, which lets data types with their
+// own block encodings, like labels, reuse the slicing.
+func (d *Data) GetArbitraryNearest(arb *ArbSlice, voxelSize dvid.NdFloat32, f BlockBytesFunc) error {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("Data %q does not have a 3d block size", d.DataName())
+	}
+	if len(voxelSize) != 3 {
+		return fmt.Errorf("Data %q does not have a 3d voxel size", d.DataName())
+	}
+	nx := blockSize[0]
+	nxy := nx * blockSize[1]
+	bytesPerVoxel := arb.bytesPerVoxel
+
+	cache := NewValueCache(100)
+	populateF := func(key []byte) ([]byte, error) {
+		bcoord, err := dvid.IZYXString(key).ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		return f(bcoord)
+	}
+
+	var errMu sync.Mutex
+	var firstErr error
+	leftPt := arb.topLeft
+	var i int32
+	var wg sync.WaitGroup
+	for y := int32(0); y < arb.size[1]; y++ {
+		<-server.HandlerToken
+		wg.Add(1)
+		go func(curPt dvid.Vector3d, dstI int32) {
+			defer func() {
+				server.HandlerToken <- 1
+				wg.Done()
+			}()
+			for x := int32(0); x < arb.size[0]; x++ {
+				var voxelCoord dvid.Point3d
+				for dim := 0; dim < 3; dim++ {
+					v := curPt[dim] / float64(voxelSize[dim])
+					c := math.Floor(v)
+					if v-c > 0.5 {
+						c++
+					}
+					voxelCoord[dim] = int32(c)
+				}
+				izyx := voxelCoord.ToBlockIZYXString(blockSize)
+				blockData, _, err := cache.Get([]byte(izyx), populateF)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					return
+				}
+				if len(blockData) != 0 {
+					blockPt := voxelCoord.Point3dInChunk(blockSize)
+					blockI := (blockPt[2]*nxy + blockPt[1]*nx + blockPt[0]) * bytesPerVoxel
+					copy(arb.data[dstI:dstI+bytesPerVoxel], blockData[blockI:blockI+bytesPerVoxel])
+				}
+				curPt.Increment(arb.incrX)
+				dstI += bytesPerVoxel
+			}
+		}(leftPt, i)
+		leftPt.Increment(arb.incrY)
+		i += arb.size[0] * bytesPerVoxel
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// ArbInterpolation is the method used to resample voxels for an arbitrary slice.
+type ArbInterpolation uint8
+
+const (
+	// InterpDefault uses trilinear interpolation for interpolable data and nearest
+	// neighbor otherwise.
+	InterpDefault ArbInterpolation = iota
+	InterpNearest
+	InterpTrilinear
+	InterpCubic
+)
+
+// ParseArbInterpolation returns the interpolation given by a string, which can be
+// "nearest", "linear" or "trilinear", and "cubic" or "tricubic".  An empty string
+// returns InterpDefault.
+func ParseArbInterpolation(s string) (ArbInterpolation, error) {
+	switch s {
+	case "":
+		return InterpDefault, nil
+	case "nearest":
+		return InterpNearest, nil
+	case "linear", "trilinear":
+		return InterpTrilinear, nil
+	case "cubic", "tricubic":
+		return InterpCubic, nil
+	default:
+		return InterpDefault, fmt.Errorf("unknown interpolation %q: must be nearest, linear or cubic", s)
+	}
+}
+
+func (interp ArbInterpolation) String() string {
+	switch interp {
+	case InterpNearest:
+		return "nearest"
+	case InterpTrilinear:
+		return "trilinear"
+	case InterpCubic:
+		return "cubic"
+	default:
+		return "default"
+	}
 }
 
-func (d *Data) neighborhood(pt dvid.Vector3d) neighbors {
-	res32 := d.Properties.Resolution
-	res := dvid.Vector3d{float64(res32.VoxelSize[0]), float64(res32.VoxelSize[1]), float64(res32.VoxelSize[2])}
-
-	// Calculate voxel lattice points
-	voxelCoord := dvid.Vector3d{pt[0] / res[0], pt[1] / res[1], pt[2] / res[2]}
-
-	x0 := math.Floor(voxelCoord[0])
-	x1 := math.Ceil(voxelCoord[0])
-	y0 := math.Floor(voxelCoord[1])
-	y1 := math.Ceil(voxelCoord[1])
-	z0 := math.Floor(voxelCoord[2])
-	z1 := math.Ceil(voxelCoord[2])
-
-	ix0 := int32(x0)
-	ix1 := int32(x1)
-	iy0 := int32(y0)
-	iy1 := int32(y1)
-	iz0 := int32(z0)
-	iz1 := int32(z1)
-
-	// Calculate real-world lattice points in given resolution
-	rx0 := x0 * res[0]
-	rx1 := x1 * res[0]
-	ry0 := y0 * res[1]
-	ry1 := y1 * res[1]
-	rz0 := z0 * res[2]
-	rz1 := z1 * res[2]
-
-	var n neighbors
-	if ix0 != ix1 {
-		n.xd = (pt[0] - rx0) / (rx1 - rx0)
-	}
-	if iy0 != iy1 {
-		n.yd = (pt[1] - ry0) / (ry1 - ry0)
-	}
-	if iz0 != iz1 {
-		n.zd = (pt[2] - rz0) / (rz1 - rz0)
-	}
-
-	n.coords[0] = dvid.Point3d{ix0, iy0, iz0}
-	n.coords[1] = dvid.Point3d{ix1, iy0, iz0}
-	n.coords[2] = dvid.Point3d{ix0, iy1, iz0}
-	n.coords[3] = dvid.Point3d{ix1, iy1, iz0}
-	n.coords[4] = dvid.Point3d{ix0, iy0, iz1}
-	n.coords[5] = dvid.Point3d{ix1, iy0, iz1}
-	n.coords[6] = dvid.Point3d{ix0, iy1, iz1}
-	n.coords[7] = dvid.Point3d{ix1, iy1, iz1}
-
-	// Allocate the values slice buffer based on bytes/voxel.
-	bufSize := 8 * d.Properties.Values.BytesPerElement()
-	n.values = make([]byte, bufSize, bufSize)
-
-	return n
+// ArbOptions are optional settings for retrieving an arbitrary slice.
+type ArbOptions struct {
+	// If set, the size in pixels of the returned image, which overrides the size computed
+	// from the resolution.
+	Size dvid.Point2d
+
+	Interp ArbInterpolation
+}
+
+// latticeWeights returns the first lattice coordinate and the weights of consecutive lattice
+// points used to resample at the given coordinate in voxel space.
+func latticeWeights(v float64, interp ArbInterpolation) (int32, []float64) {
+	c := math.Floor(v)
+	t := v - c
+	switch interp {
+	case InterpTrilinear:
+		return int32(c), []float64{1 - t, t}
+	case InterpCubic:
+		return int32(c) - 1, cubicWeights(t)
+	default:
+		if t > 0.5 {
+			c++
+		}
+		return int32(c), []float64{1}
+	}
+}
+
+// cubicWeights returns the weights of 4 consecutive lattice points for a point that is a
+// fraction t from the second to the third point using the Catmull-Rom cubic kernel.
+func cubicWeights(t float64) []float64 {
+	t2 := t * t
+	t3 := t2 * t
+	return []float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
 }
 
 type KeyFunc func(dvid.Point3d) []byte
@@ -258,13 +440,10 @@ func (vc *ValueCache) Clear() {
 	vc.Unlock()
 }
 
-// Calculates value of a 3d real world point in space defined by underlying data resolution.
-func (d *Data) computeValue(pt dvid.Vector3d, ctx storage.Context, keyF KeyFunc, cache *ValueCache) ([]byte, error) {
-	db, err := datastore.GetOrderedKeyValueDB(d)
-	if err != nil {
-		return nil, err
-	}
-
+// Calculates value of a 3d real world point in space defined by underlying data resolution
+// by resampling the surrounding voxels.  Only unsigned 8 and 16-bit values, with any number
+// of channels, are supported.
+func (d *Data) computeValue(pt dvid.Vector3d, interp ArbInterpolation, keyF KeyFunc, populateF PopulateFunc, cache *ValueCache) ([]byte, error) {
 	valuesPerElement := d.Properties.Values.ValuesPerElement()
 	bytesPerValue, err := d.Properties.Values.BytesPerValue()
 	if err != nil {
@@ -272,140 +451,59 @@ func (d *Data) computeValue(pt dvid.Vector3d, ctx storage.Context, keyF KeyFunc,
 	}
 	bytesPerVoxel := valuesPerElement * bytesPerValue
 
-	// Allocate an empty block.
 	blockSize, ok := d.BlockSize().(dvid.Point3d)
 	if !ok {
 		return nil, fmt.Errorf("Data %q does not have a 3d block size", d.DataName())
 	}
 	nx := blockSize[0]
 	nxy := nx * blockSize[1]
-	emptyBlock := d.BackgroundBlock()
 
-	populateF := func(key []byte) ([]byte, error) {
-		serializedData, err := db.Get(ctx, key)
-		if err != nil {
-			return nil, err
-		}
-		var deserializedData []byte
-		if serializedData == nil || len(serializedData) == 0 {
-			deserializedData = emptyBlock
-		} else {
-			deserializedData, _, err = dvid.DeserializeData(serializedData, true)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to deserialize block: %v", err)
-			}
-		}
-		return deserializedData, nil
-	}
-
-	// For the given point, compute surrounding lattice points and retrieve values.
-	neighbors := d.neighborhood(pt)
-	var valuesI int32
-	for _, voxelCoord := range neighbors.coords {
-		deserializedData, _, err := cache.Get(keyF(voxelCoord), populateF)
-		if err != nil {
-			return nil, err
-		}
-		blockPt := voxelCoord.PointInChunk(blockSize).(dvid.Point3d)
-		blockI := blockPt[2]*nxy + blockPt[1]*nx + blockPt[0]
-		//fmt.Printf("Block %s (%d) len %d -> Neighbor %s (buffer %d, len %d)\n",
-		//	blockPt, blockI, len(blockData), voxelCoord, valuesI, len(neighbors.values))
-		copy(neighbors.values[valuesI:valuesI+bytesPerVoxel], deserializedData[blockI:blockI+bytesPerVoxel])
-		valuesI += bytesPerVoxel
-	}
-
-	// Perform trilinear interpolation on the underlying data values.
-	unsupported := func() error {
-		return fmt.Errorf("DVID cannot retrieve images with arbitrary orientation using %d channels and %d bytes/channel",
-			valuesPerElement, bytesPerValue)
-	}
-	var value []byte
-	switch valuesPerElement {
-	case 1:
-		switch bytesPerValue {
-		case 1:
-			if d.Interpolable {
-				interpValue := trilinearInterpUint8(neighbors.xd, neighbors.yd, neighbors.zd, []uint8(neighbors.values))
-				value = []byte{byte(interpValue)}
-			} else {
-				value = []byte{nearestNeighborUint8(neighbors.xd, neighbors.yd, neighbors.zd, []uint8(neighbors.values))}
-			}
-		case 2:
-			fallthrough
-		case 4:
-			fallthrough
-		case 8:
-			fallthrough
-		default:
-			return nil, unsupported()
-		}
-	case 4:
-		switch bytesPerValue {
-		case 1:
-			value = make([]byte, 4, 4)
-			for c := 0; c < 4; c++ {
-				channelValues := make([]uint8, 8, 8)
-				for i := 0; i < 8; i++ {
-					channelValues[i] = uint8(neighbors.values[i*4+c])
+	// For the given point, compute surrounding lattice points and their weights.
+	res := d.Properties.Resolution.VoxelSize
+	x0, wx := latticeWeights(pt[0]/float64(res[0]), interp)
+	y0, wy := latticeWeights(pt[1]/float64(res[1]), interp)
+	z0, wz := latticeWeights(pt[2]/float64(res[2]), interp)
+
+	sums := make([]float64, valuesPerElement)
+	for k, weightZ := range wz {
+		for j, weightY := range wy {
+			for i, weightX := range wx {
+				w := weightZ * weightY * weightX
+				if w == 0 {
+					continue
 				}
-				if d.Interpolable {
-					interpValue := trilinearInterpUint8(neighbors.xd, neighbors.yd, neighbors.zd, channelValues)
-					value[c] = byte(interpValue)
-				} else {
-					value[c] = byte(nearestNeighborUint8(neighbors.xd, neighbors.yd, neighbors.zd, channelValues))
+				voxelCoord := dvid.Point3d{x0 + int32(i), y0 + int32(j), z0 + int32(k)}
+				blockData, _, err := cache.Get(keyF(voxelCoord), populateF)
+				if err != nil {
+					return nil, err
+				}
+				blockPt := voxelCoord.PointInChunk(blockSize).(dvid.Point3d)
+				blockI := (blockPt[2]*nxy + blockPt[1]*nx + blockPt[0]) * bytesPerVoxel
+				for c := range sums {
+					valueI := blockI + int32(c)*bytesPerValue
+					if bytesPerValue == 1 {
+						sums[c] += w * float64(blockData[valueI])
+					} else {
+						sums[c] += w * float64(binary.LittleEndian.Uint16(blockData[valueI:valueI+2]))
+					}
 				}
 			}
-		case 2:
-			fallthrough
-		default:
-			return nil, unsupported()
 		}
-	default:
 	}
 
-	return value, nil
-}
-
-// Returns value of nearest neighbor to point.
-func nearestNeighborUint8(xd, yd, zd float64, values []uint8) uint8 {
-	var x, y, z int
-	if xd > 0.5 {
-		x = 1
+	// Round and clamp the resampled values since cubic interpolation can overshoot.
+	maxValue := float64(math.MaxUint8)
+	if bytesPerValue == 2 {
+		maxValue = math.MaxUint16
 	}
-	if yd > 0.5 {
-		y = 1
-	}
-	if zd > 0.5 {
-		z = 1
+	value := make([]byte, bytesPerVoxel)
+	for c, sum := range sums {
+		v := math.Min(math.Max(math.Floor(sum+0.5), 0), maxValue)
+		if bytesPerValue == 1 {
+			value[c] = uint8(v)
+		} else {
+			binary.LittleEndian.PutUint16(value[c*2:c*2+2], uint16(v))
+		}
 	}
-	return values[z*4+y*2+x]
-}
-
-// Returns the trilinear interpolation of a point 'pt' where 'pt0' is the lattice point below and
-// 'pt1' is the lattice point above.  The values c000...c111 are at lattice points surrounding
-// the interpolated point.  This can be used for interpolation of anisotropic space.  Formulation
-// follows Wikipedia trilinear interpolation page although direction of y axes is flipped, which
-// shouldn't matter for formulae.
-func trilinearInterpUint8(xd, yd, zd float64, values []uint8) uint8 {
-	c000 := float64(values[0])
-	c100 := float64(values[1])
-	c010 := float64(values[2])
-	c110 := float64(values[3])
-	c001 := float64(values[4])
-	c101 := float64(values[5])
-	c011 := float64(values[6])
-	c111 := float64(values[7])
-	c00 := c000*(1.0-xd) + c100*xd
-	c10 := c010*(1.0-xd) + c110*xd
-	c01 := c001*(1.0-xd) + c101*xd
-	c11 := c011*(1.0-xd) + c111*xd
-
-	c0 := c00*(1.0-yd) + c10*yd
-	c1 := c01*(1.0-yd) + c11*yd
-
-	c := math.Floor(c0*(1-zd) + c1*zd + 0.5)
-	if c > 255 {
-		return 255
-	}
-	return uint8(c)
+	return value, nil
 }
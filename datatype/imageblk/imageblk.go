@@ -68,18 +68,22 @@ $ dvid repo <UUID> new imageblk <data name> <settings...>
 $ dvid node <UUID> <data name> load <offset> <image glob>
 
     Initializes version node to a set of XY images described by glob of filenames.  The
-    DVID server must have access to the named files.  Currently, XY images are required.
+    DVID server must have access to the named files.  Instead of XY images, the glob
+    can match volumetric files: multi-page TIFF stacks or local N5 or Zarr dataset
+    directories with raw or gzip compression.  Multiple volumes are stacked along Z
+    in the order given.
 
     Example: 
 
     $ dvid node 3f8c mygrayscale load 0,0,100 data/*.png
+    $ dvid node 3f8c mygrayscale load 0,0,0 data/em.n5/s0
 
     Arguments:
 
     UUID          Hexidecimal string with enough characters to uniquely identify a version node.
     data name     Name of data to add.
     offset        3d coordinate in the format "x,y,z".  Gives coordinate of top upper left voxel.
-    image glob    Filenames of images, e.g., foo-xy-*.png
+    image glob    Filenames of images, e.g., foo-xy-*.png, or volumes, e.g., stack.tif or bar.zarr
 
 $ dvid node <UUID> <data name> put local  <plane> <offset> <image glob>
 $ dvid node <UUID> <data name> put remote <plane> <offset> <image glob>
@@ -209,6 +213,16 @@ GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format
 
     Query-string Options:
 
+    window        2d images only.  Width of the value range, centered at "level", that is linearly
+                    mapped to the full output range, e.g., "window=100&level=128".
+    level         2d images only.  Center of the window.
+    gamma         2d images only.  Gamma applied after any window, where each value v normalized to
+                    [0,1] becomes v^(1/gamma).
+    clahe         2d images only.  Applies contrast-limited adaptive histogram equalization after
+                    any window and gamma using square regions of the given width in voxels.  Regions
+                    are aligned to the data origin so adjacent images are consistent at their borders.
+                    The width can be at most 1024.
+    cliplimit     Limits CLAHE contrast as a multiple of the mean histogram count (default 2).
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
@@ -368,6 +382,16 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
     attenuation   For attenuation n, this reduces the intensity of voxels outside ROI by 2^n.
                   Valid range is n = 1 to n = 7.  Currently only implemented for 8-bit voxels.
                   Default is to zero out voxels outside ROI.
+    window        2d images only.  Width of the value range, centered at "level", that is linearly
+                    mapped to the full output range, e.g., "window=100&level=128".
+    level         2d images only.  Center of the window.
+    gamma         2d images only.  Gamma applied after any window, where each value v normalized to
+                    [0,1] becomes v^(1/gamma).
+    clahe         2d images only.  Applies contrast-limited adaptive histogram equalization after
+                    any window and gamma using square regions of the given width in voxels.  Regions
+                    are aligned to the data origin so adjacent images are consistent at their borders.
+                    The width can be at most 1024.
+    cliplimit     Limits CLAHE contrast as a multiple of the mean histogram count (default 2).
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
@@ -424,15 +448,106 @@ GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/
     top right     Real world coordinate of top right pixel.
     bottom left   Real world coordinate of bottom left pixel.
     res           The resolution/pixel that is used to calculate the returned image size in pixels.
+                    Ignored if the "size" query string is given.
     format        "png", "jpg" (default: "png")  
                     jpg allows lossy quality setting, e.g., "jpg:80"
 
     Query-string Options:
 
+    size          Size of the returned image in pixels in "<width>_<height>" format, e.g., "512_256",
+                    where the corner pixels are at the given top left, top right, and bottom left.
+    interp        Resampling of voxels: "nearest", "linear" (trilinear), or "cubic" (tricubic
+                    Catmull-Rom).  Default is "linear" for interpolable data and "nearest" otherwise.
+                    Only uint8 and uint16 data with any number of channels, e.g., rgba8, is supported.
+    window        Width of the value range, centered at "level", that is linearly mapped to the full
+                    output range.  Only available for single-channel data, as are the options below.
+    level         Center of the window.
+    gamma         Gamma applied after any window, where each value v normalized to [0,1] becomes
+                    v^(1/gamma).
+    clahe         Applies contrast-limited adaptive histogram equalization after any window and
+                    gamma using square regions of the given width in pixels of the returned image.
+                    The width can be at most 1024.
+    cliplimit     Limits CLAHE contrast as a multiple of the mean histogram count (default 2).
     throttle      If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
 
+GET  <api URL>/node/<UUID>/<data name>/histogram[/<size>/<offset>][?queryopts]
+GET  <api URL>/node/<UUID>/<data name>/stats[/<size>/<offset>][?queryopts]
+
+    Returns JSON with a histogram or summary statistics of voxel values within a region given
+    by a subvolume, an ROI, and/or a label in synced label data.  If more than one is given,
+    only voxels within all of them are used.  Blocks are read one at a time so large regions
+    can be handled.  Blocks that have never been stored are skipped, so their voxels are not
+    counted, e.g., as background zeros.  Only single-channel data is supported.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/grayscale/stats/512_512_256/0_0_100?roi=medulla
+
+    Returns JSON for the statistics:
+
+    {
+        "Voxels": 34081938,
+        "Min": 3,
+        "Max": 251,
+        "Mean": 132.71,
+        "StdDev": 28.04
+    }
+
+    The histogram endpoint returns the following JSON, where "Counts" has the number of voxels
+    in each equal-width bin starting at "Min", "Below" and "Above" are the number of voxels
+    outside the binned range, and "Stats" is the JSON returned by the stats endpoint:
+
+    {
+        "Min": 0,
+        "Max": 255,
+        "BinWidth": 1,
+        "Counts": [0, 0, 0, 1024, 832, ...],
+        "Below": 0,
+        "Above": 0,
+        "Stats": { "Voxels": 34081938, ... }
+    }
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    size          Size in voxels in "x_y_z" format, e.g., "512_512_256".  Optional if an ROI or
+                    label is given.
+    offset        3d coordinate in the format "x_y_z".  Gives coordinate of first voxel.
+
+    Query-string Options:
+
+    roi           Only use voxels within the given ROI, specified as "roiname,uuid".  If just
+                    "roiname" is given, the request UUID is used.
+    label         Only use voxels of the given label in label data, e.g., labelarray, that is
+                    synced with this data via the "sync" endpoint.
+    min           (histogram only) Lowest value binned.  Default is 0 for uint8 and uint16 data.
+    max           (histogram only) Highest value binned.  Default is 255 for uint8 and 65535 for
+                    uint16 data.  Other data types require min and max to be given.
+    bins          (histogram only) Number of bins (default 256, maximum 65536).
+
+POST <api URL>/node/<UUID>/<data name>/sync?<options>
+
+    Establishes label data instances, e.g., labelarray, with which this data is synced.  The
+    synced label data is used to restrict the voxels for histograms and statistics to a label.
+    Expects JSON to be POSTed with the following format:
+
+    { "sync": "segmentation" }
+
+	To delete syncs, pass an empty string of names with query string "replace=true":
+
+	{ "sync": "" }
+
+    The "sync" property should be followed by a comma-delimited list of data instances that MUST
+    already exist.
+
+    GET Query-string Options:
+
+    replace    Set to "true" if you want passed syncs to replace and not be appended to current syncs.
+			   Default operation is false.
+
  GET <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
 POST <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
 
@@ -1895,6 +2010,9 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 
 	for ziter := int32(0); ziter < blocksize.Value(2); ziter++ {
 		for yiter := int32(0); yiter < blocksize.Value(1); yiter++ {
+			if err := storage.ContextErr(ctx); err != nil {
+				return fmt.Errorf("GET blocks %s abandoned: %v", ctx, err)
+			}
 			if !hasbuffer {
 				beginPoint := dvid.ChunkPoint3d{blockoffset.Value(0), blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
 				endPoint := dvid.ChunkPoint3d{blockoffset.Value(0) + blocksize.Value(0) - 1, blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
@@ -2216,11 +2334,34 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 			defer server.ThrottledOpDone()
 		}
-		img, err := d.GetArbitraryImage(ctx, parts[4], parts[5], parts[6], parts[7])
+		var opts ArbOptions
+		var err error
+		if opts.Interp, err = ParseArbInterpolation(queryStrings.Get("interp")); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if sizeStr := queryStrings.Get("size"); sizeStr != "" {
+			if opts.Size, err = dvid.StringToPoint2d(sizeStr, "_"); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		}
+		contrast, err := dvid.ContrastOptionsFromQuery(queryStrings)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
 		}
+		img, err := d.GetArbitraryImage(ctx, parts[4], parts[5], parts[6], parts[7], opts)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if contrast.IsSet() {
+			if img, err = img.Contrast(contrast, img.Bounds().Min, img.Bounds()); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		}
 		var formatStr string
 		if len(parts) >= 9 {
 			formatStr = parts[8]
@@ -2232,6 +2373,27 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: Arbitrary image (%s)", r.Method, r.URL)
 
+	case "sync":
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST allowed to sync endpoint")
+			return
+		}
+		replace := queryStrings.Get("replace") == "true"
+		if err := datastore.SetSyncByJSON(d, uuid, replace, r.Body); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	case "histogram", "stats":
+		// GET <api URL>/node/<UUID>/<data name>/histogram[/<size>/<offset>][?queryopts]
+		// GET <api URL>/node/<UUID>/<data name>/stats[/<size>/<offset>][?queryopts]
+		if action != "get" {
+			server.BadRequest(w, r, "DVID does not accept the %s action on the %q endpoint", action, parts[3])
+			return
+		}
+		d.handleIntensityStats(uuid, ctx, w, r, parts)
+		timedLog.Infof("HTTP %s: %s (%s)", r.Method, parts[3], r.URL)
+
 	case "raw", "isotropic":
 		// GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format>]
 		if len(parts) < 7 {
@@ -2262,16 +2424,36 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
-			vox, err := d.NewVoxels(rawSlice, nil)
+			contrast, err := dvid.ContrastOptionsFromQuery(queryStrings)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			readSlice := rawSlice
+			var ctxOffset image.Point
+			var ctxBounds image.Rectangle
+			if contrast.IsSet() {
+				if readSlice, ctxOffset, ctxBounds, err = contrast.ContextSlice(rawSlice); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			}
+			vox, err := d.NewVoxels(readSlice, nil)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
-			img, err := d.GetImage(ctx.VersionID(), vox, roiname)
+			img, err := d.GetImage(ctx, vox, roiname)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			if contrast.IsSet() {
+				if img, err = img.Contrast(contrast, ctxOffset, ctxBounds); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			}
 			if isotropic {
 				dstW := int(slice.Size().Value(0))
 				dstH := int(slice.Size().Value(1))
@@ -2313,7 +2495,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				if len(parts) >= 8 && (parts[7] == "jpeg" || parts[7] == "jpg") {
 
 					// extract volume
-					if err := d.GetVoxels(ctx.VersionID(), vox, roiname); err != nil {
+					if err := d.getVoxels(ctx, vox, roiname); err != nil {
 						server.BadRequest(w, r, err)
 						return
 					}
@@ -2342,7 +2524,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 					}
 				} else {
 
-					data, err := d.GetVolume(ctx.VersionID(), vox, roiname)
+					data, err := d.GetVolume(ctx, vox, roiname)
 					if err != nil {
 						server.BadRequest(w, r, err)
 						return
@@ -2385,3 +2567,96 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		server.BadAPIRequest(w, r, d)
 	}
 }
+
+// handleIntensityStats returns JSON for the histogram or summary statistics of voxel values
+// within a region given by a subvolume, ROI, and/or label query strings.
+func (d *Data) handleIntensityStats(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	var region StatsRegion
+	var err error
+	switch len(parts) {
+	case 4:
+	case 6:
+		if region.Subvol, err = dvid.NewSubvolumeFromStrings(parts[5], parts[4], "_"); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if region.Subvol.StartPoint().NumDims() != 3 || region.Subvol.Size().NumDims() != 3 {
+			server.BadRequest(w, r, "must specify 3D subvolumes")
+			return
+		}
+	default:
+		server.BadRequest(w, r, "%q must be followed by either nothing or size/offset", parts[3])
+		return
+	}
+	queryStrings := r.URL.Query()
+	if roiStr := queryStrings.Get("roi"); roiStr != "" {
+		switch len(strings.Split(roiStr, ",")) {
+		case 1:
+			region.ROI = roiStr + "," + string(uuid)
+		case 2:
+			region.ROI = roiStr
+		default:
+			server.BadRequest(w, r, "Bad ROI specification: %q", roiStr)
+			return
+		}
+	}
+	if labelStr := queryStrings.Get("label"); labelStr != "" {
+		if region.Label, err = strconv.ParseUint(labelStr, 10, 64); err != nil {
+			server.BadRequest(w, r, "bad label %q: %v", labelStr, err)
+			return
+		}
+		if region.Label == 0 {
+			server.BadRequest(w, r, "label 0 is background and can't be used for statistics")
+			return
+		}
+	}
+	if region.Subvol == nil && region.ROI == "" && region.Label == 0 {
+		server.BadRequest(w, r, "%q requires a subvolume, roi, or label", parts[3])
+		return
+	}
+
+	var result interface{}
+	if parts[3] == "stats" {
+		if result, err = d.GetIntensityStats(ctx, region); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	} else {
+		var spec *HistogramSpec
+		minStr, maxStr, binsStr := queryStrings.Get("min"), queryStrings.Get("max"), queryStrings.Get("bins")
+		if minStr != "" || maxStr != "" || binsStr != "" {
+			spec = new(HistogramSpec)
+			if (minStr == "") != (maxStr == "") {
+				server.BadRequest(w, r, "histogram min and max must be given together")
+				return
+			}
+			if minStr != "" {
+				if spec.Min, err = strconv.ParseFloat(minStr, 64); err != nil {
+					server.BadRequest(w, r, "bad min %q: %v", minStr, err)
+					return
+				}
+				if spec.Max, err = strconv.ParseFloat(maxStr, 64); err != nil {
+					server.BadRequest(w, r, "bad max %q: %v", maxStr, err)
+					return
+				}
+			}
+			if binsStr != "" {
+				if spec.Bins, err = strconv.Atoi(binsStr); err != nil || spec.Bins < 1 || spec.Bins > MaxHistogramBins {
+					server.BadRequest(w, r, "bad bins %q, must be from 1 to %d", binsStr, MaxHistogramBins)
+					return
+				}
+			}
+		}
+		if result, err = d.GetHistogram(ctx, region, spec); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+}
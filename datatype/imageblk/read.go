@@ -298,16 +298,16 @@ func (d *Data) BackgroundBlock() []byte {
 }
 
 // GetImage retrieves a 2d image from a version node given a geometry of voxels.
-func (d *Data) GetImage(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceName) (*dvid.Image, error) {
-	if err := d.GetVoxels(v, vox, roiname); err != nil {
+func (d *Data) GetImage(ctx *datastore.VersionedCtx, vox *Voxels, roiname dvid.InstanceName) (*dvid.Image, error) {
+	if err := d.getVoxels(ctx, vox, roiname); err != nil {
 		return nil, err
 	}
 	return vox.GetImage2d()
 }
 
 // GetVolume retrieves a n-d volume from a version node given a geometry of voxels.
-func (d *Data) GetVolume(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceName) ([]byte, error) {
-	if err := d.GetVoxels(v, vox, roiname); err != nil {
+func (d *Data) GetVolume(ctx *datastore.VersionedCtx, vox *Voxels, roiname dvid.InstanceName) ([]byte, error) {
+	if err := d.getVoxels(ctx, vox, roiname); err != nil {
 		return nil, err
 	}
 	return vox.Data(), nil
@@ -321,7 +321,13 @@ type getOperation struct {
 
 // GetVoxels copies voxels from the storage engine to Voxels, a requested subvolume or 2d image.
 func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceName) error {
-	r, err := GetROI(v, roiname, vox)
+	return d.getVoxels(datastore.NewVersionedCtx(d, v), vox, roiname)
+}
+
+// getVoxels copies voxels for the given context, abandoning the read if the context's
+// request is cancelled.
+func (d *Data) getVoxels(ctx *datastore.VersionedCtx, vox *Voxels, roiname dvid.InstanceName) error {
+	r, err := GetROI(ctx.VersionID(), roiname, vox)
 	if err != nil {
 		return err
 	}
@@ -338,8 +344,6 @@ func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceNam
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
-	ctx := datastore.NewVersionedCtx(d, v)
-
 	wg := new(sync.WaitGroup)
 
 	okv := store.(storage.BufferableOps)
@@ -350,6 +354,9 @@ func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceNam
 	}
 
 	for it, err := vox.NewIndexIterator(d.BlockSize()); err == nil && it.Valid(); it.NextSpan() {
+		if err := storage.ContextErr(ctx); err != nil {
+			return fmt.Errorf("GET data %s abandoned: %v", ctx, err)
+		}
 		indexBeg, indexEnd, err := it.IndexSpan()
 		if err != nil {
 			return err
@@ -0,0 +1,442 @@
+/*
+	This file supports intensity histograms and summary statistics over regions of voxels
+	given by a subvolume, an ROI, and/or a label in synced label data.
+*/
+
+package imageblk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// DefaultHistogramBins is the number of histogram bins used if none is specified.
+	DefaultHistogramBins = 256
+
+	// MaxHistogramBins is the maximum number of histogram bins that can be requested.
+	MaxHistogramBins = 65536
+)
+
+// StatsRegion selects the voxels used for intensity statistics.  Each set field further
+// restricts the voxels, and at least one field must be set.
+type StatsRegion struct {
+	// Subvol restricts voxels to a subvolume.
+	Subvol *dvid.Subvolume
+
+	// ROI restricts voxels to an ROI given as "roiname,uuid".
+	ROI string
+
+	// Label restricts voxels to a label in the synced label data.
+	Label uint64
+}
+
+// HistogramSpec gives the binning of voxel values into Bins equal-width bins spanning
+// values from Min to Max, inclusive.
+type HistogramSpec struct {
+	Min  float64
+	Max  float64
+	Bins int
+}
+
+// IntensityStats holds summary statistics of voxel values within a region.
+type IntensityStats struct {
+	Voxels uint64
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64
+}
+
+// Histogram holds the counts of voxel values within a region.
+type Histogram struct {
+	Min      float64 // lowest value in first bin
+	Max      float64 // highest value in last bin
+	BinWidth float64
+	Counts   []uint64
+	Below    uint64 // # of voxels with values below Min
+	Above    uint64 // # of voxels with values above Max
+	Stats    IntensityStats
+}
+
+// intensityAccum accumulates voxel values into statistics and an optional histogram.
+// The mean and variance are updated with Welford's algorithm to avoid the cancellation
+// of subtracting large sums of squares.
+type intensityAccum struct {
+	voxels   uint64
+	min, max float64
+	mean     float64
+	m2       float64 // sum of squared differences from the mean
+	hist     *Histogram
+}
+
+func (acc *intensityAccum) add(value float64) {
+	if acc.voxels == 0 || value < acc.min {
+		acc.min = value
+	}
+	if acc.voxels == 0 || value > acc.max {
+		acc.max = value
+	}
+	acc.voxels++
+	delta := value - acc.mean
+	acc.mean += delta / float64(acc.voxels)
+	acc.m2 += delta * (value - acc.mean)
+
+	h := acc.hist
+	if h == nil {
+		return
+	}
+	if value < h.Min {
+		h.Below++
+		return
+	}
+	if value > h.Max {
+		h.Above++
+		return
+	}
+	bin := int((value - h.Min) / h.BinWidth)
+	if bin >= len(h.Counts) {
+		bin = len(h.Counts) - 1 // floating point value at Max
+	}
+	h.Counts[bin]++
+}
+
+func (acc *intensityAccum) stats() IntensityStats {
+	stats := IntensityStats{Voxels: acc.voxels}
+	if acc.voxels == 0 {
+		return stats
+	}
+	stats.Min = acc.min
+	stats.Max = acc.max
+	stats.Mean = acc.mean
+	if variance := acc.m2 / float64(acc.voxels); variance > 0 {
+		stats.StdDev = math.Sqrt(variance)
+	}
+	return stats
+}
+
+// voxelValueFunc returns a function that decodes a little-endian voxel value of the
+// given type and whether the type has integral values.
+func voxelValueFunc(t dvid.DataType) (f func([]byte) float64, integral bool, err error) {
+	switch t {
+	case dvid.T_uint8:
+		return func(b []byte) float64 { return float64(b[0]) }, true, nil
+	case dvid.T_int8:
+		return func(b []byte) float64 { return float64(int8(b[0])) }, true, nil
+	case dvid.T_uint16:
+		return func(b []byte) float64 { return float64(binary.LittleEndian.Uint16(b)) }, true, nil
+	case dvid.T_int16:
+		return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) }, true, nil
+	case dvid.T_uint32:
+		return func(b []byte) float64 { return float64(binary.LittleEndian.Uint32(b)) }, true, nil
+	case dvid.T_int32:
+		return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) }, true, nil
+	case dvid.T_uint64:
+		return func(b []byte) float64 { return float64(binary.LittleEndian.Uint64(b)) }, true, nil
+	case dvid.T_int64:
+		return func(b []byte) float64 { return float64(int64(binary.LittleEndian.Uint64(b))) }, true, nil
+	case dvid.T_float32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, false, nil
+	case dvid.T_float64:
+		return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }, false, nil
+	default:
+		return nil, false, fmt.Errorf("unknown voxel data type %d", t)
+	}
+}
+
+// GetIntensityStats returns summary statistics of voxel values within a region.
+func (d *Data) GetIntensityStats(ctx *datastore.VersionedCtx, region StatsRegion) (IntensityStats, error) {
+	acc, err := d.accumIntensities(ctx, region, nil)
+	if err != nil {
+		return IntensityStats{}, err
+	}
+	return acc.stats(), nil
+}
+
+// GetHistogram returns a histogram of voxel values within a region.  If the spec is nil,
+// 256 bins across the full value range are used for 8-bit and 16-bit data.  Other data
+// requires a spec with Min and Max.  A spec with zero Bins uses DefaultHistogramBins, and
+// no more than MaxHistogramBins can be used.
+func (d *Data) GetHistogram(ctx *datastore.VersionedCtx, region StatsRegion, spec *HistogramSpec) (*Histogram, error) {
+	if len(d.Values) != 1 {
+		return nil, fmt.Errorf("histograms are only available for single-channel data, not %q", d.DataName())
+	}
+	var hs HistogramSpec
+	if spec != nil {
+		hs = *spec
+	}
+	if spec == nil || (hs.Min == 0 && hs.Max == 0) {
+		switch d.Values[0].T {
+		case dvid.T_uint8:
+			hs.Min, hs.Max = 0, math.MaxUint8
+		case dvid.T_uint16:
+			hs.Min, hs.Max = 0, math.MaxUint16
+		default:
+			return nil, fmt.Errorf("histograms of data %q require a min and max value", d.DataName())
+		}
+	}
+	if hs.Bins == 0 {
+		hs.Bins = DefaultHistogramBins
+	}
+	if hs.Bins < 0 || hs.Bins > MaxHistogramBins || hs.Max < hs.Min {
+		return nil, fmt.Errorf("bad histogram of %d bins from %g to %g", hs.Bins, hs.Min, hs.Max)
+	}
+	_, integral, err := voxelValueFunc(d.Values[0].T)
+	if err != nil {
+		return nil, err
+	}
+	hist := &Histogram{
+		Min:    hs.Min,
+		Max:    hs.Max,
+		Counts: make([]uint64, hs.Bins),
+	}
+	if integral {
+		hist.Min = math.Ceil(hs.Min)
+		hist.Max = math.Floor(hs.Max)
+		hist.BinWidth = (hist.Max - hist.Min + 1) / float64(hs.Bins)
+	} else {
+		hist.BinWidth = (hist.Max - hist.Min) / float64(hs.Bins)
+		if hist.BinWidth == 0 {
+			hist.BinWidth = 1
+		}
+	}
+	acc, err := d.accumIntensities(ctx, region, hist)
+	if err != nil {
+		return nil, err
+	}
+	hist.Stats = acc.stats()
+	return hist, nil
+}
+
+// accumIntensities reads the blocks intersecting a region, block by block, and accumulates
+// the values of voxels within the region.
+func (d *Data) accumIntensities(ctx *datastore.VersionedCtx, region StatsRegion, hist *Histogram) (*intensityAccum, error) {
+	if len(d.Values) != 1 {
+		return nil, fmt.Errorf("intensity statistics are only available for single-channel data, not %q", d.DataName())
+	}
+	valueF, _, err := voxelValueFunc(d.Values[0].T)
+	if err != nil {
+		return nil, err
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("intensity statistics require 3d block size, not %s", d.BlockSize())
+	}
+	if region.Subvol == nil && region.ROI == "" && region.Label == 0 {
+		return nil, fmt.Errorf("intensity statistics require a subvolume, ROI, or label")
+	}
+	v := ctx.VersionID()
+
+	// Get the voxel bounds of any subvolume.
+	var minPt, maxPt dvid.Point3d
+	if region.Subvol != nil {
+		var ok1, ok2 bool
+		minPt, ok1 = region.Subvol.StartPoint().(dvid.Point3d)
+		maxPt, ok2 = region.Subvol.EndPoint().(dvid.Point3d)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("intensity statistics require a 3d subvolume, not %s", region.Subvol)
+		}
+	}
+
+	// Get the blocks of any ROI.
+	var roiBlocks map[dvid.IZYXString]struct{}
+	var roiSpans []dvid.Span
+	var roiBlockSize dvid.Point3d
+	if region.ROI != "" {
+		roiData, roiV, found, err := roi.DataBySpec(region.ROI)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("ROI %q not found", region.ROI)
+		}
+		if roiSpans, err = roiData.GetSpans(roiV); err != nil {
+			return nil, err
+		}
+		roiBlockSize = roiData.BlockSize
+		roiBlocks = make(map[dvid.IZYXString]struct{})
+		for _, span := range roiSpans {
+			for x := span[2]; x <= span[3]; x++ {
+				roiBlocks[dvid.ChunkPoint3d{x, span[1], span[0]}.ToIZYXString()] = struct{}{}
+			}
+		}
+	}
+	roiByBlock := roiBlocks != nil && roiBlockSize.Equals(blockSize)
+
+	// Get the synced label data for any label.
+	var labelData LabelSource
+	if region.Label != 0 {
+		if labelData = d.GetSyncedLabels(); labelData == nil {
+			return nil, fmt.Errorf("data %q has no synced label data for statistics by label", d.DataName())
+		}
+		lblSize, ok := labelData.BlockSize().(dvid.Point3d)
+		if !ok || !lblSize.Equals(blockSize) {
+			return nil, fmt.Errorf("synced label data %q block size %s doesn't match block size %s of data %q", labelData.DataName(), labelData.BlockSize(), blockSize, d.DataName())
+		}
+	}
+
+	// Determine the candidate blocks from the most restrictive part of the region.
+	blockSet := make(map[dvid.IZYXString]struct{})
+	switch {
+	case labelData != nil:
+		lblBlocks, err := labelData.GetLabelBlocks(v, region.Label)
+		if err != nil {
+			return nil, err
+		}
+		for _, izyx := range lblBlocks {
+			blockSet[izyx] = struct{}{}
+		}
+	case roiBlocks != nil:
+		for _, span := range roiSpans {
+			spanMin := dvid.Point3d{span[2] * roiBlockSize[0], span[1] * roiBlockSize[1], span[0] * roiBlockSize[2]}
+			spanMax := dvid.Point3d{(span[3]+1)*roiBlockSize[0] - 1, (span[1]+1)*roiBlockSize[1] - 1, (span[0]+1)*roiBlockSize[2] - 1}
+			addBlocksInBounds(blockSet, spanMin, spanMax, blockSize)
+		}
+	default:
+		addBlocksInBounds(blockSet, minPt, maxPt, blockSize)
+	}
+	var minBlock, maxBlock dvid.ChunkPoint3d
+	if region.Subvol != nil {
+		minBlock = minPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+		maxBlock = maxPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+	}
+	blocks := make(dvid.IZYXSlice, 0, len(blockSet))
+	for izyx := range blockSet {
+		if roiByBlock {
+			if _, inROI := roiBlocks[izyx]; !inROI {
+				continue
+			}
+		}
+		if region.Subvol != nil {
+			bcoord, err := izyx.ToChunkPoint3d()
+			if err != nil {
+				return nil, err
+			}
+			if bcoord[0] < minBlock[0] || bcoord[0] > maxBlock[0] ||
+				bcoord[1] < minBlock[1] || bcoord[1] > maxBlock[1] ||
+				bcoord[2] < minBlock[2] || bcoord[2] > maxBlock[2] {
+				continue
+			}
+		}
+		blocks = append(blocks, izyx)
+	}
+	sort.Sort(blocks)
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, fmt.Errorf("data type imageblk had error initializing store: %v", err)
+	}
+
+	acc := &intensityAccum{hist: hist}
+	bytesPerVoxel := int(d.Values.BytesPerElement())
+	numVoxels := int(blockSize.Prod())
+	var f storage.ChunkFunc = func(chunk *storage.Chunk) error {
+		if chunk == nil || chunk.V == nil {
+			return nil
+		}
+		indexZYX, err := DecodeTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		bcoord := dvid.ChunkPoint3d(*indexZYX)
+		data, _, err := dvid.DeserializeData(chunk.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize block %s in %q: %v", bcoord, d.DataName(), err)
+		}
+		if len(data) < numVoxels*bytesPerVoxel {
+			return fmt.Errorf("block %s in %q has %d bytes, expected %d", bcoord, d.DataName(), len(data), numVoxels*bytesPerVoxel)
+		}
+		var lblBytes []byte
+		if labelData != nil {
+			if lblBytes, err = labelData.GetLabelBytes(v, bcoord); err != nil {
+				return err
+			}
+			if len(lblBytes) == 0 {
+				return nil
+			}
+		}
+
+		// Restrict voxel range within block to any subvolume.
+		offset := bcoord.MinPoint(blockSize).(dvid.Point3d)
+		var lo, hi dvid.Point3d
+		for dim := 0; dim < 3; dim++ {
+			lo[dim], hi[dim] = 0, blockSize[dim]-1
+			if region.Subvol != nil {
+				if minPt[dim] > offset[dim] {
+					lo[dim] = minPt[dim] - offset[dim]
+				}
+				if maxPt[dim] < offset[dim]+blockSize[dim]-1 {
+					hi[dim] = maxPt[dim] - offset[dim]
+				}
+			}
+		}
+		for z := lo[2]; z <= hi[2]; z++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				i := int((z*blockSize[1]+y)*blockSize[0] + lo[0])
+				for x := lo[0]; x <= hi[0]; x, i = x+1, i+1 {
+					if lblBytes != nil && binary.LittleEndian.Uint64(lblBytes[i*8:i*8+8]) != region.Label {
+						continue
+					}
+					if roiBlocks != nil && !roiByBlock {
+						pt := dvid.Point3d{offset[0] + x, offset[1] + y, offset[2] + z}
+						if _, inROI := roiBlocks[pt.ToBlockIZYXString(roiBlockSize)]; !inROI {
+							continue
+						}
+					}
+					acc.add(valueF(data[i*bytesPerVoxel : (i+1)*bytesPerVoxel]))
+				}
+			}
+		}
+		return nil
+	}
+
+	// Read each run of blocks along x.
+	for beg := 0; beg < len(blocks); {
+		begCoord, err := blocks[beg].ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		endCoord := begCoord
+		end := beg + 1
+		for ; end < len(blocks); end++ {
+			bcoord, err := blocks[end].ToChunkPoint3d()
+			if err != nil {
+				return nil, err
+			}
+			if bcoord[1] != endCoord[1] || bcoord[2] != endCoord[2] || bcoord[0] != endCoord[0]+1 {
+				break
+			}
+			endCoord = bcoord
+		}
+		if err := storage.ContextErr(ctx); err != nil {
+			return nil, fmt.Errorf("intensity statistics for %q abandoned: %v", d.DataName(), err)
+		}
+		begTKey := NewTKeyByCoord(blocks[beg])
+		endTKey := NewTKeyByCoord(blocks[end-1])
+		if err := store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, f); err != nil {
+			return nil, err
+		}
+		beg = end
+	}
+	return acc, nil
+}
+
+// addBlocksInBounds adds the coordinates of blocks intersecting the given voxel bounds.
+func addBlocksInBounds(blockSet map[dvid.IZYXString]struct{}, minPt, maxPt, blockSize dvid.Point3d) {
+	minBlock := minPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+	maxBlock := maxPt.Chunk(blockSize).(dvid.ChunkPoint3d)
+	for z := minBlock[2]; z <= maxBlock[2]; z++ {
+		for y := minBlock[1]; y <= maxBlock[1]; y++ {
+			for x := minBlock[0]; x <= maxBlock[0]; x++ {
+				blockSet[dvid.ChunkPoint3d{x, y, z}.ToIZYXString()] = struct{}{}
+			}
+		}
+	}
+}
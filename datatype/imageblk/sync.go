@@ -1,6 +1,11 @@
 package imageblk
 
-import "github.com/janelia-flyem/dvid/dvid"
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
 
 // Events for imageblk
 const (
@@ -25,3 +30,40 @@ type MutatedBlock struct {
 	Data  []byte
 	MutID  uint64
 }
+
+// LabelSource is label data, e.g., labelarray, that can be synced with image data to
+// restrict intensity statistics to the voxels of a label.
+type LabelSource interface {
+	DataName() dvid.InstanceName
+	BlockSize() dvid.Point
+
+	// GetLabelBlocks returns the coordinates of all blocks with voxels of the given label.
+	GetLabelBlocks(v dvid.VersionID, label uint64) (dvid.IZYXSlice, error)
+
+	// GetLabelBytes returns the little-endian uint64 labels of a block, or an empty slice
+	// if the block isn't stored.
+	GetLabelBytes(v dvid.VersionID, bcoord dvid.ChunkPoint3d) ([]byte, error)
+}
+
+// GetSyncSubs implements the datastore.Syncer interface.  Image data can only sync with
+// label data, which is read on demand, so no subscriptions are needed.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	if _, ok := synced.(LabelSource); !ok {
+		return nil, fmt.Errorf("data %q can only be synced with label data like labelarray, not %q", d.DataName(), synced.DataName())
+	}
+	return nil, nil
+}
+
+// GetSyncedLabels returns the label data synced with this data or nil if there is none.
+func (d *Data) GetSyncedLabels() LabelSource {
+	for dataUUID := range d.SyncedData() {
+		source, err := datastore.GetDataByDataUUID(dataUUID)
+		if err != nil {
+			continue
+		}
+		if labelData, ok := source.(LabelSource); ok {
+			return labelData
+		}
+	}
+	return nil
+}
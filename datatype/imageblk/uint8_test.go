@@ -2,12 +2,20 @@ package imageblk
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
@@ -426,6 +434,348 @@ func TestBlockAPI(t *testing.T) {
 	}
 }
 
+func TestArchiveROIFilter(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	grayscale := makeGrayscale(uuid, t, "grayscale")
+	numBlockBytes := int(grayscale.BlockSize().Prod())
+	blockData := dvid.RandomBytes(int32(2 * numBlockBytes))
+	blockReq := fmt.Sprintf("%snode/%s/grayscale/blocks/0_0_0/2", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", blockReq, bytes.NewBuffer(blockData))
+
+	// Only the first block is within the ROI.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	apiStr := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString("[[0,0,0,0]]"))
+
+	dir, err := ioutil.TempDir("", "dvid-imageblk-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "filtered.dvid")
+	config := dvid.NewConfig()
+	config.Set("data", "grayscale")
+	config.Set("filter", fmt.Sprintf("roi:myroi,%s", uuid))
+	if err := datastore.ExportRepo(uuid, filename, config); err != nil {
+		t.Fatalf("couldn't export repo: %v\n", err)
+	}
+	if err := datastore.DeleteRepo(uuid, "foobar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.ImportRepo(filename); err != nil {
+		t.Fatalf("couldn't import repo: %v\n", err)
+	}
+
+	returnedData := server.TestHTTP(t, "GET", blockReq, nil)
+	if len(returnedData) != 2*numBlockBytes {
+		t.Fatalf("Returned %d bytes, expected %d bytes", len(returnedData), 2*numBlockBytes)
+	}
+	if !bytes.Equal(returnedData[:numBlockBytes], blockData[:numBlockBytes]) {
+		t.Errorf("Imported block within ROI != original block data\n")
+	}
+	for i, b := range returnedData[numBlockBytes:] {
+		if b != 0 {
+			t.Fatalf("Expected block outside ROI to be filtered, got %d at byte %d\n", b, i)
+		}
+	}
+}
+
+func TestCubicWeights(t *testing.T) {
+	for _, frac := range []float64{0, 0.25, 0.5, 0.9} {
+		var sum float64
+		for _, w := range cubicWeights(frac) {
+			sum += w
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("cubic weights for %f sum to %f, not 1\n", frac, sum)
+		}
+	}
+	if w := cubicWeights(0); w[0] != 0 || w[1] != 1 || w[2] != 0 || w[3] != 0 {
+		t.Errorf("expected cubic weights at lattice point to select it, got %v\n", w)
+	}
+	first, w := latticeWeights(3.75, InterpTrilinear)
+	if first != 3 || w[0] != 0.25 || w[1] != 0.75 {
+		t.Errorf("bad trilinear weights: first %d, weights %v\n", first, w)
+	}
+	if first, w = latticeWeights(3.75, InterpNearest); first != 4 || len(w) != 1 {
+		t.Errorf("bad nearest weights: first %d, weights %v\n", first, w)
+	}
+}
+
+// arbHalfway gives, for each resampling, the first lattice point relative to the voxel below
+// and the weights of consecutive lattice points when sampling halfway between voxels.
+var arbHalfway = map[string]struct {
+	first   int32
+	weights []float64
+}{
+	"nearest": {0, []float64{1}},
+	"linear":  {0, []float64{0.5, 0.5}},
+	"cubic":   {-1, []float64{-1.0 / 16, 9.0 / 16, 9.0 / 16, -1.0 / 16}},
+}
+
+// expectedHalfway returns the resampled value expected halfway between the voxel at pt and
+// its next neighbors in x, y, and z, given a function returning voxel values.
+func expectedHalfway(interp string, pt dvid.Point3d, maxValue float64, value func(x, y, z int32) float64) float64 {
+	hw := arbHalfway[interp]
+	var sum float64
+	for k, wz := range hw.weights {
+		for j, wy := range hw.weights {
+			for i, wx := range hw.weights {
+				x := pt[0] + hw.first + int32(i)
+				y := pt[1] + hw.first + int32(j)
+				z := pt[2] + hw.first + int32(k)
+				sum += wz * wy * wx * value(x, y, z)
+			}
+		}
+	}
+	return math.Min(math.Max(math.Floor(sum+0.5), 0), maxValue)
+}
+
+func TestArbitraryImage(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	offset := dvid.Point3d{0, 0, 0}
+	size := dvid.Point3d{64, 64, 64}
+	vol := testVolume{data: makeVolume(offset, size), offset: offset, size: size}
+	vol.put(t, uuid, "grayscale")
+
+	// An axis-aligned slice through voxel centers should return the voxels for any resampling.
+	expected := makeSlice(dvid.Point3d{1, 1, 10}, dvid.Point2d{32, 32})
+	for _, interp := range []string{"nearest", "linear", "cubic"} {
+		apiStr := fmt.Sprintf("%snode/%s/grayscale/arb/8_8_80/256_8_80/8_256_80/8/png?interp=%s", server.WebAPIPath, uuid, interp)
+		img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+		if err != nil {
+			t.Fatalf("unable to decode %s arb image: %v\n", interp, err)
+		}
+		gray, ok := img.(*image.Gray)
+		if !ok {
+			t.Fatalf("expected gray arb image, got %T\n", img)
+		}
+		if gray.Rect.Dx() != 32 || gray.Rect.Dy() != 32 {
+			t.Fatalf("expected 32 x 32 %s arb image, got %s\n", interp, gray.Rect)
+		}
+		if !bytes.Equal(gray.Pix, expected) {
+			t.Errorf("bad %s arb image\n", interp)
+		}
+	}
+
+	// The output size can be given instead of using the resolution.
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/arb/0_0_80/248_0_80/0_248_80/0/png?size=16_8&interp=cubic", server.WebAPIPath, uuid)
+	img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to decode sized arb image: %v\n", err)
+	}
+	if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+		t.Errorf("expected 16 x 8 arb image, got %s\n", img.Bounds())
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/arb/0_0_80/248_0_80/0_248_80/8/png?interp=sinc", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// Sample halfway between voxels in x, y, and z, starting at voxel coordinate (1.5, 1.5, 10.5).
+	grayValue := func(x, y, z int32) float64 {
+		return float64(vol.data[(z*size[1]+y)*size[0]+x])
+	}
+	for interp := range arbHalfway {
+		apiStr := fmt.Sprintf("%snode/%s/grayscale/arb/12_12_84/260_12_84/12_260_84/8/png?interp=%s", server.WebAPIPath, uuid, interp)
+		img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+		if err != nil {
+			t.Fatalf("unable to decode off-lattice %s arb image: %v\n", interp, err)
+		}
+		gray, ok := img.(*image.Gray)
+		if !ok {
+			t.Fatalf("expected gray arb image, got %T\n", img)
+		}
+		for py := int32(0); py < 32; py++ {
+			for px := int32(0); px < 32; px++ {
+				expected := expectedHalfway(interp, dvid.Point3d{1 + px, 1 + py, 10}, math.MaxUint8, grayValue)
+				if got := gray.GrayAt(int(px), int(py)).Y; float64(got) != expected {
+					t.Fatalf("off-lattice %s arb image has %d at (%d, %d), expected %.0f\n", interp, got, px, py, expected)
+				}
+			}
+		}
+	}
+
+	// uint16 values are resampled without truncation to 8 bits.
+	server.CreateTestInstance(t, uuid, "uint16blk", "uint16img", dvid.Config{})
+	size16 := dvid.Point3d{32, 32, 32}
+	createUint16TestVolume(t, uuid, "uint16img", offset, size16)
+	uint16Value := func(x, y, z int32) float64 {
+		return float64((z*size16[1]+y)*size16[0] + x)
+	}
+	for interp := range arbHalfway {
+		apiStr := fmt.Sprintf("%snode/%s/uint16img/arb/12_12_84/132_12_84/12_132_84/8/png?interp=%s", server.WebAPIPath, uuid, interp)
+		img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+		if err != nil {
+			t.Fatalf("unable to decode uint16 %s arb image: %v\n", interp, err)
+		}
+		gray16, ok := img.(*image.Gray16)
+		if !ok {
+			t.Fatalf("expected 16-bit gray arb image, got %T\n", img)
+		}
+		if gray16.Rect.Dx() != 16 || gray16.Rect.Dy() != 16 {
+			t.Fatalf("expected 16 x 16 uint16 %s arb image, got %s\n", interp, gray16.Rect)
+		}
+		// The image holds the little-endian voxel values as stored.
+		for py := int32(0); py < 16; py++ {
+			for px := int32(0); px < 16; px++ {
+				expected := expectedHalfway(interp, dvid.Point3d{1 + px, 1 + py, 10}, math.MaxUint16, uint16Value)
+				i := gray16.PixOffset(int(px), int(py))
+				if got := binary.LittleEndian.Uint16(gray16.Pix[i : i+2]); float64(got) != expected {
+					t.Fatalf("uint16 %s arb image has %d at (%d, %d), expected %.0f\n", interp, got, px, py, expected)
+				}
+			}
+		}
+	}
+
+	// Each channel of multichannel data is resampled separately.
+	server.CreateTestInstance(t, uuid, "rgba8blk", "rgba", dvid.Config{})
+	sizeRGBA := dvid.Point3d{32, 32, 32}
+	grayRGBA := makeVolume(offset, sizeRGBA)
+	rgba := testVolume{data: make([]byte, 4*len(grayRGBA)), offset: offset, size: sizeRGBA}
+	for i, v := range grayRGBA {
+		copy(rgba.data[i*4:i*4+4], []byte{v, 255 - v, v ^ 0x5A, 255})
+	}
+	rgba.put(t, uuid, "rgba")
+	for interp := range arbHalfway {
+		apiStr := fmt.Sprintf("%snode/%s/rgba/arb/12_12_84/132_12_84/12_132_84/8/png?interp=%s", server.WebAPIPath, uuid, interp)
+		img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+		if err != nil {
+			t.Fatalf("unable to decode rgba8 %s arb image: %v\n", interp, err)
+		}
+		if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 16 {
+			t.Fatalf("expected 16 x 16 rgba8 %s arb image, got %s\n", interp, img.Bounds())
+		}
+		for py := int32(0); py < 16; py++ {
+			for px := int32(0); px < 16; px++ {
+				got := color.NRGBAModel.Convert(img.At(int(px), int(py))).(color.NRGBA)
+				gotValues := []uint8{got.R, got.G, got.B, got.A}
+				for c, gotValue := range gotValues {
+					channelValue := func(x, y, z int32) float64 {
+						return float64(rgba.data[((z*sizeRGBA[1]+y)*sizeRGBA[0]+x)*4+int32(c)])
+					}
+					expected := expectedHalfway(interp, dvid.Point3d{1 + px, 1 + py, 10}, math.MaxUint8, channelValue)
+					if float64(gotValue) != expected {
+						t.Fatalf("rgba8 %s arb image has %d in channel %d at (%d, %d), expected %.0f\n", interp, gotValue, c, px, py, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestIntensityStats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	offset := dvid.Point3d{0, 0, 0}
+	size := dvid.Point3d{64, 64, 64}
+	vol := testVolume{data: makeVolume(offset, size), offset: offset, size: size}
+	vol.put(t, uuid, "grayscale")
+
+	// Compute expected histogram over a subvolume that crosses block boundaries,
+	// where only the block at 1,0,1 is in the ROI.
+	expected := make([]uint64, 256)
+	expectedROI := make([]uint64, 256)
+	var sum float64
+	var n uint64
+	for z := int32(20); z < 50; z++ {
+		for y := int32(10); y < 30; y++ {
+			for x := int32(5); x < 45; x++ {
+				value := vol.data[(z*size[1]+y)*size[0]+x]
+				expected[value]++
+				sum += float64(value)
+				n++
+				if x >= 32 && z >= 32 {
+					expectedROI[value]++
+				}
+			}
+		}
+	}
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/histogram/40_20_30/5_10_20", server.WebAPIPath, uuid)
+	var hist Histogram
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &hist); err != nil {
+		t.Fatalf("unable to unmarshal histogram: %v\n", err)
+	}
+	if !reflect.DeepEqual(hist.Counts, expected) {
+		t.Errorf("bad histogram over subvolume: %v\n", hist.Counts)
+	}
+	mean := sum / float64(n)
+	var sumSqDiff float64
+	for value, count := range expected {
+		sumSqDiff += float64(count) * (float64(value) - mean) * (float64(value) - mean)
+	}
+	stdDev := math.Sqrt(sumSqDiff / float64(n))
+	if hist.Stats.Voxels != n || math.Abs(hist.Stats.Mean-mean) > 1e-6 || math.Abs(hist.Stats.StdDev-stdDev) > 1e-6 {
+		t.Errorf("expected %d voxels with mean %f and std dev %f, got %v\n", n, mean, stdDev, hist.Stats)
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/stats/40_20_30/5_10_20", server.WebAPIPath, uuid)
+	var stats IntensityStats
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &stats); err != nil {
+		t.Fatalf("unable to unmarshal stats: %v\n", err)
+	}
+	if stats != hist.Stats {
+		t.Errorf("expected stats %v to match histogram stats %v\n", stats, hist.Stats)
+	}
+
+	// Restrict to an ROI.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	apiStr = fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString("[[1,0,1,1]]"))
+
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/histogram/40_20_30/5_10_20?roi=myroi", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &hist); err != nil {
+		t.Fatalf("unable to unmarshal histogram: %v\n", err)
+	}
+	if !reflect.DeepEqual(hist.Counts, expectedROI) {
+		t.Errorf("bad histogram over subvolume and ROI: %v\n", hist.Counts)
+	}
+
+	// Coarser bins over a given range.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/histogram/40_20_30/5_10_20?min=64&max=191&bins=4", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &hist); err != nil {
+		t.Fatalf("unable to unmarshal histogram: %v\n", err)
+	}
+	var below, above uint64
+	binned := make([]uint64, 4)
+	for value, count := range expected {
+		switch {
+		case value < 64:
+			below += count
+		case value > 191:
+			above += count
+		default:
+			binned[(value-64)/32] += count
+		}
+	}
+	if hist.BinWidth != 32 || hist.Below != below || hist.Above != above || !reflect.DeepEqual(hist.Counts, binned) {
+		t.Errorf("bad binned histogram: %v\n", hist)
+	}
+
+	// Too many bins are rejected.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/histogram/40_20_30/5_10_20?bins=%d", server.WebAPIPath, uuid, MaxHistogramBins+1)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// A region is required.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/stats", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+}
+
 func TestGrayscaleRepoPersistence(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,934 @@
+/*
+	Readers for volumetric files -- multi-page TIFF stacks and local N5 or Zarr chunk
+	directories -- that supply XY slices for ingestion.
+*/
+
+package imageblk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// VolumeReader supplies the XY slices of a volume in the voxel format of a data instance.
+type VolumeReader interface {
+	// Size returns the size of the volume in voxels.
+	Size() dvid.Point3d
+
+	// ReadSlice returns the packed little-endian voxels of the XY slice at the
+	// given z, where the first slice is at z = 0.  Slices should be read in order.
+	ReadSlice(z int32) ([]byte, error)
+
+	Close() error
+}
+
+// IsVolumeFile returns true if the path is a N5 or Zarr directory or a TIFF file
+// with more than one page.
+func IsVolumeFile(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if fi.IsDir() {
+		return fileExists(filepath.Join(path, "attributes.json")) || fileExists(filepath.Join(path, ".zarray"))
+	}
+	if !dvid.Filename(path).HasExtensionPrefix("tif") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	offsets, err := tiffPageOffsets(f)
+	return err == nil && len(offsets) > 1
+}
+
+// OpenVolume returns a VolumeReader for a multi-page TIFF file or a N5 or Zarr directory
+// that converts voxels into the given data values.
+func OpenVolume(path string, values dvid.DataValues) (VolumeReader, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		if fileExists(filepath.Join(path, "attributes.json")) {
+			return openN5(path, values)
+		}
+		if fileExists(filepath.Join(path, ".zarray")) {
+			return openZarr(path, values)
+		}
+		return nil, fmt.Errorf("directory %q is neither a N5 nor Zarr dataset", path)
+	}
+	return openTIFFStack(path, values)
+}
+
+// NewVolumeSlice returns the voxels for the XY slice at z of a volume, positioned at
+// the given offset.
+func (d *Data) NewVolumeSlice(vol VolumeReader, z int32, offset dvid.Point) (*Voxels, error) {
+	data, err := vol.ReadSlice(z)
+	if err != nil {
+		return nil, err
+	}
+	size := vol.Size()
+	slice, err := dvid.NewOrthogSlice(dvid.XY, offset, dvid.Point2d{size[0], size[1]})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine slice: %v", err)
+	}
+	return NewVoxels(slice, d.Properties.Values, data, size[0]*d.Properties.Values.BytesPerElement()), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// sampleFormat describes the voxel encoding of an external volume.
+type sampleFormat struct {
+	valueBytes int32
+	channels   int32
+	bigEndian  bool
+	float      bool
+	signed     bool
+}
+
+func (f sampleFormat) voxelBytes() int32 {
+	return f.valueBytes * f.channels
+}
+
+// returns true if the data values are floating point.
+func floatValues(values dvid.DataValues) bool {
+	for _, value := range values {
+		if value.T == dvid.T_float32 || value.T == dvid.T_float64 {
+			return true
+		}
+	}
+	return false
+}
+
+// returns a function that converts packed voxels in the sample format to the little-endian
+// format of the given data values.  Single channel integer values can be widened, e.g.,
+// uint32 labels can be converted to uint64, with signed values sign-extended.  Floating
+// point and integer values are never converted into each other.
+func (f sampleFormat) converter(values dvid.DataValues) (func(dst, src []byte), error) {
+	srcBytes := f.voxelBytes()
+	dstBytes := values.BytesPerElement()
+	n := f.valueBytes
+	if f.float != floatValues(values) {
+		if f.float {
+			return nil, fmt.Errorf("can't convert floating point samples into integer values")
+		}
+		return nil, fmt.Errorf("can't convert integer samples into floating point values")
+	}
+	switch {
+	case srcBytes == dstBytes && f.channels == values.ValuesPerElement():
+		if !f.bigEndian || n == 1 {
+			return func(dst, src []byte) { copy(dst, src) }, nil
+		}
+		return func(dst, src []byte) {
+			for i := 0; i+int(n) <= len(src); i += int(n) {
+				for b := 0; b < int(n); b++ {
+					dst[i+b] = src[i+int(n)-1-b]
+				}
+			}
+		}, nil
+	case f.channels == 1 && values.ValuesPerElement() == 1 && srcBytes < dstBytes && !f.float:
+		return func(dst, src []byte) {
+			for i, j := 0, 0; i+int(n) <= len(src); i, j = i+int(n), j+int(dstBytes) {
+				for b := 0; b < int(n); b++ {
+					if f.bigEndian {
+						dst[j+b] = src[i+int(n)-1-b]
+					} else {
+						dst[j+b] = src[i+b]
+					}
+				}
+				var ext byte
+				if f.signed && dst[j+int(n)-1]&0x80 != 0 {
+					ext = 0xFF
+				}
+				for b := int(n); b < int(dstBytes); b++ {
+					dst[j+b] = ext
+				}
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("can't convert %d channel(s) of %d byte values into %d channel(s) of %d bytes/voxel",
+			f.channels, f.valueBytes, values.ValuesPerElement(), dstBytes)
+	}
+}
+
+// ---- Multi-page TIFF stacks
+
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPlanarConfig    = 284
+	tiffPredictor       = 317
+	tiffTileWidth       = 322
+	tiffSampleFormat    = 339
+
+	tiffCompressNone       = 1
+	tiffCompressDeflate    = 8
+	tiffCompressDeflateOld = 32946
+
+	tiffSampleUint  = 1
+	tiffSampleInt   = 2
+	tiffSampleFloat = 3
+)
+
+type tiffHeader struct {
+	order   binary.ByteOrder
+	bigTIFF bool
+	first   uint64
+}
+
+func readTIFFHeader(r io.ReaderAt) (*tiffHeader, error) {
+	buf := make([]byte, 16)
+	if _, err := r.ReadAt(buf[:8], 0); err != nil {
+		return nil, fmt.Errorf("unable to read TIFF header: %v", err)
+	}
+	var h tiffHeader
+	switch string(buf[:2]) {
+	case "II":
+		h.order = binary.LittleEndian
+	case "MM":
+		h.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	switch h.order.Uint16(buf[2:4]) {
+	case 42:
+		h.first = uint64(h.order.Uint32(buf[4:8]))
+	case 43:
+		if _, err := r.ReadAt(buf, 0); err != nil {
+			return nil, fmt.Errorf("unable to read BigTIFF header: %v", err)
+		}
+		h.bigTIFF = true
+		h.first = h.order.Uint64(buf[8:16])
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	return &h, nil
+}
+
+// returns the offsets of the IFD for each page in a TIFF file.
+func tiffPageOffsets(r io.ReaderAt) ([]uint64, error) {
+	h, err := readTIFFHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []uint64
+	seen := make(map[uint64]bool)
+	for offset := h.first; offset != 0; {
+		if seen[offset] {
+			return nil, fmt.Errorf("circular IFD chain in TIFF file")
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+		if offset, err = h.nextIFD(r, offset); err != nil {
+			return nil, err
+		}
+	}
+	return offsets, nil
+}
+
+func (h *tiffHeader) numEntries(r io.ReaderAt, offset uint64) (n uint64, entryStart uint64, entrySize uint64, err error) {
+	buf := make([]byte, 8)
+	if h.bigTIFF {
+		if _, err = r.ReadAt(buf, int64(offset)); err != nil {
+			return
+		}
+		return h.order.Uint64(buf), offset + 8, 20, nil
+	}
+	if _, err = r.ReadAt(buf[:2], int64(offset)); err != nil {
+		return
+	}
+	return uint64(h.order.Uint16(buf[:2])), offset + 2, 12, nil
+}
+
+func (h *tiffHeader) nextIFD(r io.ReaderAt, offset uint64) (uint64, error) {
+	n, start, size, err := h.numEntries(r, offset)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 8)
+	if h.bigTIFF {
+		if _, err := r.ReadAt(buf, int64(start+n*size)); err != nil {
+			return 0, err
+		}
+		return h.order.Uint64(buf), nil
+	}
+	if _, err := r.ReadAt(buf[:4], int64(start+n*size)); err != nil {
+		return 0, err
+	}
+	return uint64(h.order.Uint32(buf[:4])), nil
+}
+
+// reads the tags of an IFD, returning the integer values for each tag.
+func (h *tiffHeader) readIFD(r io.ReaderAt, offset uint64) (map[uint16][]uint64, error) {
+	n, start, size, err := h.numEntries(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]byte, n*size)
+	if _, err := r.ReadAt(entries, int64(start)); err != nil {
+		return nil, fmt.Errorf("unable to read TIFF IFD: %v", err)
+	}
+	tags := make(map[uint16][]uint64, n)
+	for i := uint64(0); i < n; i++ {
+		entry := entries[i*size : (i+1)*size]
+		tag := h.order.Uint16(entry[0:2])
+		fieldType := h.order.Uint16(entry[2:4])
+		var count uint64
+		var valueField []byte
+		if h.bigTIFF {
+			count = h.order.Uint64(entry[4:12])
+			valueField = entry[12:20]
+		} else {
+			count = uint64(h.order.Uint32(entry[4:8]))
+			valueField = entry[8:12]
+		}
+		var typeSize uint64
+		switch fieldType {
+		case 1: // BYTE
+			typeSize = 1
+		case 3: // SHORT
+			typeSize = 2
+		case 4: // LONG
+			typeSize = 4
+		case 16: // LONG8
+			typeSize = 8
+		default:
+			continue // not needed for image data
+		}
+		data := valueField
+		if typeSize*count > uint64(len(valueField)) {
+			var valueOffset uint64
+			if h.bigTIFF {
+				valueOffset = h.order.Uint64(valueField)
+			} else {
+				valueOffset = uint64(h.order.Uint32(valueField))
+			}
+			data = make([]byte, typeSize*count)
+			if _, err := r.ReadAt(data, int64(valueOffset)); err != nil {
+				return nil, fmt.Errorf("unable to read values of TIFF tag %d: %v", tag, err)
+			}
+		}
+		values := make([]uint64, count)
+		for j := uint64(0); j < count; j++ {
+			v := data[j*typeSize : (j+1)*typeSize]
+			switch typeSize {
+			case 1:
+				values[j] = uint64(v[0])
+			case 2:
+				values[j] = uint64(h.order.Uint16(v))
+			case 4:
+				values[j] = uint64(h.order.Uint32(v))
+			case 8:
+				values[j] = h.order.Uint64(v)
+			}
+		}
+		tags[tag] = values
+	}
+	return tags, nil
+}
+
+type tiffPage struct {
+	width, height int32
+	format        sampleFormat
+	compression   uint64
+	stripOffsets  []uint64
+	stripCounts   []uint64
+}
+
+func tagValue(tags map[uint16][]uint64, tag uint16, defaultValue uint64) uint64 {
+	if values, found := tags[tag]; found && len(values) != 0 {
+		return values[0]
+	}
+	return defaultValue
+}
+
+func (h *tiffHeader) readPage(r io.ReaderAt, offset uint64) (*tiffPage, error) {
+	tags, err := h.readIFD(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	if _, tiled := tags[tiffTileWidth]; tiled {
+		return nil, fmt.Errorf("tiled TIFF images are not supported")
+	}
+	if tagValue(tags, tiffPredictor, 1) != 1 {
+		return nil, fmt.Errorf("TIFF images with predictors are not supported")
+	}
+	page := &tiffPage{
+		width:        int32(tagValue(tags, tiffImageWidth, 0)),
+		height:       int32(tagValue(tags, tiffImageLength, 0)),
+		compression:  tagValue(tags, tiffCompression, tiffCompressNone),
+		stripOffsets: tags[tiffStripOffsets],
+		stripCounts:  tags[tiffStripByteCounts],
+	}
+	if page.width <= 0 || page.height <= 0 {
+		return nil, fmt.Errorf("bad TIFF page size %d x %d", page.width, page.height)
+	}
+	if len(page.stripOffsets) == 0 || len(page.stripOffsets) != len(page.stripCounts) {
+		return nil, fmt.Errorf("TIFF page has bad strip offsets or byte counts")
+	}
+	channels := tagValue(tags, tiffSamplesPerPixel, 1)
+	if channels > 1 && tagValue(tags, tiffPlanarConfig, 1) != 1 {
+		return nil, fmt.Errorf("only chunky (interleaved) multi-channel TIFF images are supported")
+	}
+	bits := tagValue(tags, tiffBitsPerSample, 1)
+	if bits%8 != 0 {
+		return nil, fmt.Errorf("TIFF images with %d bits per sample are not supported", bits)
+	}
+	page.format = sampleFormat{
+		valueBytes: int32(bits / 8),
+		channels:   int32(channels),
+		bigEndian:  h.order == binary.BigEndian,
+	}
+	switch tagValue(tags, tiffSampleFormat, tiffSampleUint) {
+	case tiffSampleUint:
+	case tiffSampleInt:
+		page.format.signed = true
+	case tiffSampleFloat:
+		page.format.float = true
+	default:
+		return nil, fmt.Errorf("TIFF sample format %d is not supported", tagValue(tags, tiffSampleFormat, 0))
+	}
+	switch page.compression {
+	case tiffCompressNone, tiffCompressDeflate, tiffCompressDeflateOld:
+	default:
+		return nil, fmt.Errorf("TIFF compression %d is not supported, only none and deflate", page.compression)
+	}
+	return page, nil
+}
+
+type tiffStack struct {
+	f       *os.File
+	header  *tiffHeader
+	offsets []uint64
+	size    dvid.Point3d
+	format  sampleFormat
+	convert func(dst, src []byte)
+	dstSize int32
+}
+
+func openTIFFStack(path string, values dvid.DataValues) (*tiffStack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &tiffStack{f: f, dstSize: values.BytesPerElement()}
+	if s.header, err = readTIFFHeader(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if s.offsets, err = tiffPageOffsets(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	page, err := s.header.readPage(f, s.offsets[0])
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	s.size = dvid.Point3d{page.width, page.height, int32(len(s.offsets))}
+	s.format = page.format
+	if s.convert, err = page.format.converter(values); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *tiffStack) Size() dvid.Point3d {
+	return s.size
+}
+
+func (s *tiffStack) ReadSlice(z int32) ([]byte, error) {
+	if z < 0 || z >= s.size[2] {
+		return nil, fmt.Errorf("TIFF page %d is outside the %d pages of %s", z, s.size[2], s.f.Name())
+	}
+	page, err := s.header.readPage(s.f, s.offsets[z])
+	if err != nil {
+		return nil, fmt.Errorf("%s page %d: %v", s.f.Name(), z, err)
+	}
+	if page.width != s.size[0] || page.height != s.size[1] || page.format != s.format {
+		return nil, fmt.Errorf("%s page %d differs in size or format from first page", s.f.Name(), z)
+	}
+	numBytes := int(page.width) * int(page.height) * int(s.format.voxelBytes())
+	raw := make([]byte, 0, numBytes)
+	for i, offset := range page.stripOffsets {
+		strip := make([]byte, page.stripCounts[i])
+		if _, err := s.f.ReadAt(strip, int64(offset)); err != nil {
+			return nil, fmt.Errorf("unable to read strip %d of %s page %d: %v", i, s.f.Name(), z, err)
+		}
+		if page.compression != tiffCompressNone {
+			zr, err := zlib.NewReader(bytes.NewBuffer(strip))
+			if err != nil {
+				return nil, fmt.Errorf("bad deflate strip %d of %s page %d: %v", i, s.f.Name(), z, err)
+			}
+			if strip, err = ioutil.ReadAll(zr); err != nil {
+				return nil, fmt.Errorf("bad deflate strip %d of %s page %d: %v", i, s.f.Name(), z, err)
+			}
+			zr.Close()
+		}
+		storage.FileBytesRead <- int(page.stripCounts[i])
+		raw = append(raw, strip...)
+	}
+	if len(raw) < numBytes {
+		return nil, fmt.Errorf("%s page %d has %d bytes of image data, expected %d", s.f.Name(), z, len(raw), numBytes)
+	}
+	data := make([]byte, int(page.width)*int(page.height)*int(s.dstSize))
+	s.convert(data, raw[:numBytes])
+	return data, nil
+}
+
+func (s *tiffStack) Close() error {
+	return s.f.Close()
+}
+
+// ---- N5 and Zarr chunk directories
+
+// chunkedVolume reads XY slices from a directory of chunks, decoding each layer of
+// chunks along z in parallel and caching it until slices move past it.
+type chunkedVolume struct {
+	dir       string
+	size      dvid.Point3d
+	chunkSize dvid.Point3d
+	dstSize   int32
+
+	// voxel in the data instance format used for missing chunks, or nil for zero.
+	fill []byte
+
+	// returns the path of a chunk file given its chunk coordinate.
+	chunkPath func(dvid.ChunkPoint3d) string
+
+	// decodes a chunk file into little-endian voxels in the data instance format and
+	// returns the dimensions of the chunk.
+	decode func([]byte) ([]byte, dvid.Point3d, error)
+
+	layerZ    int32
+	layer     []decodedChunk
+	fillChunk []byte
+}
+
+type decodedChunk struct {
+	data []byte
+	dims dvid.Point3d
+}
+
+func (v *chunkedVolume) Size() dvid.Point3d {
+	return v.size
+}
+
+func (v *chunkedVolume) Close() error {
+	v.layer = nil
+	return nil
+}
+
+func (v *chunkedVolume) numChunks(dim int) int32 {
+	return (v.size[dim] + v.chunkSize[dim] - 1) / v.chunkSize[dim]
+}
+
+func (v *chunkedVolume) loadLayer(cz int32) error {
+	if v.fill != nil && v.fillChunk == nil {
+		v.fillChunk = bytes.Repeat(v.fill, int(v.chunkSize.Prod()))
+	}
+	nx, ny := v.numChunks(0), v.numChunks(1)
+	v.layer = make([]decodedChunk, nx*ny)
+	v.layerZ = cz
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	tokens := make(chan struct{}, runtime.NumCPU())
+	for cy := int32(0); cy < ny; cy++ {
+		for cx := int32(0); cx < nx; cx++ {
+			wg.Add(1)
+			tokens <- struct{}{}
+			go func(cx, cy int32) {
+				defer func() {
+					<-tokens
+					wg.Done()
+				}()
+				path := v.chunkPath(dvid.ChunkPoint3d{cx, cy, cz})
+				encoded, err := ioutil.ReadFile(path)
+				if os.IsNotExist(err) {
+					// missing chunks are treated as background
+					if v.fillChunk != nil {
+						v.layer[cy*nx+cx] = decodedChunk{data: v.fillChunk, dims: v.chunkSize}
+					}
+					return
+				}
+				var chunk decodedChunk
+				if err == nil {
+					chunk.data, chunk.dims, err = v.decode(encoded)
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("chunk %s: %v", path, err)
+					}
+					mu.Unlock()
+					return
+				}
+				storage.FileBytesRead <- len(encoded)
+				v.layer[cy*nx+cx] = chunk
+			}(cx, cy)
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (v *chunkedVolume) ReadSlice(z int32) ([]byte, error) {
+	if z < 0 || z >= v.size[2] {
+		return nil, fmt.Errorf("slice %d is outside the %d slices of %s", z, v.size[2], v.dir)
+	}
+	cz := z / v.chunkSize[2]
+	if v.layer == nil || cz != v.layerZ {
+		if err := v.loadLayer(cz); err != nil {
+			return nil, err
+		}
+	}
+	nx := v.numChunks(0)
+	rowBytes := v.size[0] * v.dstSize
+	data := make([]byte, v.size[1]*rowBytes)
+	zInChunk := z - cz*v.chunkSize[2]
+	for i, chunk := range v.layer {
+		if chunk.data == nil || zInChunk >= chunk.dims[2] {
+			continue
+		}
+		x0 := (int32(i) % nx) * v.chunkSize[0]
+		y0 := (int32(i) / nx) * v.chunkSize[1]
+		width := chunk.dims[0]
+		if x0+width > v.size[0] {
+			width = v.size[0] - x0
+		}
+		for y := int32(0); y < chunk.dims[1] && y0+y < v.size[1]; y++ {
+			srcI := ((zInChunk*chunk.dims[1] + y) * chunk.dims[0]) * v.dstSize
+			dstI := (y0+y)*rowBytes + x0*v.dstSize
+			copy(data[dstI:dstI+width*v.dstSize], chunk.data[srcI:srcI+width*v.dstSize])
+		}
+	}
+	return data, nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// returns the sample format for a N5 data type, which is always big-endian.
+func n5SampleFormat(dataType string) (sampleFormat, error) {
+	var nbytes int32
+	switch dataType {
+	case "uint8", "int8":
+		nbytes = 1
+	case "uint16", "int16":
+		nbytes = 2
+	case "uint32", "int32", "float32":
+		nbytes = 4
+	case "uint64", "int64", "float64":
+		nbytes = 8
+	default:
+		return sampleFormat{}, fmt.Errorf("unsupported N5 data type %q", dataType)
+	}
+	isFloat := strings.HasPrefix(dataType, "float")
+	isSigned := strings.HasPrefix(dataType, "int")
+	return sampleFormat{valueBytes: nbytes, channels: 1, bigEndian: true, float: isFloat, signed: isSigned}, nil
+}
+
+type n5Attributes struct {
+	Dimensions      []int32
+	BlockSize       []int32
+	DataType        string
+	CompressionType string
+	Compression     *struct {
+		Type string
+	}
+}
+
+func openN5(dir string, values dvid.DataValues) (*chunkedVolume, error) {
+	attrBytes, err := ioutil.ReadFile(filepath.Join(dir, "attributes.json"))
+	if err != nil {
+		return nil, err
+	}
+	var attrs n5Attributes
+	if err := json.Unmarshal(attrBytes, &attrs); err != nil {
+		return nil, fmt.Errorf("bad N5 attributes in %s: %v", dir, err)
+	}
+	if len(attrs.Dimensions) != 3 || len(attrs.BlockSize) != 3 {
+		return nil, fmt.Errorf("N5 dataset %s must be 3d", dir)
+	}
+	format, err := n5SampleFormat(attrs.DataType)
+	if err != nil {
+		return nil, err
+	}
+	convert, err := format.converter(values)
+	if err != nil {
+		return nil, err
+	}
+	compression := attrs.CompressionType
+	if attrs.Compression != nil {
+		compression = attrs.Compression.Type
+	}
+	if compression != "raw" && compression != "gzip" {
+		return nil, fmt.Errorf("N5 compression %q not supported, only raw and gzip", compression)
+	}
+	dstSize := values.BytesPerElement()
+	v := &chunkedVolume{
+		dir:       dir,
+		size:      dvid.Point3d{attrs.Dimensions[0], attrs.Dimensions[1], attrs.Dimensions[2]},
+		chunkSize: dvid.Point3d{attrs.BlockSize[0], attrs.BlockSize[1], attrs.BlockSize[2]},
+		dstSize:   dstSize,
+		chunkPath: func(c dvid.ChunkPoint3d) string {
+			return filepath.Join(dir, strconv.Itoa(int(c[0])), strconv.Itoa(int(c[1])), strconv.Itoa(int(c[2])))
+		},
+	}
+	v.decode = func(encoded []byte) ([]byte, dvid.Point3d, error) {
+		// N5 block header: uint16 mode, uint16 # dimensions, uint32 per dimension, and
+		// for varlength mode, an uint32 # of elements.  All big-endian.
+		var dims dvid.Point3d
+		if len(encoded) < 4 {
+			return nil, dims, fmt.Errorf("truncated N5 block header")
+		}
+		mode := binary.BigEndian.Uint16(encoded[0:2])
+		ndim := int(binary.BigEndian.Uint16(encoded[2:4]))
+		pos := 4 + 4*ndim
+		if mode == 1 {
+			pos += 4
+		} else if mode != 0 {
+			return nil, dims, fmt.Errorf("unsupported N5 block mode %d", mode)
+		}
+		if ndim != 3 || len(encoded) < pos {
+			return nil, dims, fmt.Errorf("bad N5 block header")
+		}
+		for i := 0; i < 3; i++ {
+			dims[i] = int32(binary.BigEndian.Uint32(encoded[4+4*i : 8+4*i]))
+		}
+		raw := encoded[pos:]
+		if compression == "gzip" {
+			var err error
+			if raw, err = gunzip(raw); err != nil {
+				return nil, dims, err
+			}
+		}
+		numVoxels := int(dims.Prod())
+		if len(raw) < numVoxels*int(format.voxelBytes()) {
+			return nil, dims, fmt.Errorf("N5 block has %d bytes, expected %d", len(raw), numVoxels*int(format.voxelBytes()))
+		}
+		data := make([]byte, numVoxels*int(dstSize))
+		convert(data, raw[:numVoxels*int(format.voxelBytes())])
+		return data, dims, nil
+	}
+	return v, nil
+}
+
+// returns the sample format for a Zarr dtype, e.g., "<u2" or "|u1".
+func zarrSampleFormat(dtype string) (sampleFormat, error) {
+	if len(dtype) < 3 {
+		return sampleFormat{}, fmt.Errorf("bad Zarr dtype %q", dtype)
+	}
+	var f sampleFormat
+	switch dtype[0] {
+	case '<', '|':
+	case '>':
+		f.bigEndian = true
+	default:
+		return f, fmt.Errorf("bad Zarr dtype %q", dtype)
+	}
+	if !strings.ContainsRune("uif", rune(dtype[1])) {
+		return f, fmt.Errorf("unsupported Zarr dtype %q", dtype)
+	}
+	nbytes, err := strconv.Atoi(dtype[2:])
+	if err != nil || (nbytes != 1 && nbytes != 2 && nbytes != 4 && nbytes != 8) {
+		return f, fmt.Errorf("unsupported Zarr dtype %q", dtype)
+	}
+	f.valueBytes = int32(nbytes)
+	f.channels = 1
+	f.float = dtype[1] == 'f'
+	f.signed = dtype[1] == 'i'
+	return f, nil
+}
+
+// returns a voxel in the data instance format for a Zarr fill_value, or nil if the
+// fill value is zero or null.  Floating point fill values can be "NaN", "Infinity",
+// or "-Infinity".
+func zarrFillVoxel(fillValue json.RawMessage, format sampleFormat, convert func(dst, src []byte), dstSize int32) ([]byte, error) {
+	if len(fillValue) == 0 || string(fillValue) == "null" {
+		return nil, nil
+	}
+	src := make([]byte, 8)
+	if format.float {
+		var f float64
+		var s string
+		if err := json.Unmarshal(fillValue, &s); err == nil {
+			switch s {
+			case "NaN":
+				f = math.NaN()
+			case "Infinity":
+				f = math.Inf(1)
+			case "-Infinity":
+				f = math.Inf(-1)
+			default:
+				return nil, fmt.Errorf("bad Zarr fill_value %q", s)
+			}
+		} else if err := json.Unmarshal(fillValue, &f); err != nil {
+			return nil, fmt.Errorf("bad Zarr fill_value %s: %v", fillValue, err)
+		}
+		switch format.valueBytes {
+		case 4:
+			binary.LittleEndian.PutUint32(src, math.Float32bits(float32(f)))
+		case 8:
+			binary.LittleEndian.PutUint64(src, math.Float64bits(f))
+		default:
+			return nil, fmt.Errorf("unsupported %d byte floating point fill_value", format.valueBytes)
+		}
+	} else {
+		bits := uint(format.valueBytes * 8)
+		if format.signed {
+			var v int64
+			if err := json.Unmarshal(fillValue, &v); err != nil {
+				return nil, fmt.Errorf("bad Zarr fill_value %s: %v", fillValue, err)
+			}
+			if bits < 64 && (v < -(1<<(bits-1)) || v >= 1<<(bits-1)) {
+				return nil, fmt.Errorf("Zarr fill_value %d out of range for %d-bit integers", v, bits)
+			}
+			binary.LittleEndian.PutUint64(src, uint64(v))
+		} else {
+			var v uint64
+			if err := json.Unmarshal(fillValue, &v); err != nil {
+				return nil, fmt.Errorf("bad Zarr fill_value %s: %v", fillValue, err)
+			}
+			if bits < 64 && v >= 1<<bits {
+				return nil, fmt.Errorf("Zarr fill_value %d out of range for %d-bit integers", v, bits)
+			}
+			binary.LittleEndian.PutUint64(src, v)
+		}
+	}
+	src = src[:format.valueBytes]
+	if format.bigEndian {
+		for i, j := 0, len(src)-1; i < j; i, j = i+1, j-1 {
+			src[i], src[j] = src[j], src[i]
+		}
+	}
+	voxel := make([]byte, dstSize)
+	convert(voxel, src)
+	for _, b := range voxel {
+		if b != 0 {
+			return voxel, nil
+		}
+	}
+	return nil, nil
+}
+
+type zarrAttributes struct {
+	Shape      []int32
+	Chunks     []int32
+	Dtype      string
+	Order      string
+	Compressor *struct {
+		ID string
+	}
+	FillValue          json.RawMessage `json:"fill_value"`
+	DimensionSeparator string          `json:"dimension_separator"`
+}
+
+func openZarr(dir string, values dvid.DataValues) (*chunkedVolume, error) {
+	attrBytes, err := ioutil.ReadFile(filepath.Join(dir, ".zarray"))
+	if err != nil {
+		return nil, err
+	}
+	var attrs zarrAttributes
+	if err := json.Unmarshal(attrBytes, &attrs); err != nil {
+		return nil, fmt.Errorf("bad Zarr metadata in %s: %v", dir, err)
+	}
+	if len(attrs.Shape) != 3 || len(attrs.Chunks) != 3 {
+		return nil, fmt.Errorf("Zarr array %s must be 3d", dir)
+	}
+	if attrs.Order != "" && attrs.Order != "C" {
+		return nil, fmt.Errorf("Zarr array %s must be in C order, not %q", dir, attrs.Order)
+	}
+	format, err := zarrSampleFormat(attrs.Dtype)
+	if err != nil {
+		return nil, err
+	}
+	convert, err := format.converter(values)
+	if err != nil {
+		return nil, err
+	}
+	var compressed bool
+	if attrs.Compressor != nil {
+		if attrs.Compressor.ID != "gzip" {
+			return nil, fmt.Errorf("Zarr compressor %q not supported, only raw and gzip", attrs.Compressor.ID)
+		}
+		compressed = true
+	}
+	fill, err := zarrFillVoxel(attrs.FillValue, format, convert, values.BytesPerElement())
+	if err != nil {
+		return nil, err
+	}
+	sep := attrs.DimensionSeparator
+	if sep == "" {
+		sep = "."
+	}
+
+	// Zarr shapes are in C order, i.e., z, y, x, and edge chunks are padded to full size.
+	dstSize := values.BytesPerElement()
+	chunkSize := dvid.Point3d{attrs.Chunks[2], attrs.Chunks[1], attrs.Chunks[0]}
+	v := &chunkedVolume{
+		dir:       dir,
+		size:      dvid.Point3d{attrs.Shape[2], attrs.Shape[1], attrs.Shape[0]},
+		chunkSize: chunkSize,
+		dstSize:   dstSize,
+		fill:      fill,
+		chunkPath: func(c dvid.ChunkPoint3d) string {
+			key := fmt.Sprintf("%d%s%d%s%d", c[2], sep, c[1], sep, c[0])
+			return filepath.Join(dir, filepath.FromSlash(key))
+		},
+	}
+	v.decode = func(encoded []byte) ([]byte, dvid.Point3d, error) {
+		raw := encoded
+		if compressed {
+			var err error
+			if raw, err = gunzip(encoded); err != nil {
+				return nil, chunkSize, err
+			}
+		}
+		numVoxels := int(chunkSize.Prod())
+		if len(raw) < numVoxels*int(format.voxelBytes()) {
+			return nil, chunkSize, fmt.Errorf("Zarr chunk has %d bytes, expected %d", len(raw), numVoxels*int(format.voxelBytes()))
+		}
+		data := make([]byte, numVoxels*int(dstSize))
+		convert(data, raw[:numVoxels*int(format.voxelBytes())])
+		return data, chunkSize, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,375 @@
+package imageblk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// Writes a little-endian, 8-bit multi-page TIFF with one strip per page.
+func writeTIFFStack(t *testing.T, filename string, size dvid.Point3d, data []byte, deflate bool) {
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, binary.LittleEndian, uint16(42))
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+
+	sliceBytes := int(size[0] * size[1])
+	for z := 0; z < int(size[2]); z++ {
+		strip := data[z*sliceBytes : (z+1)*sliceBytes]
+		compression := uint16(tiffCompressNone)
+		if deflate {
+			var zbuf bytes.Buffer
+			zw := zlib.NewWriter(&zbuf)
+			zw.Write(strip)
+			zw.Close()
+			strip = zbuf.Bytes()
+			compression = tiffCompressDeflate
+		}
+		const numEntries = 7
+		ifdBytes := 2 + numEntries*12 + 4
+		stripOffset := buf.Len() + ifdBytes
+		nextIFD := 0
+		if z != int(size[2])-1 {
+			nextIFD = stripOffset + len(strip)
+		}
+		entries := []struct {
+			tag, fieldType uint16
+			value          uint32
+		}{
+			{tiffImageWidth, 4, uint32(size[0])},
+			{tiffImageLength, 4, uint32(size[1])},
+			{tiffBitsPerSample, 3, 8},
+			{tiffCompression, 3, uint32(compression)},
+			{tiffStripOffsets, 4, uint32(stripOffset)},
+			{tiffRowsPerStrip, 4, uint32(size[1])},
+			{tiffStripByteCounts, 4, uint32(len(strip))},
+		}
+		binary.Write(&buf, binary.LittleEndian, uint16(numEntries))
+		for _, entry := range entries {
+			binary.Write(&buf, binary.LittleEndian, entry.tag)
+			binary.Write(&buf, binary.LittleEndian, entry.fieldType)
+			binary.Write(&buf, binary.LittleEndian, uint32(1))
+			if entry.fieldType == 3 {
+				binary.Write(&buf, binary.LittleEndian, uint16(entry.value))
+				binary.Write(&buf, binary.LittleEndian, uint16(0))
+			} else {
+				binary.Write(&buf, binary.LittleEndian, entry.value)
+			}
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(nextIFD))
+		buf.Write(strip)
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("unable to write TIFF stack: %v\n", err)
+	}
+}
+
+// returns the subvolume of a packed 8-bit volume.
+func subvolume(data []byte, size, offset, subsize dvid.Point3d) []byte {
+	out := make([]byte, subsize.Prod())
+	var i int
+	for z := offset[2]; z < offset[2]+subsize[2]; z++ {
+		for y := offset[1]; y < offset[1]+subsize[1]; y++ {
+			j := (z*size[1]+y)*size[0] + offset[0]
+			copy(out[i:i+int(subsize[0])], data[j:j+subsize[0]])
+			i += int(subsize[0])
+		}
+	}
+	return out
+}
+
+// Writes a gzip-compressed 8-bit N5 dataset with truncated edge blocks.
+func writeN5(t *testing.T, dir string, size, blockSize dvid.Point3d, data []byte) {
+	attrs := fmt.Sprintf(`{"dimensions":[%d,%d,%d],"blockSize":[%d,%d,%d],"dataType":"uint8","compression":{"type":"gzip"}}`,
+		size[0], size[1], size[2], blockSize[0], blockSize[1], blockSize[2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("unable to make N5 dir: %v\n", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "attributes.json"), []byte(attrs), 0644); err != nil {
+		t.Fatalf("unable to write N5 attributes: %v\n", err)
+	}
+	for z := int32(0); z < size[2]; z += blockSize[2] {
+		for y := int32(0); y < size[1]; y += blockSize[1] {
+			for x := int32(0); x < size[0]; x += blockSize[0] {
+				dims := blockSize
+				for i, v := range []int32{x, y, z} {
+					if v+dims[i] > size[i] {
+						dims[i] = size[i] - v
+					}
+				}
+				var buf bytes.Buffer
+				binary.Write(&buf, binary.BigEndian, uint16(0))
+				binary.Write(&buf, binary.BigEndian, uint16(3))
+				for i := 0; i < 3; i++ {
+					binary.Write(&buf, binary.BigEndian, uint32(dims[i]))
+				}
+				gw := gzip.NewWriter(&buf)
+				gw.Write(subvolume(data, size, dvid.Point3d{x, y, z}, dims))
+				gw.Close()
+				chunkDir := filepath.Join(dir, fmt.Sprintf("%d/%d", x/blockSize[0], y/blockSize[1]))
+				if err := os.MkdirAll(chunkDir, 0755); err != nil {
+					t.Fatalf("unable to make N5 chunk dir: %v\n", err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(chunkDir, fmt.Sprintf("%d", z/blockSize[2])), buf.Bytes(), 0644); err != nil {
+					t.Fatalf("unable to write N5 block: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// Writes an uncompressed 8-bit Zarr array with padded edge chunks.  Chunks with only the
+// fill value are omitted.
+func writeZarr(t *testing.T, dir string, size, chunkSize dvid.Point3d, data []byte, fill byte) {
+	attrs := fmt.Sprintf(`{"zarr_format":2,"shape":[%d,%d,%d],"chunks":[%d,%d,%d],"dtype":"|u1","compressor":null,"fill_value":%d,"order":"C"}`,
+		size[2], size[1], size[0], chunkSize[2], chunkSize[1], chunkSize[0], fill)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("unable to make Zarr dir: %v\n", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".zarray"), []byte(attrs), 0644); err != nil {
+		t.Fatalf("unable to write Zarr metadata: %v\n", err)
+	}
+	for z := int32(0); z < size[2]; z += chunkSize[2] {
+		for y := int32(0); y < size[1]; y += chunkSize[1] {
+			for x := int32(0); x < size[0]; x += chunkSize[0] {
+				dims := chunkSize
+				for i, v := range []int32{x, y, z} {
+					if v+dims[i] > size[i] {
+						dims[i] = size[i] - v
+					}
+				}
+				sub := subvolume(data, size, dvid.Point3d{x, y, z}, dims)
+				var nonfill bool
+				for _, v := range sub {
+					if v != fill {
+						nonfill = true
+						break
+					}
+				}
+				if !nonfill {
+					continue
+				}
+				chunk := make([]byte, chunkSize.Prod())
+				for cz := int32(0); cz < dims[2]; cz++ {
+					for cy := int32(0); cy < dims[1]; cy++ {
+						i := (cz*chunkSize[1] + cy) * chunkSize[0]
+						j := (cz*dims[1] + cy) * dims[0]
+						copy(chunk[i:i+dims[0]], sub[j:j+dims[0]])
+					}
+				}
+				key := fmt.Sprintf("%d.%d.%d", z/chunkSize[2], y/chunkSize[1], x/chunkSize[0])
+				if err := ioutil.WriteFile(filepath.Join(dir, key), chunk, 0644); err != nil {
+					t.Fatalf("unable to write Zarr chunk: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+func checkVolumeReader(t *testing.T, path string, size dvid.Point3d, expected []byte) {
+	if !IsVolumeFile(path) {
+		t.Fatalf("expected %s to be detected as a volume\n", path)
+	}
+	vol, err := OpenVolume(path, uint8EncodeFormat)
+	if err != nil {
+		t.Fatalf("unable to open volume %s: %v\n", path, err)
+	}
+	defer vol.Close()
+	if vol.Size() != size {
+		t.Fatalf("expected volume %s to have size %s, got %s\n", path, size, vol.Size())
+	}
+	sliceBytes := size[0] * size[1]
+	for z := int32(0); z < size[2]; z++ {
+		data, err := vol.ReadSlice(z)
+		if err != nil {
+			t.Fatalf("error reading slice %d of %s: %v\n", z, path, err)
+		}
+		if !bytes.Equal(data, expected[z*sliceBytes:(z+1)*sliceBytes]) {
+			t.Fatalf("slice %d of %s differs from expected data\n", z, path)
+		}
+	}
+}
+
+func TestVolumeReaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvid-volume-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	size := dvid.Point3d{70, 50, 40}
+	data := makeVolume(dvid.Point3d{0, 0, 0}, size)
+	// zero a corner so some Zarr chunks are missing.
+	for z := int32(0); z < 16; z++ {
+		for y := int32(0); y < 32; y++ {
+			for x := int32(0); x < 32; x++ {
+				data[(z*size[1]+y)*size[0]+x] = 0
+			}
+		}
+	}
+
+	writeTIFFStack(t, filepath.Join(dir, "stack.tif"), size, data, false)
+	checkVolumeReader(t, filepath.Join(dir, "stack.tif"), size, data)
+
+	writeTIFFStack(t, filepath.Join(dir, "deflate.tif"), size, data, true)
+	checkVolumeReader(t, filepath.Join(dir, "deflate.tif"), size, data)
+
+	writeN5(t, filepath.Join(dir, "vol.n5"), size, dvid.Point3d{32, 32, 16}, data)
+	checkVolumeReader(t, filepath.Join(dir, "vol.n5"), size, data)
+
+	writeZarr(t, filepath.Join(dir, "vol.zarr"), size, dvid.Point3d{32, 32, 16}, data, 0)
+	checkVolumeReader(t, filepath.Join(dir, "vol.zarr"), size, data)
+
+	// missing Zarr chunks should be set to a nonzero fill value.
+	filled := make([]byte, len(data))
+	copy(filled, data)
+	for z := int32(0); z < 16; z++ {
+		for y := int32(0); y < 32; y++ {
+			for x := int32(0); x < 32; x++ {
+				filled[(z*size[1]+y)*size[0]+x] = 9
+			}
+		}
+	}
+	writeZarr(t, filepath.Join(dir, "filled.zarr"), size, dvid.Point3d{32, 32, 16}, filled, 9)
+	if _, err := os.Stat(filepath.Join(dir, "filled.zarr", "0.0.0")); !os.IsNotExist(err) {
+		t.Fatalf("expected fill-only Zarr chunk to be omitted\n")
+	}
+	checkVolumeReader(t, filepath.Join(dir, "filled.zarr"), size, filled)
+
+	// a single page TIFF is left to the 2d image loader.
+	writeTIFFStack(t, filepath.Join(dir, "single.tif"), dvid.Point3d{70, 50, 1}, data, false)
+	if IsVolumeFile(filepath.Join(dir, "single.tif")) {
+		t.Errorf("single page TIFF should not be detected as a volume\n")
+	}
+}
+
+func TestVolumeWidening(t *testing.T) {
+	labelValues := dvid.DataValues{{T: dvid.T_uint64, Label: "labels"}}
+	f := sampleFormat{valueBytes: 2, channels: 1, bigEndian: true}
+	convert, err := f.converter(labelValues)
+	if err != nil {
+		t.Fatalf("unable to get uint16 to uint64 converter: %v\n", err)
+	}
+	dst := make([]byte, 16)
+	convert(dst, []byte{0x01, 0x02, 0xFF, 0x00})
+	if v := binary.LittleEndian.Uint64(dst[0:8]); v != 0x0102 {
+		t.Errorf("expected first converted label 0x0102, got 0x%x\n", v)
+	}
+	if v := binary.LittleEndian.Uint64(dst[8:16]); v != 0xFF00 {
+		t.Errorf("expected second converted label 0xFF00, got 0x%x\n", v)
+	}
+	if _, err := f.converter(uint8EncodeFormat); err == nil {
+		t.Errorf("expected error narrowing uint16 to uint8\n")
+	}
+
+	// signed values should be sign-extended.
+	f = sampleFormat{valueBytes: 2, channels: 1, signed: true}
+	if convert, err = f.converter(labelValues); err != nil {
+		t.Fatalf("unable to get int16 to uint64 converter: %v\n", err)
+	}
+	convert(dst, []byte{0xFE, 0xFF, 0x05, 0x00})
+	if v := int64(binary.LittleEndian.Uint64(dst[0:8])); v != -2 {
+		t.Errorf("expected first converted value -2, got %d\n", v)
+	}
+	if v := binary.LittleEndian.Uint64(dst[8:16]); v != 5 {
+		t.Errorf("expected second converted value 5, got %d\n", v)
+	}
+
+	// floating point and integer samples should not be converted into each other.
+	f = sampleFormat{valueBytes: 8, channels: 1, float: true}
+	if _, err := f.converter(labelValues); err == nil {
+		t.Errorf("expected error converting float64 samples to uint64\n")
+	}
+	f = sampleFormat{valueBytes: 4, channels: 1}
+	if _, err := f.converter(dvid.DataValues{{T: dvid.T_float32, Label: "intensity"}}); err == nil {
+		t.Errorf("expected error converting uint32 samples to float32\n")
+	}
+}
+
+func TestZarrFillValue(t *testing.T) {
+	labelValues := dvid.DataValues{{T: dvid.T_uint64, Label: "labels"}}
+	f := sampleFormat{valueBytes: 2, channels: 1, bigEndian: true, signed: true}
+	convert, err := f.converter(labelValues)
+	if err != nil {
+		t.Fatalf("unable to get converter: %v\n", err)
+	}
+	fill, err := zarrFillVoxel([]byte("-3"), f, convert, 8)
+	if err != nil {
+		t.Fatalf("unable to get fill voxel: %v\n", err)
+	}
+	if v := int64(binary.LittleEndian.Uint64(fill)); v != -3 {
+		t.Errorf("expected fill value -3, got %d\n", v)
+	}
+	for _, zero := range []string{"", "null", "0"} {
+		if fill, err = zarrFillVoxel([]byte(zero), f, convert, 8); err != nil || fill != nil {
+			t.Errorf("expected no fill voxel for fill_value %q, got %v (%v)\n", zero, fill, err)
+		}
+	}
+	if _, err = zarrFillVoxel([]byte("40000"), f, convert, 8); err == nil {
+		t.Errorf("expected error for out of range fill_value\n")
+	}
+
+	f = sampleFormat{valueBytes: 4, channels: 1, float: true}
+	floatValues := dvid.DataValues{{T: dvid.T_float32, Label: "intensity"}}
+	if convert, err = f.converter(floatValues); err != nil {
+		t.Fatalf("unable to get float32 converter: %v\n", err)
+	}
+	if fill, err = zarrFillVoxel([]byte(`"NaN"`), f, convert, 4); err != nil {
+		t.Fatalf("unable to get NaN fill voxel: %v\n", err)
+	}
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(fill)); !math.IsNaN(float64(v)) {
+		t.Errorf("expected NaN fill value, got %f\n", v)
+	}
+	if fill, err = zarrFillVoxel([]byte("1.5"), f, convert, 4); err != nil {
+		t.Fatalf("unable to get fill voxel: %v\n", err)
+	}
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(fill)); v != 1.5 {
+		t.Errorf("expected 1.5 fill value, got %f\n", v)
+	}
+}
+
+func TestLoadVolume(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	dir, err := ioutil.TempDir("", "dvid-volume-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	uuid, versionID := initTestRepo()
+	grayscale := makeGrayscale(uuid, t, "grayscale")
+
+	size := dvid.Point3d{70, 50, 40}
+	data := makeVolume(dvid.Point3d{0, 0, 0}, size)
+	writeN5(t, filepath.Join(dir, "vol.n5"), size, dvid.Point3d{32, 32, 16}, data)
+
+	offset := dvid.Point3d{32, 64, 96}
+	if err := grayscale.LoadImages(versionID, offset, []string{filepath.Join(dir, "vol.n5")}); err != nil {
+		t.Fatalf("unable to load N5 volume: %v\n", err)
+	}
+
+	v, err := grayscale.NewVoxels(dvid.NewSubvolume(offset, size), nil)
+	if err != nil {
+		t.Fatalf("unable to make voxels: %v\n", err)
+	}
+	if err = grayscale.GetVoxels(versionID, v, ""); err != nil {
+		t.Fatalf("unable to get voxels: %v\n", err)
+	}
+	if !bytes.Equal(v.Data(), data) {
+		t.Errorf("loaded N5 volume differs from original data\n")
+	}
+}
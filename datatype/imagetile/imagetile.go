@@ -23,9 +23,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/datatype/labelarray"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -63,15 +65,23 @@ $ dvid repo <UUID> new imagetile <data name> <settings...>
 					  tile request time and is a better choice if you primarily ask for arbitrary sized images
 					  (via GET .../raw/... or .../isotropic/...) instead of tiles (via GET .../tile/...)
 	Versioned      "true" or "false" (default)
-	Source         Name of uint8blk data instance if using the tile "generate" command below.
+	Source         Name of uint8blk or labelarray data instance if using the tile "generate" command
+					  below.  Tiles from labelarray are stored as uint64 labels if Format is "lz4",
+					  otherwise as pseudocolor images using the hashing of the labelarray
+					  "pseudocolor" endpoint.
 	Placeholder    Bool ("false", "true", "0", or "1").  Return placeholder tile if missing.
+	OnDemand       Bool ("false", "true", "0", or "1").  Render missing tiles from Source when
+					  requested and store them for reuse.  Requires Source and tile metadata, which
+					  can be set by the "metadata" endpoint.  To delete stored tiles when Source is
+					  changed, sync the instance to Source via the "sync" endpoint.
 
 
 $ dvid node <UUID> <data name> generate [settings]
 $ dvid -stdin node <UUID> <data name> generate [settings] < config.json
 
 	Generates multiresolution XY, XZ, and YZ imagetile from Source to repo with specified UUID.
-	The resolutions at each scale and the dimensions of the tiles are passed in the configuration
+	For labelarray sources, each tile is read from the labelarray scale matching the tile scale,
+	or subsampled from the coarsest labelarray scale for lower resolution tiles.  The resolutions at each scale and the dimensions of the tiles are passed in the configuration
 	JSON.  Only integral multiplications of original resolutions are allowed for scale.  If you
 	want more sophisticated processing, post the imagetile tiles directly via HTTP.  Note that
 	the generated tiles are aligned in a grid having (0,0,0) as a top left corner of a tile, not
@@ -194,6 +204,27 @@ POST <api URL>/node/<UUID>/<data name>/metadata
 	where "MinTileCoord" and "MaxTileCoord" are the minimum and maximum tile coordinates,
 	thereby defining the extent of the tiled volume when coupled with level "0" tile sizes.
 
+POST <api URL>/node/<UUID>/<data name>/sync?<options>
+
+	Establishes the Source data instance whose changes delete stored tiles.  This is useful
+	for imagetile with OnDemand set, where deleted tiles are rendered again from the updated
+	Source when next requested, e.g., to keep segmentation overlays current after merges.  Expects JSON to be POSTed with the following format:
+
+	{ "sync": "grayscale" }
+
+	To delete syncs, pass an empty string of names with query string "replace=true":
+
+	{ "sync": "" }
+
+	The imagetile data type only accepts a sync to its Source uint8blk or labelarray data instance.
+	Any ingestion or mutation of Source blocks, including labelarray merges and splits, deletes
+	the tiles at all scales and planes that include those blocks.
+
+	POST Query-string Options:
+
+	replace    Set to "true" if you want passed syncs to replace and not be appended to current syncs.
+			   Default operation is false.
+
 
 GET  <api URL>/node/<UUID>/<data name>/tile/<dims>/<scaling>/<tile coord>[?noblanks=true]
 POST
@@ -202,8 +233,15 @@ POST
 	compression format, whereas arbitrary geometry calls require the DVID server to stitch images
 	together.
 
+	If the imagetile has OnDemand set, a missing tile within the Source extents is rendered from
+	the Source voxels and stored before being returned.  Tiles are not rendered if they would
+	require reading more than 4096 x 4096 Source voxels, so coarse scales of large tiles must
+	be precomputed.
+
 	The returned image format is dictated by the imagetile encoding.  PNG tiles are returned
 	if internal encoding is either lz4 or png.  JPG tiles are returned if internal encoding is JPG.
+	Tiles of labelarray labels stored as lz4 are returned as 16-bit RGBA PNG where the 8 bytes
+	of each pixel are the little-endian uint64 label.
 	The only reason to use lz4 for internal encoding is if the majority of endpoint use for
 	the data instance is via the "raw" endpoint where many tiles need to be stitched before
 	sending the requested image back.
@@ -230,6 +268,20 @@ POST
 
   	noblanks	  (only GET) If true, any tile request for tiles outside the currently stored extents
   				  will return a blank image.
+  	window        (only GET) Width of the value range, centered at "level", that is linearly
+  				  mapped to the full output range, e.g., "window=100&level=128".  When any
+  				  contrast option is given, the tile is decoded and re-encoded as PNG, or JPG
+  				  if that is the internal encoding, and color tiles are converted to grayscale.
+  	level         (only GET) Center of the window.
+  	gamma         (only GET) Gamma applied after any window, where each value v normalized
+  				  to [0,1] becomes v^(1/gamma).
+  	clahe         (only GET) Applies contrast-limited adaptive histogram equalization after any
+  				  window and gamma using square regions of the given width in tile pixels.
+  				  Regions are aligned across tiles of a scale and neighboring tiles are read,
+  				  so results are consistent across tile boundaries.  The width can be at
+  				  most 1024.
+  	cliplimit     (only GET) Limits CLAHE contrast as a multiple of the mean histogram count
+  				  (default 2).
 
 
 GET  <api URL>/node/<UUID>/<data name>/tilekey/<dims>/<scaling>/<tile coord>
@@ -308,6 +360,15 @@ GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format
 
 var (
 	ErrNoMetadataSet = errors.New("Tile metadata has not been POSTed yet.  GET requests require metadata to be POST.")
+
+	// pseudoColorValues describe the RGBA pixels of tiles computed from labelarray sources
+	// when tiles are stored as png or jpg.
+	pseudoColorValues = dvid.DataValues{
+		{T: dvid.T_uint8, Label: "red"},
+		{T: dvid.T_uint8, Label: "green"},
+		{T: dvid.T_uint8, Label: "blue"},
+		{T: dvid.T_uint8, Label: "alpha"},
+	}
 )
 
 func init() {
@@ -359,6 +420,15 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 		return nil, err
 	}
 
+	// See if missing tiles should be rendered from the source.
+	onDemand, found, err := c.GetBool("OnDemand")
+	if err != nil {
+		return nil, err
+	}
+	if onDemand && sourcename == "" {
+		return nil, fmt.Errorf("imagetile %q with OnDemand set must specify a Source", name)
+	}
+
 	// Determine encoding for tile storage and this dictates what kind of compression we use.
 	encoding, found, err := c.GetString("Format")
 	if err != nil {
@@ -408,6 +478,7 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 		Properties: Properties{
 			Source:      dvid.InstanceName(sourcename),
 			Placeholder: placeholder,
+			OnDemand:    onDemand,
 			Encoding:    format,
 		},
 	}
@@ -602,6 +673,10 @@ type Properties struct {
 	// be found.  This is useful in testing clients.
 	Placeholder bool
 
+	// OnDemand, when true, renders missing tiles from the Source data instance when requested
+	// and stores them for reuse.  Stored tiles are deleted when synced Source blocks change.
+	OnDemand bool
+
 	// Encoding describes encoding of the stored tile.  See imagetile.Format
 	Encoding Format
 
@@ -613,6 +688,16 @@ type Properties struct {
 type Data struct {
 	*datastore.Data
 	Properties
+
+	// Keep track of sync operations that could be updating the data.
+	datastore.Updater
+
+	// invalidations counts tile invalidations due to source changes so an on-demand tile
+	// rendered while its source changes isn't stored.
+	invalidations uint64
+
+	syncCh   chan datastore.SyncMessage
+	syncDone chan *sync.WaitGroup
 }
 
 // CopyPropertiesFrom copies the data instance-specific properties from a given
@@ -639,6 +724,7 @@ func (p *Properties) copyImmutable(p2 *Properties) {
 		p.Levels[scale] = TileScaleSpec{spec.LevelSpec.Duplicate(), spec.levelMag}
 	}
 	p.Placeholder = p2.Placeholder
+	p.OnDemand = p2.OnDemand
 	p.Encoding = p2.Encoding
 	p.Quality = p2.Quality
 }
@@ -676,8 +762,9 @@ func (d *Data) DefaultTileSpec(uuidStr string) (TileSpec, error) {
 	}
 	var ok bool
 	var src *imageblk.Data
-	src, ok = source.(*imageblk.Data)
-	if !ok {
+	if labelSrc, isLabels := source.(*labelarray.Data); isLabels {
+		src = labelSrc.Data
+	} else if src, ok = source.(*imageblk.Data); !ok {
 		return nil, fmt.Errorf("Cannot construct tile spec for non-voxels data: %s", d.Source)
 	}
 
@@ -866,6 +953,18 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		w.Header().Set("Content-Type", "application/json")
 		fmt.Fprintf(w, string(jsonBytes))
 
+	case "sync":
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST allowed to sync endpoint")
+			return
+		}
+		replace := r.URL.Query().Get("replace") == "true"
+		if err := datastore.SetSyncByJSON(d, uuid, replace, r.Body); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: sync (%s)", r.Method, r.URL)
+
 	case "metadata":
 		switch action {
 		case "post":
@@ -1110,6 +1209,27 @@ func (d *Data) ServeTile(ctx storage.Context, w http.ResponseWriter, r *http.Req
 		formatStr = parts[7]
 	}
 
+	contrast, err := dvid.ContrastOptionsFromQuery(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return err
+	}
+	if contrast.IsSet() {
+		img, err := d.getContrastTile(ctx, tileReq, contrast, noblanks)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return err
+		}
+		if img == nil {
+			http.NotFound(w, r)
+			return nil
+		}
+		if formatStr == "" && d.Encoding == JPG {
+			formatStr = "jpg"
+		}
+		return dvid.WriteImageHttp(w, img, formatStr)
+	}
+
 	data, err := d.getTileData(ctx, tileReq)
 	if err != nil {
 		server.BadRequest(w, r, err)
@@ -1183,7 +1303,13 @@ func (d *Data) getTileImage(ctx storage.Context, req TileReq) (image.Image, erro
 		return nil, nil // Not found
 	}
 
+	return d.decodeTile(data)
+}
+
+// decodeTile returns the image for stored tile data.
+func (d *Data) decodeTile(data []byte) (image.Image, error) {
 	var goImg image.Image
+	var err error
 	switch d.Encoding {
 	case LZ4:
 		var img dvid.Image
@@ -1204,6 +1330,95 @@ func (d *Data) getTileImage(ctx storage.Context, req TileReq) (image.Image, erro
 	return goImg, err
 }
 
+// planeTileCoord returns the tile coordinate with the given 2d tile coordinate within
+// the plane of a tile coordinate.
+func planeTileCoord(plane dvid.DataShape, tile dvid.ChunkPoint3d, x, y int32) (dvid.ChunkPoint3d, error) {
+	switch {
+	case plane.Equals(dvid.XY):
+		tile[0], tile[1] = x, y
+	case plane.Equals(dvid.XZ):
+		tile[0], tile[2] = x, y
+	case plane.Equals(dvid.YZ):
+		tile[1], tile[2] = x, y
+	default:
+		return tile, fmt.Errorf("tiles must be in XY, XZ, or YZ planes, not %s", plane)
+	}
+	return tile, nil
+}
+
+// getContrastTile returns a tile with contrast transforms applied.  For CLAHE, the
+// neighboring tiles at the same scale are read so equalization is consistent across tile
+// boundaries.  Missing tiles are treated as blank unless noblanks is true and the requested
+// tile is missing, in which case nil is returned.
+func (d *Data) getContrastTile(ctx storage.Context, req TileReq, opts dvid.ContrastOptions, noblanks bool) (image.Image, error) {
+	levelSpec, found := d.Levels[req.scale]
+	if !found {
+		return nil, fmt.Errorf("Could not find tile specification at given scale %d", req.scale)
+	}
+	tileW, tileH, err := req.plane.GetSize2D(levelSpec.TileSize)
+	if err != nil {
+		return nil, err
+	}
+	tileX, tileY, err := req.plane.GetSize2D(req.tile)
+	if err != nil {
+		return nil, err
+	}
+	if noblanks {
+		data, err := d.getTileData(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, nil
+		}
+	}
+	bounds := image.Rect(int(tileX*tileW), int(tileY*tileH), int((tileX+1)*tileW), int((tileY+1)*tileH))
+	ctxBounds := opts.ContextBounds(bounds)
+
+	// Read all tiles intersecting the context into a canvas in global 2d coordinates.
+	tx0 := int32(math.Floor(float64(ctxBounds.Min.X) / float64(tileW)))
+	tx1 := int32(math.Floor(float64(ctxBounds.Max.X-1) / float64(tileW)))
+	ty0 := int32(math.Floor(float64(ctxBounds.Min.Y) / float64(tileH)))
+	ty1 := int32(math.Floor(float64(ctxBounds.Max.Y-1) / float64(tileH)))
+	tiles := make(map[image.Point]image.Image)
+	var format image.Image
+	for ty := ty0; ty <= ty1; ty++ {
+		for tx := tx0; tx <= tx1; tx++ {
+			tileCoord, err := planeTileCoord(req.plane, req.tile, tx, ty)
+			if err != nil {
+				return nil, err
+			}
+			data, err := d.getTileData(ctx, TileReq{tileCoord, req.plane, req.scale})
+			if err != nil {
+				return nil, err
+			}
+			if len(data) == 0 {
+				continue
+			}
+			goImg, err := d.decodeTile(data)
+			if err != nil {
+				return nil, err
+			}
+			pt := image.Pt(int(tx*tileW), int(ty*tileH))
+			tiles[pt] = goImg
+			if format == nil || (tx == tileX && ty == tileY) {
+				format = goImg
+			}
+		}
+	}
+	var canvas draw.Image
+	if _, is16 := format.(*image.Gray16); is16 {
+		canvas = image.NewGray16(ctxBounds)
+	} else {
+		canvas = image.NewGray(ctxBounds)
+	}
+	for pt, goImg := range tiles {
+		r := image.Rect(pt.X, pt.Y, pt.X+int(tileW), pt.Y+int(tileH))
+		draw.Draw(canvas, r, goImg, goImg.Bounds().Min, draw.Src)
+	}
+	return dvid.ContrastGoImage(canvas, opts, ctxBounds.Min, bounds)
+}
+
 // getTileData returns 2d tile data straight from storage without decoding.
 func (d *Data) getTileData(ctx storage.Context, req TileReq) ([]byte, error) {
 	// Don't allow negative tile coordinates for now.
@@ -1222,9 +1437,175 @@ func (d *Data) getTileData(ctx storage.Context, req TileReq) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error trying to GET from datastore: %v", err)
 	}
+	if len(data) == 0 && d.OnDemand {
+		return d.renderTile(ctx, req)
+	}
 	return data, nil
 }
 
+// MaxOnDemandVoxels is the maximum number of source voxels read to render a missing tile.
+// Coarse tiles that would require reading more voxels must be precomputed.
+const MaxOnDemandVoxels = 4096 * 4096
+
+// checkOnDemandSize returns an error if rendering a tile requires reading too many voxels.
+func checkOnDemandSize(req TileReq, width, height int32) error {
+	if voxels := int64(width) * int64(height); voxels > MaxOnDemandVoxels {
+		return fmt.Errorf("on-demand %s tile at scale %d would read %d voxels, more than maximum %d; precompute tiles at this scale",
+			req.plane, req.scale, voxels, MaxOnDemandVoxels)
+	}
+	return nil
+}
+
+// renderTile computes a missing tile from the Source data, stores it for reuse, and returns
+// the encoded tile data.  Nil data is returned if the tile is outside the source extents.
+func (d *Data) renderTile(ctx storage.Context, req TileReq) ([]byte, error) {
+	v := ctx.VersionID()
+	source, err := datastore.GetDataByVersionName(v, d.Source)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get source %q for %q on-demand tile: %v", d.Source, d.DataName(), err)
+	}
+	invalidations := atomic.LoadUint64(&d.invalidations)
+	tile, cacheable, err := d.sourceTile(v, source, req)
+	if err != nil || tile == nil {
+		return nil, err
+	}
+	data, err := d.encodeTile(tile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only store the tile if the source hasn't changed since we started reading it.
+	if cacheable && atomic.LoadUint64(&d.invalidations) == invalidations {
+		db, err := datastore.GetKeyValueDB(d)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Put(ctx, NewTKeyByTileReq(req), data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// sourceTile returns a tile image computed from uint8blk or labelarray source data, or nil
+// if the tile is outside the source extents.  The returned bool is false if the tile was
+// computed from source data still being updated and shouldn't be stored.
+func (d *Data) sourceTile(v dvid.VersionID, source datastore.DataService, req TileReq) (*dvid.Image, bool, error) {
+	var src *imageblk.Data
+	labelSrc, isLabels := source.(*labelarray.Data)
+	if isLabels {
+		src = labelSrc.Data
+	} else {
+		var ok bool
+		if src, ok = source.(*imageblk.Data); !ok {
+			return nil, false, fmt.Errorf("Cannot render imagetile for non-voxels data: %s", d.Source)
+		}
+	}
+	extents, err := src.GetExtents(datastore.NewVersionedCtx(source, v))
+	if err != nil {
+		return nil, false, err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil {
+		return nil, false, nil
+	}
+	bounds, err := d.computeVoxelBounds(req.tile, req.plane, req.scale)
+	if err != nil {
+		return nil, false, err
+	}
+	for dim := uint8(0); dim < 3; dim++ {
+		if bounds.MaxPoint.Value(dim) < extents.MinPoint.Value(dim) || bounds.MinPoint.Value(dim) > extents.MaxPoint.Value(dim) {
+			return nil, false, nil
+		}
+	}
+	if isLabels {
+		return d.labelTile(v, labelSrc, req)
+	}
+
+	// Read the full resolution voxels under the tile and downsample to the tile size.
+	width, height, err := req.plane.GetSize2D(bounds.MaxPoint.Sub(bounds.MinPoint).AddScalar(1))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkOnDemandSize(req, width, height); err != nil {
+		return nil, false, err
+	}
+	slice, err := dvid.NewOrthogSlice(req.plane, bounds.MinPoint, dvid.Point2d{width, height})
+	if err != nil {
+		return nil, false, err
+	}
+	voxels, err := src.NewVoxels(slice, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = src.GetVoxels(v, voxels, ""); err != nil {
+		return nil, false, err
+	}
+	if req.scale > 0 {
+		mag := int32(1) << req.scale
+		if err := voxels.DownRes(dvid.Point3d{mag, mag, mag}); err != nil {
+			return nil, false, err
+		}
+	}
+	tile, err := voxels.GetImage2d()
+	return tile, true, err
+}
+
+// labelTile returns a tile of labels, or its pseudocolor image if tiles aren't stored as lz4,
+// read from the labelarray scale closest to the tile scale.  The returned bool is false if
+// the labelarray is being mutated or that labelarray scale is still being computed.
+func (d *Data) labelTile(v dvid.VersionID, src *labelarray.Data, req TileReq) (*dvid.Image, bool, error) {
+	bounds, err := d.computeVoxelBounds(req.tile, req.plane, req.scale)
+	if err != nil {
+		return nil, false, err
+	}
+	tileW, tileH, err := req.plane.GetSize2D(d.Levels[req.scale].TileSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Labels past the coarsest labelarray scale are subsampled to the tile size.
+	scale := uint8(req.scale)
+	if maxScale := src.GetMaxDownresLevel(); scale > maxScale {
+		scale = maxScale
+	}
+	reduce := int32(1) << (uint8(req.scale) - scale)
+	if err := checkOnDemandSize(req, tileW*reduce, tileH*reduce); err != nil {
+		return nil, false, err
+	}
+	div := int32(1) << scale
+	offset := dvid.Point3d{bounds.MinPoint[0] / div, bounds.MinPoint[1] / div, bounds.MinPoint[2] / div}
+	slice, err := dvid.NewOrthogSlice(req.plane, offset, dvid.Point2d{tileW * reduce, tileH * reduce})
+	if err != nil {
+		return nil, false, err
+	}
+	lbl, err := src.NewLabels(slice, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	cacheable := !src.Updating() && !src.ScaleUpdating(scale)
+	if err := src.GetLabels(datastore.NewVersionedCtx(src, v), scale, lbl, nil, false); err != nil {
+		return nil, false, err
+	}
+	img, err := lbl.GetImage2d()
+	if err != nil {
+		return nil, false, err
+	}
+	if reduce > 1 {
+		if img, err = img.ScaleImage(int(tileW), int(tileH)); err != nil {
+			return nil, false, err
+		}
+	}
+	if d.Encoding == LZ4 {
+		return img, cacheable, nil
+	}
+	pseudoColor, err := labelarray.PseudoColorImage(img)
+	if err != nil {
+		return nil, false, err
+	}
+	tile, err := dvid.ImageFromGoImage(pseudoColor, pseudoColorValues, false)
+	return tile, cacheable, err
+}
+
 // getBlankTileData returns zero 2d tile image.
 func (d *Data) getBlankTileImage(req TileReq) (image.Image, error) {
 	levelSpec, found := d.Levels[req.scale]
@@ -1318,21 +1699,7 @@ func (d *Data) putTileFunc(versionID dvid.VersionID) (outFunc, error) {
 	ctx := datastore.NewVersionedCtx(d, versionID)
 
 	return func(req TileReq, tile *dvid.Image) error {
-		var err error
-		var data []byte
-
-		switch d.Encoding {
-		case LZ4:
-			compression, err := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
-			if err != nil {
-				return err
-			}
-			data, err = tile.Serialize(compression, d.Checksum())
-		case PNG:
-			data, err = tile.GetPNG()
-		case JPG:
-			data, err = tile.GetJPEG(d.Quality)
-		}
+		data, err := d.encodeTile(tile)
 		if err != nil {
 			return err
 		}
@@ -1340,6 +1707,24 @@ func (d *Data) putTileFunc(versionID dvid.VersionID) (outFunc, error) {
 	}, nil
 }
 
+// encodeTile returns the tile image in the instance's storage encoding.
+func (d *Data) encodeTile(tile *dvid.Image) ([]byte, error) {
+	switch d.Encoding {
+	case LZ4:
+		compression, err := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		return tile.Serialize(compression, d.Checksum())
+	case PNG:
+		return tile.GetPNG()
+	case JPG:
+		return tile.GetJPEG(d.Quality)
+	default:
+		return nil, fmt.Errorf("Unknown tile encoding: %s", d.Encoding)
+	}
+}
+
 func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datastore.Request) error {
 	config := request.Settings()
 	uuid, versionID, err := datastore.MatchingUUID(uuidStr)
@@ -1355,9 +1740,15 @@ func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datasto
 	if err != nil {
 		return fmt.Errorf("Cannot get source %q for %q tile construction: %v", d.Source, d.DataName(), err)
 	}
-	src, ok := source.(*imageblk.Data)
-	if !ok {
-		return fmt.Errorf("Cannot construct imagetile for non-voxels data: %s", d.Source)
+	var src *imageblk.Data
+	labelSrc, isLabels := source.(*labelarray.Data)
+	if isLabels {
+		src = labelSrc.Data
+	} else {
+		var ok bool
+		if src, ok = source.(*imageblk.Data); !ok {
+			return fmt.Errorf("Cannot construct imagetile for non-voxels data: %s", d.Source)
+		}
 	}
 
 	// Get size of tile at lowest resolution.
@@ -1437,6 +1828,11 @@ func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datasto
 	if err != nil {
 		return err
 	}
+	if isLabels {
+		mins := [3]*int32{minx, miny, minz}
+		maxs := [3]*int32{maxx, maxy, maxz}
+		return d.constructLabelTiles(versionID, labelSrc, planes, mins, maxs, outF)
+	}
 
 	// sort the tile spec keys to iterate from highest to lowest resolution
 	var sortedKeys []int
@@ -1641,3 +2037,73 @@ func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datasto
 	}
 	return nil
 }
+
+// constructLabelTiles generates tiles at all scales from labelarray data, reading each tile from
+// the labelarray scale closest to the tile scale.  Slices along the axis orthogonal to each plane
+// can be limited by the given minimums and maximums.
+func (d *Data) constructLabelTiles(versionID dvid.VersionID, src *labelarray.Data, planes []dvid.DataShape, mins, maxs [3]*int32, outF outFunc) error {
+	if src.MinPoint == nil || src.MaxPoint == nil {
+		return fmt.Errorf("Cannot construct imagetile for labelarray %q without data extents", src.DataName())
+	}
+	for _, plane := range planes {
+		var axis uint8
+		switch {
+		case plane.Equals(dvid.XY):
+			axis = 2
+		case plane.Equals(dvid.XZ):
+			axis = 1
+		case plane.Equals(dvid.YZ):
+			axis = 0
+		default:
+			dvid.Infof("Skipping request to tile '%s'.  Unsupported.", plane)
+			continue
+		}
+		timedLog := dvid.NewTimeLog()
+		slice0 := src.MinPoint.Value(axis)
+		slice1 := src.MaxPoint.Value(axis)
+		if mins[axis] != nil && slice0 < *mins[axis] {
+			slice0 = *mins[axis]
+		}
+		if maxs[axis] != nil && slice1 > *maxs[axis] {
+			slice1 = *maxs[axis]
+		}
+		for slice := slice0; slice <= slice1; slice++ {
+			server.BlockOnInteractiveRequests("imagetile.ConstructTiles [labels]")
+
+			var tile dvid.ChunkPoint3d
+			tile[axis] = slice
+			for scale := Scaling(0); scale < Scaling(len(d.Levels)); scale++ {
+				mag := int32(1) << scale
+				tileSize := d.Levels[scale].TileSize.Mult(dvid.Point3d{mag, mag, mag})
+				minTile := src.MinPoint.(dvid.Chunkable).Chunk(tileSize)
+				maxTile := src.MaxPoint.(dvid.Chunkable).Chunk(tileSize)
+				tx0, ty0, err := plane.GetSize2D(minTile)
+				if err != nil {
+					return err
+				}
+				tx1, ty1, err := plane.GetSize2D(maxTile)
+				if err != nil {
+					return err
+				}
+				for ty := ty0; ty <= ty1; ty++ {
+					for tx := tx0; tx <= tx1; tx++ {
+						tileCoord, err := planeTileCoord(plane, tile, tx, ty)
+						if err != nil {
+							return err
+						}
+						req := NewTileReq(tileCoord, plane, scale)
+						img, _, err := d.labelTile(versionID, src, req)
+						if err != nil {
+							return err
+						}
+						if err := outF(req, img); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+		timedLog.Infof("Total time to generate %s label tiles", plane)
+	}
+	return nil
+}
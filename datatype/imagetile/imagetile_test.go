@@ -5,13 +5,17 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"log"
+	"net/http"
 	"reflect"
 	"sync"
 	"testing"
 
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/imageblk"
 	"github.com/janelia-flyem/dvid/datatype/roi"
 	"github.com/janelia-flyem/dvid/dvid"
@@ -355,3 +359,248 @@ func TestTileCheck(t *testing.T) {
 	}
 
 }
+
+const testOnDemandMetadata = `
+{
+	"MinTileCoord": [0,0,0],
+	"MaxTileCoord": [1,1,1],
+	"Levels": {
+	    "0": {  "Resolution": [10.0, 10.0, 10.0], "TileSize": [32, 32, 32] },
+	    "1": {  "Resolution": [20.0, 20.0, 20.0], "TileSize": [32, 32, 32] }
+	}
+}
+`
+
+// Scale 1 tiles would each require reading 8192 x 8192 voxels.
+const testBigOnDemandMetadata = `
+{
+	"MinTileCoord": [0,0,0],
+	"MaxTileCoord": [0,0,0],
+	"Levels": {
+	    "0": {  "Resolution": [10.0, 10.0, 10.0], "TileSize": [32, 32, 32] },
+	    "1": {  "Resolution": [20.0, 20.0, 20.0], "TileSize": [4096, 4096, 4096] }
+	}
+}
+`
+
+func putUniformGrayscale(t *testing.T, uuid dvid.UUID, offset, size dvid.Point3d, value byte, mutate bool) {
+	data := bytes.Repeat([]byte{value}, int(size.Prod()))
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/%d_%d_%d/%d_%d_%d?mutate=%t", server.WebAPIPath,
+		uuid, size[0], size[1], size[2], offset[0], offset[1], offset[2], mutate)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(data))
+}
+
+func getGrayTile(t *testing.T, uuid dvid.UUID, tile string) *image.Gray {
+	apiStr := fmt.Sprintf("%snode/%s/tiles/tile/%s", server.WebAPIPath, uuid, tile)
+	img, err := png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("Unable to decode tile %s: %v\n", tile, err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("Expected gray tile %s, got %T\n", tile, img)
+	}
+	return gray
+}
+
+func TestOnDemandTiles(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+
+	config := dvid.NewConfig()
+	config.Set("Source", "grayscale")
+	config.Set("OnDemand", "true")
+	tileservice, err := datastore.NewData(uuid, mstype, "tiles", config)
+	if err != nil {
+		t.Fatalf("Unable to create imagetile instance: %v\n", err)
+	}
+	tiles := tileservice.(*Data)
+
+	url := fmt.Sprintf("%snode/%s/tiles/metadata", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(testOnDemandMetadata))
+	url = fmt.Sprintf("%snode/%s/tiles/sync", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(`{"sync": "grayscale"}`))
+
+	putUniformGrayscale(t, uuid, dvid.Point3d{0, 0, 0}, dvid.Point3d{64, 64, 64}, 10, false)
+	if err := datastore.BlockOnUpdating(uuid, "tiles"); err != nil {
+		t.Fatalf("Error blocking on sync of tiles: %v\n", err)
+	}
+
+	// Missing tiles should be rendered from the source and stored.
+	tile := getGrayTile(t, uuid, "xy/0/1_1_5")
+	if tile.Bounds().Dx() != 32 || tile.Bounds().Dy() != 32 || tile.GrayAt(3, 4).Y != 10 {
+		t.Errorf("Bad on-demand tile with bounds %s and value %d\n", tile.Bounds(), tile.GrayAt(3, 4).Y)
+	}
+	tile = getGrayTile(t, uuid, "xz/1/0_40_0")
+	if tile.Bounds().Dx() != 32 || tile.Bounds().Dy() != 32 || tile.GrayAt(31, 31).Y != 10 {
+		t.Errorf("Bad scale 1 on-demand tile with bounds %s and value %d\n", tile.Bounds(), tile.GrayAt(31, 31).Y)
+	}
+	db, err := datastore.GetKeyValueDB(tiles)
+	if err != nil {
+		t.Fatalf("Unable to get imagetile store: %v\n", err)
+	}
+	ctx := datastore.NewVersionedCtx(tiles, versionID)
+	storedXY := NewTKeyByTileReq(NewTileReq(dvid.ChunkPoint3d{1, 1, 5}, dvid.XY, 0))
+	storedXZ := NewTKeyByTileReq(NewTileReq(dvid.ChunkPoint3d{0, 40, 0}, dvid.XZ, 1))
+	for _, tk := range []storage.TKey{storedXY, storedXZ} {
+		if data, err := db.Get(ctx, tk); err != nil || len(data) == 0 {
+			t.Errorf("Expected on-demand tile to be stored: %v\n", err)
+		}
+	}
+
+	// Tiles outside the source extents are not rendered.
+	if data, err := tiles.getTileData(ctx, NewTileReq(dvid.ChunkPoint3d{3, 0, 5}, dvid.XY, 0)); err != nil || data != nil {
+		t.Errorf("Expected no tile outside source extents, got %d bytes, err %v\n", len(data), err)
+	}
+
+	// Mutating the source should delete the stored tiles so new data is rendered.
+	putUniformGrayscale(t, uuid, dvid.Point3d{32, 32, 0}, dvid.Point3d{32, 32, 32}, 200, true)
+	if err := datastore.BlockOnUpdating(uuid, "tiles"); err != nil {
+		t.Fatalf("Error blocking on sync of tiles: %v\n", err)
+	}
+	for _, tk := range []storage.TKey{storedXY, storedXZ} {
+		if data, err := db.Get(ctx, tk); err != nil || len(data) != 0 {
+			t.Errorf("Expected tile to be deleted after source mutation: %v\n", err)
+		}
+	}
+	tile = getGrayTile(t, uuid, "xy/0/1_1_5")
+	if tile.GrayAt(3, 4).Y != 200 {
+		t.Errorf("Expected re-rendered tile value 200, got %d\n", tile.GrayAt(3, 4).Y)
+	}
+	tile = getGrayTile(t, uuid, "xz/1/0_40_0")
+	if tile.GrayAt(0, 0).Y != 10 || tile.GrayAt(31, 0).Y != 200 || tile.GrayAt(31, 31).Y != 10 {
+		t.Errorf("Bad re-rendered scale 1 tile values %d, %d, %d\n", tile.GrayAt(0, 0).Y, tile.GrayAt(31, 0).Y, tile.GrayAt(31, 31).Y)
+	}
+
+	// Contrast requests honor noblanks and reject bad options.
+	apiStr := fmt.Sprintf("%snode/%s/tiles/tile/xy/0/3_0_5?gamma=2&noblanks=true", server.WebAPIPath, uuid)
+	if resp := server.TestHTTPResponse(t, "GET", apiStr, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing contrast tile with noblanks, got %d\n", resp.Code)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/tiles/tile/xy/0/3_0_5?gamma=2", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/tiles/tile/xy/0/1_1_5?clahe=%d", server.WebAPIPath, uuid, dvid.MaxCLAHERegion+1)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// Tiles that would read too many source voxels are not rendered on demand.
+	if _, err := datastore.NewData(uuid, mstype, "bigtiles", config); err != nil {
+		t.Fatalf("Unable to create imagetile instance: %v\n", err)
+	}
+	url = fmt.Sprintf("%snode/%s/bigtiles/metadata", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(testBigOnDemandMetadata))
+	apiStr = fmt.Sprintf("%snode/%s/bigtiles/tile/xy/1/0_0_5", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+}
+
+func getColorTile(t *testing.T, uuid dvid.UUID, name, tile string) *image.NRGBA {
+	apiStr := fmt.Sprintf("%snode/%s/%s/tile/%s", server.WebAPIPath, uuid, name, tile)
+	img, err := png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("Unable to decode tile %s: %v\n", tile, err)
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("Expected color tile %s, got %T\n", tile, img)
+	}
+	return nrgba
+}
+
+func TestLabelTiles(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "1")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	config = dvid.NewConfig()
+	config.Set("Source", "labels")
+	config.Set("OnDemand", "true")
+	server.CreateTestInstance(t, uuid, "imagetile", "overlay", config)
+	url := fmt.Sprintf("%snode/%s/overlay/metadata", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(testOnDemandMetadata))
+	url = fmt.Sprintf("%snode/%s/overlay/sync", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(`{"sync": "labels"}`))
+
+	// Label 1 for x < 32 and label 2 for x >= 32.
+	data := make([]byte, 64*64*64*8)
+	for i := 0; i < 64*64*64; i++ {
+		if i%64 < 32 {
+			data[i*8] = 1
+		} else {
+			data[i*8] = 2
+		}
+	}
+	url = fmt.Sprintf("%snode/%s/labels/raw/0_1_2/64_64_64/0_0_0", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(data))
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	// Tiles should be pseudocolored by label at each scale.
+	tile0 := getColorTile(t, uuid, "overlay", "xy/0/0_0_5")
+	tile1 := getColorTile(t, uuid, "overlay", "xy/0/1_0_5")
+	color1, color2 := tile0.NRGBAAt(3, 4), tile1.NRGBAAt(3, 4)
+	if color1 == color2 || color1.A != 255 || color2.A != 255 {
+		t.Errorf("Expected different opaque colors for labels 1 and 2, got %v and %v\n", color1, color2)
+	}
+	if tile0.NRGBAAt(31, 31) != color1 || tile1.NRGBAAt(0, 31) != color2 {
+		t.Errorf("Expected uniform pseudocolor within label tiles\n")
+	}
+	lores := getColorTile(t, uuid, "overlay", "xz/1/0_40_0")
+	if lores.NRGBAAt(3, 20) != color1 || lores.NRGBAAt(20, 3) != color2 {
+		t.Errorf("Bad scale 1 label tile colors %v and %v\n", lores.NRGBAAt(3, 20), lores.NRGBAAt(20, 3))
+	}
+
+	// After a merge, the tiles should be recomputed with the merged label color.
+	mergeJSON := `[1, 2]`
+	url = fmt.Sprintf("%snode/%s/labels/merge", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBufferString(mergeJSON))
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "overlay"); err != nil {
+		t.Fatalf("Error blocking on sync of overlay: %v\n", err)
+	}
+	tile1 = getColorTile(t, uuid, "overlay", "xy/0/1_0_5")
+	if tile1.NRGBAAt(3, 4) != color1 {
+		t.Errorf("Expected merged label color %v, got %v\n", color1, tile1.NRGBAAt(3, 4))
+	}
+	lores = getColorTile(t, uuid, "overlay", "xz/1/0_40_0")
+	if lores.NRGBAAt(20, 3) != color1 {
+		t.Errorf("Expected merged label color %v at scale 1, got %v\n", color1, lores.NRGBAAt(20, 3))
+	}
+}
+
+func TestTilesInBounds(t *testing.T) {
+	d := &Data{Properties: Properties{Levels: TileSpec{
+		0: TileScaleSpec{LevelSpec: LevelSpec{TileSize: dvid.Point3d{512, 512, 512}}},
+	}}}
+	got := make(map[string]struct{})
+	for _, req := range d.tilesInBounds(dvid.Point3d{-1, -1, 0}, dvid.Point3d{0, 0, 0}) {
+		got[string(NewTKeyByTileReq(req))] = struct{}{}
+	}
+
+	// Bounds straddling the origin touch the tiles on both sides in x and y.
+	for _, tile := range []dvid.ChunkPoint3d{{-1, -1, 0}, {0, -1, 0}, {-1, 0, 0}, {0, 0, 0}} {
+		if _, found := got[string(NewTKey(tile, dvid.XY, 0))]; !found {
+			t.Errorf("expected xy tile %s for bounds around origin\n", tile)
+		}
+	}
+	for _, tile := range []dvid.ChunkPoint3d{{-1, -1, 0}, {0, 0, 0}} {
+		if _, found := got[string(NewTKey(tile, dvid.XZ, 0))]; !found {
+			t.Errorf("expected xz tile %s for bounds around origin\n", tile)
+		}
+		if _, found := got[string(NewTKey(tile, dvid.YZ, 0))]; !found {
+			t.Errorf("expected yz tile %s for bounds around origin\n", tile)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+	This file supports keeping stored tiles in sync with changes to the source data.
+*/
+
+package imagetile
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/datatype/labelarray"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// Number of change messages we can buffer before blocking on sync channel.
+	syncBufferSize = 100
+
+	// Number of tile deletions committed in one batch during invalidation.
+	deleteBatchSize = 1000
+)
+
+// InitDataHandlers launches goroutines to handle each imagetile instance's syncs.
+func (d *Data) InitDataHandlers() error {
+	if d.syncCh != nil || d.syncDone != nil {
+		return nil
+	}
+	d.syncCh = make(chan datastore.SyncMessage, syncBufferSize)
+	d.syncDone = make(chan *sync.WaitGroup)
+
+	// Launch handlers of sync events.
+	dvid.Infof("Launching sync event handler for data %q...\n", d.DataName())
+	go d.processEvents()
+	return nil
+}
+
+// Shutdown terminates blocks until syncs are done then terminates background goroutines processing data.
+func (d *Data) Shutdown(wg *sync.WaitGroup) {
+	if d.syncDone != nil {
+		dwg := new(sync.WaitGroup)
+		dwg.Add(1)
+		d.syncDone <- dwg
+		dwg.Wait() // Block until we are done.
+	}
+	wg.Done()
+}
+
+// GetSyncSubs implements the datastore.Syncer interface.  Returns a list of subscriptions
+// to the Source data instance that will notify the receiver of block changes.  For labelarray
+// sources, this includes the blocks changed by merges and splits.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	if synced.DataName() != d.Source {
+		return nil, fmt.Errorf("imagetile %q can only sync with its source %q, not %q", d.DataName(), d.Source, synced.DataName())
+	}
+	var events []string
+	switch synced.(type) {
+	case *imageblk.Data:
+		events = []string{imageblk.IngestBlockEvent, imageblk.MutateBlockEvent}
+	case *labelarray.Data:
+		events = []string{labels.IngestBlockEvent, labels.MutateBlockEvent, labels.MergeBlockEvent, labels.SplitLabelEvent}
+	default:
+		return nil, fmt.Errorf("imagetile %q can only sync with uint8blk or labelarray data, not %q", d.DataName(), synced.DataName())
+	}
+	if d.syncCh == nil {
+		if err := d.InitDataHandlers(); err != nil {
+			return nil, fmt.Errorf("unable to initialize handlers for data %q: %v\n", d.DataName(), err)
+		}
+	}
+
+	subs := make(datastore.SyncSubs, len(events))
+	for i, event := range events {
+		subs[i] = datastore.SyncSub{
+			Event:  datastore.SyncEvent{synced.DataUUID(), event},
+			Notify: d.DataUUID(),
+			Ch:     d.syncCh,
+		}
+	}
+	return subs, nil
+}
+
+// If source blocks are ingested or mutated, or labels are merged or split, delete any stored
+// tiles that include the changed blocks.
+func (d *Data) processEvents() {
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		dvid.Errorf("Exiting sync goroutine for imagetile %q after source changes: %v\n", d.DataName(), err)
+		return
+	}
+	var stop bool
+	var wg *sync.WaitGroup
+	for {
+		select {
+		case wg = <-d.syncDone:
+			queued := len(d.syncCh)
+			if queued > 0 {
+				dvid.Infof("Received shutdown signal for %q sync events (%d in queue)\n", d.DataName(), queued)
+				stop = true
+			} else {
+				dvid.Infof("Shutting down sync event handler for instance %q...\n", d.DataName())
+				wg.Done()
+				return
+			}
+		case msg := <-d.syncCh:
+			d.StartUpdate()
+			ctx := datastore.NewVersionedCtx(d, msg.Version)
+			switch delta := msg.Delta.(type) {
+			case imageblk.Block:
+				d.invalidateBlocks(ctx, batcher, []dvid.ChunkPoint3d{dvid.ChunkPoint3d(*delta.Index)})
+			case imageblk.MutatedBlock:
+				d.invalidateBlocks(ctx, batcher, []dvid.ChunkPoint3d{dvid.ChunkPoint3d(*delta.Index)})
+			case labelarray.IngestedBlock:
+				d.invalidateLabelBlocks(ctx, batcher, dvid.IZYXSlice{delta.BCoord})
+			case labelarray.MutatedBlock:
+				d.invalidateLabelBlocks(ctx, batcher, dvid.IZYXSlice{delta.BCoord})
+			case labels.DeltaMerge:
+				d.invalidateLabelBlocks(ctx, batcher, delta.Blocks)
+			case labels.DeltaSplit:
+				if delta.SortedBlocks != nil {
+					d.invalidateLabelBlocks(ctx, batcher, delta.SortedBlocks)
+				} else {
+					d.invalidateLabelBlocks(ctx, batcher, delta.Split.SortedKeys())
+				}
+			default:
+				dvid.Criticalf("Cannot sync imagetile from source block change.  Got unexpected delta: %v\n", msg)
+			}
+			d.StopUpdate()
+
+			if stop && len(d.syncCh) == 0 {
+				dvid.Infof("Shutting down sync even handler for instance %q after draining sync events.\n", d.DataName())
+				wg.Done()
+				return
+			}
+		}
+	}
+}
+
+// invalidateLabelBlocks deletes the tiles that include voxels of the given labelarray blocks.
+func (d *Data) invalidateLabelBlocks(ctx *datastore.VersionedCtx, batcher storage.KeyValueBatcher, blocks dvid.IZYXSlice) {
+	bcoords := make([]dvid.ChunkPoint3d, 0, len(blocks))
+	for _, izyx := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			dvid.Errorf("Skipping bad block %s for imagetile %q invalidation: %v\n", izyx, d.DataName(), err)
+			continue
+		}
+		bcoords = append(bcoords, bcoord)
+	}
+	d.invalidateBlocks(ctx, batcher, bcoords)
+}
+
+// invalidateBlocks deletes the tiles at all scales and planes that include voxels of source blocks.
+func (d *Data) invalidateBlocks(ctx *datastore.VersionedCtx, batcher storage.KeyValueBatcher, bcoords []dvid.ChunkPoint3d) {
+	atomic.AddUint64(&d.invalidations, 1)
+	if len(d.Levels) == 0 {
+		return
+	}
+	source, err := datastore.GetDataByVersionName(ctx.VersionID(), d.Source)
+	if err != nil {
+		dvid.Errorf("Unable to get source %q for imagetile %q invalidation: %v\n", d.Source, d.DataName(), err)
+		return
+	}
+	var ok bool
+	var blockSize dvid.Point3d
+	switch src := source.(type) {
+	case *imageblk.Data:
+		blockSize, ok = src.BlockSize().(dvid.Point3d)
+	case *labelarray.Data:
+		blockSize, ok = src.BlockSize().(dvid.Point3d)
+	}
+	if !ok {
+		dvid.Errorf("Source %q for imagetile %q must be voxels data with 3d blocks\n", d.Source, d.DataName())
+		return
+	}
+
+	// Neighboring blocks share tiles, particularly at coarser scales, so only delete each
+	// tile once and commit the deletions in bounded batches.
+	deleted := make(map[string]struct{})
+	batch := batcher.NewBatch(ctx)
+	for _, bcoord := range bcoords {
+		minPt := bcoord.MinPoint(blockSize).(dvid.Point3d)
+		maxPt := bcoord.MaxPoint(blockSize).(dvid.Point3d)
+		for _, req := range d.tilesInBounds(minPt, maxPt) {
+			tk := NewTKeyByTileReq(req)
+			if _, found := deleted[string(tk)]; found {
+				continue
+			}
+			deleted[string(tk)] = struct{}{}
+			batch.Delete(tk)
+			if len(deleted)%deleteBatchSize == 0 {
+				if err := batch.Commit(); err != nil {
+					dvid.Errorf("Unable to delete tiles for %d blocks in imagetile %q: %v\n", len(bcoords), d.DataName(), err)
+					return
+				}
+				batch = batcher.NewBatch(ctx)
+			}
+		}
+	}
+	if len(deleted)%deleteBatchSize != 0 {
+		if err := batch.Commit(); err != nil {
+			dvid.Errorf("Unable to delete tiles for %d blocks in imagetile %q: %v\n", len(bcoords), d.DataName(), err)
+		}
+	}
+}
+
+// tilesInBounds returns the tile requests at all scales and planes for tiles that include voxels
+// within the given bounds.
+func (d *Data) tilesInBounds(minPt, maxPt dvid.Point3d) []TileReq {
+	var reqs []TileReq
+	for scale, spec := range d.Levels {
+		mag := int32(1) << scale
+		tileSize := spec.TileSize.Mult(dvid.Point3d{mag, mag, mag}).(dvid.Point3d)
+		// Chunk floors the tile coordinates so negative voxel coordinates map to the right tiles.
+		tileMin := minPt.Chunk(tileSize).(dvid.ChunkPoint3d)
+		tileMax := maxPt.Chunk(tileSize).(dvid.ChunkPoint3d)
+		for z := minPt[2]; z <= maxPt[2]; z++ {
+			for ty := tileMin[1]; ty <= tileMax[1]; ty++ {
+				for tx := tileMin[0]; tx <= tileMax[0]; tx++ {
+					reqs = append(reqs, NewTileReq(dvid.ChunkPoint3d{tx, ty, z}, dvid.XY, scale))
+				}
+			}
+		}
+		for y := minPt[1]; y <= maxPt[1]; y++ {
+			for tz := tileMin[2]; tz <= tileMax[2]; tz++ {
+				for tx := tileMin[0]; tx <= tileMax[0]; tx++ {
+					reqs = append(reqs, NewTileReq(dvid.ChunkPoint3d{tx, y, tz}, dvid.XZ, scale))
+				}
+			}
+		}
+		for x := minPt[0]; x <= maxPt[0]; x++ {
+			for tz := tileMin[2]; tz <= tileMax[2]; tz++ {
+				for ty := tileMin[1]; ty <= tileMax[1]; ty++ {
+					reqs = append(reqs, NewTileReq(dvid.ChunkPoint3d{x, ty, tz}, dvid.YZ, scale))
+				}
+			}
+		}
+	}
+	return reqs
+}
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -228,6 +232,102 @@ func TestKeyvalueRequests(t *testing.T) {
 	testRequest(t, uuid, versionID, "mykeyvalue")
 }
 
+func keyRequest(uuid dvid.UUID, name, key string) string {
+	return fmt.Sprintf("%snode/%s/%s/key/%s", server.WebAPIPath, uuid, name, key)
+}
+
+func checkArchivedKey(t *testing.T, uuid dvid.UUID, name, key, expected string) {
+	resp := server.TestHTTPResponse(t, "GET", keyRequest(uuid, name, key), nil)
+	if expected == "" {
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("expected key %q of %q @ %s to be absent, got status %d: %s\n", key, name, uuid, resp.Code, resp.Body.String())
+		}
+		return
+	}
+	if resp.Code != http.StatusOK || resp.Body.String() != expected {
+		t.Errorf("expected key %q of %q @ %s to be %q, got status %d: %s\n", key, name, uuid, expected, resp.Code, resp.Body.String())
+	}
+}
+
+func TestKeyvalueArchive(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "keyvalue", "archived", dvid.Config{})
+	server.CreateTestInstance(t, uuid, "keyvalue", "skipped", dvid.Config{})
+	server.TestHTTP(t, "POST", keyRequest(uuid, "archived", "a"), strings.NewReader("root a"))
+	server.TestHTTP(t, "POST", keyRequest(uuid, "archived", "gone"), strings.NewReader("root only"))
+	server.TestHTTP(t, "POST", keyRequest(uuid, "skipped", "x"), strings.NewReader("not exported"))
+	if err := datastore.Commit(uuid, "root", nil); err != nil {
+		t.Fatalf("couldn't commit root: %v\n", err)
+	}
+	child, err := datastore.NewVersion(uuid, "child", "", nil)
+	if err != nil {
+		t.Fatalf("couldn't create child version: %v\n", err)
+	}
+	server.TestHTTP(t, "POST", keyRequest(child, "archived", "a"), strings.NewReader("child a"))
+	server.TestHTTP(t, "POST", keyRequest(child, "archived", "b"), strings.NewReader("child b"))
+	server.TestHTTP(t, "DELETE", keyRequest(child, "archived", "gone"), nil)
+
+	dir, err := ioutil.TempDir("", "dvid-keyvalue-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	allFile := filepath.Join(dir, "all.dvid")
+	config := dvid.NewConfig()
+	config.Set("data", "archived")
+	if err := datastore.ExportRepo(child, allFile, config); err != nil {
+		t.Fatalf("couldn't export repo: %v\n", err)
+	}
+	flatFile := filepath.Join(dir, "flatten.dvid")
+	config = dvid.NewConfig()
+	config.Set("transmit", "flatten")
+	if err := datastore.ExportRepo(child, flatFile, config); err != nil {
+		t.Fatalf("couldn't export flattened repo: %v\n", err)
+	}
+	if err := datastore.DeleteRepo(uuid, "foobar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// All versions of just the selected instance should be restored.
+	if _, err := datastore.ImportRepo(allFile); err != nil {
+		t.Fatalf("couldn't import repo: %v\n", err)
+	}
+	checkArchivedKey(t, uuid, "archived", "a", "root a")
+	checkArchivedKey(t, uuid, "archived", "gone", "root only")
+	checkArchivedKey(t, uuid, "archived", "b", "")
+	checkArchivedKey(t, child, "archived", "a", "child a")
+	checkArchivedKey(t, child, "archived", "b", "child b")
+	checkArchivedKey(t, child, "archived", "gone", "")
+	if _, err := datastore.GetDataByUUIDName(uuid, "skipped"); err == nil {
+		t.Errorf("expected instance not selected for export to be absent after import\n")
+	}
+	if err := datastore.DeleteRepo(uuid, "foobar"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A flattened export holds only the exported version, which becomes the root.
+	root, err := datastore.ImportRepo(flatFile)
+	if err != nil {
+		t.Fatalf("couldn't import flattened repo: %v\n", err)
+	}
+	if root != child {
+		t.Errorf("expected flattened repo root %s, got %s\n", child, root)
+	}
+	if _, err := datastore.GetRepoRoot(uuid); err == nil {
+		t.Errorf("expected flattened repo to not hold root version %s\n", uuid)
+	}
+	checkArchivedKey(t, child, "archived", "a", "child a")
+	checkArchivedKey(t, child, "archived", "b", "child b")
+	checkArchivedKey(t, child, "archived", "gone", "")
+	checkArchivedKey(t, child, "skipped", "x", "not exported")
+}
+
 type resolveResp struct {
 	Child dvid.UUID `json:"child"`
 }
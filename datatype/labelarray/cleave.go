@@ -0,0 +1,202 @@
+/*
+	This file supports cleaving of a body into a new label by selecting pieces, either blocks
+	or labels from an immutable base labelarray, instead of voxels.
+*/
+
+package labelarray
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// CleaveOp gives the pieces of a body to be cleaved off into a new label.  Only one of
+// Blocks or Labels should be set.
+type CleaveOp struct {
+	// Block coordinates, where all voxels of the body within each block are cleaved.
+	Blocks []dvid.ChunkPoint3d `json:",omitempty"`
+
+	// Labels in the base labelarray, where all voxels of the body that have one of these
+	// labels in the base labelarray are cleaved.
+	Labels []uint64 `json:",omitempty"`
+}
+
+// CleaveLabel moves the given pieces of a label into a given cleave label or, if the given
+// cleave label is 0, a new label, which is returned.  Cleaving by blocks is done as a coarse
+// split and cleaving by base labels is done as a split, so the usual split events, Kafka
+// messages, and mutation records for undo are generated.  The cleave is rejected if either
+// label is checked out by a user other than the given user.
+func (d *Data) CleaveLabel(v dvid.VersionID, fromLabel, cleaveLabel uint64, op CleaveOp, user string) (toLabel uint64, err error) {
+	if d.MapSupervoxels {
+		err = fmt.Errorf("data %q maps supervoxels so cleaves must use SplitSupervoxels", d.DataName())
+		return
+	}
+	if len(op.Blocks) != 0 && len(op.Labels) != 0 {
+		err = fmt.Errorf("cleave of label %d must be given either blocks or base labels, not both", fromLabel)
+		return
+	}
+	if len(op.Blocks) == 0 && len(op.Labels) == 0 {
+		err = fmt.Errorf("cleave of label %d requires blocks or base labels", fromLabel)
+		return
+	}
+	var base *Data
+	if len(op.Labels) != 0 {
+		if base, err = d.getBaseLabels(v); err != nil {
+			return
+		}
+	}
+
+	// Only do one large mutation at a time, although each request can start many goroutines.
+	server.LargeMutationMutex.Lock()
+	defer server.LargeMutationMutex.Unlock()
+
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if err = labels.CheckoutConflict(iv, user, fromLabel, cleaveLabel); err != nil {
+		return
+	}
+	var meta *Meta
+	if meta, err = GetLabelIndex(d, v, fromLabel); err != nil {
+		return
+	}
+	if meta == nil || len(meta.Blocks) == 0 {
+		err = fmt.Errorf("label %d has no voxels in data %q", fromLabel, d.DataName())
+		return
+	}
+
+	var splits dvid.RLEs
+	if len(op.Blocks) != 0 {
+		splits = cleaveBlockRLEs(meta.Blocks, op.Blocks)
+	} else if splits, err = d.cleaveBaseRLEs(v, base, fromLabel, meta.Blocks, labels.NewSet(op.Labels...)); err != nil {
+		return
+	}
+	if len(splits) == 0 {
+		err = fmt.Errorf("no voxels of label %d are within the given pieces", fromLabel)
+		return
+	}
+
+	if cleaveLabel != 0 {
+		toLabel = cleaveLabel
+		if err = d.updateMaxLabel(v, cleaveLabel); err != nil {
+			return
+		}
+	} else if toLabel, err = d.NewLabel(v); err != nil {
+		return
+	}
+	dvid.Debugf("Cleaving label %d into label %d ...\n", fromLabel, toLabel)
+
+	if len(op.Blocks) != 0 {
+		err = d.splitCoarseLabels(v, fromLabel, toLabel, splits)
+	} else {
+		err = d.splitLabels(v, fromLabel, toLabel, splits)
+	}
+	if err != nil {
+		return
+	}
+	return toLabel, nil
+}
+
+// getBaseLabels returns the base labelarray used for cleaving by label.
+func (d *Data) getBaseLabels(v dvid.VersionID) (*Data, error) {
+	if d.BaseLabels == "" {
+		return nil, fmt.Errorf("data %q has no BaseLabels set for cleaving by label", d.DataName())
+	}
+	base, err := GetByVersionName(v, d.BaseLabels)
+	if err != nil {
+		return nil, err
+	}
+	baseSize, baseOK := base.BlockSize().(dvid.Point3d)
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok || !baseOK || !baseSize.Equals(blockSize) {
+		return nil, fmt.Errorf("base labels %q block size %s doesn't match block size %s of data %q", base.DataName(), base.BlockSize(), d.BlockSize(), d.DataName())
+	}
+	return base, nil
+}
+
+// cleaveBlockRLEs returns block coordinate RLEs for the given blocks that hold a label's
+// voxels according to its indexed blocks.
+func cleaveBlockRLEs(indexed dvid.IZYXSlice, blocks []dvid.ChunkPoint3d) dvid.RLEs {
+	inLabel := make(map[dvid.IZYXString]struct{}, len(indexed))
+	for _, izyx := range indexed {
+		inLabel[izyx] = struct{}{}
+	}
+	var rles dvid.RLEs
+	for _, block := range blocks {
+		izyx := block.ToIZYXString()
+		if _, found := inLabel[izyx]; !found {
+			continue
+		}
+		delete(inLabel, izyx) // prevent duplicate blocks
+		rles = append(rles, dvid.NewRLE(dvid.Point3d(block), 1))
+	}
+	return rles
+}
+
+// cleaveBaseRLEs returns the voxel RLEs of a label where the base labelarray has one of the
+// given base labels.
+func (d *Data) cleaveBaseRLEs(v dvid.VersionID, base *Data, label uint64, indexed dvid.IZYXSlice, baseLabels labels.Set) (dvid.RLEs, error) {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("can't cleave data %q with non-3d block size: %s", d.DataName(), d.BlockSize())
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	baseCtx := datastore.NewVersionedCtx(base, v)
+
+	var scale uint8
+	var rles dvid.RLEs
+	for _, bcoord := range indexed {
+		pb, err := d.getLabelBlock(ctx, scale, bcoord)
+		if err != nil {
+			return nil, err
+		}
+		basepb, err := base.getLabelBlock(baseCtx, scale, bcoord)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil || basepb == nil {
+			continue
+		}
+		offset, err := bcoord.VoxelOffset(blockSize)
+		if err != nil {
+			return nil, err
+		}
+		lblarray, err := pb.MakeLabelVolume()
+		if err != nil {
+			return nil, err
+		}
+		basearray, err := basepb.MakeLabelVolume()
+		if err != nil {
+			return nil, err
+		}
+
+		var i int
+		for z := int32(0); z < blockSize[2]; z++ {
+			for y := int32(0); y < blockSize[1]; y++ {
+				var runStart, runLength int32
+				for x := int32(0); x < blockSize[0]; x++ {
+					_, inBase := baseLabels[binary.LittleEndian.Uint64(basearray[i:i+8])]
+					if inBase && binary.LittleEndian.Uint64(lblarray[i:i+8]) == label {
+						if runLength == 0 {
+							runStart = x
+						}
+						runLength++
+					} else if runLength != 0 {
+						start := dvid.Point3d{offset[0] + runStart, offset[1] + y, offset[2] + z}
+						rles = append(rles, dvid.NewRLE(start, runLength))
+						runLength = 0
+					}
+					i += 8
+				}
+				if runLength != 0 {
+					start := dvid.Point3d{offset[0] + runStart, offset[1] + y, offset[2] + z}
+					rles = append(rles, dvid.NewRLE(start, runLength))
+				}
+			}
+		}
+	}
+	return rles, nil
+}
@@ -0,0 +1,365 @@
+/*
+	This file supports consistency checks of label indices against the actual label blocks.
+*/
+
+package labelarray
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Kinds of label index problems found by a consistency check.
+const (
+	ProblemMissingIndex  = "missing index"  // label is in blocks but has no index
+	ProblemStaleIndex    = "stale index"    // label has an index but isn't in any checked block
+	ProblemBlockMismatch = "block mismatch" // index blocks differ from blocks containing label
+)
+
+// IndexProblem describes a label index that disagrees with the label blocks.
+type IndexProblem struct {
+	Label   uint64
+	Problem string
+
+	// MissingBlocks are blocks containing the label that aren't in its index.
+	MissingBlocks []dvid.ChunkPoint3d `json:",omitempty"`
+
+	// ExtraBlocks are blocks in the label's index that don't contain the label.
+	ExtraBlocks []dvid.ChunkPoint3d `json:",omitempty"`
+}
+
+type indexProblems []IndexProblem
+
+func (p indexProblems) Len() int           { return len(p) }
+func (p indexProblems) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p indexProblems) Less(i, j int) bool { return p[i].Label < p[j].Label }
+
+// FsckOptions limit the scope of a consistency check and specify whether problems are repaired.
+type FsckOptions struct {
+	MinLabel uint64
+	MaxLabel uint64
+	ROI      *roi.Immutable // if non-nil, only blocks within the ROI are checked.
+	Repair   bool
+}
+
+// FsckReport gives the results of a consistency check of label indices.
+type FsckReport struct {
+	BlocksScanned uint64
+	LabelsChecked uint64
+	Problems      []IndexProblem
+	Repaired      uint64 // number of label indices rewritten or deleted
+}
+
+// labelBlocks holds the sorted blocks and total voxels of a label found by scanning blocks.
+type labelBlocks struct {
+	blocks dvid.IZYXSlice
+	voxels uint64
+}
+
+// diffBlocks returns the coordinates in sorted slice a but not b and those in b but not a.
+func diffBlocks(a, b dvid.IZYXSlice) (onlyA, onlyB dvid.IZYXSlice) {
+	var i, j int
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case a[i] < b[j]:
+			onlyA = append(onlyA, a[i])
+			i++
+		default:
+			onlyB = append(onlyB, b[j])
+			j++
+		}
+	}
+	onlyA = append(onlyA, a[i:]...)
+	onlyB = append(onlyB, b[j:]...)
+	return
+}
+
+func blockCoords(blocks dvid.IZYXSlice) ([]dvid.ChunkPoint3d, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	coords := make([]dvid.ChunkPoint3d, len(blocks))
+	for i, izyx := range blocks {
+		var err error
+		if coords[i], err = izyx.ToChunkPoint3d(); err != nil {
+			return nil, err
+		}
+	}
+	return coords, nil
+}
+
+// scanLabelBlocks reads all scale 0 label blocks, optionally limited to an ROI, and returns
+// the blocks and voxel counts for each label within the given label range.
+func (d *Data) scanLabelBlocks(ctx *datastore.VersionedCtx, opts FsckOptions) (map[uint64]*labelBlocks, uint64, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, 0, err
+	}
+	minIdx, maxIdx := dvid.MinIndexZYX, dvid.MaxIndexZYX
+	begTKey := NewBlockTKey(0, &minIdx)
+	endTKey := NewBlockTKey(0, &maxIdx)
+
+	found := make(map[uint64]*labelBlocks)
+	var numBlocks uint64
+	err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || c.V == nil {
+			return nil
+		}
+		scale, idx, err := DecodeBlockTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if scale != 0 {
+			return nil
+		}
+		izyx := idx.ToIZYXString()
+		if opts.ROI != nil && !opts.ROI.BlockWithin(izyx) {
+			return nil
+		}
+		data, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize block %s in %q: %v", izyx, d.DataName(), err)
+		}
+		var block labels.Block
+		if err := block.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("unable to unmarshal block %s in %q: %v", izyx, d.DataName(), err)
+		}
+		numBlocks++
+		for label, count := range block.CalcNumLabels(nil) {
+			if label == 0 || count <= 0 || label < opts.MinLabel || label > opts.MaxLabel {
+				continue
+			}
+			lb, ok := found[label]
+			if !ok {
+				lb = new(labelBlocks)
+				found[label] = lb
+			}
+			lb.blocks = append(lb.blocks, izyx) // blocks are scanned in sorted order
+			lb.voxels += uint64(count)
+		}
+		return nil
+	})
+	return found, numBlocks, err
+}
+
+// countLabelVoxels returns the number of voxels with the given label in the scale 0 blocks.
+func (d *Data) countLabelVoxels(ctx *datastore.VersionedCtx, label uint64, blocks dvid.IZYXSlice) (uint64, error) {
+	var voxels uint64
+	for _, izyx := range blocks {
+		pb, err := d.getLabelBlock(ctx, 0, izyx)
+		if err != nil {
+			return 0, err
+		}
+		if pb == nil {
+			continue
+		}
+		if count := pb.CalcNumLabels(nil)[label]; count > 0 {
+			voxels += uint64(count)
+		}
+	}
+	return voxels, nil
+}
+
+// Fsck checks the label indices of a version against the label blocks, reporting any
+// discrepancies and, if requested, repairing them.  If an ROI limits the check, voxel
+// counts of repaired indices are recomputed from all blocks in the repaired index.
+func (d *Data) Fsck(v dvid.VersionID, opts FsckOptions) (*FsckReport, error) {
+	if !d.IndexedLabels {
+		return nil, fmt.Errorf("data %q is not label indexed (IndexedLabels=false)", d.DataName())
+	}
+	if opts.MaxLabel == 0 {
+		opts.MaxLabel = math.MaxUint64
+	}
+	if opts.MinLabel > opts.MaxLabel {
+		return nil, fmt.Errorf("minimum label %d is greater than maximum label %d", opts.MinLabel, opts.MaxLabel)
+	}
+	if opts.ROI != nil {
+		blockSize, ok := d.BlockSize().(dvid.Point3d)
+		if !ok || !blockSize.Equals(opts.ROI.BlockSize()) {
+			return nil, fmt.Errorf("ROI block size %s must equal block size %s of data %q", opts.ROI.BlockSize(), d.BlockSize(), d.DataName())
+		}
+	}
+
+	// Prevent merges and splits while repairing.
+	if opts.Repair {
+		server.LargeMutationMutex.Lock()
+		defer server.LargeMutationMutex.Unlock()
+	}
+
+	timedLog := dvid.NewTimeLog()
+	ctx := datastore.NewVersionedCtx(d, v)
+	found, numBlocks, err := d.scanLabelBlocks(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &FsckReport{BlocksScanned: numBlocks}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	repairs := make(map[uint64]*Meta)
+	begTKey := NewLabelIndexTKey(opts.MinLabel)
+	endTKey := NewLabelIndexTKey(opts.MaxLabel)
+	err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || c.V == nil {
+			return nil
+		}
+		label, err := DecodeLabelIndexTKey(c.K)
+		if err != nil {
+			return err
+		}
+		val, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize index for label %d: %v", label, err)
+		}
+		if len(val) == 0 {
+			return nil // treated as no index.
+		}
+		var meta Meta
+		if err := meta.UnmarshalBinary(val); err != nil {
+			return fmt.Errorf("unable to unmarshal index for label %d: %v", label, err)
+		}
+		indexBlocks := meta.Blocks
+		if opts.ROI != nil {
+			indexBlocks = nil
+			for _, izyx := range meta.Blocks {
+				if opts.ROI.BlockWithin(izyx) {
+					indexBlocks = append(indexBlocks, izyx)
+				}
+			}
+		}
+		var scanned labelBlocks
+		if lb, ok := found[label]; ok {
+			scanned = *lb
+			delete(found, label)
+		} else if len(indexBlocks) == 0 && opts.ROI != nil {
+			return nil // label has nothing within ROI to check.
+		}
+		report.LabelsChecked++
+
+		extra, missing := diffBlocks(indexBlocks, scanned.blocks)
+		if len(extra) == 0 && len(missing) == 0 {
+			return nil
+		}
+		problem := IndexProblem{Label: label, Problem: ProblemBlockMismatch}
+		if len(scanned.blocks) == 0 {
+			problem.Problem = ProblemStaleIndex
+		}
+		if problem.MissingBlocks, err = blockCoords(missing); err != nil {
+			return err
+		}
+		if problem.ExtraBlocks, err = blockCoords(extra); err != nil {
+			return err
+		}
+		report.Problems = append(report.Problems, problem)
+
+		if opts.Repair {
+			repaired := Meta{Voxels: scanned.voxels, Blocks: meta.Blocks}
+			repaired.Blocks.Delete(extra)
+			repaired.Blocks.Merge(missing)
+			repairs[label] = &repaired
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Any labels remaining in scanned blocks have no index.
+	for label, lb := range found {
+		report.LabelsChecked++
+		problem := IndexProblem{Label: label, Problem: ProblemMissingIndex}
+		if problem.MissingBlocks, err = blockCoords(lb.blocks); err != nil {
+			return nil, err
+		}
+		report.Problems = append(report.Problems, problem)
+		if opts.Repair {
+			repairs[label] = &Meta{Voxels: lb.voxels, Blocks: lb.blocks}
+		}
+	}
+	sort.Sort(indexProblems(report.Problems))
+
+	for label, meta := range repairs {
+		if len(meta.Blocks) == 0 {
+			meta = nil
+		} else if opts.ROI != nil {
+			// Scanned counts only cover blocks within the ROI.
+			if meta.Voxels, err = d.countLabelVoxels(ctx, label, meta.Blocks); err != nil {
+				return report, fmt.Errorf("unable to count voxels for label %d: %v", label, err)
+			}
+		}
+		if err := SetLabelIndex(d, v, label, meta); err != nil {
+			return report, fmt.Errorf("unable to repair index for label %d: %v", label, err)
+		}
+		report.Repaired++
+	}
+	timedLog.Infof("Fsck of %q labels %d-%d: %d blocks, %d labels, %d problems, %d repaired", d.DataName(), opts.MinLabel, opts.MaxLabel, report.BlocksScanned, report.LabelsChecked, len(report.Problems), report.Repaired)
+	return report, nil
+}
+
+func (d *Data) handleFsck(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET  <api URL>/node/<UUID>/<data name>/fsck[?queryopts]
+	// POST <api URL>/node/<UUID>/<data name>/fsck[?queryopts]
+	var opts FsckOptions
+	switch strings.ToLower(r.Method) {
+	case "get":
+	case "post":
+		opts.Repair = true
+	default:
+		server.BadRequest(w, r, "Only GET or POST actions are available on 'fsck' endpoint.")
+		return
+	}
+	queryStrings := r.URL.Query()
+	var err error
+	if s := queryStrings.Get("minlabel"); s != "" {
+		if opts.MinLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+			server.BadRequest(w, r, "bad minlabel %q: %v", s, err)
+			return
+		}
+	}
+	if s := queryStrings.Get("maxlabel"); s != "" {
+		if opts.MaxLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+			server.BadRequest(w, r, "bad maxlabel %q: %v", s, err)
+			return
+		}
+	}
+	if roiname := queryStrings.Get("roi"); roiname != "" {
+		uuid, err := datastore.UUIDFromVersion(ctx.VersionID())
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if opts.ROI, err = roi.ImmutableBySpec(roiname + "," + string(uuid)); err != nil {
+			server.BadRequest(w, r, "bad ROI %q: %v", roiname, err)
+			return
+		}
+	}
+	report, err := d.Fsck(ctx.VersionID(), opts)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,153 @@
+package labelarray
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+func getFsckReport(t *testing.T, method string, uuid dvid.UUID, name string) FsckReport {
+	apiStr := fmt.Sprintf("%snode/%s/%s/fsck", server.WebAPIPath, uuid, name)
+	r := server.TestHTTP(t, method, apiStr, nil)
+	var report FsckReport
+	if err := json.Unmarshal(r, &report); err != nil {
+		t.Fatalf("unable to parse fsck report %q: %v\n", string(r), err)
+	}
+	return report
+}
+
+func TestFsck(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", dvid.Config{})
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{40, 40, 40}, 1)
+	volume.addSubvol(dvid.Point3d{90, 90, 90}, dvid.Point3d{20, 20, 20}, 2)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	report := getFsckReport(t, "GET", uuid, "labels")
+	if len(report.Problems) != 0 || report.LabelsChecked != 2 || report.BlocksScanned != 8 {
+		t.Fatalf("expected clean fsck of 2 labels in 8 blocks, got %v\n", report)
+	}
+
+	// Corrupt the label indices.
+	meta, err := GetLabelIndex(d, v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Blocks) != 8 {
+		t.Fatalf("expected label 1 in 8 blocks, got %s\n", meta.Blocks)
+	}
+	meta.Blocks = meta.Blocks[1:]
+	if err := SetLabelIndex(d, v, 1, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteLabelIndex(d, v, 2); err != nil {
+		t.Fatal(err)
+	}
+	stale := &Meta{Voxels: 10, Blocks: dvid.IZYXSlice{dvid.ChunkPoint3d{5, 5, 5}.ToIZYXString()}}
+	if err := SetLabelIndex(d, v, 99, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	report = getFsckReport(t, "GET", uuid, "labels")
+	if len(report.Problems) != 3 || report.Repaired != 0 {
+		t.Fatalf("expected 3 problems and no repairs, got %v\n", report)
+	}
+	expected := []struct {
+		label   uint64
+		problem string
+	}{
+		{1, ProblemBlockMismatch},
+		{2, ProblemMissingIndex},
+		{99, ProblemStaleIndex},
+	}
+	for i, problem := range report.Problems {
+		if problem.Label != expected[i].label || problem.Problem != expected[i].problem {
+			t.Errorf("expected problem %q for label %d, got %v\n", expected[i].problem, expected[i].label, problem)
+		}
+	}
+	if len(report.Problems[0].MissingBlocks) != 1 || len(report.Problems[0].ExtraBlocks) != 0 {
+		t.Errorf("expected label 1 to be missing 1 block, got %v\n", report.Problems[0])
+	}
+
+	report = getFsckReport(t, "POST", uuid, "labels")
+	if report.Repaired != 3 {
+		t.Fatalf("expected 3 repairs, got %v\n", report)
+	}
+	report = getFsckReport(t, "GET", uuid, "labels")
+	if len(report.Problems) != 0 {
+		t.Fatalf("expected no problems after repair, got %v\n", report)
+	}
+	meta, err = GetLabelIndex(d, v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Blocks) != 8 || meta.Voxels != 40*40*40 {
+		t.Errorf("expected repaired label 1 with 8 blocks and %d voxels, got %d blocks and %d voxels\n", 40*40*40, len(meta.Blocks), meta.Voxels)
+	}
+	meta, err = GetLabelIndex(d, v, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta != nil {
+		t.Errorf("expected stale index of label 99 to be deleted, got %v\n", meta)
+	}
+
+	// Repairs limited to an ROI should still set voxel counts from the label blocks.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	apiStr := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString("[[2,2,2,2]]"))
+
+	roiBlock := dvid.ChunkPoint3d{2, 2, 2}.ToIZYXString()
+	meta, err = GetLabelIndex(d, v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Voxels = 10
+	meta.Blocks.Delete(dvid.IZYXSlice{roiBlock})
+	if err := SetLabelIndex(d, v, 1, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteLabelIndex(d, v, 2); err != nil {
+		t.Fatal(err)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/labels/fsck?roi=myroi", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", apiStr, nil), &report); err != nil {
+		t.Fatalf("unable to parse fsck report: %v\n", err)
+	}
+	if report.BlocksScanned != 1 || report.Repaired != 2 {
+		t.Fatalf("expected 2 repairs within 1 ROI block, got %v\n", report)
+	}
+	meta, err = GetLabelIndex(d, v, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Blocks) != 8 || meta.Voxels != 40*40*40 {
+		t.Errorf("expected ROI-repaired label 1 with 8 blocks and %d voxels, got %d blocks and %d voxels\n", 40*40*40, len(meta.Blocks), meta.Voxels)
+	}
+	meta, err = GetLabelIndex(d, v, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta == nil || len(meta.Blocks) != 1 || meta.Blocks[0] != roiBlock || meta.Voxels != 6*6*6 {
+		t.Errorf("expected ROI-repaired label 2 with block %s and %d voxels, got %v\n", roiBlock, 6*6*6, meta)
+	}
+}
@@ -18,7 +18,8 @@ import (
 )
 
 // LoadImages bulk loads images using different techniques if it is a multidimensional
-// file like HDF5 or a sequence of PNG/JPG/TIF images.
+// file like HDF5, a multi-page TIFF, or a N5 or Zarr directory, or a sequence of
+// PNG/JPG/TIF images.
 func (d *Data) LoadImages(v dvid.VersionID, offset dvid.Point, filenames []string) error {
 	if len(filenames) == 0 {
 		return nil
@@ -46,11 +47,13 @@ func (d *Data) LoadImages(v dvid.VersionID, offset dvid.Point, filenames []strin
 		}
 	}()
 
-	// Use different loading techniques if we have a potentially multidimensional HDF5 file
-	// or many 2d images.
+	// Use different loading techniques if we have a potentially multidimensional HDF5 file,
+	// volumetric files, or many 2d images.
 	var err error
 	if dvid.Filename(filenames[0]).HasExtensionPrefix("hdf", "h5") {
 		err = d.loadHDF(load)
+	} else if imageblk.IsVolumeFile(filenames[0]) {
+		err = d.loadVolumes(load)
 	} else {
 		err = d.loadXYImages(load)
 	}
@@ -65,6 +68,34 @@ func (d *Data) LoadImages(v dvid.VersionID, offset dvid.Point, filenames []strin
 // Optimized bulk loading of XY images by loading all slices for a block before processing.
 // Trades off memory for speed.
 func (d *Data) loadXYImages(load *bulkLoadInfo) error {
+	return d.loadXYSlices(load, len(load.filenames), func(i int, offset dvid.Point) (*imageblk.Voxels, error) {
+		return d.loadXYImage(load.filenames[i], offset)
+	})
+}
+
+// Loads each volumetric file in turn, with each file's slices following the previous file's slices.
+func (d *Data) loadVolumes(load *bulkLoadInfo) error {
+	for _, filename := range load.filenames {
+		vol, err := imageblk.OpenVolume(filename, d.Properties.Values)
+		if err != nil {
+			return err
+		}
+		size := vol.Size()
+		dvid.Infof("Loading %s volume %s from %s...\n", d.DataName(), size, filename)
+		err = d.loadXYSlices(load, int(size[2]), func(i int, offset dvid.Point) (*imageblk.Voxels, error) {
+			return d.NewVolumeSlice(vol, int32(i), offset)
+		})
+		vol.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loads a sequence of XY slices, where the voxels for the i-th slice at the given offset are
+// returned by the passed function.
+func (d *Data) loadXYSlices(load *bulkLoadInfo, numSlices int, sliceF func(i int, offset dvid.Point) (*imageblk.Voxels, error)) error {
 	// Load first slice, get dimensions, allocate blocks for whole slice.
 	// Note: We don't need to lock the block slices because goroutines do NOT
 	// access the same elements of a slice.
@@ -81,20 +112,20 @@ func (d *Data) loadXYImages(load *bulkLoadInfo) error {
 	// Iterate through XY slices batched into the Z length of blocks.
 	fileNum := 1
 	errs := make(chan error, 10) // keep track of async errors.
-	for _, filename := range load.filenames {
+	for i := 0; i < numSlices; i++ {
 		server.BlockOnInteractiveRequests("imageblk.loadXYImages")
 
 		timedLog := dvid.NewTimeLog()
 
 		zInBlock := load.offset.Value(2) % blockSize.Value(2)
 		firstSlice := fileNum == 1
-		lastSlice := fileNum == len(load.filenames)
+		lastSlice := fileNum == numSlices
 		firstSliceInBlock := firstSlice || zInBlock == 0
 		lastSliceInBlock := lastSlice || zInBlock == blockSize.Value(2)-1
-		lastBlocks := fileNum+int(blockSize.Value(2)) > len(load.filenames)
+		lastBlocks := fileNum+int(blockSize.Value(2)) > numSlices
 
 		// Load images synchronously
-		vox, err := d.loadXYImage(filename, load.offset)
+		vox, err := sliceF(i, load.offset)
 		if err != nil {
 			return err
 		}
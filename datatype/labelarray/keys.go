@@ -22,6 +22,12 @@ const (
 	// key = label. value = labels.LabelMeta
 	keyLabelIndex = 187
 
+	// key = mutation id. value = record of merge or split for undo.
+	keyMutation = 188
+
+	// key = supervoxel. value = body label the supervoxel is mapped to.
+	keySupervoxelMap = 189
+
 	// Used to store max label on commit for each version of the instance.
 	keyLabelMax = 237
 
@@ -84,3 +90,45 @@ func DecodeLabelIndexTKey(tk storage.TKey) (label uint64, err error) {
 	label = binary.BigEndian.Uint64(ibytes[0:8])
 	return
 }
+
+// NewMutationTKey returns a TKey for the record of a mutation.
+func NewMutationTKey(mutID uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, mutID)
+	return storage.NewTKey(keyMutation, buf)
+}
+
+// DecodeMutationTKey parses a TKey and returns the corresponding mutation id.
+func DecodeMutationTKey(tk storage.TKey) (mutID uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyMutation)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 8 {
+		err = fmt.Errorf("bad labelarray mutation key of %d bytes: %v", len(ibytes), ibytes)
+		return
+	}
+	mutID = binary.BigEndian.Uint64(ibytes)
+	return
+}
+
+// NewSupervoxelMapTKey returns a TKey for the body mapping of a supervoxel.
+func NewSupervoxelMapTKey(supervoxel uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, supervoxel)
+	return storage.NewTKey(keySupervoxelMap, buf)
+}
+
+// DecodeSupervoxelMapTKey parses a TKey and returns the corresponding supervoxel.
+func DecodeSupervoxelMapTKey(tk storage.TKey) (supervoxel uint64, err error) {
+	ibytes, err := tk.ClassBytes(keySupervoxelMap)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 8 {
+		err = fmt.Errorf("bad labelarray supervoxel map key of %d bytes: %v", len(ibytes), ibytes)
+		return
+	}
+	supervoxel = binary.BigEndian.Uint64(ibytes)
+	return
+}
@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"compress/gzip"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/datatype/roi"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -73,22 +75,28 @@ $ dvid repo <UUID> new labelarray <data name> <settings...>
 	IndexedLabels   "false" if no sparse volume support is required (default "true")
 	CountLabels     "false" if no voxel counts per label is required (default "true")
 	MaxDownresLevel  The maximum down-res level supported.  Each down-res is factor of 2.
+	MapSupervoxels  "true" if label blocks hold supervoxels mapped to bodies (default "false")
+	BaseLabels      Name of an immutable labelarray with original labels used for cleaves
 
 $ dvid node <UUID> <data name> load <offset> <image glob> <settings...>
 
     Initializes version node to a set of XY label images described by glob of filenames.
-    The DVID server must have access to the named files.  Currently, XY images are required.
+    The DVID server must have access to the named files.  Instead of XY images, the glob
+    can match volumetric files: multi-page TIFF stacks or local N5 or Zarr dataset
+    directories with raw or gzip compression.  Unsigned 8, 16, or 32-bit labels are
+    widened to 64-bit labels.  Multiple volumes are stacked along Z in the order given.
 
     Example: 
 
     $ dvid node 3f8c superpixels load 0,0,100 "data/*.png" proc=noindex
+    $ dvid node 3f8c superpixels load 0,0,0 data/segmentation.zarr
 
     Arguments:
 
     UUID          Hexidecimal string with enough characters to uniquely identify a version node.
     data name     Name of data to add.
     offset        3d coordinate in the format "x,y,z".  Gives coordinate of top upper left voxel.
-    image glob    Filenames of label images, preferably in quotes, e.g., "foo-xy-*.png"
+    image glob    Filenames of label images or volumes, preferably in quotes, e.g., "foo-xy-*.png"
 
     Configuration Settings (case-insensitive keys)
 
@@ -132,6 +140,11 @@ HTTP API (Level 2 REST):
 	OPTIONAL "IndexedLabels"    "false" if no sparse volume support is required (default "true")
 	OPTIONAL "CountLabels"      "false" if no voxel counts per label is required (default "true")
 	OPTIONAL "MaxDownresLevel"  The maximum down-res level supported.  Each down-res is factor of 2.
+	OPTIONAL "MapSupervoxels"   "true" if label blocks hold immutable supervoxels that are mapped
+	                             to bodies on reads (default "false").  Merges then only change the
+	                             mapping and splits must use the "split-supervoxels" endpoint.
+	OPTIONAL "BaseLabels"       Name of an immutable labelarray in the same repo holding the original
+	                             labels, e.g., agglomeration fragments, used by the "cleave" endpoint.
 	
 
 GET  <api URL>/node/<UUID>/<data name>/help
@@ -245,6 +258,7 @@ GET  <api URL>/node/<UUID>/<data name>/specificblocks[?queryopts]
     blocks	  x,y,z... block string
     scale         A number from 0 up to MaxDownresLevel where each level has 1/2 resolution of
 	              previous level.  Level 0 (default) is the highest resolution.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
 
 
 GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format>][?queryopts]
@@ -290,6 +304,7 @@ GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format
     compression   Allows retrieval or submission of 3d data in "lz4" and "gzip"
                     compressed format.  The 2d data will ignore this and use
                     the image-based codec.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
     				(all API calls that can be throttled) are handled.  If the server can't initiate the API 
     				call right away, a 503 (Service Unavailable) status code is returned.
@@ -338,6 +353,7 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
                     (neuroglancer compression format), "googlegzip" (google + gzip)
                     compressed format.  The 2d data will ignore this and use
                     the image-based codec.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
     				(all API calls that can be throttled) are handled.  If the server can't initiate the API 
     				call right away, a 503 (Service Unavailable) status code is returned.
@@ -397,11 +413,46 @@ GET  <api URL>/node/<UUID>/<data name>/pseudocolor/<dims>/<size>/<offset>[?query
     roi       	  Name of roi data instance used to mask the requested data.
     compression   Allows retrieval or submission of 3d data in "lz4" and "gzip"
                     compressed format.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
     throttle      If "true", makes sure only N compute-intense operation (all API calls that can be throttled) 
                     are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
                     status code is returned.
 
-GET <api URL>/node/<UUID>/<data name>/label/<coord>
+GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>][?queryopts]
+
+    Retrieves non-orthogonal (arbitrarily oriented planar) label data of named 3d data 
+    within a version node using nearest-neighbor sampling.  The top left pixel corresponds 
+    to the real world coordinate (not in voxel space but in space defined by resolution, e.g.,
+    nanometer space).  The real world coordinates are specified in  "x_y_z" format, e.g., "20.3_11.8_109.4".
+    The resolution is used to determine the # pixels in the returned image.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/segmentation/arb/100.2_90_80.7/200.2_90_80.7/100.2_190.0_80.7/10.0/png
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to add.
+    top left      Real world coordinate (in nanometers) of top left pixel in returned image.
+    top right     Real world coordinate of top right pixel.
+    bottom left   Real world coordinate of bottom left pixel.
+    res           The resolution/pixel that is used to calculate the returned image size in pixels.
+    format        "raw" or "png" (default: "raw").  "raw" returns packed little-endian uint64 labels
+                    with x varying fastest.  "png" returns a pseudocolored image as in the 
+                    "pseudocolor" endpoint.
+
+    Query-string Options:
+
+    scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+	                of previous level.  Level 0 is the highest resolution.
+    compression   Allows retrieval of "raw" labels in "lz4" and "gzip" compressed format.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
+    throttle      If "true", makes sure only N compute-intense operation (all API calls that can be throttled) 
+                    are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
+                    status code is returned.
+
+GET <api URL>/node/<UUID>/<data name>/label/<coord>[?queryopts]
 
 	Returns JSON for the label at the given coordinate:
 	{ "Label": 23 }
@@ -411,6 +462,10 @@ GET <api URL>/node/<UUID>/<data name>/label/<coord>
     data name     Name of label data.
     coord     	  Coordinate of voxel with underscore as separator, e.g., 10_20_30
 
+    Query-string Options:
+
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
+
 GET <api URL>/node/<UUID>/<data name>/labels[?queryopts]
 
 	Returns JSON for the labels at a list of coordinates.  Expects JSON in GET body:
@@ -428,6 +483,7 @@ GET <api URL>/node/<UUID>/<data name>/labels[?queryopts]
     Query-string Options:
 
     hash          MD5 hash of request body content in hexidecimal string format.
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
 
 GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>[?queryopts]
 
@@ -486,6 +542,7 @@ GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>[?queryopts]
 	                of previous level.  Level 0 is the highest resolution.
     compression   Allows retrieval of block data in "lz4" (default), "gzip", blocks" (native DVID
 	              label blocks) or "uncompressed" (uint64 labels).
+    supervoxels   If "true" and the data maps supervoxels, returns supervoxels instead of bodies.
     throttle      If "true", makes sure only N compute-intense operation (all API calls that can be 
 	              throttled) are handled.  If the server can't initiate the API call right away, a 503 
                   (Service Unavailable) status code is returned.
@@ -673,6 +730,32 @@ GET  <api URL>/node/<UUID>/<data name>/sparsevol/<label>?<options>
 	         resolution of previous level.  Level 0 is the highest resolution.
 
 
+GET  <api URL>/node/<UUID>/<data name>/surface/<label>?<options>
+
+	Returns the surface voxels of the given label with normals, which allows lightweight
+	viewers to render a body without meshing.  The returned data is "application/octet-stream"
+	with the following format where integers and floats are little endian:
+
+	    uint32     # surface voxels (N)
+	    N * 3 float32   vertices (x, y, z) in voxel coordinates of the requested scale
+	    N * 3 float32   normals (nx, ny, nz)
+
+	Normals are corrected for anisotropy using the VoxelSize of the data instance.
+	If the label isn't found within any given bounds, a 404 (Not Found) is returned.
+
+    GET Query-string Options:
+
+    minx    Surface voxels must be equal to or larger than this minimum x voxel coordinate.
+    maxx    Surface voxels must be equal to or smaller than this maximum x voxel coordinate.
+    miny    Surface voxels must be equal to or larger than this minimum y voxel coordinate.
+    maxy    Surface voxels must be equal to or smaller than this maximum y voxel coordinate.
+    minz    Surface voxels must be equal to or larger than this minimum z voxel coordinate.
+    maxz    Surface voxels must be equal to or smaller than this maximum z voxel coordinate.
+    exact   "false" if the body can extend a bit outside voxel bounds within border blocks.
+	scale   A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 
+	         resolution of previous level.  Level 0 is the highest resolution.
+
+
 HEAD <api URL>/node/<UUID>/<data name>/sparsevol/<label>?<options>
 
 	Returns:
@@ -762,6 +845,25 @@ GET <api URL>/node/<UUID>/<data name>/sparsevols-coarse/<start label>/<end label
 			int32   Length of run
 
 
+POST <api URL>/node/<UUID>/<data name>/roi/<label>/<roi name>
+
+	Creates or replaces the given ROI with the blocks of the given label, as returned by
+	the sparsevol-coarse endpoint.  If the ROI data instance doesn't exist, a new one is
+	created with default settings.  If the ROI has a different block size than this data
+	instance, the ROI includes all of its blocks that intersect the label's blocks.
+
+	Returns JSON giving the number of ROI spans written:
+
+		{ "spans": <# of spans> }
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelarray instance.
+    label         The label whose blocks define the ROI.
+    roi name      Name of the roi instance that will receive the ROI.
+
+
 GET <api URL>/node/<UUID>/<data name>/nextlabel
 POST <api URL>/node/<UUID>/<data name>/nextlabel
 
@@ -781,7 +883,7 @@ POST <api URL>/node/<UUID>/<data name>/nextlabel
 		{ "start": <starting label #>, "end": <ending label #> }
 
 
-POST <api URL>/node/<UUID>/<data name>/merge
+POST <api URL>/node/<UUID>/<data name>/merge[?u=<user>]
 
 	Merges labels.  Requires JSON in request body using the following format:
 
@@ -791,6 +893,9 @@ POST <api URL>/node/<UUID>/<data name>/merge
 	Note that it's computationally more efficient to group a number of merges into the
 	same toLabel as a single merge request instead of multiple merge requests.
 
+	The merge is rejected if any of the labels is checked out by a user other than the one
+	given by the "u" query string.  See the "checkout" endpoint below.
+
 	Kafka JSON message generated by this request:
 		{ 
 			"Action": "merge",
@@ -807,7 +912,7 @@ POST <api URL>/node/<UUID>/<data name>/merge
 			"UUID": <UUID on which split was done>
 		}
 
-POST <api URL>/node/<UUID>/<data name>/split/<label>[?splitlabel=X]
+POST <api URL>/node/<UUID>/<data name>/split/<label>[?splitlabel=X&u=<user>]
 
 	Splits a portion of a label's voxels into a new label or, if "splitlabel" is specified
 	as an optional query string, the given split label.  Returns the following JSON:
@@ -842,6 +947,9 @@ POST <api URL>/node/<UUID>/<data name>/split/<label>[?splitlabel=X]
 	chain operations like "split-coarse" followed by "split" using voxels, where the new label
 	created by the split coarse is used as the split label for the smaller, higher-res "split".
 
+	NOTE 3: The split is rejected if the label or split label is checked out by a user other than
+	the one given by the "u" query string.  See the "checkout" endpoint below.
+
 	Kafka JSON message generated by this request:
 		{ 
 			"Action": "split",
@@ -864,7 +972,7 @@ POST <api URL>/node/<UUID>/<data name>/split/<label>[?splitlabel=X]
 		}
 
 
-POST <api URL>/node/<UUID>/<data name>/split-coarse/<label>[?splitlabel=X]
+POST <api URL>/node/<UUID>/<data name>/split-coarse/<label>[?splitlabel=X&u=<user>]
 
 	Splits a portion of a label's blocks into a new label or, if "splitlabel" is specified
 	as an optional query string, the given split label.  Returns the following JSON:
@@ -892,6 +1000,196 @@ POST <api URL>/node/<UUID>/<data name>/split-coarse/<label>[?splitlabel=X]
 	        int32   Length of run
 
 	The Notes for "split" endpoint above are applicable to this "split-coarse" endpoint.
+
+POST <api URL>/node/<UUID>/<data name>/cleave/<label>[?cleavelabel=X&u=<user>]
+
+	Moves selected pieces of a label into a new label or, if "cleavelabel" is specified as an
+	optional query string, the given cleave label.  Pieces are given in POSTed JSON either as
+	block coordinates or as labels of the immutable labelarray named by the "BaseLabels" 
+	setting, which must have the same block size:
+
+		{ "Blocks": [[x1, y1, z1], [x2, y2, z2], ...] }
+		{ "Labels": [base label 1, base label 2, ...] }
+
+	For blocks, all of the label's voxels within each block are moved as in "split-coarse".
+	For base labels, the label's voxels that have one of the given labels in the base 
+	labelarray are moved as in "split".  Pieces without voxels of the label are ignored.
+	Returns the following JSON:
+
+		{ "label": <new label> }
+
+	The cleave is done as a single "split-coarse" or "split" mutation, so the same Kafka 
+	messages are generated and the cleave can be undone.  NOTE 2 and NOTE 3 of the "split"
+	endpoint above also apply.  Not supported for data with MapSupervoxels set.
+
+POST <api URL>/node/<UUID>/<data name>/paint/<label>[?format=...&u=<user>]
+
+	Overwrites all voxels of a POSTed sparse volume with the given label, whatever their
+	current labels, and returns the mutation id and number of changed voxels:
+
+		{ "MutationID": 23, "Voxels": 4096 }
+
+	Unlike "split", the sparse volume need not be a subset of any label's voxels, and voxels
+	outside existing blocks create new blocks.  Label indices, downres scales, and synced data
+	are updated as for any label mutation.  If MapSupervoxels is set, the label is written as
+	the supervoxel of painted voxels.  The paint is rejected if the label, or any label whose
+	voxels it would overwrite, is checked out by a user other than the one given by the "u"
+	query string or is being merged or split.  A paint cannot be undone, but it blocks undo of
+	earlier mutations involving any overwritten label.
+
+    POST Query-string Options:
+
+	format  One of the sparse volume formats described for the "sparsevol" endpoint above:
+	          "rles" (default) - legacy RLEs with header including # spans
+	          "srles" - streaming RLEs with each RLE composed of 4 int32 (16 bytes) for x, y, z, run 
+	          "blocks" - binary Block stream, where the foreground label is ignored
+
+	Kafka JSON message generated by this request:
+		{ 
+			"Action": "paint",
+			"Target": <painted label>,
+			"RLEs": <string for reference to painted voxels in serialized RLE format>,
+			"MutationID": <unique id for mutation>,
+			"UUID": <UUID on which paint was done>
+		}
+	
+	After completion of the paint op, the following JSON message is published:
+		{ 
+			"Action": "paint-complete",
+			"Labels": [<overwritten label 1>, <overwritten label 2>, ...],
+			"Changed": <number of changed voxels>,
+			"MutationID": <unique id for mutation>,
+			"UUID": <UUID on which paint was done>
+		}
+
+POST <api URL>/node/<UUID>/<data name>/erase/<label>[?format=...&u=<user>]
+
+	Sets voxels of the given label within a POSTed sparse volume to background 0.  Voxels
+	of other labels within the sparse volume are unchanged.  If MapSupervoxels is set, voxels
+	of all supervoxels of the given body are erased.  The format query string, returned
+	JSON, checkout restriction, and Kafka messages are as for "paint" with "erase" and
+	"erase-complete" actions.
+
+POST <api URL>/node/<UUID>/<data name>/split-supervoxels/<label>[?splitlabel=X&u=<user>]
+
+	Only for data with MapSupervoxels set.  Moves supervoxels of a body into a new body or, 
+	if "splitlabel" is specified as an optional query string, the given split label.  No label
+	blocks are modified; only the supervoxel to body mapping changes.  Requires a JSON array 
+	of supervoxels, all of which must currently belong to the given label, e.g., [23, 45, 101].
+	Returns the following JSON:
+
+		{ "label": <new label> }
+
+	NOTE 2 and NOTE 3 of the "split" endpoint above also apply.  Note that for data with 
+	MapSupervoxels set, the "split" and "split-coarse" endpoints are not supported.
+
+	Kafka JSON message generated by this request:
+		{ 
+			"Action": "split-supervoxels",
+			"Target": <from label>,
+			"NewLabel": <to label>,
+			"Supervoxels": [<supervoxel 1>, <supervoxel 2>, ...],
+			"MutationID": <unique id for mutation>,
+			"UUID": <UUID on which split was done>
+		}
+	
+	After completion of the split op, the following JSON message is published:
+		{ 
+			"Action": "split-supervoxels-complete",
+			"MutationID": <unique id for mutation>
+			"UUID": <UUID on which split was done>
+		}
+
+GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
+
+	Returns a JSON array of the supervoxels mapped to the given body label.  If the data
+	does not map supervoxels, only the given label is returned.
+
+GET <api URL>/node/<UUID>/<data name>/mapping
+
+	Returns JSON for the bodies of a list of supervoxels.  Expects JSON in GET body:
+
+	[ supervoxel1, supervoxel2, ...]
+
+	Returns for each supervoxel the corresponding body label:
+
+	[ 23, 911, ...]
+
+POST <api URL>/node/<UUID>/<data name>/undo/<mutation id>[?u=<user>]
+
+	Reverts the merge or split with the given mutation id, as published in the "MutationID"
+	of the Kafka messages for merges and splits.  The mutation must have been done on the
+	given UUID, which cannot be committed (locked), and no later mutation in that UUID may
+	have changed any of the involved labels.  A merge is undone by splitting each merged
+	label's voxels, or supervoxels if MapSupervoxels is set, recorded at the time of merge, 
+	back out of the target label.  A split
+	is undone by merging the split label back into the original label, so the undo is
+	rejected for splits into a previously existing label given by "splitlabel".  The
+	reverting splits and merges generate the usual Kafka messages and sync events, so
+	synced data like annotations are updated, and can themselves be undone.
+
+	The undo is rejected if any involved label is checked out by a user other than the one
+	given by the "u" query string.  Returns JSON describing the reverted mutation:
+
+	{ "MutID": 23, "UUID": "a4d8...", "Action": "merge", "Target": 4, "Labels": [1, 2, 3], "Undone": true }
+
+GET  <api URL>/node/<UUID>/<data name>/checkout
+POST <api URL>/node/<UUID>/<data name>/checkout?u=<user>[&lease=<seconds>]
+
+	Checks out labels for a user so that editing tools can coordinate proofreading sessions.
+	While a label is checked out, merges and splits involving that label are rejected unless
+	the request is made by the same user, given by the "u" query string.  The checkout lasts
+	until the labels are released or the lease, 600 seconds by default, expires.  POSTing
+	labels already checked out by the same user renews their lease.  Either all POSTed labels
+	are checked out or, if any label is checked out by another user, none are and an error
+	is returned.  Checkouts are held in memory and do not persist across server restarts.
+
+	A POST requires a JSON array of labels in the request body, e.g., [23, 45, 101], and
+	returns the granted checkouts.  A GET returns all current checkouts for the version:
+
+	[
+		{ "Label": 23, "User": "alice", "Expires": "2017-08-08T14:23:10.3-04:00" },
+		{ "Label": 45, "User": "alice", "Expires": "2017-08-08T14:23:10.3-04:00" },
+		...
+	]
+
+POST <api URL>/node/<UUID>/<data name>/release?u=<user>[&force=true]
+
+	Releases labels checked out by the user given by the "u" query string.  Requires a JSON
+	array of labels in the request body.  Labels checked out by other users cannot be
+	released unless "force=true" is specified.  Labels not checked out are ignored.
+
+GET  <api URL>/node/<UUID>/<data name>/fsck[?queryopts]
+POST <api URL>/node/<UUID>/<data name>/fsck[?queryopts]
+
+	Checks the label indices of this version against the labels actually present in the
+	highest resolution blocks and returns a JSON report of any discrepancies.  A POST also
+	repairs the label indices so they match the blocks and holds off merges and splits
+	until done.  Results can include transient discrepancies if blocks are being written
+	during the check.
+
+	Example return:
+
+	{
+		"BlocksScanned": 38240,
+		"LabelsChecked": 1862,
+		"Problems": [
+			{ "Label": 23, "Problem": "block mismatch", "MissingBlocks": [[10, 3, 7]], "ExtraBlocks": [[11, 3, 7]] },
+			{ "Label": 187, "Problem": "stale index", "ExtraBlocks": [[2, 8, 1]] },
+			{ "Label": 2001, "Problem": "missing index", "MissingBlocks": [[4, 5, 6]] }
+		],
+		"Repaired": 0
+	}
+
+	Block coordinates are given in block space.  Voxel counts of repaired indices are only
+	recomputed when no ROI is specified.
+
+	Query-string Options:
+
+	minlabel    Only check labels equal to or larger than this label.
+	maxlabel    Only check labels equal to or smaller than this label.
+	roi         Name of ROI in this version limiting the blocks checked.  The ROI must have the
+	            same block size as this data instance.
 `
 
 var (
@@ -1072,11 +1370,22 @@ type Data struct {
 	// the higher level.
 	MaxDownresLevel uint8
 
+	// True if label blocks hold supervoxels that are mapped to bodies on reads, so merges
+	// only change the mapping and splits move whole supervoxels.  (Default false)
+	MapSupervoxels bool
+
+	// Name of an immutable labelarray with the same block size holding original labels that
+	// can be selected as pieces of a body to cleave.  (Default none)
+	BaseLabels dvid.InstanceName
+
 	updates  []uint32 // tracks updating to each scale of labelarray [0:MaxDownresLevel+1]
 	updateMu sync.RWMutex
 
 	mlMu sync.RWMutex // For atomic access of MaxLabel and MaxRepoLabel
 
+	svMu   sync.RWMutex                       // For access of cached supervoxel mappings
+	svMaps map[dvid.VersionID]*labels.Mapping // supervoxel to body mapping for each version
+
 	// unpersisted data: channels for mutations
 	mutateCh [numMutateHandlers]chan procMsg // channels into mutate (merge/split) ops.
 }
@@ -1139,6 +1448,8 @@ func (d *Data) CopyPropertiesFrom(src datastore.DataService, fs storage.FilterSp
 	d.IndexedLabels = d2.IndexedLabels
 	d.CountLabels = d2.CountLabels
 	d.MaxDownresLevel = d2.MaxDownresLevel
+	d.MapSupervoxels = d2.MapSupervoxels
+	d.BaseLabels = d2.BaseLabels
 
 	return d.Data.CopyPropertiesFrom(d2.Data, fs)
 }
@@ -1188,12 +1499,27 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 		}
 		downresLevels = uint8(levels)
 	}
+
+	mapSupervoxels, _, err := c.GetBool("MapSupervoxels")
+	if err != nil {
+		return nil, err
+	}
+	if mapSupervoxels && !indexedLabels {
+		return nil, fmt.Errorf("MapSupervoxels requires IndexedLabels to be true")
+	}
+
+	baseLabels, _, err := c.GetString("BaseLabels")
+	if err != nil {
+		return nil, err
+	}
 	data.updates = make([]uint32, downresLevels+1)
 
 	data.MaxLabel = make(map[dvid.VersionID]uint64)
 	data.IndexedLabels = indexedLabels
 	data.CountLabels = countLabels
 	data.MaxDownresLevel = downresLevels
+	data.MapSupervoxels = mapSupervoxels
+	data.BaseLabels = dvid.InstanceName(baseLabels)
 
 	data.Initialize()
 	return data, nil
@@ -1206,6 +1532,8 @@ type propsJSON struct {
 	IndexedLabels   bool
 	CountLabels     bool
 	MaxDownresLevel uint8
+	MapSupervoxels  bool
+	BaseLabels      dvid.InstanceName
 }
 
 func (d *Data) MarshalJSON() ([]byte, error) {
@@ -1221,6 +1549,8 @@ func (d *Data) MarshalJSON() ([]byte, error) {
 			IndexedLabels:   d.IndexedLabels,
 			CountLabels:     d.CountLabels,
 			MaxDownresLevel: d.MaxDownresLevel,
+			MapSupervoxels:  d.MapSupervoxels,
+			BaseLabels:      d.BaseLabels,
 		},
 	})
 }
@@ -1253,6 +1583,8 @@ func (d *Data) MarshalJSONExtents(ctx *datastore.VersionedCtx) ([]byte, error) {
 			IndexedLabels:   d.IndexedLabels,
 			CountLabels:     d.CountLabels,
 			MaxDownresLevel: d.MaxDownresLevel,
+			MapSupervoxels:  d.MapSupervoxels,
+			BaseLabels:      d.BaseLabels,
 		},
 		extentsJSON,
 	})
@@ -1276,6 +1608,12 @@ func (d *Data) GobDecode(b []byte) error {
 		dvid.Errorf("Decoding labelarray %q: no MaxDownresLevel, setting to 7", d.DataName())
 		d.MaxDownresLevel = 7
 	}
+	if err := dec.Decode(&(d.MapSupervoxels)); err != nil {
+		d.MapSupervoxels = false
+	}
+	if err := dec.Decode(&(d.BaseLabels)); err != nil {
+		d.BaseLabels = ""
+	}
 	d.updates = make([]uint32, d.MaxDownresLevel+1)
 	return nil
 }
@@ -1295,6 +1633,12 @@ func (d *Data) GobEncode() ([]byte, error) {
 	if err := enc.Encode(d.MaxDownresLevel); err != nil {
 		return nil, err
 	}
+	if err := enc.Encode(d.MapSupervoxels); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.BaseLabels); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -1355,6 +1699,18 @@ func (d *Data) updateBlockMaxLabel(v dvid.VersionID, block *labels.Block) {
 	}
 }
 
+// ModifyConfig modifies the BaseLabels setting as well as the imageblk properties.
+func (d *Data) ModifyConfig(config dvid.Config) error {
+	baseLabels, found, err := config.GetString("BaseLabels")
+	if err != nil {
+		return err
+	}
+	if found {
+		d.BaseLabels = dvid.InstanceName(baseLabels)
+	}
+	return d.Data.ModifyConfig(config)
+}
+
 func (d *Data) Equals(d2 *Data) bool {
 	if !d.Data.Equals(d2.Data) {
 		return false
@@ -1460,6 +1816,11 @@ func (d *Data) LoadMutable(root dvid.VersionID, storedVersion, expectedVersion u
 	}
 	wg.Wait()
 
+	// Make sure mutation ids aren't reused from before restart.
+	if err := d.loadMutationID(); err != nil {
+		return false, err
+	}
+
 	dvid.Infof("Loaded max label values for labelarray %q with repo-wide max %d\n", d.DataName(), d.MaxRepoLabel)
 	return saveRequired, nil
 }
@@ -1731,7 +2092,7 @@ func (d *Data) convertTo64bit(geom dvid.Geometry, data []uint8, bytesPerVoxel, s
 }
 
 // sendBlocksSpecific writes data to the blocks specified -- best for non-ordered backend
-func (d *Data) sendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWriter, blockstring string, scale uint8) error {
+func (d *Data) sendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWriter, blockstring string, scale uint8, supervoxels bool) error {
 	w.Header().Set("Content-type", "application/octet-stream")
 	// extract querey string
 	if blockstring == "" {
@@ -1746,6 +2107,14 @@ func (d *Data) sendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWr
 	finishedRequests := make(chan error, len(coordarray)/3)
 	var mutex sync.Mutex
 
+	var mapping *labels.Mapping
+	if !supervoxels {
+		var err error
+		if mapping, err = d.getMapping(ctx.VersionID()); err != nil {
+			return err
+		}
+	}
+
 	// get store
 	store, err := datastore.GetKeyValueDB(d)
 	if err != nil {
@@ -1779,6 +2148,11 @@ func (d *Data) sendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWr
 			if err != nil {
 				return
 			}
+			if len(value) > 0 && mapping != nil {
+				if value, err = d.mapSerializedBlock(value, mapping); err != nil {
+					return
+				}
+			}
 			if len(value) > 0 {
 				// lock shared resource
 				mutex.Lock()
@@ -1966,8 +2340,9 @@ func (d *Data) sendBlock(w http.ResponseWriter, x, y, z int32, v []byte, compres
 	return nil
 }
 
-// SendBlocks returns a series of blocks covering the given block-aligned subvolume.
-func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, scale uint8, subvol *dvid.Subvolume, compression string) error {
+// SendBlocks returns a series of blocks covering the given block-aligned subvolume.  If the data
+// maps supervoxels, block labels are mapped to bodies unless supervoxels is true.
+func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, scale uint8, subvol *dvid.Subvolume, compression string, supervoxels bool) error {
 	w.Header().Set("Content-type", "application/octet-stream")
 
 	switch compression {
@@ -1988,6 +2363,13 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, sc
 		return fmt.Errorf("Data type labelarray had error initializing store: %v\n", err)
 	}
 
+	var mapping *labels.Mapping
+	if !supervoxels {
+		if mapping, err = d.getMapping(ctx.VersionID()); err != nil {
+			return err
+		}
+	}
+
 	// only do one request at a time, although each request can start many goroutines.
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
@@ -2001,6 +2383,9 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, sc
 
 	for ziter := int32(0); ziter < blocksdims.Value(2); ziter++ {
 		for yiter := int32(0); yiter < blocksdims.Value(1); yiter++ {
+			if err := storage.ContextErr(ctx); err != nil {
+				return fmt.Errorf("GET blocks %s abandoned: %v", ctx, err)
+			}
 			beginPoint := dvid.ChunkPoint3d{blocksoff.Value(0), blocksoff.Value(1) + yiter, blocksoff.Value(2) + ziter}
 			endPoint := dvid.ChunkPoint3d{blocksoff.Value(0) + blocksdims.Value(0) - 1, blocksoff.Value(1) + yiter, blocksoff.Value(2) + ziter}
 
@@ -2029,7 +2414,13 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, sc
 				if z != sz || y != sy || x < sx || x >= sx+int32(blocksdims.Value(0)) {
 					return nil
 				}
-				if err := d.sendBlock(w, x, y, z, kv.V, compression); err != nil {
+				value := kv.V
+				if mapping != nil {
+					if value, err = d.mapSerializedBlock(value, mapping); err != nil {
+						return err
+					}
+				}
+				if err := d.sendBlock(w, x, y, z, value, compression); err != nil {
 					return err
 				}
 				return nil
@@ -2290,7 +2681,9 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 	}
 }
 
-func colorImage(labels *dvid.Image) (image.Image, error) {
+// PseudoColorImage returns an image where each label of a labels image is hashed to
+// a different opaque RGB color, as in the "pseudocolor" endpoint.
+func PseudoColorImage(labels *dvid.Image) (image.Image, error) {
 	if labels == nil || labels.Which != 3 || labels.NRGBA64 == nil {
 		return nil, fmt.Errorf("writePseudoColor can't use labels image with wrong format: %v\n", labels)
 	}
@@ -2648,7 +3041,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	// Prevent use of APIs that require IndexedLabels when it is not set.
 	if !d.IndexedLabels {
 		switch parts[3] {
-		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "maxlabel", "nextlabel", "split", "split-coarse", "merge":
+		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "surface", "roi", "maxlabel", "nextlabel", "split", "split-coarse", "split-supervoxels", "cleave", "merge", "fsck", "undo":
 			server.BadRequest(w, r, "data %q is not label indexed (IndexedLabels=false): %q endpoint is not supported", d.DataName(), parts[3])
 			return
 		}
@@ -2698,7 +3091,8 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 		if action == "get" {
-			if err := d.sendBlocksSpecific(ctx, w, blocklist, scale); err != nil {
+			supervoxels := r.URL.Query().Get("supervoxels") == "true"
+			if err := d.sendBlocksSpecific(ctx, w, blocklist, scale, supervoxels); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -2732,6 +3126,9 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "pseudocolor":
 		d.handlePseudocolor(ctx, w, r, parts)
 
+	case "arb":
+		d.handleArb(ctx, w, r, parts)
+
 	case "raw", "isotropic":
 		d.handleDataRequest(ctx, w, r, parts)
 
@@ -2746,12 +3143,18 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "sparsevol-by-point":
 		d.handleSparsevolByPoint(ctx, w, r, parts)
 
+	case "surface":
+		d.handleSurface(ctx, w, r, parts)
+
 	case "sparsevol-coarse":
 		d.handleSparsevolCoarse(ctx, w, r, parts)
 
 	case "sparsevols-coarse":
 		d.handleSparsevolsCoarse(ctx, w, r, parts)
 
+	case "roi":
+		d.handleROI(ctx, w, r, parts)
+
 	case "maxlabel":
 		d.handleMaxlabel(ctx, w, r)
 
@@ -2764,9 +3167,36 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "split-coarse":
 		d.handleSplitCoarse(ctx, w, r, parts)
 
+	case "split-supervoxels":
+		d.handleSplitSupervoxels(ctx, w, r, parts)
+
+	case "cleave":
+		d.handleCleave(ctx, w, r, parts)
+
+	case "supervoxels":
+		d.handleSupervoxels(ctx, w, r, parts)
+
+	case "mapping":
+		d.handleMapping(ctx, w, r)
+
 	case "merge":
 		d.handleMerge(ctx, w, r, parts)
 
+	case "paint", "erase":
+		d.handlePaint(ctx, w, r, parts)
+
+	case "fsck":
+		d.handleFsck(ctx, w, r)
+
+	case "undo":
+		d.handleUndo(ctx, w, r, parts)
+
+	case "checkout":
+		d.handleCheckout(ctx, w, r)
+
+	case "release":
+		d.handleRelease(ctx, w, r)
+
 	default:
 		server.BadAPIRequest(w, r, d)
 	}
@@ -2787,7 +3217,12 @@ func (d *Data) handleLabel(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		server.BadRequest(w, r, err)
 		return
 	}
-	label, err := d.GetLabelAtPoint(ctx.VersionID(), coord)
+	var label uint64
+	if r.URL.Query().Get("supervoxels") == "true" {
+		label, err = d.GetSupervoxelAtPoint(ctx.VersionID(), coord)
+	} else {
+		label, err = d.GetLabelAtPoint(ctx.VersionID(), coord)
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
@@ -2823,11 +3258,18 @@ func (d *Data) handleLabels(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 		server.BadRequest(w, r, fmt.Sprintf("Bad labels request JSON: %v", err))
 		return
 	}
+	supervoxels := queryStrings.Get("supervoxels") == "true"
 	w.Header().Set("Content-type", "application/json")
 	fmt.Fprintf(w, "[")
 	sep := false
 	for _, coord := range coords {
-		label, err := d.GetLabelAtPoint(ctx.VersionID(), coord)
+		var label uint64
+		var err error
+		if supervoxels {
+			label, err = d.GetSupervoxelAtPoint(ctx.VersionID(), coord)
+		} else {
+			label, err = d.GetLabelAtPoint(ctx.VersionID(), coord)
+		}
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -2885,7 +3327,8 @@ func (d *Data) handleBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 			return
 		}
 
-		if err := d.SendBlocks(ctx, w, scale, subvol, compression); err != nil {
+		supervoxels := queryStrings.Get("supervoxels") == "true"
+		if err := d.SendBlocks(ctx, w, scale, subvol, compression, supervoxels); err != nil {
 			server.BadRequest(w, r, err)
 		}
 		timedLog.Infof("HTTP GET blocks at size %s, offset %s (%s)", parts[4], parts[5], r.URL)
@@ -2906,6 +3349,7 @@ func (d *Data) handlePseudocolor(ctx *datastore.VersionedCtx, w http.ResponseWri
 
 	queryStrings := r.URL.Query()
 	roiname := dvid.InstanceName(queryStrings.Get("roi"))
+	supervoxels := queryStrings.Get("supervoxels") == "true"
 	scale, err := getScale(queryStrings)
 	if err != nil {
 		server.BadRequest(w, r, "bad scale specified: %v", err)
@@ -2935,14 +3379,14 @@ func (d *Data) handlePseudocolor(ctx *datastore.VersionedCtx, w http.ResponseWri
 			server.BadRequest(w, r, err)
 			return
 		}
-		img, err := d.GetImage(ctx.VersionID(), lbl, scale, roiname)
+		img, err := d.GetImage(ctx, lbl, scale, roiname, supervoxels)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
 		}
 
 		// Convert to pseudocolor
-		pseudoColor, err := colorImage(img)
+		pseudoColor, err := PseudoColorImage(img)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -2965,6 +3409,104 @@ func (d *Data) handlePseudocolor(ctx *datastore.VersionedCtx, w http.ResponseWri
 	timedLog.Infof("HTTP GET pseudocolor with shape %s, size %s, offset %s", parts[4], parts[5], parts[6])
 }
 
+func (d *Data) handleArb(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>]
+	if len(parts) < 8 {
+		server.BadRequest(w, r, "%q must be followed by top-left/top-right/bottom-left/res", parts[3])
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "DVID only permits GET of arbitrary slices")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	queryStrings := r.URL.Query()
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	if throttle := queryStrings.Get("throttle"); throttle == "on" || throttle == "true" {
+		if server.ThrottledHTTP(w) {
+			return
+		}
+		defer server.ThrottledOpDone()
+	}
+
+	arb, err := d.NewArbSliceFromStrings(parts[4], parts[5], parts[6], parts[7], "_")
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	voxelSize := make(dvid.NdFloat32, len(d.Properties.VoxelSize))
+	for i, res := range d.Properties.VoxelSize {
+		voxelSize[i] = res * float32(uint32(1)<<scale)
+	}
+	v := ctx.VersionID()
+	var mapping *labels.Mapping
+	if queryStrings.Get("supervoxels") != "true" {
+		if mapping, err = d.getMapping(v); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	}
+	err = d.GetArbitraryNearest(arb, voxelSize, func(bcoord dvid.ChunkPoint3d) ([]byte, error) {
+		block, err := d.GetLabelBlock(v, scale, bcoord)
+		if err != nil {
+			return nil, err
+		}
+		if mapping != nil {
+			if block, err = block.MapLabels(mapping); err != nil {
+				return nil, err
+			}
+		}
+		labelData, _ := block.MakeLabelVolume()
+		return labelData, nil
+	})
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	var formatStr string
+	if len(parts) >= 9 {
+		formatStr = parts[8]
+	}
+	switch formatStr {
+	case "", "raw":
+		compression := queryStrings.Get("compression")
+		if compression != "" && compression != "lz4" && compression != "gzip" {
+			server.BadRequest(w, r, "arbitrary label slices only support lz4 and gzip compression, not %q", compression)
+			return
+		}
+		if err := sendBinaryData(compression, arb.Bytes(), nil, w); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	case "png":
+		size := arb.Size()
+		img, err := dvid.ImageFromData(size[0], size[1], arb.Bytes(), d.Properties.Values, false)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		pseudoColor, err := PseudoColorImage(img)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err = dvid.WriteImageHttp(w, pseudoColor, formatStr); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	default:
+		server.BadRequest(w, r, "arbitrary label slices must be in raw or png format, not %q", formatStr)
+		return
+	}
+	timedLog.Infof("HTTP GET arbitrary label slice %s, scale %d (%s)", arb, scale, r.URL)
+}
+
 func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	if len(parts) < 7 {
 		server.BadRequest(w, r, "'%s' must be followed by shape/size/offset", parts[3])
@@ -2982,6 +3524,7 @@ func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWri
 	}
 	queryStrings := r.URL.Query()
 	roiname := dvid.InstanceName(queryStrings.Get("roi"))
+	supervoxels := queryStrings.Get("supervoxels") == "true"
 
 	scale, err := getScale(queryStrings)
 	if err != nil {
@@ -3006,7 +3549,7 @@ func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWri
 			server.BadRequest(w, r, err)
 			return
 		}
-		img, err := d.GetImage(ctx.VersionID(), lbl, scale, roiname)
+		img, err := d.GetImage(ctx, lbl, scale, roiname, supervoxels)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -3049,7 +3592,7 @@ func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWri
 				server.BadRequest(w, r, err)
 				return
 			}
-			data, err := d.GetVolume(ctx.VersionID(), lbl, scale, roiname)
+			data, err := d.GetVolume(ctx, lbl, scale, roiname, supervoxels)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -3236,51 +3779,99 @@ func (d *Data) handleSparsevol(ctx *datastore.VersionedCtx, w http.ResponseWrite
 	timedLog.Infof("HTTP %s: sparsevol on label %s (%s)", r.Method, parts[4], r.URL)
 }
 
-func (d *Data) handleSparsevolByPoint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
-	// GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>
+func (d *Data) handleSurface(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/surface/<label>
 	if len(parts) < 5 {
-		server.BadRequest(w, r, "ERROR: DVID requires coord to follow 'sparsevol-by-point' command")
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'surface' command")
 		return
 	}
-	timedLog := dvid.NewTimeLog()
-
-	coord, err := dvid.StringToPoint(parts[4], "_")
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "DVID does not support %s on /surface endpoint", r.Method)
+		return
+	}
+	scale, err := getScale(r.URL.Query())
 	if err != nil {
-		server.BadRequest(w, r, err)
+		server.BadRequest(w, r, "bad scale specified: %v", err)
 		return
 	}
-	label, err := d.GetLabelAtPoint(ctx.VersionID(), coord)
+	label, err := strconv.ParseUint(parts[4], 10, 64)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
 	if label == 0 {
-		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as surface.\n")
 		return
 	}
-	b, compression, err := d.getSparsevolOptions(r)
+	b, _, err := d.getSparsevolOptions(r)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-type", "application/octet-stream")
-
-	format := svformatFromQueryString(r)
-	var found bool
-	switch format {
-	case FormatLegacyRLE:
-		found, err = d.WriteLegacyRLE(ctx, label, 0, b, compression, w)
-	case FormatBinaryBlocks:
-		found, err = d.WriteBinaryBlocks(ctx, label, 0, b, compression, w)
-	case FormatStreamingRLE:
-		found, err = d.WriteStreamingRLE(ctx, label, 0, b, compression, w)
-	}
+	timedLog := dvid.NewTimeLog()
+	data, err := d.GetSurface(ctx, label, scale, b)
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
 	}
-	if !found {
+	if data == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/octet-stream")
+	if _, err := w.Write(data); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP %s: surface on label %s (%s)", r.Method, parts[4], r.URL)
+}
+
+func (d *Data) handleSparsevolByPoint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires coord to follow 'sparsevol-by-point' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	coord, err := dvid.StringToPoint(parts[4], "_")
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	label, err := d.GetLabelAtPoint(ctx.VersionID(), coord)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
+		return
+	}
+	b, compression, err := d.getSparsevolOptions(r)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/octet-stream")
+
+	format := svformatFromQueryString(r)
+	var found bool
+	switch format {
+	case FormatLegacyRLE:
+		found, err = d.WriteLegacyRLE(ctx, label, 0, b, compression, w)
+	case FormatBinaryBlocks:
+		found, err = d.WriteBinaryBlocks(ctx, label, 0, b, compression, w)
+	case FormatStreamingRLE:
+		found, err = d.WriteStreamingRLE(ctx, label, 0, b, compression, w)
+	}
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if !found {
 		w.WriteHeader(http.StatusNotFound)
 	}
 	timedLog.Infof("HTTP %s: sparsevol-by-point at %s (%s)", r.Method, parts[4], r.URL)
@@ -3333,6 +3924,47 @@ func (d *Data) handleSparsevolCoarse(ctx *datastore.VersionedCtx, w http.Respons
 	timedLog.Infof("HTTP %s: sparsevol-coarse on label %s (%s)", r.Method, parts[4], r.URL)
 }
 
+func (d *Data) handleROI(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/roi/<label>/<roi name>
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Only POST action is available on 'roi' endpoint.")
+		return
+	}
+	if len(parts) < 6 {
+		server.BadRequest(w, r, "DVID requires label ID and ROI name to follow 'roi' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as ROI.\n")
+		return
+	}
+	uuid, err := datastore.UUIDFromVersion(ctx.VersionID())
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	dest, err := roi.GetOrCreateByUUIDName(uuid, dvid.InstanceName(parts[5]))
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	numSpans, err := d.PutLabelROI(ctx.VersionID(), label, dest)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprintf(w, `{"spans": %d}`, numSpans)
+	timedLog.Infof("HTTP %s: roi %q from label %d (%s)", r.Method, parts[5], label, r.URL)
+}
+
 func (d *Data) handleSparsevolsCoarse(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	// GET <api URL>/node/<UUID>/<data name>/sparsevols-coarse/<start label>/<end label>
 	if len(parts) < 6 {
@@ -3444,7 +4076,7 @@ func (d *Data) handleSplit(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 			server.BadRequest(w, r, "Bad parameter for 'splitlabel' query string (%q).  Must be uint64.\n", splitStr)
 		}
 	}
-	toLabel, err := d.SplitLabels(ctx.VersionID(), fromLabel, splitLabel, r.Body)
+	toLabel, err := d.SplitLabels(ctx.VersionID(), fromLabel, splitLabel, r.Body, queryStrings.Get("u"))
 	if err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("split label %d -> %d: %v", fromLabel, splitLabel, err))
 		return
@@ -3485,7 +4117,7 @@ func (d *Data) handleSplitCoarse(ctx *datastore.VersionedCtx, w http.ResponseWri
 			server.BadRequest(w, r, "Bad parameter for 'splitlabel' query string (%q).  Must be uint64.\n", splitStr)
 		}
 	}
-	toLabel, err := d.SplitCoarseLabels(ctx.VersionID(), fromLabel, splitLabel, r.Body)
+	toLabel, err := d.SplitCoarseLabels(ctx.VersionID(), fromLabel, splitLabel, r.Body, queryStrings.Get("u"))
 	if err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("split-coarse: %v", err))
 		return
@@ -3496,6 +4128,124 @@ func (d *Data) handleSplitCoarse(ctx *datastore.VersionedCtx, w http.ResponseWri
 	timedLog.Infof("HTTP split-coarse of label %d request (%s)", fromLabel, r.URL)
 }
 
+func (d *Data) handleSplitSupervoxels(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/split-supervoxels/<label>[?splitlabel=X&u=<user>]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Split-supervoxels requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'split-supervoxels' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	fromLabel, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if fromLabel == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be split.\n")
+		return
+	}
+	var splitLabel uint64
+	queryStrings := r.URL.Query()
+	if splitStr := queryStrings.Get("splitlabel"); splitStr != "" {
+		splitLabel, err = strconv.ParseUint(splitStr, 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, "Bad parameter for 'splitlabel' query string (%q).  Must be uint64.\n", splitStr)
+			return
+		}
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad POSTed data for split-supervoxels.  Should be JSON.")
+		return
+	}
+	var supervoxels []uint64
+	if err := json.Unmarshal(data, &supervoxels); err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Bad split-supervoxels JSON: %v", err))
+		return
+	}
+	toLabel, err := d.SplitSupervoxels(ctx.VersionID(), fromLabel, splitLabel, labels.NewSet(supervoxels...), queryStrings.Get("u"))
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("split-supervoxels: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "{%q: %d}", "label", toLabel)
+
+	timedLog.Infof("HTTP split-supervoxels of label %d request (%s)", fromLabel, r.URL)
+}
+
+func (d *Data) handleSupervoxels(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Only GET action is available on 'supervoxels' endpoint.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'supervoxels' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	supervoxels, err := d.GetSupervoxels(ctx.VersionID(), label)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(sortedLabels(supervoxels))
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP GET supervoxels for label %d (%s)", label, r.URL)
+}
+
+func (d *Data) handleMapping(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET <api URL>/node/<UUID>/<data name>/mapping
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "Only GET action is available on 'mapping' endpoint.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad GET request body for mapping query: %v", err)
+		return
+	}
+	var supervoxels []uint64
+	if err := json.Unmarshal(data, &supervoxels); err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Bad mapping request JSON: %v", err))
+		return
+	}
+	bodies, err := d.GetBodies(ctx.VersionID(), supervoxels)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(bodies)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP GET mapping of %d supervoxels (%s)", len(supervoxels), r.URL)
+}
+
 func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	// POST <api URL>/node/<UUID>/<data name>/merge
 	if strings.ToLower(r.Method) != "post" {
@@ -3519,7 +4269,7 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		server.BadRequest(w, r, err)
 		return
 	}
-	if err := d.MergeLabels(ctx.VersionID(), mergeOp); err != nil {
+	if err := d.MergeLabels(ctx.VersionID(), mergeOp, r.URL.Query().Get("u")); err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("Error on merge: %v", err))
 		return
 	}
@@ -3527,6 +4277,197 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 	timedLog.Infof("HTTP merge request (%s)", r.URL)
 }
 
+func (d *Data) handleCleave(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/cleave/<label>[?cleavelabel=X&u=<user>]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Cleave requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'cleave' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	fromLabel, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if fromLabel == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be cleaved.\n")
+		return
+	}
+	var cleaveLabel uint64
+	queryStrings := r.URL.Query()
+	cleaveStr := queryStrings.Get("cleavelabel")
+	if cleaveStr != "" {
+		cleaveLabel, err = strconv.ParseUint(cleaveStr, 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, "Bad parameter for 'cleavelabel' query string (%q).  Must be uint64.\n", cleaveStr)
+			return
+		}
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad POSTed data for cleave.  Should be JSON.")
+		return
+	}
+	var op CleaveOp
+	if err := json.Unmarshal(data, &op); err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Bad cleave op JSON: %v", err))
+		return
+	}
+	toLabel, err := d.CleaveLabel(ctx.VersionID(), fromLabel, cleaveLabel, op, queryStrings.Get("u"))
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("cleave label %d -> %d: %v", fromLabel, cleaveLabel, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "{%q: %d}", "label", toLabel)
+
+	timedLog.Infof("HTTP cleave of label %d request (%s)", fromLabel, r.URL)
+}
+
+func (d *Data) handlePaint(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/paint/<label>[?format=...&u=<user>]
+	// POST <api URL>/node/<UUID>/<data name>/erase/<label>[?format=...&u=<user>]
+	action := parts[3]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "%s requests must be POST actions.", action)
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires label ID to follow '%s' command", action)
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	format := svformatFromQueryString(r)
+	user := r.URL.Query().Get("u")
+	var mutID, changed uint64
+	if action == "erase" {
+		mutID, changed, err = d.EraseLabel(ctx.VersionID(), label, r.Body, format, user)
+	} else {
+		mutID, changed, err = d.PaintLabel(ctx.VersionID(), label, r.Body, format, user)
+	}
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("%s label %d: %v", action, label, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "{%q: %d, %q: %d}", "MutationID", mutID, "Voxels", changed)
+
+	timedLog.Infof("HTTP %s of label %d request (%s)", action, label, r.URL)
+}
+
+func (d *Data) handleUndo(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// POST <api URL>/node/<UUID>/<data name>/undo/<mutation id>[?u=<user>]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Undo requests must be POST actions.")
+		return
+	}
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "ERROR: DVID requires mutation id to follow 'undo' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	mutID, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	rec, err := d.UndoMutation(ctx.VersionID(), mutID, r.URL.Query().Get("u"))
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("undo of mutation %d: %v", mutID, err))
+		return
+	}
+	jsonBytes, err := json.Marshal(rec)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP undo of %s mutation %d (%s)", rec.Action, mutID, r.URL)
+}
+
+func (d *Data) handleCheckout(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET  <api URL>/node/<UUID>/<data name>/checkout
+	// POST <api URL>/node/<UUID>/<data name>/checkout?u=<user>[&lease=<seconds>]
+	timedLog := dvid.NewTimeLog()
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: ctx.VersionID()}
+
+	var checkouts labels.LabelCheckouts
+	switch strings.ToLower(r.Method) {
+	case "get":
+		checkouts = labels.Checkouts(iv)
+	case "post":
+		queryStrings := r.URL.Query()
+		lease := labels.DefaultCheckoutLease
+		if leaseStr := queryStrings.Get("lease"); leaseStr != "" {
+			secs, err := strconv.ParseUint(leaseStr, 10, 32)
+			if err != nil {
+				server.BadRequest(w, r, "Bad parameter for 'lease' query string (%q).  Must be seconds.\n", leaseStr)
+				return
+			}
+			lease = time.Duration(secs) * time.Second
+		}
+		var lbls []uint64
+		if err := json.NewDecoder(r.Body).Decode(&lbls); err != nil {
+			server.BadRequest(w, r, "expected JSON array of labels in POST: %v", err)
+			return
+		}
+		var err error
+		if checkouts, err = labels.Checkout(iv, queryStrings.Get("u"), lbls, lease); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	default:
+		server.BadRequest(w, r, "Only GET or POST actions are available on 'checkout' endpoint.")
+		return
+	}
+	jsonBytes, err := json.Marshal(checkouts)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP %s checkout request with %d labels (%s)", r.Method, len(checkouts), r.URL)
+}
+
+func (d *Data) handleRelease(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/release?u=<user>[&force=true]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Release requests must be POST actions.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	var lbls []uint64
+	if err := json.NewDecoder(r.Body).Decode(&lbls); err != nil {
+		server.BadRequest(w, r, "expected JSON array of labels in POST: %v", err)
+		return
+	}
+	queryStrings := r.URL.Query()
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: ctx.VersionID()}
+	if err := labels.Release(iv, queryStrings.Get("u"), lbls, queryStrings.Get("force") == "true"); err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	timedLog.Infof("HTTP release of %d labels (%s)", len(lbls), r.URL)
+}
+
 // --------- Other functions on labelarray Data -----------------
 
 // GetLabelBlock returns a compressed label Block of the given block coordinate.
@@ -3561,8 +4502,23 @@ func (d *Data) GetLabelBlock(v dvid.VersionID, scale uint8, bcoord dvid.ChunkPoi
 	return &block, nil
 }
 
+// GetLabelBlocks returns the hi-res block coordinates holding voxels of the given label,
+// including any labels mapped to it.
+func (d *Data) GetLabelBlocks(v dvid.VersionID, label uint64) (dvid.IZYXSlice, error) {
+	meta, _, err := GetMappedLabelIndex(d, v, label, 0, dvid.Bounds{})
+	if err != nil {
+		return nil, err
+	}
+	return meta.Blocks, nil
+}
+
 // GetLabelBytes returns a hi-res block of labels in packed little-endian uint64 format.
+// If the data maps supervoxels, the labels are bodies.
 func (d *Data) GetLabelBytes(v dvid.VersionID, bcoord dvid.ChunkPoint3d) ([]byte, error) {
+	return d.getLabelBytes(v, bcoord, false)
+}
+
+func (d *Data) getLabelBytes(v dvid.VersionID, bcoord dvid.ChunkPoint3d, supervoxels bool) ([]byte, error) {
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return nil, err
@@ -3586,12 +4542,29 @@ func (d *Data) GetLabelBytes(v dvid.VersionID, bcoord dvid.ChunkPoint3d) ([]byte
 	if err = block.UnmarshalBinary(deserialization); err != nil {
 		return nil, err
 	}
+	if !supervoxels {
+		mapping, err := d.getMapping(v)
+		if err != nil {
+			return nil, err
+		}
+		if mapping != nil {
+			mapped, err := block.MapLabels(mapping)
+			if err != nil {
+				return nil, err
+			}
+			block = *mapped
+		}
+	}
 	labelData, _ := block.MakeLabelVolume()
 	return labelData, nil
 }
 
 // GetLabelBytesAtPoint returns the 8 byte slice corresponding to a 64-bit label at a point.
 func (d *Data) GetLabelBytesAtPoint(v dvid.VersionID, pt dvid.Point) ([]byte, error) {
+	return d.getLabelBytesAtPoint(v, pt, false)
+}
+
+func (d *Data) getLabelBytesAtPoint(v dvid.VersionID, pt dvid.Point, supervoxels bool) ([]byte, error) {
 	coord, ok := pt.(dvid.Chunkable)
 	if !ok {
 		return nil, fmt.Errorf("Can't determine block of point %s", pt)
@@ -3599,7 +4572,7 @@ func (d *Data) GetLabelBytesAtPoint(v dvid.VersionID, pt dvid.Point) ([]byte, er
 	blockSize := d.BlockSize()
 	bcoord := coord.Chunk(blockSize).(dvid.ChunkPoint3d)
 
-	labelData, err := d.GetLabelBytes(v, bcoord)
+	labelData, err := d.getLabelBytes(v, bcoord, supervoxels)
 	if err != nil {
 		return nil, err
 	}
@@ -3623,3 +4596,13 @@ func (d *Data) GetLabelAtPoint(v dvid.VersionID, pt dvid.Point) (uint64, error)
 	}
 	return binary.LittleEndian.Uint64(labelBytes), nil
 }
+
+// GetSupervoxelAtPoint returns the supervoxel for a given point, which is the same as the label
+// if the data doesn't map supervoxels.
+func (d *Data) GetSupervoxelAtPoint(v dvid.VersionID, pt dvid.Point) (uint64, error) {
+	labelBytes, err := d.getLabelBytesAtPoint(v, pt, true)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(labelBytes), nil
+}
@@ -3,12 +3,15 @@ package labelarray
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -909,6 +912,68 @@ func TestLabelarrayDirectAPI(t *testing.T) {
 	}
 }
 
+func TestCancelledRequest(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, versionID := initTestRepo()
+	lbls := newDataInstance(uuid, t, "mylabels")
+
+	offset := dvid.Point3d{0, 0, 0}
+	size := dvid.Point3d{2 * DefaultBlockSize, DefaultBlockSize, 2 * DefaultBlockSize}
+	subvol := dvid.NewSubvolume(offset, size)
+	data := make([]byte, size.Prod()*8)
+	for i := int64(0); i < size.Prod(); i++ {
+		binary.LittleEndian.PutUint64(data[i*8:i*8+8], 7)
+	}
+	v, err := lbls.NewVoxels(subvol, data)
+	if err != nil {
+		t.Fatalf("Unable to make new labels Voxels: %v\n", err)
+	}
+	if err = lbls.IngestVoxels(versionID, 1, v, ""); err != nil {
+		t.Fatalf("Unable to put labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "mylabels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	// A request whose client has already disconnected should not read any blocks.
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := datastore.NewVersionedCtx(lbls, versionID)
+	ctx.SetRequestContext(reqCtx)
+
+	lbl, err := lbls.NewLabels(subvol, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lbls.GetLabels(ctx, 0, lbl, nil, false); err == nil {
+		t.Errorf("expected error on GET of labels with cancelled request\n")
+	}
+	var buf bytes.Buffer
+	w := httptest.NewRecorder()
+	if err := lbls.SendBlocks(ctx, w, 0, subvol, "blocks", false); err == nil {
+		t.Errorf("expected error on GET of blocks with cancelled request\n")
+	}
+	if _, err := lbls.WriteStreamingRLE(ctx, 7, 0, dvid.Bounds{}, "", &buf); err == nil {
+		t.Errorf("expected error on streaming sparsevol with cancelled request\n")
+	}
+
+	// The same reads with a live request should succeed.
+	ctx.SetRequestContext(context.Background())
+	if err := lbls.GetLabels(ctx, 0, lbl, nil, false); err != nil {
+		t.Errorf("unexpected error on GET of labels: %v\n", err)
+	}
+	if !bytes.Equal(lbl.Data(), data) {
+		t.Errorf("labels read after cancelled request differ from stored labels\n")
+	}
+	if found, err := lbls.WriteStreamingRLE(ctx, 7, 0, dvid.Bounds{}, "", &buf); err != nil || !found {
+		t.Errorf("unexpected result on streaming sparsevol: found %t, err %v\n", found, err)
+	}
+}
+
 func TestLabelarrayRepoPersistence(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -1612,3 +1677,76 @@ func TestLabels(t *testing.T) {
 func TestLabelsUnindexed(t *testing.T) {
 	testLabels(t, false)
 }
+
+func TestArbitrarySlice(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("VoxelSize", "8,8,8")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{40, 40, 40}, dvid.Point3d{40, 40, 40}, 1)
+	volume.addSubvol(dvid.Point3d{40, 40, 80}, dvid.Point3d{40, 40, 40}, 2)
+	volume.addSubvol(dvid.Point3d{80, 40, 40}, dvid.Point3d{40, 40, 40}, 13)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+
+	// XY slice at z = 50 and XZ slice at y = 50 with one pixel per voxel.
+	tests := []struct {
+		tl, tr, bl string
+		voxel      func(x, y int32) dvid.Point3d
+	}{
+		{"0_0_400", "1016_0_400", "0_1016_400", func(x, y int32) dvid.Point3d { return dvid.Point3d{x, y, 50} }},
+		{"0_400_0", "1016_400_0", "0_400_1016", func(x, y int32) dvid.Point3d { return dvid.Point3d{x, 50, y} }},
+	}
+	for n, tc := range tests {
+		apiStr := fmt.Sprintf("%snode/%s/labels/arb/%s/%s/%s/8", server.WebAPIPath, uuid, tc.tl, tc.tr, tc.bl)
+		data := server.TestHTTP(t, "GET", apiStr, nil)
+		if len(data) != 128*128*8 {
+			t.Fatalf("expected %d bytes from arbitrary slice %d, got %d\n", 128*128*8, n, len(data))
+		}
+		for y := int32(0); y < 128; y++ {
+			for x := int32(0); x < 128; x++ {
+				i := (y*128 + x) * 8
+				got := binary.LittleEndian.Uint64(data[i : i+8])
+				pt := tc.voxel(x, y)
+				if expected := volume.getVoxel(pt); got != expected {
+					t.Fatalf("arbitrary slice %d: expected label %d at %s, got %d\n", n, expected, pt, got)
+				}
+			}
+		}
+
+		compressed := server.TestHTTP(t, "GET", apiStr+"?compression=lz4", nil)
+		uncompressed := make([]byte, 128*128*8)
+		if err := lz4.Uncompress(compressed, uncompressed); err != nil {
+			t.Fatalf("unable to uncompress lz4 arbitrary slice: %v\n", err)
+		}
+		if !bytes.Equal(data, uncompressed) {
+			t.Errorf("lz4 compressed arbitrary slice %d differs from uncompressed slice\n", n)
+		}
+	}
+
+	apiStr := fmt.Sprintf("%snode/%s/labels/arb/0_0_400/1016_0_400/0_1016_400/8/png", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	img, err := png.Decode(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("unable to decode pseudocolor arbitrary slice: %v\n", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 128 {
+		t.Errorf("expected 128 x 128 pseudocolor arbitrary slice, got %v\n", bounds)
+	}
+	_, _, _, a := img.At(0, 0).RGBA()
+	if a == 0 {
+		t.Errorf("expected opaque pseudocolor pixels in arbitrary slice\n")
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/labels/arb/0_0_400/1016_0_400/0_1016_400/8/jpg", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/roi"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -217,7 +218,12 @@ func GetMappedLabelIndex(d dvid.Data, v dvid.VersionID, label uint64, scale uint
 
 	// Get set of all labels that have been merged to this given label.
 	var lbls labels.Set
-	if mapping == nil {
+	if ld, ok := d.(*Data); ok && ld.MapSupervoxels {
+		var err error
+		if lbls, err = ld.GetSupervoxels(v, label); err != nil {
+			return nil, nil, err
+		}
+	} else if mapping == nil {
 		lbls = labels.Set{label: struct{}{}}
 	} else {
 		lbls = mapping.ConstituentLabels(label)
@@ -278,7 +284,16 @@ func GetMappedLabelSetIndex(d dvid.Data, v dvid.VersionID, lbls labels.Set, scal
 
 	// Expand set of all labels based on mappings.
 	var lbls2 labels.Set
-	if mapping == nil {
+	if ld, ok := d.(*Data); ok && ld.MapSupervoxels {
+		lbls2 = make(labels.Set)
+		for label := range lbls {
+			supervoxels, err := ld.GetSupervoxels(v, label)
+			if err != nil {
+				return nil, nil, err
+			}
+			lbls2.Merge(supervoxels)
+		}
+	} else if mapping == nil {
 		lbls2 = lbls
 	} else {
 		lbls2 = make(labels.Set)
@@ -299,7 +314,7 @@ func GetMappedLabelSetIndex(d dvid.Data, v dvid.VersionID, lbls labels.Set, scal
 			return nil, nil, err
 		}
 		if meta != nil {
-			if len(lbls) == 1 {
+			if len(lbls2) == 1 {
 				blocks = meta.Blocks
 				voxels = meta.Voxels
 			} else if len(meta.Blocks) > 0 {
@@ -865,6 +880,10 @@ func (d *Data) WriteBinaryBlocks(ctx *datastore.VersionedCtx, label uint64, scal
 	op := labels.NewOutputOp(w)
 	go labels.WriteBinaryBlocks(label, lbls, op, bounds)
 	for _, izyx := range indices {
+		if err := storage.ContextErr(ctx); err != nil {
+			op.Finish()
+			return false, fmt.Errorf("sparsevol for labels %v abandoned: %v", lbls, err)
+		}
 		tk := NewBlockTKeyByCoord(scale, izyx)
 		data, err := store.Get(ctx, tk)
 		if err != nil {
@@ -915,6 +934,10 @@ func (d *Data) WriteStreamingRLE(ctx *datastore.VersionedCtx, label uint64, scal
 	op := labels.NewOutputOp(w)
 	go labels.WriteRLEs(lbls, op, bounds)
 	for _, izyx := range indices {
+		if err := storage.ContextErr(ctx); err != nil {
+			op.Finish()
+			return false, fmt.Errorf("sparsevol for labels %v abandoned: %v", lbls, err)
+		}
 		tk := NewBlockTKeyByCoord(scale, izyx)
 		data, err := store.Get(ctx, tk)
 		if err != nil {
@@ -989,6 +1012,28 @@ func (d *Data) GetLegacyRLE(ctx *datastore.VersionedCtx, label uint64, scale uin
 	return d.getLegacyRLEs(ctx, meta, lbls, scale, bounds)
 }
 
+// GetSurface returns the surface voxels and normals of a label at the given scale using
+// the serialization of dvid.SparseVol.SurfaceSerialization.  If the label isn't found
+// within the given bounds, nil is returned.
+func (d *Data) GetSurface(ctx *datastore.VersionedCtx, label uint64, scale uint8, bounds dvid.Bounds) ([]byte, error) {
+	meta, lbls, err := GetMappedLabelIndex(d, ctx.VersionID(), label, scale, bounds)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || len(meta.Blocks) == 0 || len(lbls) == 0 {
+		return nil, nil
+	}
+	rles, err := d.getLegacyRLEs(ctx, meta, lbls, scale, bounds)
+	if err != nil || rles == nil {
+		return nil, err
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("block size for data %q must be 3d", d.DataName())
+	}
+	return dvid.SparseVolSurface(rles, blockSize[2], d.Properties.VoxelSize)
+}
+
 //  The encoding has the following format where integers are little endian:
 //
 //    byte     Payload descriptor:
@@ -1030,6 +1075,10 @@ func (d *Data) getLegacyRLEs(ctx *datastore.VersionedCtx, meta *Meta, lbls label
 	go labels.WriteRLEs(lbls, op, bounds)
 	var numEmpty int
 	for _, izyx := range indices {
+		if err := storage.ContextErr(ctx); err != nil {
+			op.Finish()
+			return nil, fmt.Errorf("sparsevol for labels %v abandoned: %v", lbls, err)
+		}
 		tk := NewBlockTKeyByCoord(scale, izyx)
 		data, err := store.Get(ctx, tk)
 		if err != nil {
@@ -1143,6 +1192,30 @@ func (d *Data) GetSparseCoarseVol(ctx *datastore.VersionedCtx, label uint64, bou
 	return serialization, nil
 }
 
+// PutLabelROI stores the blocks of a label into the given ROI, replacing any previous ROI
+// for that version, and returns the number of ROI spans.
+func (d *Data) PutLabelROI(v dvid.VersionID, label uint64, dest *roi.Data) (int, error) {
+	meta, _, err := GetMappedLabelIndex(d, v, label, 0, dvid.Bounds{})
+	if err != nil {
+		return 0, err
+	}
+	if meta == nil || len(meta.Blocks) == 0 {
+		return 0, fmt.Errorf("label %d not found in data %q", label, d.DataName())
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return 0, fmt.Errorf("block size for data %q must be 3d", d.DataName())
+	}
+	spans, err := dest.BlockSpans(meta.Blocks, blockSize)
+	if err != nil {
+		return 0, err
+	}
+	if err := dest.PutSpans(v, spans, true); err != nil {
+		return 0, err
+	}
+	return len(spans), nil
+}
+
 // WriteSparseCoarseVols returns a stream of sparse volumes with blocks of the given label
 // in encoded RLE format:
 //
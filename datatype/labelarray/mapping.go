@@ -0,0 +1,493 @@
+/*
+	This file supports the MapSupervoxels mode, where label blocks hold immutable supervoxel
+	ids and a versioned supervoxel to body mapping is applied on reads.  Merges then only
+	change the mapping, and splits move whole supervoxels to a new body.
+*/
+
+package labelarray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// getMapping returns the supervoxel to body mapping for a version, loading it from the store
+// if it isn't cached.  Returns nil if the data instance doesn't map supervoxels.
+func (d *Data) getMapping(v dvid.VersionID) (*labels.Mapping, error) {
+	if !d.MapSupervoxels {
+		return nil, nil
+	}
+	d.svMu.RLock()
+	m, found := d.svMaps[v]
+	d.svMu.RUnlock()
+	if found {
+		return m, nil
+	}
+
+	d.svMu.Lock()
+	defer d.svMu.Unlock()
+	if m, found = d.svMaps[v]; found {
+		return m, nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	m = new(labels.Mapping)
+	ctx := datastore.NewVersionedCtx(d, v)
+	begTKey := NewSupervoxelMapTKey(0)
+	endTKey := NewSupervoxelMapTKey(math.MaxUint64)
+	err = store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || len(c.V) != 8 {
+			return nil
+		}
+		supervoxel, err := DecodeSupervoxelMapTKey(c.K)
+		if err != nil {
+			return err
+		}
+		m.Set(supervoxel, binary.LittleEndian.Uint64(c.V))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load supervoxel mapping for data %q: %v", d.DataName(), err)
+	}
+	if d.svMaps == nil {
+		d.svMaps = make(map[dvid.VersionID]*labels.Mapping)
+	}
+	d.svMaps[v] = m
+	return m, nil
+}
+
+// setMapping maps the given supervoxels to a body in both the store and the cached mapping.
+// Supervoxels mapped to their own id have their mapping removed.
+func (d *Data) setMapping(v dvid.VersionID, m *labels.Mapping, supervoxels labels.Set, body uint64) error {
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	batch := batcher.NewBatch(ctx)
+	for supervoxel := range supervoxels {
+		tk := NewSupervoxelMapTKey(supervoxel)
+		if supervoxel == body {
+			batch.Delete(tk)
+		} else {
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, body)
+			batch.Put(tk, buf)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("unable to store supervoxel mapping for data %q: %v", d.DataName(), err)
+	}
+	for supervoxel := range supervoxels {
+		if supervoxel == body {
+			m.Delete(supervoxel)
+		} else {
+			m.Set(supervoxel, body)
+		}
+	}
+	return nil
+}
+
+// mappedBody returns the body for a supervoxel given a mapping.
+func mappedBody(m *labels.Mapping, supervoxel uint64) uint64 {
+	if body, found := m.Get(supervoxel); found {
+		return body
+	}
+	return supervoxel
+}
+
+// bodySupervoxels returns the supervoxels mapped to a body given a mapping.
+func bodySupervoxels(m *labels.Mapping, body uint64) labels.Set {
+	supervoxels := m.ConstituentLabels(body)
+	if mapped, found := m.Get(body); found && mapped != body {
+		delete(supervoxels, body)
+	}
+	return supervoxels
+}
+
+// checkBody returns an error if the label is a supervoxel that has been mapped to another body.
+func checkBody(m *labels.Mapping, label uint64) error {
+	if mapped, found := m.Get(label); found && mapped != label {
+		return fmt.Errorf("label %d has already been merged into label %d", label, mapped)
+	}
+	return nil
+}
+
+// GetSupervoxels returns the supervoxels of a body.  If the data instance doesn't map
+// supervoxels, only the body label itself is returned.
+func (d *Data) GetSupervoxels(v dvid.VersionID, body uint64) (labels.Set, error) {
+	m, err := d.getMapping(v)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return labels.NewSet(body), nil
+	}
+	if err := checkBody(m, body); err != nil {
+		return nil, err
+	}
+	return bodySupervoxels(m, body), nil
+}
+
+// GetBodies returns the body for each of the given supervoxels.
+func (d *Data) GetBodies(v dvid.VersionID, supervoxels []uint64) ([]uint64, error) {
+	m, err := d.getMapping(v)
+	if err != nil {
+		return nil, err
+	}
+	bodies := make([]uint64, len(supervoxels))
+	for i, supervoxel := range supervoxels {
+		if m == nil {
+			bodies[i] = supervoxel
+		} else {
+			bodies[i] = mappedBody(m, supervoxel)
+		}
+	}
+	return bodies, nil
+}
+
+// getSupervoxelsIndex returns the union of the label indices for a set of supervoxels.
+func (d *Data) getSupervoxelsIndex(v dvid.VersionID, supervoxels labels.Set) (*Meta, error) {
+	var meta Meta
+	for supervoxel := range supervoxels {
+		svMeta, err := GetLabelIndex(d, v, supervoxel)
+		if err != nil {
+			return nil, err
+		}
+		if svMeta != nil && len(svMeta.Blocks) > 0 {
+			meta.Voxels += svMeta.Voxels
+			meta.Blocks.Merge(svMeta.Blocks)
+		}
+	}
+	return &meta, nil
+}
+
+// returns a sorted slice of labels in the set.
+func sortedLabels(lbls labels.Set) []uint64 {
+	sorted := make([]uint64, 0, len(lbls))
+	for label := range lbls {
+		sorted = append(sorted, label)
+	}
+	sort.Sort(labelSlice(sorted))
+	return sorted
+}
+
+type labelSlice []uint64
+
+func (s labelSlice) Len() int           { return len(s) }
+func (s labelSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s labelSlice) Less(i, j int) bool { return s[i] < s[j] }
+
+// mergeSupervoxels merges bodies by mapping all their supervoxels to the target body without
+// changing any label blocks or indices.  The caller must hold LargeMutationMutex.
+func (d *Data) mergeSupervoxels(v dvid.VersionID, op labels.MergeOp) error {
+	m, err := d.getMapping(v)
+	if err != nil {
+		return err
+	}
+	if err := checkBody(m, op.Target); err != nil {
+		return err
+	}
+	rec := &MutationRecord{Action: "merge", Target: op.Target}
+	mergedSupervoxels := make(labels.Set)
+	for _, body := range sortedLabels(op.Merged) {
+		if err := checkBody(m, body); err != nil {
+			return err
+		}
+		supervoxels := bodySupervoxels(m, body)
+		mergedSupervoxels.Merge(supervoxels)
+		rec.Labels = append(rec.Labels, body)
+		rec.Supervoxels = append(rec.Supervoxels, sortedLabels(supervoxels))
+	}
+	targetMeta, err := d.getSupervoxelsIndex(v, bodySupervoxels(m, op.Target))
+	if err != nil {
+		return fmt.Errorf("can't get block indices of merge target label %d: %v", op.Target, err)
+	}
+	mergedMeta, err := d.getSupervoxelsIndex(v, mergedSupervoxels)
+	if err != nil {
+		return fmt.Errorf("can't get block indices of merged labels %s: %v", op.Merged, err)
+	}
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	mutID := d.NewMutationID()
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":     "merge",
+		"Target":     op.Target,
+		"Labels":     rec.Labels,
+		"UUID":       string(versionuuid),
+		"MutationID": mutID,
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("can't send merge op for %q to kafka: %v\n", d.DataName(), err)
+	}
+
+	evt := datastore.SyncEvent{d.DataUUID(), labels.MergeStartEvent}
+	msg := datastore.SyncMessage{labels.MergeStartEvent, v, labels.DeltaMergeStart{op}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		return err
+	}
+
+	if err := d.setMapping(v, m, mergedSupervoxels, op.Target); err != nil {
+		return err
+	}
+
+	delta := labels.DeltaMerge{
+		MergeOp:      op,
+		Blocks:       targetMeta.Blocks.MergeCopy(mergedMeta.Blocks),
+		TargetVoxels: targetMeta.Voxels,
+		MergedVoxels: mergedMeta.Voxels,
+	}
+	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeBlockEvent}
+	msg = datastore.SyncMessage{labels.MergeBlockEvent, v, delta}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	deltaRep := labels.DeltaReplaceSize{
+		Label:   op.Target,
+		OldSize: targetMeta.Voxels,
+		NewSize: targetMeta.Voxels + mergedMeta.Voxels,
+	}
+	evt = datastore.SyncEvent{d.DataUUID(), labels.ChangeSizeEvent}
+	msg = datastore.SyncMessage{labels.ChangeSizeEvent, v, deltaRep}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeEndEvent}
+	msg = datastore.SyncMessage{labels.MergeEndEvent, v, labels.DeltaMergeEnd{op}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	rec.MutID = mutID
+	if err := d.putMutationRecord(v, rec); err != nil {
+		return err
+	}
+
+	msginfo = map[string]interface{}{
+		"Action":     "merge-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("can't send merge complete op for %q to kafka: %v\n", d.DataName(), err)
+	}
+	dvid.Infof("Mapped %d supervoxels of labels %s -> %d, data %q\n", len(mergedSupervoxels), op.Merged, op.Target, d.DataName())
+	return nil
+}
+
+// SplitSupervoxels moves the given supervoxels of a body to a new body, which is returned.
+// If splitLabel is 0, a new label is used for the new body.  The split is rejected if either
+// body is checked out by a user other than the given user.
+func (d *Data) SplitSupervoxels(v dvid.VersionID, fromLabel, splitLabel uint64, supervoxels labels.Set, user string) (toLabel uint64, err error) {
+	if !d.MapSupervoxels {
+		return 0, fmt.Errorf("data %q does not map supervoxels", d.DataName())
+	}
+	if splitLabel != 0 {
+		toLabel = splitLabel
+		if err = d.updateMaxLabel(v, splitLabel); err != nil {
+			return
+		}
+	} else if toLabel, err = d.NewLabel(v); err != nil {
+		return
+	}
+
+	// Only do one large mutation at a time.
+	server.LargeMutationMutex.Lock()
+	defer server.LargeMutationMutex.Unlock()
+
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if err = labels.CheckoutConflict(iv, user, fromLabel, toLabel); err != nil {
+		return
+	}
+	err = d.splitSupervoxels(v, fromLabel, toLabel, supervoxels)
+	return
+}
+
+// splitSupervoxels moves supervoxels from one body to another and records it for undo.
+// The caller must hold LargeMutationMutex.
+func (d *Data) splitSupervoxels(v dvid.VersionID, fromLabel, toLabel uint64, supervoxels labels.Set) error {
+	if len(supervoxels) == 0 {
+		return fmt.Errorf("no supervoxels given for split of label %d", fromLabel)
+	}
+	m, err := d.getMapping(v)
+	if err != nil {
+		return err
+	}
+	if err := checkBody(m, fromLabel); err != nil {
+		return err
+	}
+	for supervoxel := range supervoxels {
+		if body := mappedBody(m, supervoxel); body != fromLabel {
+			return fmt.Errorf("supervoxel %d belongs to label %d, not label %d", supervoxel, body, fromLabel)
+		}
+	}
+
+	// A split into a body with voxels can't be undone by merging it back.
+	existing, err := d.getSupervoxelsIndex(v, bodySupervoxels(m, toLabel))
+	if err != nil {
+		return err
+	}
+
+	// Get the voxels of the split supervoxels for synced data.
+	meta, err := d.getSupervoxelsIndex(v, supervoxels)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	rleBytes, err := d.getLegacyRLEs(ctx, meta, supervoxels, 0, dvid.Bounds{})
+	if err != nil {
+		return err
+	}
+	var splitmap dvid.BlockRLEs
+	if len(rleBytes) != 0 {
+		split, err := dvid.ReadRLEs(bytes.NewReader(rleBytes))
+		if err != nil {
+			return err
+		}
+		blockSize, ok := d.BlockSize().(dvid.Point3d)
+		if !ok {
+			return fmt.Errorf("can't do split because block size for instance %s is not 3d: %v", d.DataName(), d.BlockSize())
+		}
+		if splitmap, err = split.Partition(blockSize); err != nil {
+			return err
+		}
+	}
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	splitOpStart := labels.DeltaSplitStart{fromLabel, toLabel}
+	splitOpEnd := labels.DeltaSplitEnd{fromLabel, toLabel}
+	if err := labels.SplitStart(iv, splitOpStart); err != nil {
+		return err
+	}
+	defer labels.SplitStop(iv, splitOpEnd)
+
+	mutID := d.NewMutationID()
+	sorted := sortedLabels(supervoxels)
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":      "split-supervoxels",
+		"Target":      fromLabel,
+		"NewLabel":    toLabel,
+		"Supervoxels": sorted,
+		"MutationID":  mutID,
+		"UUID":        string(versionuuid),
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending split supervoxels op to kafka: %v", err)
+	}
+
+	evt := datastore.SyncEvent{d.DataUUID(), labels.SplitStartEvent}
+	msg := datastore.SyncMessage{labels.SplitStartEvent, v, splitOpStart}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		return err
+	}
+
+	if err := d.setMapping(v, m, supervoxels, toLabel); err != nil {
+		return err
+	}
+
+	deltaNewSize := labels.DeltaNewSize{
+		Label: toLabel,
+		Size:  meta.Voxels,
+	}
+	evt = datastore.SyncEvent{d.DataUUID(), labels.ChangeSizeEvent}
+	msg = datastore.SyncMessage{labels.ChangeSizeEvent, v, deltaNewSize}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+	deltaModSize := labels.DeltaModSize{
+		Label:      fromLabel,
+		SizeChange: int64(-meta.Voxels),
+	}
+	msg = datastore.SyncMessage{labels.ChangeSizeEvent, v, deltaModSize}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	deltaSplit := labels.DeltaSplit{
+		OldLabel:     fromLabel,
+		NewLabel:     toLabel,
+		Split:        splitmap,
+		SortedBlocks: splitmap.SortedKeys(),
+		SplitVoxels:  meta.Voxels,
+	}
+	evt = datastore.SyncEvent{d.DataUUID(), labels.SplitLabelEvent}
+	msg = datastore.SyncMessage{labels.SplitLabelEvent, v, deltaSplit}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	evt = datastore.SyncEvent{d.DataUUID(), labels.SplitEndEvent}
+	msg = datastore.SyncMessage{labels.SplitEndEvent, v, splitOpEnd}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		return fmt.Errorf("Unable to notify subscribers to data %q for evt %v\n", d.DataName(), evt)
+	}
+
+	rec := &MutationRecord{
+		MutID:             mutID,
+		Action:            "split-supervoxels",
+		Target:            fromLabel,
+		NewLabel:          toLabel,
+		Supervoxels:       [][]uint64{sorted},
+		SplitIntoExisting: len(existing.Blocks) != 0,
+	}
+	if err := d.putMutationRecord(v, rec); err != nil {
+		return err
+	}
+
+	msginfo = map[string]interface{}{
+		"Action":     "split-supervoxels-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending split supervoxels complete op to kafka: %v", err)
+	}
+	dvid.Infof("Split %d supervoxels from label %d to label %d, data %q\n", len(supervoxels), fromLabel, toLabel, d.DataName())
+	return nil
+}
+
+// mapSerializedBlock returns a serialized label block with the given mapping applied.
+func (d *Data) mapSerializedBlock(serialization []byte, m *labels.Mapping) ([]byte, error) {
+	data, _, err := dvid.DeserializeData(serialization, true)
+	if err != nil {
+		return nil, err
+	}
+	var block labels.Block
+	if err := block.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	mapped, err := block.MapLabels(m)
+	if err != nil {
+		return nil, err
+	}
+	data, err = mapped.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return dvid.SerializeData(data, d.Compression(), d.Checksum())
+}
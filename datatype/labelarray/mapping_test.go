@@ -0,0 +1,137 @@
+package labelarray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// checks an XY arbitrary slice through the given z against the expected volume.
+func checkArbSlice(t *testing.T, uuid dvid.UUID, z int32, query string, expected *testVolume) {
+	zStr := fmt.Sprintf("%d", z*8)
+	apiStr := fmt.Sprintf("%snode/%s/labels/arb/0_0_%s/1016_0_%s/0_1016_%s/8%s", server.WebAPIPath, uuid, zStr, zStr, zStr, query)
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	if len(data) != 128*128*8 {
+		t.Fatalf("expected %d bytes from arbitrary slice, got %d\n", 128*128*8, len(data))
+	}
+	for y := int32(0); y < 128; y++ {
+		for x := int32(0); x < 128; x++ {
+			i := (y*128 + x) * 8
+			pt := dvid.Point3d{x, y, z}
+			if got, label := binary.LittleEndian.Uint64(data[i:i+8]), expected.getVoxel(pt); got != label {
+				t.Fatalf("arbitrary slice%s: expected label %d at %s, got %d\n", query, label, pt, got)
+			}
+		}
+	}
+}
+
+func getJSONLabels(t *testing.T, method, reqStr string, payload []byte) []uint64 {
+	var lbls []uint64
+	r := server.TestHTTP(t, method, reqStr, bytes.NewBuffer(payload))
+	if err := json.Unmarshal(r, &lbls); err != nil {
+		t.Fatalf("couldn't parse JSON labels %q: %v\n", string(r), err)
+	}
+	return lbls
+}
+
+func TestMapSupervoxels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("MapSupervoxels", "true")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	supervoxels := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// Merge only changes the mapping.
+	testMerge := mergeJSON(`[2, 3]`)
+	testMerge.send(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	bodies := newTestVolume(128, 128, 128)
+	copy(bodies.data, supervoxels.data)
+	bodies.addBody(body3, 2)
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(bodies); err != nil {
+		t.Errorf("merged bodies not returned: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/raw/0_1_2/128_128_128/0_0_0?supervoxels=true", server.WebAPIPath, uuid)
+	retrieved.data = server.TestHTTP(t, "GET", reqStr, nil)
+	if err := retrieved.equals(supervoxels); err != nil {
+		t.Errorf("supervoxels changed by merge: %v\n", err)
+	}
+
+	// Arbitrary slices also use the bodies unless supervoxels are requested.
+	z := body3.voxelSpans[0][0]
+	checkArbSlice(t, uuid, z, "", bodies)
+	checkArbSlice(t, uuid, z, "?supervoxels=true", supervoxels)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/supervoxels/2", server.WebAPIPath, uuid)
+	if svs := getJSONLabels(t, "GET", reqStr, nil); !reflect.DeepEqual(svs, []uint64{2, 3}) {
+		t.Errorf("expected supervoxels [2 3] for body 2, got %v\n", svs)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/mapping", server.WebAPIPath, uuid)
+	if mapped := getJSONLabels(t, "GET", reqStr, []byte("[1, 2, 3, 4]")); !reflect.DeepEqual(mapped, []uint64{1, 2, 2, 4}) {
+		t.Errorf("expected mapping [1 2 2 4], got %v\n", mapped)
+	}
+
+	// Sparse volumes use the bodies.
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/3", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/2", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "GET", reqStr, nil)
+
+	// Voxel splits aren't allowed, but supervoxels can be split off.
+	reqStr = fmt.Sprintf("%snode/%s/labels/split/2", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString("junk"))
+	reqStr = fmt.Sprintf("%snode/%s/labels/split-supervoxels/2", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString("[4]"))
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString("[3]"))
+	var jsonVal struct{ Label uint64 }
+	if err := json.Unmarshal(r, &jsonVal); err != nil {
+		t.Fatalf("Unable to get new label from split-supervoxels.  Instead got: %s\n", string(r))
+	}
+	if jsonVal.Label != 5 {
+		t.Errorf("expected split-supervoxels to create label 5, got %d\n", jsonVal.Label)
+	}
+	bodies.addBody(body3, 5)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(bodies); err != nil {
+		t.Errorf("split bodies not returned: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/5", server.WebAPIPath, uuid)
+	body3.checkSparseVol(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.OptionalBounds{})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/label/%d_%d_%d", server.WebAPIPath, uuid, body3.voxelSpans[0][2], body3.voxelSpans[0][1], body3.voxelSpans[0][0])
+	var labelVal struct{ Label uint64 }
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr, nil), &labelVal); err != nil {
+		t.Fatal(err)
+	}
+	if labelVal.Label != 5 {
+		t.Errorf("expected label 5 at split supervoxel, got %d\n", labelVal.Label)
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr+"?supervoxels=true", nil), &labelVal); err != nil {
+		t.Fatal(err)
+	}
+	if labelVal.Label != 3 {
+		t.Errorf("expected supervoxel 3 at split supervoxel, got %d\n", labelVal.Label)
+	}
+}
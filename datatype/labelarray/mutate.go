@@ -27,6 +27,8 @@ type sizeChange struct {
 // MergeLabels handles merging of any number of labels throughout the various label data
 // structures.  It assumes that the merges aren't cascading, e.g., there is no attempt
 // to merge label 3 into 4 and also 4 into 5.  The caller should have flattened the merges.
+// If the data maps supervoxels, only the supervoxel to body mapping is changed.  The merge
+// is rejected if any of the labels is checked out by a user other than the given user.
 // TODO: Provide some indication that subset of labels are under evolution, returning
 //   an "unavailable" status or 203 for non-authoritative response.  This might not be
 //   feasible for clustered DVID front-ends due to coordination issues.
@@ -39,13 +41,32 @@ type sizeChange struct {
 //
 // labels.MergeEndEvent occurs at end of merge and transmits labels.DeltaMergeEnd struct.
 //
-func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp) error {
+func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, user string) error {
 	dvid.Debugf("Merging %s into label %d ...\n", op.Merged, op.Target)
 
 	// Only do one large mutation at a time, although each request can start many goroutines.
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	lbls := []uint64{op.Target}
+	for label := range op.Merged {
+		lbls = append(lbls, label)
+	}
+	if err := labels.CheckoutConflict(iv, user, lbls...); err != nil {
+		return err
+	}
+	return d.mergeLabels(v, op)
+}
+
+// mergeLabels starts a merge and records it for undo.  The caller must hold LargeMutationMutex.
+func (d *Data) mergeLabels(v dvid.VersionID, op labels.MergeOp) error {
+	if d.MapSupervoxels {
+		return d.mergeSupervoxels(v, op)
+	}
+
+	rec := newMergeRecord(op)
+
 	// Get all the affected blocks in the merge.
 	targetMeta, _, err := GetMappedLabelIndex(d, v, op.Target, 0, dvid.Bounds{})
 	if err != nil {
@@ -65,6 +86,12 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp) error {
 		return err
 	}
 	mutID := d.NewMutationID()
+	rec.MutID = mutID
+	if err := d.putMutationRecord(v, rec); err != nil {
+		labels.MergeStop(iv, op)
+		d.StopUpdate()
+		return err
+	}
 
 	// send kafka merge event to instance-uuid topic
 	// msg: {"action": "merge", "target": targetlabel, "labels": [merge labels]}
@@ -95,6 +122,14 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp) error {
 	}
 
 	go func() {
+		// Record the merged labels' voxels for undo before they are changed.
+		if err := d.storeMergedRLEs(v, rec); err != nil {
+			dvid.Errorf("can't record voxels of labels %s merged into %d for undo: %v\n", op.Merged, op.Target, err)
+			rec.NotUndoable = true
+			if err := d.putMutationRecord(v, rec); err != nil {
+				dvid.Errorf("can't mark merge %d as not undoable: %v\n", mutID, err)
+			}
+		}
 		delta := labels.DeltaMerge{
 			MergeOp:      op,
 			Blocks:       targetMeta.Blocks.MergeCopy(mergedMeta.Blocks),
@@ -184,7 +219,8 @@ func (d *Data) processMerge(v dvid.VersionID, mutID uint64, delta labels.DeltaMe
 // preferably be the smaller portion of a labeled region.  In other words, the caller should chose
 // to submit for relabeling the smaller portion of any split.  It is assumed that the given split
 // voxels are within the fromLabel set of voxels and will generate unspecified behavior if this is
-// not the case.
+// not the case.  The split is rejected if either label is checked out by a user other than
+// the given user.
 //
 // EVENTS
 //
@@ -194,7 +230,11 @@ func (d *Data) processMerge(v dvid.VersionID, mutID uint64, delta labels.DeltaMe
 //
 // labels.SplitEndEvent occurs at end of split and transmits labels.DeltaSplitEnd struct.
 //
-func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.ReadCloser) (toLabel uint64, err error) {
+func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.ReadCloser, user string) (toLabel uint64, err error) {
+	if d.MapSupervoxels {
+		err = fmt.Errorf("data %q maps supervoxels so splits must use SplitSupervoxels", d.DataName())
+		return
+	}
 	// Create a new label id for this version that will persist to store
 	if splitLabel != 0 {
 		toLabel = splitLabel
@@ -216,12 +256,30 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.
 	if err != nil {
 		return
 	}
-	toLabelSize, _ := split.Stats()
 
 	// Only do one large mutation at a time, although each request can start many goroutines.
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if err = labels.CheckoutConflict(iv, user, fromLabel, toLabel); err != nil {
+		return
+	}
+	if err = d.splitLabels(v, fromLabel, toLabel, split); err != nil {
+		return
+	}
+	return toLabel, nil
+}
+
+// splitLabels splits the given voxels of a label into another label and records the split
+// for undo.  The caller must hold LargeMutationMutex.
+func (d *Data) splitLabels(v dvid.VersionID, fromLabel, toLabel uint64, split dvid.RLEs) (err error) {
+	toLabelSize, _ := split.Stats()
+	var splitIntoExisting bool
+	if splitIntoExisting, err = d.labelHasVoxels(v, toLabel); err != nil {
+		return
+	}
+
 	// store split info into separate data.
 	var splitData []byte
 	if splitData, err = split.MarshalBinary(); err != nil {
@@ -296,6 +354,17 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.
 	if err = d.processSplit(v, mutID, deltaSplit); err != nil {
 		return
 	}
+	rec := &MutationRecord{
+		MutID:             mutID,
+		Action:            "split",
+		Target:            fromLabel,
+		NewLabel:          toLabel,
+		RLERef:            splitRef,
+		SplitIntoExisting: splitIntoExisting,
+	}
+	if err = d.putMutationRecord(v, rec); err != nil {
+		return
+	}
 
 	msginfo = map[string]interface{}{
 		"Action":     "split-complete",
@@ -306,13 +375,13 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.
 	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
 		dvid.Errorf("error on sending split complete op to kafka: %v", err)
 	}
-
-	return toLabel, nil
+	return nil
 }
 
 // SplitCoarseLabels splits a portion of a label's voxels into a given split label or, if the given split
 // label is 0, a new label, which is returned.  The input is a binary sparse volume defined by block
-// coordinates and should be the smaller portion of a labeled region-to-be-split.
+// coordinates and should be the smaller portion of a labeled region-to-be-split.  The split is
+// rejected if either label is checked out by a user other than the given user.
 //
 // EVENTS
 //
@@ -322,7 +391,11 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.
 //
 // labels.SplitEndEvent occurs at end of split and transmits labels.DeltaSplitEnd struct.
 //
-func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.ReadCloser) (toLabel uint64, err error) {
+func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64, r io.ReadCloser, user string) (toLabel uint64, err error) {
+	if d.MapSupervoxels {
+		err = fmt.Errorf("data %q maps supervoxels so splits must use SplitSupervoxels", d.DataName())
+		return
+	}
 	// Create a new label id for this version that will persist to store
 	if splitLabel != 0 {
 		toLabel = splitLabel
@@ -344,12 +417,31 @@ func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64,
 	if err != nil {
 		return
 	}
-	numBlocks, _ := splits.Stats()
 
 	// Only do one request at a time, although each request can start many goroutines.
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if err = labels.CheckoutConflict(iv, user, fromLabel, toLabel); err != nil {
+		return
+	}
+	if err = d.splitCoarseLabels(v, fromLabel, toLabel, splits); err != nil {
+		return
+	}
+	return toLabel, nil
+}
+
+// splitCoarseLabels splits all voxels of a label within the blocks given by block coordinate
+// RLEs into another label and records the split for undo.  The caller must hold
+// LargeMutationMutex.
+func (d *Data) splitCoarseLabels(v dvid.VersionID, fromLabel, toLabel uint64, splits dvid.RLEs) (err error) {
+	numBlocks, _ := splits.Stats()
+	var splitIntoExisting bool
+	if splitIntoExisting, err = d.labelHasVoxels(v, toLabel); err != nil {
+		return
+	}
+
 	// store split info into separate data.
 	var splitData []byte
 	if splitData, err = splits.MarshalBinary(); err != nil {
@@ -365,11 +457,12 @@ func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64,
 	mutID := d.NewMutationID()
 	versionuuid, _ := datastore.UUIDFromVersion(v)
 	msginfo := map[string]interface{}{
-		"Action":   "splitcoarse",
-		"Target":   fromLabel,
-		"NewLabel": toLabel,
-		"Split":    splitRef,
-		"UUID":     string(versionuuid),
+		"Action":     "splitcoarse",
+		"Target":     fromLabel,
+		"NewLabel":   toLabel,
+		"Split":      splitRef,
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
 	}
 	jsonmsg, _ := json.Marshal(msginfo)
 	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
@@ -383,14 +476,14 @@ func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64,
 	// Make sure we can split given current merges in progress
 	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
 	if err := labels.SplitStart(iv, splitOpStart); err != nil {
-		return toLabel, err
+		return err
 	}
 	defer labels.SplitStop(iv, splitOpEnd)
 
 	// Signal that we are starting a split.
 	msg := datastore.SyncMessage{labels.SplitStartEvent, v, splitOpStart}
 	if err := datastore.NotifySubscribers(evt, msg); err != nil {
-		return 0, err
+		return err
 	}
 
 	// Order the split blocks
@@ -420,7 +513,17 @@ func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64,
 	evt = datastore.SyncEvent{d.DataUUID(), labels.SplitLabelEvent}
 	msg = datastore.SyncMessage{labels.SplitLabelEvent, v, deltaSplit}
 	if err := datastore.NotifySubscribers(evt, msg); err != nil {
-		return 0, err
+		return err
+	}
+	rec := &MutationRecord{
+		MutID:             mutID,
+		Action:            "split-coarse",
+		Target:            fromLabel,
+		NewLabel:          toLabel,
+		SplitIntoExisting: splitIntoExisting,
+	}
+	if err = d.putMutationRecord(v, rec); err != nil {
+		return
 	}
 
 	msginfo = map[string]interface{}{
@@ -434,7 +537,7 @@ func (d *Data) SplitCoarseLabels(v dvid.VersionID, fromLabel, splitLabel uint64,
 	}
 
 	dvid.Infof("Coarsely split %d blocks from label %d to label %d\n", numBlocks, fromLabel, toLabel)
-	return toLabel, nil
+	return nil
 }
 
 func (d *Data) processSplit(v dvid.VersionID, mutID uint64, delta labels.DeltaSplit) error {
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"net/http"
 	"reflect"
@@ -595,6 +596,216 @@ func Test16x16x16SparseVolumes(t *testing.T) {
 	}
 }
 
+func TestLabelROI(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/roi/%d/body4roi", server.WebAPIPath, uuid, body4.label)
+	server.TestHTTP(t, "POST", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/body4roi/roi", server.WebAPIPath, uuid)
+	var spans dvid.Spans
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr, nil), &spans); err != nil {
+		t.Fatalf("couldn't decode ROI spans: %v\n", err)
+	}
+	if expected := body4.blockSpans.Normalize(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected ROI spans for label %d:\n%s\nGot:\n%s\n", body4.label, expected, spans)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/roi/9/body9roi", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+}
+
+// checks the surface serialization of a 3x3x3 cube centered at the given voxel, where every
+// voxel except the center is on the surface with a normal pointing toward the center.
+func checkCubeSurface(t *testing.T, surface []byte, center dvid.Point3d) {
+	if len(surface) < 4 {
+		t.Fatalf("bad surface serialization of %d bytes\n", len(surface))
+	}
+	numVoxels := binary.LittleEndian.Uint32(surface[0:4])
+	if numVoxels != 26 || len(surface) != 4+26*24 {
+		t.Fatalf("expected 26 surface voxels for 3x3x3 cube, got %d voxels in %d bytes\n", numVoxels, len(surface))
+	}
+	getFloat := func(pos int) float64 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(surface[pos : pos+4])))
+	}
+	found := make(map[dvid.Point3d]struct{}, 26)
+	for i := 0; i < 26; i++ {
+		var d [3]int32
+		var norm2 float64
+		for dim := 0; dim < 3; dim++ {
+			d[dim] = int32(getFloat(4+i*12+dim*4)) - center[dim]
+			if d[dim] < -1 || d[dim] > 1 {
+				t.Fatalf("surface voxel %d is outside cube centered at %s\n", i, center)
+			}
+			norm2 += float64(d[dim] * d[dim])
+		}
+		pt := dvid.Point3d{d[0], d[1], d[2]}
+		if norm2 == 0 {
+			t.Fatalf("center of cube %s should not be a surface voxel\n", center)
+		}
+		found[pt] = struct{}{}
+		for dim := 0; dim < 3; dim++ {
+			expected := -float64(d[dim]) / math.Sqrt(norm2)
+			if got := getFloat(4 + 26*12 + i*12 + dim*4); math.Abs(got-expected) > 1e-4 {
+				t.Errorf("surface voxel at offset %s from center: expected normal component %d to be %f, got %f\n", pt, dim, expected, got)
+			}
+		}
+	}
+	if len(found) != 26 {
+		t.Errorf("expected 26 distinct surface voxels, got %d\n", len(found))
+	}
+}
+
+func TestSurface(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	// A 3x3x3 cube that crosses a block boundary in z and a 5x4x3 box.
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{10, 20, 30}, dvid.Point3d{3, 3, 3}, 7)
+	volume.addSubvol(dvid.Point3d{60, 60, 60}, dvid.Point3d{5, 4, 3}, 8)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/surface/7", server.WebAPIPath, uuid)
+	checkCubeSurface(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.Point3d{11, 21, 31})
+
+	// Only the 3x2x1 interior voxels of the box aren't on the surface.
+	reqStr = fmt.Sprintf("%snode/%s/labels/surface/8", server.WebAPIPath, uuid)
+	surface := server.TestHTTP(t, "GET", reqStr, nil)
+	if numVoxels := binary.LittleEndian.Uint32(surface[0:4]); numVoxels != 5*4*3-3*2*1 || len(surface) != 4+int(numVoxels)*24 {
+		t.Errorf("expected %d surface voxels for 5x4x3 box, got %d voxels in %d bytes\n", 5*4*3-3*2*1, numVoxels, len(surface))
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/surface/9", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", reqStr, nil)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for surface of missing label, got %d\n", resp.Code)
+	}
+}
+
+func (b testBody) numVoxels() uint64 {
+	var n uint64
+	for _, span := range b.voxelSpans {
+		n += uint64(span[3] - span[2] + 1)
+	}
+	return n
+}
+
+func TestPaintErase(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	expected := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/sparsevol/3", server.WebAPIPath, uuid)
+	body3RLEs := server.TestHTTP(t, "GET", reqStr, nil)
+	body3Blocks := server.TestHTTP(t, "GET", reqStr+"?format=blocks", nil)
+
+	// A paint is rejected if it would overwrite a label checked out by another user.
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatalf("Can't get labels data: %v\n", err)
+	}
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if _, err := labels.Checkout(iv, "alice", []uint64{3}, time.Minute); err != nil {
+		t.Fatalf("Can't check out label 3: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint/2?format=blocks&u=bob", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBuffer(body3Blocks))
+	if err := labels.Release(iv, "alice", []uint64{3}, false); err != nil {
+		t.Fatalf("Can't release label 3: %v\n", err)
+	}
+
+	// Paint body 3 with label 2 using binary blocks.
+	var result struct {
+		MutationID uint64
+		Voxels     uint64
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint/2?format=blocks", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(body3Blocks)), &result); err != nil {
+		t.Fatalf("couldn't parse paint response: %v\n", err)
+	}
+	if result.Voxels != body3.numVoxels() {
+		t.Errorf("expected paint to change %d voxels, got %d\n", body3.numVoxels(), result.Voxels)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	expected.addBody(body3, 2)
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("painted labels not returned: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/3", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	// A paint can't be undone.
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, result.MutationID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	// Erasing a label not in the sparse volume changes nothing.
+	reqStr = fmt.Sprintf("%snode/%s/labels/erase/1", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(body3RLEs)), &result); err != nil {
+		t.Fatalf("couldn't parse erase response: %v\n", err)
+	}
+	if result.Voxels != 0 {
+		t.Errorf("expected erase of absent label to change no voxels, got %d\n", result.Voxels)
+	}
+
+	// Erase label 2 within body 3 and make sure the original body 2 remains.
+	reqStr = fmt.Sprintf("%snode/%s/labels/erase/2", server.WebAPIPath, uuid)
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(body3RLEs)), &result); err != nil {
+		t.Fatalf("couldn't parse erase response: %v\n", err)
+	}
+	if result.Voxels != body3.numVoxels() {
+		t.Errorf("expected erase to change %d voxels, got %d\n", body3.numVoxels(), result.Voxels)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	expected.addBody(body3, 0)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("erased labels not returned: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/2", server.WebAPIPath, uuid)
+	body2.checkSparseVol(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.OptionalBounds{})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/paint/0", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBuffer(body3RLEs))
+}
+
 func TestMergeLabels(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -660,6 +871,127 @@ func TestMergeLabels(t *testing.T) {
 	}
 }
 
+func TestMutationCheckouts(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatalf("Can't get labels data: %v\n", err)
+	}
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if _, err := labels.Checkout(iv, "alice", []uint64{3}, time.Minute); err != nil {
+		t.Fatalf("Can't check out label 3: %v\n", err)
+	}
+	defer labels.Release(iv, "alice", []uint64{3}, true)
+
+	// Mutations check checkouts themselves so other users are rejected.
+	op := labels.MergeOp{Target: 2, Merged: labels.NewSet(3)}
+	if err := d.MergeLabels(v, op, "bob"); err == nil {
+		t.Errorf("Expected merge of label checked out by another user to fail\n")
+	}
+	if _, err := d.CleaveLabel(v, 3, 0, CleaveOp{Blocks: []dvid.ChunkPoint3d{{2, 1, 2}}}, "bob"); err == nil {
+		t.Errorf("Expected cleave of label checked out by another user to fail\n")
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/merge?u=bob", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString("[2, 3]"))
+
+	if err := d.MergeLabels(v, op, "alice"); err != nil {
+		t.Errorf("Expected merge by user with checkout to succeed: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+}
+
+func TestCleaveLabel(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelarray", "base", config)
+	config.Set("BaseLabels", "base")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+
+	createLabelTestVolume(t, uuid, "base")
+	expected := newTestVolume(128, 128, 128)
+	expected.addBody(body1, 1)
+	expected.addBody(body2, 2)
+	expected.addBody(body3, 2)
+	expected.addBody(body4, 4)
+	expected.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// Cleave off the base label 3 piece of body 2.
+	reqStr := fmt.Sprintf("%snode/%s/labels/cleave/2", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Labels": [3]}`))
+	var jsonVal struct{ Label uint64 }
+	if err := json.Unmarshal(r, &jsonVal); err != nil {
+		t.Fatalf("Unable to get new label from cleave.  Instead got: %s\n", string(r))
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	expected.addBody(body3, jsonVal.Label)
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("cleave by base label not returned: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/2", server.WebAPIPath, uuid)
+	body2.checkSparseVol(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.OptionalBounds{})
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/%d", server.WebAPIPath, uuid, jsonVal.Label)
+	body3.checkSparseVol(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.OptionalBounds{})
+
+	// Cleave off the first block of body 1, ignoring a block without the label.
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/1?cleavelabel=20", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Blocks": [[0, 0, 0], [1, 1, 1]]}`))
+	if err := json.Unmarshal(r, &jsonVal); err != nil {
+		t.Fatalf("Unable to get new label from cleave.  Instead got: %s\n", string(r))
+	}
+	if jsonVal.Label != 20 {
+		t.Errorf("expected cleave into label 20, got %d\n", jsonVal.Label)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	for _, span := range body1.voxelSpans {
+		z, y, x0, x1 := span.Unpack()
+		if z < DefaultBlockSize {
+			for x := x0; x <= x1; x++ {
+				i := ((z*128+y)*128 + x) * 8
+				binary.LittleEndian.PutUint64(expected.data[i:i+8], 20)
+			}
+		}
+	}
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("cleave by blocks not returned: %v\n", err)
+	}
+
+	// Bad cleave requests.
+	reqStr = fmt.Sprintf("%snode/%s/labels/cleave/1", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{}`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Blocks": [[0, 0, 0]], "Labels": [1]}`))
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Blocks": [[1, 1, 1]]}`))
+	reqStr = fmt.Sprintf("%snode/%s/base/cleave/1", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(`{"Labels": [1]}`))
+}
+
 func TestSplitCoarseLabel(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,385 @@
+/*
+	This file supports painting of arbitrary sparse volumes with a label and erasing a label
+	within a sparse volume.
+*/
+
+package labelarray
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// readPaintRLEs reads a sparse volume in the given format from a reader.  Binary blocks
+// are converted to RLEs and their foreground label is ignored.
+func readPaintRLEs(r io.Reader, format SparseVolFormat) (dvid.RLEs, error) {
+	switch format {
+	case FormatLegacyRLE:
+		return dvid.ReadRLEs(r)
+	case FormatStreamingRLE:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var rles dvid.RLEs
+		if err := rles.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return rles, nil
+	case FormatBinaryBlocks:
+		blocks, err := labels.ReceiveBinaryBlocks(r)
+		if err != nil {
+			return nil, err
+		}
+		return binaryBlocksToRLEs(blocks), nil
+	default:
+		return nil, fmt.Errorf("unknown sparse volume format %d", format)
+	}
+}
+
+// binaryBlocksToRLEs returns the RLEs of the foreground voxels in binary blocks.
+func binaryBlocksToRLEs(blocks []labels.BinaryBlock) dvid.RLEs {
+	var rles dvid.RLEs
+	for _, block := range blocks {
+		nx, ny, nz := block.Size[0], block.Size[1], block.Size[2]
+		var i int32
+		for z := int32(0); z < nz; z++ {
+			for y := int32(0); y < ny; y++ {
+				var runStart, runLength int32
+				for x := int32(0); x < nx; x++ {
+					if block.Voxels[i] {
+						if runLength == 0 {
+							runStart = x
+						}
+						runLength++
+					} else if runLength != 0 {
+						start := dvid.Point3d{block.Offset[0] + runStart, block.Offset[1] + y, block.Offset[2] + z}
+						rles = append(rles, dvid.NewRLE(start, runLength))
+						runLength = 0
+					}
+					i++
+				}
+				if runLength != 0 {
+					start := dvid.Point3d{block.Offset[0] + runStart, block.Offset[1] + y, block.Offset[2] + z}
+					rles = append(rles, dvid.NewRLE(start, runLength))
+				}
+			}
+		}
+	}
+	return rles
+}
+
+// PaintLabel overwrites all voxels in the given sparse volume with a label, regardless of
+// their current labels, and returns the mutation id and the number of voxels changed.  If
+// supervoxels are mapped, the painted voxels are given the label as their supervoxel.  The
+// paint is rejected if the label or any label it would overwrite is being merged or split, or
+// is checked out by a user other than the given user.
+//
+// EVENTS
+//
+// labels.MutateBlockEvent occurs for every changed block that previously existed and
+// labels.IngestBlockEvent for every block that is created by the paint.
+func (d *Data) PaintLabel(v dvid.VersionID, label uint64, r io.Reader, format SparseVolFormat, user string) (mutID, changed uint64, err error) {
+	if label == 0 {
+		err = fmt.Errorf("label 0 is background and can only be painted by erasing a label")
+		return
+	}
+	var rles dvid.RLEs
+	if rles, err = readPaintRLEs(r, format); err != nil {
+		return
+	}
+	if err = d.updateMaxLabel(v, label); err != nil {
+		return
+	}
+	return d.paintVoxels(v, "paint", label, rles, user)
+}
+
+// EraseLabel sets voxels of the given label within the given sparse volume to background 0
+// and returns the mutation id and the number of voxels erased.  If supervoxels are mapped,
+// all supervoxels of the given body are erased.  Voxels with other labels are unchanged.  The
+// erase is rejected if the label is being merged or split, or is checked out by a user other
+// than the given user.
+//
+// EVENTS
+//
+// labels.MutateBlockEvent occurs for every changed block.
+func (d *Data) EraseLabel(v dvid.VersionID, label uint64, r io.Reader, format SparseVolFormat, user string) (mutID, changed uint64, err error) {
+	if label == 0 {
+		err = fmt.Errorf("label 0 is background and cannot be erased")
+		return
+	}
+	var rles dvid.RLEs
+	if rles, err = readPaintRLEs(r, format); err != nil {
+		return
+	}
+	return d.paintVoxels(v, "erase", label, rles, user)
+}
+
+// paintVoxels writes a label into the voxels of a sparse volume or, for an erase, sets the
+// voxels of a label within the sparse volume to 0, then records the mutation.
+func (d *Data) paintVoxels(v dvid.VersionID, action string, label uint64, rles dvid.RLEs, user string) (mutID, changed uint64, err error) {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		err = fmt.Errorf("can't %s data %q with non-3d block size: %s", action, d.DataName(), d.BlockSize())
+		return
+	}
+	var blockRLEs dvid.BlockRLEs
+	if blockRLEs, err = rles.Partition(blockSize); err != nil {
+		return
+	}
+
+	// Only do one large mutation at a time and wait for any asynchronous merges or splits to
+	// finish so they don't change the painted blocks or label indices concurrently.
+	server.LargeMutationMutex.Lock()
+	defer server.LargeMutationMutex.Unlock()
+	for d.Updating() {
+		time.Sleep(50 * time.Millisecond)
+	}
+	var m *labels.Mapping
+	if m, err = d.getMapping(v); err != nil {
+		return
+	}
+
+	// Reject the paint if any label it changes is being mutated or is checked out by another user.
+	ctx := datastore.NewVersionedCtx(d, v)
+	overwritten := make(labels.Set)
+	if action == "paint" {
+		if err = d.paintedLabels(ctx, label, blockRLEs, blockSize, m, overwritten); err != nil {
+			return
+		}
+	}
+	lbls := append(sortedLabels(overwritten), label)
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	if err = labels.MutationConflict(iv, lbls...); err != nil {
+		return
+	}
+	if err = labels.CheckoutConflict(iv, user, lbls...); err != nil {
+		return
+	}
+
+	var rleData []byte
+	if rleData, err = rles.MarshalBinary(); err != nil {
+		return
+	}
+	var rleRef string
+	if rleRef, err = d.PutBlob(rleData); err != nil {
+		dvid.Errorf("error storing %s data: %v", action, err)
+	}
+
+	// send kafka paint event to instance-uuid topic
+	mutID = d.NewMutationID()
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	msginfo := map[string]interface{}{
+		"Action":     action,
+		"Target":     label,
+		"RLEs":       rleRef,
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending %s op to kafka: %v", action, err)
+	}
+
+	// Label indexing is done asynchronously so mark the data as updating until it's finished.
+	d.StartUpdate()
+	blockCh := make(chan blockChange, 100)
+	go func() {
+		d.aggregateBlockChanges(v, blockCh)
+		d.StopUpdate()
+	}()
+	downresMut := downres.NewMutation(d, v, mutID)
+
+	extents := d.Extents()
+	var extentChanged bool
+	for _, bcoord := range blockRLEs.SortedKeys() {
+		var n uint64
+		n, err = d.paintBlock(ctx, mutID, action, label, bcoord, blockRLEs[bcoord], blockSize, m, overwritten, blockCh, downresMut)
+		if err != nil {
+			break
+		}
+		if n == 0 {
+			continue
+		}
+		changed += n
+		if action == "paint" {
+			var chunkPt dvid.ChunkPoint3d
+			if chunkPt, err = bcoord.ToChunkPoint3d(); err != nil {
+				break
+			}
+			minPt := chunkPt.MinPoint(blockSize)
+			maxPt := chunkPt.MaxPoint(blockSize)
+			if extents.AdjustPoints(minPt, maxPt) {
+				extentChanged = true
+			}
+		}
+	}
+	close(blockCh)
+	downresMut.Done()
+	if err != nil {
+		return
+	}
+	if extentChanged {
+		if err = d.PostExtents(ctx, extents.MinPoint, extents.MaxPoint); err != nil {
+			return
+		}
+		if err := datastore.SaveDataByVersion(v, d); err != nil {
+			dvid.Infof("Error in trying to save repo on change: %v\n", err)
+		}
+	}
+
+	rec := &MutationRecord{
+		MutID:  mutID,
+		Action: action,
+		Target: label,
+		Labels: sortedLabels(overwritten),
+		RLERef: rleRef,
+	}
+	if err = d.putMutationRecord(v, rec); err != nil {
+		return
+	}
+
+	msginfo = map[string]interface{}{
+		"Action":     action + "-complete",
+		"Labels":     rec.Labels,
+		"Changed":    changed,
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending %s complete op to kafka: %v", action, err)
+	}
+	return mutID, changed, nil
+}
+
+// paintedLabels adds the labels that a paint would overwrite to the given set without
+// changing any blocks.
+func (d *Data) paintedLabels(ctx *datastore.VersionedCtx, label uint64, blockRLEs dvid.BlockRLEs, blockSize dvid.Point3d, m *labels.Mapping, overwritten labels.Set) error {
+	for bcoord, rles := range blockRLEs {
+		oldBlock, err := d.getLabelBlock(ctx, 0, bcoord)
+		if err != nil {
+			return err
+		}
+		if oldBlock == nil {
+			continue
+		}
+		lblarray, err := oldBlock.MakeLabelVolume()
+		if err != nil {
+			return err
+		}
+		chunkPt, err := bcoord.ToChunkPoint3d()
+		if err != nil {
+			return err
+		}
+		offset := chunkPt.MinPoint(blockSize).(dvid.Point3d)
+		paintLabelArray(lblarray, offset, blockSize, rles, "paint", label, m, overwritten)
+	}
+	return nil
+}
+
+// paintBlock paints or erases the voxels of the given block-clipped RLEs, stores the block
+// if changed, and sends the block change for indexing, downres and syncs.  Labels that were
+// overwritten by a paint are added to the given set.  Returns the number of changed voxels.
+func (d *Data) paintBlock(ctx *datastore.VersionedCtx, mutID uint64, action string, label uint64, bcoord dvid.IZYXString, rles dvid.RLEs, blockSize dvid.Point3d, m *labels.Mapping, overwritten labels.Set, blockCh chan blockChange, downresMut *downres.Mutation) (uint64, error) {
+	var scale uint8
+	oldBlock, err := d.getLabelBlock(ctx, scale, bcoord)
+	if err != nil {
+		return 0, err
+	}
+	if oldBlock == nil && action == "erase" {
+		return 0, nil
+	}
+	var lblarray []byte
+	if oldBlock != nil {
+		if lblarray, err = oldBlock.MakeLabelVolume(); err != nil {
+			return 0, err
+		}
+	} else {
+		lblarray = make([]byte, blockSize.Prod()*8)
+	}
+	chunkPt, err := bcoord.ToChunkPoint3d()
+	if err != nil {
+		return 0, err
+	}
+	offset := chunkPt.MinPoint(blockSize).(dvid.Point3d)
+
+	changed := paintLabelArray(lblarray, offset, blockSize, rles, action, label, m, overwritten)
+	if changed == 0 {
+		return 0, nil
+	}
+
+	curBlock, err := labels.MakeBlock(lblarray, blockSize)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.putLabelBlock(ctx, scale, &labels.PositionedBlock{*curBlock, bcoord}); err != nil {
+		return 0, err
+	}
+
+	var event string
+	var delta interface{}
+	if oldBlock != nil {
+		event = labels.MutateBlockEvent
+		block := MutatedBlock{mutID, bcoord, &(oldBlock.Block), curBlock}
+		d.handleBlockMutate(ctx.VersionID(), blockCh, block)
+		delta = block
+	} else {
+		event = labels.IngestBlockEvent
+		block := IngestedBlock{mutID, bcoord, curBlock}
+		d.handleBlockIndexing(ctx.VersionID(), blockCh, block)
+		delta = block
+	}
+	if err := downresMut.BlockMutated(bcoord, curBlock); err != nil {
+		dvid.Errorf("data %q publishing downres: %v\n", d.DataName(), err)
+	}
+	evt := datastore.SyncEvent{d.DataUUID(), event}
+	msg := datastore.SyncMessage{event, ctx.VersionID(), delta}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("Unable to notify subscribers of event %s in %s\n", event, d.DataName())
+	}
+	return changed, nil
+}
+
+// paintLabelArray paints or erases the voxels of block-clipped RLEs within a block's label
+// array with the given offset.  Labels overwritten by a paint are added to the given set.
+// Returns the number of changed voxels.
+func paintLabelArray(lblarray []byte, offset, blockSize dvid.Point3d, rles dvid.RLEs, action string, label uint64, m *labels.Mapping, overwritten labels.Set) uint64 {
+	var changed uint64
+	for _, rle := range rles {
+		pt := rle.StartPt()
+		x0, y, z := pt[0]-offset[0], pt[1]-offset[1], pt[2]-offset[2]
+		i := ((z*blockSize[1]+y)*blockSize[0] + x0) * 8
+		for x := x0; x < x0+rle.Length(); x++ {
+			cur := binary.LittleEndian.Uint64(lblarray[i : i+8])
+			body := cur
+			if m != nil {
+				body = mappedBody(m, cur)
+			}
+			if action == "erase" {
+				if cur != 0 && body == label {
+					binary.LittleEndian.PutUint64(lblarray[i:i+8], 0)
+					changed++
+				}
+			} else if cur != label {
+				if body != 0 && body != label {
+					overwritten[body] = struct{}{}
+				}
+				binary.LittleEndian.PutUint64(lblarray[i:i+8], label)
+				changed++
+			}
+			i += 8
+		}
+	}
+	return changed
+}
@@ -46,24 +46,24 @@ func (v *Labels) ComputeTransform(tkey storage.TKey, blockSize dvid.Point) (bloc
 }
 
 // GetImage retrieves a 2d image from a version node given a geometry of labels.
-func (d *Data) GetImage(v dvid.VersionID, vox *Labels, scale uint8, roiname dvid.InstanceName) (*dvid.Image, error) {
-	r, err := imageblk.GetROI(v, roiname, vox)
+func (d *Data) GetImage(ctx *datastore.VersionedCtx, vox *Labels, scale uint8, roiname dvid.InstanceName, supervoxels bool) (*dvid.Image, error) {
+	r, err := imageblk.GetROI(ctx.VersionID(), roiname, vox)
 	if err != nil {
 		return nil, err
 	}
-	if err := d.GetLabels(v, scale, vox, r); err != nil {
+	if err := d.GetLabels(ctx, scale, vox, r, supervoxels); err != nil {
 		return nil, err
 	}
 	return vox.GetImage2d()
 }
 
 // GetVolume retrieves a n-d volume from a version node given a geometry of labels.
-func (d *Data) GetVolume(v dvid.VersionID, vox *Labels, scale uint8, roiname dvid.InstanceName) ([]byte, error) {
-	r, err := imageblk.GetROI(v, roiname, vox)
+func (d *Data) GetVolume(ctx *datastore.VersionedCtx, vox *Labels, scale uint8, roiname dvid.InstanceName, supervoxels bool) ([]byte, error) {
+	r, err := imageblk.GetROI(ctx.VersionID(), roiname, vox)
 	if err != nil {
 		return nil, err
 	}
-	if err := d.GetLabels(v, scale, vox, r); err != nil {
+	if err := d.GetLabels(ctx, scale, vox, r, supervoxels); err != nil {
 		return nil, err
 	}
 	return vox.Data(), nil
@@ -76,7 +76,9 @@ type getOperation struct {
 }
 
 // GetLabels copies labels from the storage engine to Labels, a requested subvolume or 2d image.
-func (d *Data) GetLabels(v dvid.VersionID, scale uint8, vox *Labels, r *imageblk.ROI) error {
+// The read is abandoned if the request associated with the context is cancelled.  If the data
+// maps supervoxels, bodies are returned unless supervoxels is true.
+func (d *Data) GetLabels(ctx *datastore.VersionedCtx, scale uint8, vox *Labels, r *imageblk.ROI, supervoxels bool) error {
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return fmt.Errorf("Data type imageblk had error initializing store: %v\n", err)
@@ -89,10 +91,16 @@ func (d *Data) GetLabels(v dvid.VersionID, scale uint8, vox *Labels, r *imageblk
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
-	ctx := datastore.NewVersionedCtx(d, v)
-
-	iv := dvid.InstanceVersion{d.DataUUID(), v}
+	iv := dvid.InstanceVersion{d.DataUUID(), ctx.VersionID()}
 	mapping := labels.LabelMap(iv)
+	if d.MapSupervoxels {
+		mapping = nil
+		if !supervoxels {
+			if mapping, err = d.getMapping(ctx.VersionID()); err != nil {
+				return err
+			}
+		}
+	}
 
 	wg := new(sync.WaitGroup)
 
@@ -104,6 +112,9 @@ func (d *Data) GetLabels(v dvid.VersionID, scale uint8, vox *Labels, r *imageblk
 	}
 
 	for it, err := vox.NewIndexIterator(d.BlockSize()); err == nil && it.Valid(); it.NextSpan() {
+		if err := storage.ContextErr(ctx); err != nil {
+			return fmt.Errorf("GET data %s abandoned: %v", ctx, err)
+		}
 		indexBeg, indexEnd, err := it.IndexSpan()
 		if err != nil {
 			return err
@@ -6,6 +6,7 @@
 package labelarray
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -79,6 +80,12 @@ func (d *Data) InitDataHandlers() error {
 	return nil
 }
 
+// GetSyncSubs implements the datastore.Syncer interface.  It overrides the embedded
+// imageblk method, which accepts label data, since labelarray doesn't yet sync with any data.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	return nil, fmt.Errorf("data %q of type labelarray can't be synced with data %q", d.DataName(), synced.DataName())
+}
+
 func (d *Data) queuedSize() int {
 	var queued int
 	for i := 0; i < numMutateHandlers; i++ {
@@ -0,0 +1,357 @@
+/*
+	This file supports undo of merges and splits using a record of each mutation.
+*/
+
+package labelarray
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MutationRecord holds what's necessary to revert a merge or split.
+type MutationRecord struct {
+	MutID    uint64
+	UUID     dvid.UUID // version on which the mutation was done.
+	Action   string    // "merge", "split", "split-coarse", "split-supervoxels", "paint", or "erase"
+	Target   uint64    // label merged into or split from
+	Labels   []uint64  `json:",omitempty"` // labels merged into target or overwritten by paint
+	NewLabel uint64    `json:",omitempty"` // label split from target
+
+	// For a split, paint, or erase, a blob store reference to the given voxels in the legacy
+	// RLE format.
+	RLERef string `json:",omitempty"`
+
+	// For a merge, blob store references to the sparse volume of each merged label before
+	// the merge in the legacy RLE format.  An empty reference means the label had no voxels.
+	RLERefs []string `json:",omitempty"`
+
+	// True if the label split into already had voxels, so merging it back can't undo the split.
+	SplitIntoExisting bool `json:",omitempty"`
+
+	// If supervoxels are mapped, the supervoxels of each merged label for a merge or the
+	// supervoxels moved to the new label for a split.
+	Supervoxels [][]uint64 `json:",omitempty"`
+
+	// True if what's needed to undo the mutation couldn't be recorded.
+	NotUndoable bool `json:",omitempty"`
+
+	Undone bool `json:",omitempty"`
+}
+
+// labels returns all labels involved in the mutation.
+func (rec *MutationRecord) labels() labels.Set {
+	lbls := labels.NewSet(rec.Labels...)
+	lbls[rec.Target] = struct{}{}
+	if rec.NewLabel != 0 {
+		lbls[rec.NewLabel] = struct{}{}
+	}
+	return lbls
+}
+
+// newMergeRecord returns a merge record without the sparse volumes of the merged labels,
+// which are added by storeMergedRLEs.
+func newMergeRecord(op labels.MergeOp) *MutationRecord {
+	rec := &MutationRecord{Action: "merge", Target: op.Target}
+	for label := range op.Merged {
+		rec.Labels = append(rec.Labels, label)
+	}
+	return rec
+}
+
+// storeMergedRLEs puts the sparse volume of each merged label in the blob store and updates
+// the merge record with the references.  It must be called before the merge changes any blocks.
+func (d *Data) storeMergedRLEs(v dvid.VersionID, rec *MutationRecord) error {
+	ctx := datastore.NewVersionedCtx(d, v)
+	refs := make([]string, len(rec.Labels))
+	for i, label := range rec.Labels {
+		// Read the index directly since the label is already marked as merged into the target.
+		meta, err := GetLabelIndex(d, v, label)
+		if err != nil {
+			return err
+		}
+		if meta == nil || len(meta.Blocks) == 0 {
+			continue
+		}
+		rles, err := d.getLegacyRLEs(ctx, meta, labels.NewSet(label), 0, dvid.Bounds{})
+		if err != nil {
+			return err
+		}
+		if len(rles) == 0 {
+			continue
+		}
+		if refs[i], err = d.PutBlob(rles); err != nil {
+			return err
+		}
+	}
+	rec.RLERefs = refs
+	return d.putMutationRecord(v, rec)
+}
+
+// labelHasVoxels returns true if the label's index has any blocks.
+func (d *Data) labelHasVoxels(v dvid.VersionID, label uint64) (bool, error) {
+	meta, err := GetLabelIndex(d, v, label)
+	if err != nil {
+		return false, err
+	}
+	return meta != nil && len(meta.Blocks) != 0, nil
+}
+
+func (d *Data) putMutationRecord(v dvid.VersionID, rec *MutationRecord) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if rec.UUID, err = datastore.UUIDFromVersion(v); err != nil {
+		return err
+	}
+	recBytes, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	compressFormat, _ := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+	compressed, err := dvid.SerializeData(recBytes, compressFormat, dvid.NoChecksum)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if err := store.Put(ctx, NewMutationTKey(rec.MutID), compressed); err != nil {
+		return fmt.Errorf("unable to store record of mutation %d for data %q: %v", rec.MutID, d.DataName(), err)
+	}
+	return nil
+}
+
+func decodeMutationRecord(compressed []byte) (*MutationRecord, error) {
+	recBytes, _, err := dvid.DeserializeData(compressed, true)
+	if err != nil {
+		return nil, err
+	}
+	rec := new(MutationRecord)
+	if err := json.Unmarshal(recBytes, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// getMutationRecord returns the record of a mutation visible from the given version or nil if
+// there is no record.
+func (d *Data) getMutationRecord(v dvid.VersionID, mutID uint64) (*MutationRecord, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	compressed, err := store.Get(ctx, NewMutationTKey(mutID))
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) == 0 {
+		return nil, nil
+	}
+	return decodeMutationRecord(compressed)
+}
+
+// processMutationRecords calls f for each mutation record visible from the given version
+// with a mutation id equal to or larger than begID.
+func (d *Data) processMutationRecords(v dvid.VersionID, begID uint64, f func(*MutationRecord) error) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begTKey := NewMutationTKey(begID)
+	endTKey := NewMutationTKey(math.MaxUint64)
+	return store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || len(c.V) == 0 {
+			return nil
+		}
+		rec, err := decodeMutationRecord(c.V)
+		if err != nil {
+			return err
+		}
+		return f(rec)
+	})
+}
+
+// loadMutationID makes sure new mutation ids are larger than any recorded mutation.
+func (d *Data) loadMutationID() error {
+	ctx := storage.NewDataContext(d, 0)
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	minKey, err := ctx.MinVersionKey(NewMutationTKey(0))
+	if err != nil {
+		return err
+	}
+	maxKey, err := ctx.MaxVersionKey(NewMutationTKey(math.MaxUint64))
+	if err != nil {
+		return err
+	}
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	ch := make(chan *storage.KeyValue)
+	var maxID uint64
+	go func() {
+		for kv := range ch {
+			if kv == nil {
+				break
+			}
+			tk, err := storage.TKeyFromKey(kv.K)
+			if err != nil {
+				dvid.Errorf("Can't decode mutation key when loading mutable data for %s\n", d.DataName())
+				continue
+			}
+			mutID, err := DecodeMutationTKey(tk)
+			if err != nil {
+				dvid.Errorf("Can't decode mutation key when loading mutable data for %s: %v\n", d.DataName(), err)
+				continue
+			}
+			if mutID > maxID {
+				maxID = mutID
+			}
+		}
+		wg.Done()
+	}()
+	keysOnly := true
+	if err = store.RawRangeQuery(minKey, maxKey, keysOnly, ch, nil); err != nil {
+		return err
+	}
+	wg.Wait()
+
+	d.SetMinMutationID(maxID)
+	return nil
+}
+
+// UndoMutation reverts a merge or split done on the given version, which must not be locked.
+// The mutation can only be undone if no later mutation changed any of the involved labels.
+// A merge is undone by splitting the original voxels, or supervoxels if they are mapped, of each
+// merged label from the target label, and a split is undone by merging the split label back into the original label,
+// which is rejected if the split label had voxels before the split.
+// These reverting mutations generate the usual sync events and are themselves recorded,
+// so an undo can be undone.  The undo is rejected if any involved label is checked out by a
+// user other than the given user.
+func (d *Data) UndoMutation(v dvid.VersionID, mutID uint64, user string) (*MutationRecord, error) {
+	locked, err := datastore.LockedVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		return nil, fmt.Errorf("can't undo mutation %d on a locked version id %d", mutID, v)
+	}
+	uuid, err := datastore.UUIDFromVersion(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only do one large mutation at a time and wait for any asynchronous mutations to finish.
+	server.LargeMutationMutex.Lock()
+	defer server.LargeMutationMutex.Unlock()
+	for d.Updating() {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	rec, err := d.getMutationRecord(v, mutID)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || rec.UUID != uuid {
+		return nil, fmt.Errorf("no record of mutation %d in version %s of data %q", mutID, uuid, d.DataName())
+	}
+	if rec.Undone {
+		return nil, fmt.Errorf("mutation %d has already been undone", mutID)
+	}
+	if rec.NotUndoable {
+		return nil, fmt.Errorf("can't undo %s mutation %d because it wasn't fully recorded", rec.Action, mutID)
+	}
+	lbls := rec.labels()
+	iv := dvid.InstanceVersion{Data: d.DataUUID(), Version: v}
+	checked := make([]uint64, 0, len(lbls))
+	for label := range lbls {
+		checked = append(checked, label)
+	}
+	if err := labels.CheckoutConflict(iv, user, checked...); err != nil {
+		return nil, err
+	}
+	err = d.processMutationRecords(v, mutID+1, func(later *MutationRecord) error {
+		if later.UUID != uuid {
+			return nil
+		}
+		for label := range later.labels() {
+			if lbls.Exists(label) {
+				return fmt.Errorf("can't undo mutation %d because later mutation %d changed label %d", mutID, later.MutID, label)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch rec.Action {
+	case "merge":
+		if d.MapSupervoxels {
+			if len(rec.Supervoxels) != len(rec.Labels) {
+				return nil, fmt.Errorf("bad record of merge %d: %d labels but %d supervoxel sets", mutID, len(rec.Labels), len(rec.Supervoxels))
+			}
+			for i, label := range rec.Labels {
+				if len(rec.Supervoxels[i]) == 0 {
+					continue
+				}
+				if err := d.splitSupervoxels(v, rec.Target, label, labels.NewSet(rec.Supervoxels[i]...)); err != nil {
+					return nil, fmt.Errorf("unable to restore label %d from label %d: %v", label, rec.Target, err)
+				}
+			}
+			break
+		}
+		if len(rec.RLERefs) != len(rec.Labels) {
+			return nil, fmt.Errorf("bad record of merge %d: %d labels but %d sparse volumes", mutID, len(rec.Labels), len(rec.RLERefs))
+		}
+		for i, label := range rec.Labels {
+			if rec.RLERefs[i] == "" {
+				continue // label had no voxels when merged.
+			}
+			rles, err := d.GetBlob(rec.RLERefs[i])
+			if err != nil {
+				return nil, fmt.Errorf("unable to get voxels of label %d recorded for merge %d: %v", label, mutID, err)
+			}
+			split, err := dvid.ReadRLEs(bytes.NewReader(rles))
+			if err != nil {
+				return nil, err
+			}
+			if err := d.splitLabels(v, rec.Target, label, split); err != nil {
+				return nil, fmt.Errorf("unable to restore label %d from label %d: %v", label, rec.Target, err)
+			}
+		}
+	case "split", "split-coarse", "split-supervoxels":
+		if rec.SplitIntoExisting {
+			return nil, fmt.Errorf("can't undo %s mutation %d because label %d had voxels before the split", rec.Action, mutID, rec.NewLabel)
+		}
+		op := labels.MergeOp{Target: rec.Target, Merged: labels.NewSet(rec.NewLabel)}
+		if err := d.mergeLabels(v, op); err != nil {
+			return nil, fmt.Errorf("unable to merge label %d back into label %d: %v", rec.NewLabel, rec.Target, err)
+		}
+	case "paint", "erase":
+		return nil, fmt.Errorf("can't undo %s mutation %d because overwritten voxels aren't recorded", rec.Action, mutID)
+	default:
+		return nil, fmt.Errorf("can't undo unknown mutation %q", rec.Action)
+	}
+
+	rec.Undone = true
+	if err := d.putMutationRecord(v, rec); err != nil {
+		return nil, err
+	}
+	dvid.Infof("Undid %s mutation %d on labels %s of data %q\n", rec.Action, mutID, lbls, d.DataName())
+	return rec, nil
+}
@@ -0,0 +1,197 @@
+package labelarray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// returns the id of the last recorded mutation.
+func lastMutationID(t *testing.T, d *Data, v dvid.VersionID) uint64 {
+	var mutID uint64
+	err := d.processMutationRecords(v, 0, func(rec *MutationRecord) error {
+		if rec.MutID > mutID {
+			mutID = rec.MutID
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("couldn't read mutation records: %v\n", err)
+	}
+	return mutID
+}
+
+func checkUndo(t *testing.T, uuid dvid.UUID, mutID uint64, expected *testVolume) {
+	reqStr := fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, mutID)
+	server.TestHTTP(t, "POST", reqStr, nil)
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels")
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("label volume after undo of mutation %d: %v\n", mutID, err)
+	}
+}
+
+func TestUndoMerge(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	testMerge := mergeJSON(`[2, 3]`)
+	testMerge.send(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	mergeID := lastMutationID(t, d, v)
+	rec, err := d.getMutationRecord(v, mergeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || len(rec.RLERefs) != 1 || rec.RLERefs[0] == "" || rec.NotUndoable {
+		t.Fatalf("expected merge record with blob reference to merged voxels, got %v\n", rec)
+	}
+
+	// Undo the merge, which can't be done twice.
+	checkUndo(t, uuid, mergeID, original)
+	reqStr := fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, mergeID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/%d", server.WebAPIPath, uuid, 3)
+	encoding := server.TestHTTP(t, "GET", reqStr, nil)
+	body3.checkSparseVol(t, encoding, dvid.OptionalBounds{})
+
+	// Undo the undo to get back the merge.
+	merged := newTestVolume(128, 128, 128)
+	copy(merged.data, original.data)
+	merged.addBody(body3, 2)
+	checkUndo(t, uuid, lastMutationID(t, d, v), merged)
+
+	// Can't undo once a later mutation changes a label.
+	redoID := lastMutationID(t, d, v)
+	testMerge = mergeJSON(`[1, 2]`)
+	testMerge.send(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, redoID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+
+	// Can't undo on a committed node.
+	if err := datastore.Commit(uuid, "merged", nil); err != nil {
+		t.Fatalf("Unable to commit node %s: %v\n", uuid, err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, lastMutationID(t, d, v))
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+}
+
+func TestUndoSplit(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelarray", "labels", config)
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	numspans := len(bodysplit.voxelSpans)
+	rles := make(dvid.RLEs, numspans, numspans)
+	for i, span := range bodysplit.voxelSpans {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))         // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))          // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                   // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0))        // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(numspans)) // Placeholder for # spans
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	splitBytes := buf.Bytes()
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/split/%d", server.WebAPIPath, uuid, 4)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(splitBytes))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	splitID := lastMutationID(t, d, v)
+	rec, err := d.getMutationRecord(v, splitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.RLERef == "" {
+		t.Fatalf("expected split record with blob reference to split voxels, got %v\n", rec)
+	}
+	splitData, err := d.GetBlob(rec.RLERef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(splitData, rleBytes) {
+		t.Errorf("split record references %d bytes, expected %d bytes of split RLEs\n", len(splitData), len(rleBytes))
+	}
+
+	// A mutation that wasn't fully recorded can't be undone.
+	rec.NotUndoable = true
+	if err := d.putMutationRecord(v, rec); err != nil {
+		t.Fatal(err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, splitID)
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+	rec.NotUndoable = false
+	if err := d.putMutationRecord(v, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	checkUndo(t, uuid, splitID, original)
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/4", server.WebAPIPath, uuid)
+	encoding := server.TestHTTP(t, "GET", reqStr, nil)
+	body4.checkSparseVol(t, encoding, dvid.OptionalBounds{})
+
+	// A split into an existing label can't be undone.
+	reqStr = fmt.Sprintf("%snode/%s/labels/split/4?splitlabel=1", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(splitBytes))
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/undo/%d", server.WebAPIPath, uuid, lastMutationID(t, d, v))
+	server.TestBadHTTP(t, "POST", reqStr, nil)
+}
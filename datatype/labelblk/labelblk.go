@@ -317,6 +317,37 @@ GET  <api URL>/node/<UUID>/<data name>/pseudocolor/<dims>/<size>/<offset>[?query
                     are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
                     status code is returned.
 
+GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>][?queryopts]
+
+    Retrieves non-orthogonal (arbitrarily oriented planar) label data of named 3d data 
+    within a version node using nearest-neighbor sampling.  The top left pixel corresponds 
+    to the real world coordinate (not in voxel space but in space defined by resolution, e.g.,
+    nanometer space).  The real world coordinates are specified in  "x_y_z" format, e.g., "20.3_11.8_109.4".
+    The resolution is used to determine the # pixels in the returned image.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/segmentation/arb/100.2_90_80.7/200.2_90_80.7/100.2_190.0_80.7/10.0/png
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to add.
+    top left      Real world coordinate (in nanometers) of top left pixel in returned image.
+    top right     Real world coordinate of top right pixel.
+    bottom left   Real world coordinate of bottom left pixel.
+    res           The resolution/pixel that is used to calculate the returned image size in pixels.
+    format        "raw" or "png" (default: "raw").  "raw" returns packed little-endian uint64 labels
+                    with x varying fastest.  "png" returns a pseudocolored image as in the 
+                    "pseudocolor" endpoint.
+
+    Query-string Options:
+
+    compression   Allows retrieval of "raw" labels in "lz4" and "gzip" compressed format.
+    throttle      If "true", makes sure only N compute-intense operation (all API calls that can be throttled) 
+                    are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
+                    status code is returned.
+
 GET <api URL>/node/<UUID>/<data name>/label/<coord>
 
 	Returns JSON for the label at the given coordinate:
@@ -815,6 +846,9 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 
 	for ziter := int32(0); ziter < blocksize.Value(2); ziter++ {
 		for yiter := int32(0); yiter < blocksize.Value(1); yiter++ {
+			if err := storage.ContextErr(ctx); err != nil {
+				return fmt.Errorf("GET blocks %s abandoned: %v", ctx, err)
+			}
 			beginPoint := dvid.ChunkPoint3d{blockoffset.Value(0), blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
 			endPoint := dvid.ChunkPoint3d{blockoffset.Value(0) + blocksize.Value(0) - 1, blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
 
@@ -1465,7 +1499,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
-			img, err := d.GetImage(ctx.VersionID(), lbl, roiname)
+			img, err := d.GetImage(ctx, lbl, roiname)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -1494,6 +1528,72 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
+	case "arb":
+		// GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>]
+		if len(parts) < 8 {
+			server.BadRequest(w, r, "%q must be followed by top-left/top-right/bottom-left/res", parts[3])
+			return
+		}
+		if action != "get" {
+			server.BadRequest(w, r, "DVID only permits GET of arbitrary slices")
+			return
+		}
+		if throttle := queryStrings.Get("throttle"); throttle == "on" || throttle == "true" {
+			if server.ThrottledHTTP(w) {
+				return
+			}
+			defer server.ThrottledOpDone()
+		}
+		arb, err := d.NewArbSliceFromStrings(parts[4], parts[5], parts[6], parts[7], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		v := ctx.VersionID()
+		err = d.GetArbitraryNearest(arb, d.Properties.VoxelSize, func(bcoord dvid.ChunkPoint3d) ([]byte, error) {
+			return d.GetLabelBytes(v, bcoord)
+		})
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		var formatStr string
+		if len(parts) >= 9 {
+			formatStr = parts[8]
+		}
+		switch formatStr {
+		case "", "raw":
+			compression := queryStrings.Get("compression")
+			if compression != "" && compression != "lz4" && compression != "gzip" {
+				server.BadRequest(w, r, "arbitrary label slices only support lz4 and gzip compression, not %q", compression)
+				return
+			}
+			if err := sendBinaryData(compression, arb.Bytes(), nil, w); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "png":
+			size := arb.Size()
+			img, err := dvid.ImageFromData(size[0], size[1], arb.Bytes(), d.Properties.Values, false)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			pseudoColor, err := colorImage(img)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if err = dvid.WriteImageHttp(w, pseudoColor, formatStr); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		default:
+			server.BadRequest(w, r, "arbitrary label slices must be in raw or png format, not %q", formatStr)
+			return
+		}
+		timedLog.Infof("HTTP %s: arbitrary label slice %s (%s)", r.Method, arb, r.URL)
+
 	case "raw", "isotropic":
 		if len(parts) < 7 {
 			server.BadRequest(w, r, "'%s' must be followed by shape/size/offset", parts[3])
@@ -1524,7 +1624,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
-			img, err := d.GetImage(ctx.VersionID(), lbl, roiname)
+			img, err := d.GetImage(ctx, lbl, roiname)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -1568,7 +1668,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 					server.BadRequest(w, r, err)
 					return
 				}
-				data, err := d.GetVolume(ctx.VersionID(), lbl, roiname)
+				data, err := d.GetVolume(ctx, lbl, roiname)
 				if err != nil {
 					server.BadRequest(w, r, err)
 					return
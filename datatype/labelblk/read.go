@@ -46,24 +46,24 @@ func (v *Labels) ComputeTransform(block *storage.TKeyValue, blockSize dvid.Point
 }
 
 // GetImage retrieves a 2d image from a version node given a geometry of labels.
-func (d *Data) GetImage(v dvid.VersionID, vox *Labels, roiname dvid.InstanceName) (*dvid.Image, error) {
-	r, err := imageblk.GetROI(v, roiname, vox)
+func (d *Data) GetImage(ctx *datastore.VersionedCtx, vox *Labels, roiname dvid.InstanceName) (*dvid.Image, error) {
+	r, err := imageblk.GetROI(ctx.VersionID(), roiname, vox)
 	if err != nil {
 		return nil, err
 	}
-	if err := d.GetLabels(v, vox, r); err != nil {
+	if err := d.GetLabels(ctx, vox, r); err != nil {
 		return nil, err
 	}
 	return vox.GetImage2d()
 }
 
 // GetVolume retrieves a n-d volume from a version node given a geometry of labels.
-func (d *Data) GetVolume(v dvid.VersionID, vox *Labels, roiname dvid.InstanceName) ([]byte, error) {
-	r, err := imageblk.GetROI(v, roiname, vox)
+func (d *Data) GetVolume(ctx *datastore.VersionedCtx, vox *Labels, roiname dvid.InstanceName) ([]byte, error) {
+	r, err := imageblk.GetROI(ctx.VersionID(), roiname, vox)
 	if err != nil {
 		return nil, err
 	}
-	if err := d.GetLabels(v, vox, r); err != nil {
+	if err := d.GetLabels(ctx, vox, r); err != nil {
 		return nil, err
 	}
 	return vox.Data(), nil
@@ -76,7 +76,8 @@ type getOperation struct {
 }
 
 // GetLabels copies labels from the storage engine to Labels, a requested subvolume or 2d image.
-func (d *Data) GetLabels(v dvid.VersionID, vox *Labels, r *imageblk.ROI) error {
+// The read is abandoned if the request associated with the context is cancelled.
+func (d *Data) GetLabels(ctx *datastore.VersionedCtx, vox *Labels, r *imageblk.ROI) error {
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return fmt.Errorf("Data type imageblk had error initializing store: %v\n", err)
@@ -86,9 +87,7 @@ func (d *Data) GetLabels(v dvid.VersionID, vox *Labels, r *imageblk.ROI) error {
 	server.LargeMutationMutex.Lock()
 	defer server.LargeMutationMutex.Unlock()
 
-	ctx := datastore.NewVersionedCtx(d, v)
-
-	iv := dvid.InstanceVersion{d.DataUUID(), v}
+	iv := dvid.InstanceVersion{d.DataUUID(), ctx.VersionID()}
 	mapping := labels.LabelMap(iv)
 
 	wg := new(sync.WaitGroup)
@@ -101,6 +100,9 @@ func (d *Data) GetLabels(v dvid.VersionID, vox *Labels, r *imageblk.ROI) error {
 	}
 
 	for it, err := vox.NewIndexIterator(d.BlockSize()); err == nil && it.Valid(); it.NextSpan() {
+		if err := storage.ContextErr(ctx); err != nil {
+			return fmt.Errorf("GET data %s abandoned: %v", ctx, err)
+		}
 		indexBeg, indexEnd, err := it.IndexSpan()
 		if err != nil {
 			return err
@@ -0,0 +1,182 @@
+/*
+	This file supports consistency checks of label counts against the synced annotations.
+*/
+
+package labelsz
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/annotation"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// CountProblem describes a stored count that disagrees with the synced annotations.
+type CountProblem struct {
+	Label    uint64
+	Index    string // index type, e.g., "PreSyn" or "AllSyn"
+	Stored   uint32
+	Expected uint32
+}
+
+type countProblems []CountProblem
+
+func (p countProblems) Len() int      { return len(p) }
+func (p countProblems) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p countProblems) Less(i, j int) bool {
+	if p[i].Label == p[j].Label {
+		return p[i].Index < p[j].Index
+	}
+	return p[i].Label < p[j].Label
+}
+
+// FsckOptions limit the scope of a consistency check and specify whether problems are repaired.
+type FsckOptions struct {
+	MinLabel uint64
+	MaxLabel uint64
+	Repair   bool
+}
+
+// FsckReport gives the results of a consistency check of label counts.
+type FsckReport struct {
+	Annotation    dvid.InstanceName // synced annotation used for check
+	LabelsChecked uint64
+	Problems      []CountProblem
+	Repaired      uint64 // number of counts rewritten or deleted
+}
+
+// Fsck checks the stored counts for each label against counts of the elements denormalized
+// by label in the synced annotation instance, reporting any discrepancies and, if requested,
+// repairing them.
+func (d *Data) Fsck(v dvid.VersionID, opts FsckOptions) (*FsckReport, error) {
+	annot := d.GetSyncedAnnotation()
+	if annot == nil {
+		return nil, fmt.Errorf("labelsz %q has no synced annotation to check against", d.DataName())
+	}
+	if opts.MaxLabel == 0 {
+		opts.MaxLabel = math.MaxUint64
+	}
+	if opts.MinLabel > opts.MaxLabel {
+		return nil, fmt.Errorf("minimum label %d is greater than maximum label %d", opts.MinLabel, opts.MaxLabel)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	timedLog := dvid.NewTimeLog()
+
+	if opts.Repair {
+		d.Lock()
+		defer d.Unlock()
+	} else {
+		d.RLock()
+		defer d.RUnlock()
+	}
+
+	// Compute counts the same way element modifications are applied during syncs.
+	expected := make(map[indexedLabel]uint32)
+	checked := make(map[uint64]struct{})
+	err = annot.ProcessLabelAnnotations(v, func(label uint64, elems annotation.ElementsNR) {
+		if label < opts.MinLabel || label > opts.MaxLabel {
+			return
+		}
+		checked[label] = struct{}{}
+		for _, elem := range elems {
+			if !d.inROI(elem.Pos) {
+				continue
+			}
+			expected[newIndexedLabel(elementToIndexType(elem.Kind), label)]++
+			if elem.Kind.IsSynaptic() {
+				expected[newIndexedLabel(AllSyn, label)]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	report := &FsckReport{Annotation: annot.DataName()}
+	stored := make(map[indexedLabel]uint32)
+	err = store.ProcessRange(ctx, storage.MinTKey(keyTypeLabel), storage.MaxTKey(keyTypeLabel), &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.TKeyValue == nil || c.V == nil {
+			return nil
+		}
+		i, label, err := DecodeTypeLabelTKey(c.K)
+		if err != nil {
+			return err
+		}
+		if label < opts.MinLabel || label > opts.MaxLabel {
+			return nil
+		}
+		if len(c.V) != 4 {
+			return fmt.Errorf("bad size in value for index type %s, label %d: value has length %d", i, label, len(c.V))
+		}
+		checked[label] = struct{}{}
+		stored[newIndexedLabel(i, label)] = binary.LittleEndian.Uint32(c.V)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.LabelsChecked = uint64(len(checked))
+
+	var batch storage.Batch
+	if opts.Repair {
+		batcher, err := datastore.GetKeyValueBatcher(d)
+		if err != nil {
+			return nil, err
+		}
+		batch = batcher.NewBatch(ctx)
+	}
+	fix := func(il indexedLabel, count, want uint32) error {
+		i, label, err := decodeIndexedLabel(il)
+		if err != nil {
+			return err
+		}
+		report.Problems = append(report.Problems, CountProblem{Label: label, Index: i.String(), Stored: count, Expected: want})
+		if !opts.Repair {
+			return nil
+		}
+		batch.Delete(NewTypeSizeLabelTKey(i, count, label))
+		if want == 0 {
+			batch.Delete(NewTypeLabelTKey(i, label))
+		} else {
+			buf := make([]byte, 4)
+			binary.LittleEndian.PutUint32(buf, want)
+			batch.Put(NewTypeLabelTKey(i, label), buf)
+			batch.Put(NewTypeSizeLabelTKey(i, want, label), nil)
+		}
+		report.Repaired++
+		return nil
+	}
+	for il, count := range stored {
+		want := expected[il]
+		delete(expected, il)
+		if count == want {
+			continue
+		}
+		if err := fix(il, count, want); err != nil {
+			return nil, err
+		}
+	}
+	for il, want := range expected {
+		if err := fix(il, 0, want); err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(countProblems(report.Problems))
+
+	if opts.Repair && report.Repaired != 0 {
+		if err := batch.Commit(); err != nil {
+			return nil, fmt.Errorf("unable to repair counts for labelsz %q: %v", d.DataName(), err)
+		}
+	}
+	timedLog.Infof("Fsck of labelsz %q labels %d-%d: %d labels, %d problems, %d repaired", d.DataName(), opts.MinLabel, opts.MaxLabel, report.LabelsChecked, len(report.Problems), report.Repaired)
+	return report, nil
+}
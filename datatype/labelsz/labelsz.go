@@ -195,6 +195,29 @@ POST <api URL>/node/<UUID>/<data name>/reload
 	Forces asynchornous denormalization from its synced annotations instance.  Can be 
 	used to initialize a newly added instance.  Note that the labelsz will be locked until
 	the denormalization is finished with a log message.
+
+GET  <api URL>/node/<UUID>/<data name>/fsck[?<options>]
+POST <api URL>/node/<UUID>/<data name>/fsck[?<options>]
+
+	Checks the stored counts for each label against the elements of its synced annotations
+	instance and returns a JSON report of any discrepancies.  A POST also repairs the counts.
+
+	Example return:
+
+	{
+		"Annotation": "synapses",
+		"LabelsChecked": 2213,
+		"Problems": [
+			{ "Label": 23, "Index": "PreSyn", "Stored": 12, "Expected": 13 },
+			{ "Label": 23, "Index": "AllSyn", "Stored": 40, "Expected": 41 }
+		],
+		"Repaired": 0
+	}
+
+    Query-string Options:
+
+    minlabel    Only check labels equal to or larger than this label.
+    maxlabel    Only check labels equal to or smaller than this label.
 `
 
 var (
@@ -747,13 +770,56 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		d.ReloadData(ctx)
 
+	case "fsck":
+		// GET  <api URL>/node/<UUID>/<data name>/fsck
+		// POST <api URL>/node/<UUID>/<data name>/fsck
+		if action != "get" && action != "post" {
+			server.BadRequest(w, r, "Only GET or POST action is available on 'fsck' endpoint.")
+			return
+		}
+		opts := FsckOptions{Repair: action == "post"}
+		queryStrings := r.URL.Query()
+		var err error
+		if s := queryStrings.Get("minlabel"); s != "" {
+			if opts.MinLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad minlabel specified in query string (%q)", s))
+				return
+			}
+		}
+		if s := queryStrings.Get("maxlabel"); s != "" {
+			if opts.MaxLabel, err = strconv.ParseUint(s, 10, 64); err != nil {
+				server.BadRequest(w, r, fmt.Errorf("bad maxlabel specified in query string (%q)", s))
+				return
+			}
+		}
+		report, err := d.Fsck(ctx.VersionID(), opts)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(report)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: fsck found %d problems in %d labels (%s)", r.Method, len(report.Problems), report.LabelsChecked, r.URL)
+
 	default:
 		server.BadAPIRequest(w, r, d)
 	}
 }
 
+// ReloadData asynchronously recalculates the label sizes.  The reload uses its own
+// context since any request context is cancelled when the handler returns.  The data is
+// marked as updating before returning so callers can wait on its completion.
 func (d *Data) ReloadData(ctx *datastore.VersionedCtx) {
-	go d.resync(ctx)
+	d.StartUpdate()
+	go d.resync(datastore.NewVersionedCtx(d, ctx.VersionID()))
 	dvid.Infof("Started recalculation of labelsz %q...\n", d.DataName())
 }
 
@@ -764,16 +830,17 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 	annot := d.GetSyncedAnnotation()
 	if annot == nil {
 		dvid.Errorf("Unable to get synced annotation.  Aborting reload of labelsz %q.\n", d.DataName())
+		d.StopUpdate()
 		return
 	}
 
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		dvid.Errorf("Labelsz %q had error initializing store: %v\n", d.DataName(), err)
+		d.StopUpdate()
 		return
 	}
 
-	d.StartUpdate()
 	d.Lock()
 
 	minTSLTKey := storage.MinTKey(keyTypeSizeLabel)
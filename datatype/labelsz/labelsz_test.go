@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -623,3 +624,113 @@ func TestLabelsResync(t *testing.T) {
 
 	checkSequencing(t, uuid)
 }
+
+func getFsckReport(t *testing.T, method string, uuid dvid.UUID) FsckReport {
+	url := fmt.Sprintf("%snode/%s/noroi/fsck", server.WebAPIPath, uuid)
+	var report FsckReport
+	if err := json.Unmarshal(server.TestHTTP(t, method, url, nil), &report); err != nil {
+		t.Fatalf("couldn't decode fsck report: %v\n", err)
+	}
+	return report
+}
+
+func TestFsck(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := datastore.NewTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelblk", "labels", config)
+	server.CreateTestInstance(t, uuid, "labelvol", "bodies", config)
+	server.CreateTestSync(t, uuid, "labels", "bodies")
+	server.CreateTestSync(t, uuid, "bodies", "labels")
+	_ = createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "labels,bodies")
+	server.CreateTestInstance(t, uuid, "labelsz", "noroi", config)
+	server.CreateTestSync(t, uuid, "noroi", "mysynapses")
+
+	// Put 3 PreSyn in label 100 and 2 PreSyn in label 200.
+	var synapses annotation.Elements
+	for _, pt := range []dvid.Point3d{{2, 2, 2}, {10, 10, 10}, {20, 20, 20}, {70, 10, 10}, {80, 20, 20}} {
+		synapses = append(synapses, annotation.Element{
+			annotation.ElementNR{Pos: pt, Kind: annotation.PreSyn},
+			[]annotation.Relationship{},
+		})
+	}
+	testJSON, err := json.Marshal(synapses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(string(testJSON)))
+	if err := datastore.BlockOnUpdating(uuid, "noroi"); err != nil {
+		t.Fatalf("Error blocking on sync of noroi labelsz: %v\n", err)
+	}
+
+	report := getFsckReport(t, "GET", uuid)
+	if len(report.Problems) != 0 || report.LabelsChecked != 2 {
+		t.Fatalf("expected consistent counts for 2 labels, got fsck report %v\n", report)
+	}
+
+	// Corrupt the PreSyn count of label 100 and add a count for label 999, which has no elements.
+	d, err := GetByUUIDName(uuid, "noroi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if err := store.Delete(ctx, NewTypeSizeLabelTKey(PreSyn, 3, 100)); err != nil {
+		t.Fatal(err)
+	}
+	putCount := func(label uint64, count uint32) {
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, count)
+		if err := store.Put(ctx, NewTypeLabelTKey(PreSyn, label), buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, NewTypeSizeLabelTKey(PreSyn, count, label), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putCount(100, 7)
+	putCount(999, 5)
+
+	expected := []CountProblem{
+		{Label: 100, Index: "PreSyn", Stored: 7, Expected: 3},
+		{Label: 999, Index: "PreSyn", Stored: 5, Expected: 0},
+	}
+	report = getFsckReport(t, "GET", uuid)
+	if !reflect.DeepEqual(report.Problems, expected) || report.Repaired != 0 {
+		t.Fatalf("expected problems %v without repair, got fsck report %v\n", expected, report)
+	}
+	url = fmt.Sprintf("%snode/%s/noroi/top/3/PreSyn", server.WebAPIPath, uuid)
+	if data := server.TestHTTP(t, "GET", url, nil); string(data) != `[{"Label":100,"Size":7},{"Label":999,"Size":5},{"Label":200,"Size":2}]` {
+		t.Errorf("Got back unexpected PreSyn ranking after corruption:\n%v\n", string(data))
+	}
+
+	// Repair and make sure the counts and rankings are restored.
+	report = getFsckReport(t, "POST", uuid)
+	if !reflect.DeepEqual(report.Problems, expected) || report.Repaired != 2 {
+		t.Fatalf("expected problems %v to be repaired, got fsck report %v\n", expected, report)
+	}
+	if data := server.TestHTTP(t, "GET", url, nil); string(data) != `[{"Label":100,"Size":3},{"Label":200,"Size":2}]` {
+		t.Errorf("Got back incorrect PreSyn ranking after repair:\n%v\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/noroi/count/999/PreSyn", server.WebAPIPath, uuid)
+	if data := server.TestHTTP(t, "GET", url, nil); string(data) != `{"Label":999,"PreSyn":0}` {
+		t.Errorf("Got back incorrect PreSyn count for label 999 after repair:\n%v\n", string(data))
+	}
+	report = getFsckReport(t, "GET", uuid)
+	if len(report.Problems) != 0 {
+		t.Fatalf("expected no problems after repair, got fsck report %v\n", report)
+	}
+}
@@ -202,6 +202,30 @@ HEAD <api URL>/node/<UUID>/<data name>/sparsevol/<label>?<options>
     maxz    Spans must be equal to or smaller than this maximum z voxel coordinate.
 
 
+GET  <api URL>/node/<UUID>/<data name>/surface/<label>?<options>
+
+	Returns the surface voxels of the given label with normals, which allows lightweight
+	viewers to render a body without meshing.  The returned data is "application/octet-stream"
+	with the following format where integers and floats are little endian:
+
+	    uint32     # surface voxels (N)
+	    N * 3 float32   vertices (x, y, z) in voxel coordinates
+	    N * 3 float32   normals (nx, ny, nz)
+
+	Normals are corrected for anisotropy using the VoxelSize of the data instance.
+	If the label isn't found within any given bounds, a 404 (Not Found) is returned.
+
+    GET Query-string Options:
+
+    minx    Surface voxels must be equal to or larger than this minimum x voxel coordinate.
+    maxx    Surface voxels must be equal to or smaller than this maximum x voxel coordinate.
+    miny    Surface voxels must be equal to or larger than this minimum y voxel coordinate.
+    maxy    Surface voxels must be equal to or smaller than this maximum y voxel coordinate.
+    minz    Surface voxels must be equal to or larger than this minimum z voxel coordinate.
+    maxz    Surface voxels must be equal to or smaller than this maximum z voxel coordinate.
+    exact   "false" if the body can extend a bit outside voxel bounds within border blocks.
+
+
 GET <api URL>/node/<UUID>/<data name>/sparsevol-by-point/<coord>
 
 	Returns a sparse volume with voxels that pass through a given voxel.
@@ -1114,6 +1138,49 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: sparsevol-by-point at %s (%s)", r.Method, coord, r.URL)
 
+	case "surface":
+		// GET <api URL>/node/<UUID>/<data name>/surface/<label>
+		if action != "get" {
+			server.BadRequest(w, r, "DVID does not support %s on /surface endpoint", r.Method)
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "ERROR: DVID requires label ID to follow 'surface' command")
+			return
+		}
+		label, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if label == 0 {
+			server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as surface.\n")
+			return
+		}
+		var b dvid.Bounds
+		b.Voxel, err = dvid.OptionalBoundsFromQueryString(r)
+		if err != nil {
+			server.BadRequest(w, r, "Error parsing bounds from query string: %v\n", err)
+			return
+		}
+		b.Block = b.Voxel.Divide(d.BlockSize)
+		b.Exact = r.URL.Query().Get("exact") != "false"
+		data, err := d.GetSurface(ctx, label, b)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-type", "application/octet-stream")
+		if _, err := w.Write(data); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: surface on label %d (%s)", r.Method, label, r.URL)
+
 	case "sparsevol-coarse":
 		// GET <api URL>/node/<UUID>/<data name>/sparsevol-coarse/<label>
 		if len(parts) < 5 {
@@ -1343,9 +1410,18 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
 			return
 		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+		// The request's context is cancelled once this handler returns, so the asynchronous
+		// resync needs its own context.
+		resyncCtx := datastore.NewVersionedCtx(d, ctx.VersionID())
 		d.StartUpdate()
 		go func() {
-			if err := d.resyncLabel(ctx, relabel, r.Body); err != nil {
+			if err := d.resyncLabel(resyncCtx, relabel, ioutil.NopCloser(bytes.NewBuffer(data))); err != nil {
 				dvid.Errorf("Error on resync of data %q, label %d: %v\n", d.DataName(), relabel, err)
 			}
 			d.StopUpdate()
@@ -1558,6 +1634,17 @@ func (d *Data) FoundSparseVol(ctx *datastore.VersionedCtx, label uint64, bounds
 	return false, nil
 }
 
+// GetSurface returns the surface voxels and normals of a label using the serialization of
+// dvid.SparseVol.SurfaceSerialization.  If the label isn't found within the given bounds,
+// nil is returned.
+func (d *Data) GetSurface(ctx *datastore.VersionedCtx, label uint64, bounds dvid.Bounds) ([]byte, error) {
+	rles, err := d.GetSparseVol(ctx, label, bounds)
+	if err != nil || rles == nil {
+		return nil, err
+	}
+	return dvid.SparseVolSurface(rles, d.BlockSize[2], d.Resolution.VoxelSize)
+}
+
 // GetSparseVol returns an encoded sparse volume given a label.  The encoding has the
 // following format where integers are little endian:
 //    byte     Payload descriptor:
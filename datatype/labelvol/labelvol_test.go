@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"reflect"
 	"strings"
@@ -1434,6 +1435,90 @@ func TestResyncLabel(t *testing.T) {
 	}
 }
 
+// checks the surface serialization of a 3x3x3 cube centered at the given voxel, where every
+// voxel except the center is on the surface with a normal pointing toward the center.
+func checkCubeSurface(t *testing.T, surface []byte, center dvid.Point3d) {
+	if len(surface) < 4 {
+		t.Fatalf("bad surface serialization of %d bytes\n", len(surface))
+	}
+	numVoxels := binary.LittleEndian.Uint32(surface[0:4])
+	if numVoxels != 26 || len(surface) != 4+26*24 {
+		t.Fatalf("expected 26 surface voxels for 3x3x3 cube, got %d voxels in %d bytes\n", numVoxels, len(surface))
+	}
+	getFloat := func(pos int) float64 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(surface[pos : pos+4])))
+	}
+	found := make(map[dvid.Point3d]struct{}, 26)
+	for i := 0; i < 26; i++ {
+		var d [3]int32
+		var norm2 float64
+		for dim := 0; dim < 3; dim++ {
+			d[dim] = int32(getFloat(4+i*12+dim*4)) - center[dim]
+			if d[dim] < -1 || d[dim] > 1 {
+				t.Fatalf("surface voxel %d is outside cube centered at %s\n", i, center)
+			}
+			norm2 += float64(d[dim] * d[dim])
+		}
+		pt := dvid.Point3d{d[0], d[1], d[2]}
+		if norm2 == 0 {
+			t.Fatalf("center of cube %s should not be a surface voxel\n", center)
+		}
+		found[pt] = struct{}{}
+		for dim := 0; dim < 3; dim++ {
+			expected := -float64(d[dim]) / math.Sqrt(norm2)
+			if got := getFloat(4 + 26*12 + i*12 + dim*4); math.Abs(got-expected) > 1e-4 {
+				t.Errorf("surface voxel at offset %s from center: expected normal component %d to be %f, got %f\n", pt, dim, expected, got)
+			}
+		}
+	}
+	if len(found) != 26 {
+		t.Errorf("expected 26 distinct surface voxels, got %d\n", len(found))
+	}
+}
+
+func TestSurface(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	// Create testbed volume and data instances
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelblk", "labels", config)
+	server.CreateTestInstance(t, uuid, "labelvol", "bodies", config)
+	server.CreateTestSync(t, uuid, "labels", "bodies")
+	server.CreateTestSync(t, uuid, "bodies", "labels")
+
+	// A 3x3x3 cube that crosses a block boundary in z and a 5x4x3 box.
+	volume := newTestVolume(128, 128, 128)
+	volume.addSubvol(dvid.Point3d{10, 20, 30}, dvid.Point3d{3, 3, 3}, 7)
+	volume.addSubvol(dvid.Point3d{60, 60, 60}, dvid.Point3d{5, 4, 3}, 8)
+	volume.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "bodies"); err != nil {
+		t.Fatalf("Error blocking on sync of labels -> bodies: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/bodies/surface/7", server.WebAPIPath, uuid)
+	checkCubeSurface(t, server.TestHTTP(t, "GET", reqStr, nil), dvid.Point3d{11, 21, 31})
+
+	// Only the 3x2x1 interior voxels of the box aren't on the surface.
+	reqStr = fmt.Sprintf("%snode/%s/bodies/surface/8", server.WebAPIPath, uuid)
+	surface := server.TestHTTP(t, "GET", reqStr, nil)
+	if numVoxels := binary.LittleEndian.Uint32(surface[0:4]); numVoxels != 5*4*3-3*2*1 || len(surface) != 4+int(numVoxels)*24 {
+		t.Errorf("expected %d surface voxels for 5x4x3 box, got %d voxels in %d bytes\n", 5*4*3-3*2*1, numVoxels, len(surface))
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/bodies/surface/9", server.WebAPIPath, uuid)
+	resp := server.TestHTTPResponse(t, "GET", reqStr, nil)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for surface of missing label, got %d\n", resp.Code)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/bodies/surface/0", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
 var (
 	body1 = testBody{
 		label:  1,
@@ -251,6 +251,12 @@ func (d *Data) Equals(d2 *Data) bool {
 	return true
 }
 
+// GetSyncSubs implements the datastore.Syncer interface.  It overrides the embedded
+// imageblk method since multichan16 data can't be synced with any data.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	return nil, fmt.Errorf("data %q of type multichan16 can't be synced with data %q", d.DataName(), synced.DataName())
+}
+
 type propertiesT struct {
 	imageblk.Properties
 	NumChannels int
@@ -420,7 +426,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				Voxels:     v,
 				channelNum: channelNum,
 			}
-			img, err := d.GetImage(ctx.VersionID(), channel.Voxels, "")
+			img, err := d.GetImage(ctx, channel.Voxels, "")
 			var formatStr string
 			if len(parts) >= 7 {
 				formatStr = parts[6]
@@ -0,0 +1,135 @@
+/*
+	This file supports decoding of precomputed chunks in raw, jpeg, and compressed_segmentation
+	encodings into little-endian voxel arrays in ZYX order.
+*/
+
+package precomputed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// decodeChunk returns the voxels of a chunk of the given size encoded as in the scale.
+func decodeChunk(data []byte, s Scale, size dvid.Point3d, bytesPerVoxel int32) ([]byte, error) {
+	switch s.Encoding {
+	case "raw":
+		return decodeRaw(data, size, bytesPerVoxel)
+	case "jpeg":
+		return decodeJPEG(data, size)
+	case "compressed_segmentation":
+		return decodeCompressedSegmentation(data, size, s.CompressedSegmentationBlockSize, bytesPerVoxel)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", s.Encoding)
+	}
+}
+
+func decodeRaw(data []byte, size dvid.Point3d, bytesPerVoxel int32) ([]byte, error) {
+	numBytes := size.Prod() * int64(bytesPerVoxel)
+	if int64(len(data)) < numBytes {
+		return nil, fmt.Errorf("expected %d bytes for raw chunk of size %s, got %d bytes", numBytes, size, len(data))
+	}
+	return data[:numBytes], nil
+}
+
+// decodeJPEG decodes a chunk stored as a grayscale JPEG with width of the chunk's
+// x size and height of the chunk's y * z size.
+func decodeJPEG(data []byte, size dvid.Point3d) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	if int32(bounds.Dx()) != size[0] || int32(bounds.Dy()) != size[1]*size[2] {
+		return nil, fmt.Errorf("expected %d x %d jpeg for chunk of size %s, got %d x %d",
+			size[0], size[1]*size[2], size, bounds.Dx(), bounds.Dy())
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok || gray.Stride != bounds.Dx() {
+		gray = image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	}
+	return gray.Pix, nil
+}
+
+// decodeCompressedSegmentation decodes the first channel of a chunk in the neuroglancer
+// compressed_segmentation format for uint32 or uint64 labels.  The chunk is divided into
+// blocks, each with a table of distinct labels and bit-packed indices into that table.
+func decodeCompressedSegmentation(data []byte, size, blockSize dvid.Point3d, bytesPerVoxel int32) ([]byte, error) {
+	if bytesPerVoxel != 4 && bytesPerVoxel != 8 {
+		return nil, fmt.Errorf("compressed_segmentation requires 4 or 8 bytes/voxel, not %d", bytesPerVoxel)
+	}
+	if len(data)%4 != 0 || len(data) < 4 {
+		return nil, fmt.Errorf("compressed_segmentation data has bad length %d", len(data))
+	}
+	numWords := uint32(len(data) / 4)
+	word := func(i uint32) uint32 {
+		return binary.LittleEndian.Uint32(data[i*4 : i*4+4])
+	}
+	wordsPerValue := uint32(bytesPerVoxel / 4)
+	channelOffset := word(0)
+
+	var grid dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		grid[dim] = (size[dim] + blockSize[dim] - 1) / blockSize[dim]
+	}
+	out := make([]byte, size.Prod()*int64(bytesPerVoxel))
+	for bz := int32(0); bz < grid[2]; bz++ {
+		for by := int32(0); by < grid[1]; by++ {
+			for bx := int32(0); bx < grid[0]; bx++ {
+				header := channelOffset + 2*uint32(bx+grid[0]*(by+grid[1]*bz))
+				if header+1 >= numWords {
+					return nil, fmt.Errorf("compressed_segmentation header for block (%d,%d,%d) is out of range", bx, by, bz)
+				}
+				tableOffset := channelOffset + word(header)&0xFFFFFF
+				bits := word(header) >> 24
+				valuesOffset := channelOffset + word(header+1)
+				if bits > 32 {
+					return nil, fmt.Errorf("compressed_segmentation block (%d,%d,%d) has bad encoding bits %d", bx, by, bz, bits)
+				}
+				mask := uint32((uint64(1) << bits) - 1)
+
+				for vz := int32(0); vz < blockSize[2]; vz++ {
+					z := bz*blockSize[2] + vz
+					if z >= size[2] {
+						break
+					}
+					for vy := int32(0); vy < blockSize[1]; vy++ {
+						y := by*blockSize[1] + vy
+						if y >= size[1] {
+							break
+						}
+						for vx := int32(0); vx < blockSize[0]; vx++ {
+							x := bx*blockSize[0] + vx
+							if x >= size[0] {
+								break
+							}
+							var index uint32
+							if bits > 0 {
+								pos := uint32(vx+blockSize[0]*(vy+blockSize[1]*vz)) * bits
+								w := valuesOffset + pos/32
+								if w >= numWords {
+									return nil, fmt.Errorf("compressed_segmentation values for block (%d,%d,%d) are out of range", bx, by, bz)
+								}
+								index = (word(w) >> (pos % 32)) & mask
+							}
+							t := tableOffset + index*wordsPerValue
+							if t+wordsPerValue > numWords {
+								return nil, fmt.Errorf("compressed_segmentation table for block (%d,%d,%d) is out of range", bx, by, bz)
+							}
+							i := (int64(z)*int64(size[1])+int64(y))*int64(size[0]) + int64(x)
+							copy(out[i*int64(bytesPerVoxel):], data[t*4:(t+wordsPerValue)*4])
+						}
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
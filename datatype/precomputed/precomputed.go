@@ -0,0 +1,898 @@
+/*
+Package precomputed implements read-only DVID support for volumes published in the
+neuroglancer precomputed format over HTTP or on local disk.  Chunks are fetched on demand,
+decoded, and served through the same raw, isotropic, subvolblocks and tile APIs as imageblk
+and imagetile data.
+*/
+package precomputed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/proxy"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/datatype/imagetile"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+
+	lz4 "github.com/janelia-flyem/go/golz4"
+)
+
+const (
+	Version  = "0.1"
+	RepoURL  = "github.com/janelia-flyem/dvid/datatype/precomputed"
+	TypeName = "precomputed"
+)
+
+const HelpMessage = `
+API for datatypes derived from precomputed (github.com/janelia-flyem/dvid/datatype/precomputed)
+===============================================================================================
+
+Command-line:
+
+$ dvid repo <UUID> new precomputed <data name> <settings...>
+
+	Adds read-only access to a neuroglancer precomputed volume.
+
+	Example:
+
+	$ dvid repo 3f8c new precomputed grayscale source=https://example.org/volumes/fib25/image
+
+    Arguments:
+
+    UUID           Hexidecimal string with enough characters to uniquely identify a version node.
+    data name      Name of data to create, e.g., "mygrayscale"
+    settings       Configuration settings in "key=value" format separated by spaces.
+
+    Required Configuration Settings (case-insensitive keys)
+
+    source         Location of the precomputed volume, i.e., the directory holding its "info" file.
+                   This can be an "http://" or "https://" URL, a "gs://" bucket path that is
+                   read through the public Google Cloud Storage HTTP API, or a local directory
+                   with optional "file://" prefix.  A "precomputed://" prefix is ignored.
+
+    Optional Configuration Settings (case-insensitive keys)
+
+    blocksize      Size of blocks returned by the "subvolblocks" endpoint, e.g., "64,64,64".
+                   If unspecified, the chunk size of the highest resolution scale.
+    tilesize       Default size in pixels along one dimension of square tile.  If unspecified, 512.
+    cachesize      Size budget in MB for chunks from HTTP sources cached in the instance's assigned
+                   store.  Once exceeded, the least recently used chunks are deleted.  If unspecified,
+                   1024.  A size of 0 disables caching.  Local sources are never cached.
+    cachettl       Time after which cached chunks are refetched, e.g., "1h30m" or "72h".
+                   If unspecified, cached chunks never expire.
+
+    The source must have a single channel of uint8, uint16, uint32, uint64 or float32 voxels.
+    Chunks may be encoded as "raw", "jpeg", or "compressed_segmentation".  Sharded scales
+    are not supported.  Chunks missing from the source are treated as all zero voxels.
+
+    ------------------
+
+HTTP API (Level 2 REST):
+
+All endpoints are read-only.  Voxel coordinates are those of the precomputed volume, i.e.,
+the "voxel_offset" of a scale is its first voxel.  For endpoints with a "scale" option,
+scale N is the Nth scale listed in the source's info and coordinates are voxels at that scale.
+
+GET  <api URL>/node/<UUID>/<data name>/help
+
+	Returns data-specific help message.
+
+
+GET  <api URL>/node/<UUID>/<data name>/info
+
+    Retrieves characteristics of this data in JSON format, including the data values, block
+    size, resolution and extents as with imageblk data, the scales of the precomputed source,
+    and "Levels" giving imagetile-style tile specifications for the tile endpoint.
+
+    Example:
+
+    GET <api URL>/node/3f8c/grayscale/info
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of precomputed data.
+
+
+GET  <api URL>/node/<UUID>/<data name>/cache
+
+    Returns JSON describing the cache of chunks fetched from an HTTP source: the number of
+    cached chunks, the total and maximum bytes, the time-to-live, and the hits and misses since
+    the server was started.
+
+
+GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?queryopts]
+
+    Retrieves either 2d images (PNG by default) or 3d binary data, depending on the dims parameter.
+    The 3d binary data response has "Content-type" set to "application/octet-stream" and is an array of
+    voxel values in ZYX order (X iterates most rapidly).  Multi-byte values are little-endian.
+    Segmentation images have each uint64 label packed into a 16-bit RGBA pixel as with labelarray.
+
+    Example:
+
+    GET <api URL>/node/3f8c/grayscale/raw/0_1/512_256/0_0_100/jpg:80
+
+    Returns a raw XY slice (0th and 1st dimensions) with width (x) of 512 voxels and
+    height (y) of 256 voxels with offset (0,0,100) in JPG format with quality 80.
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    dims          The axes of data extraction in form "i_j_k,..."
+                    Slice strings ("xy", "xz", or "yz") are also accepted.
+                    Example: "0_2" is XZ, and "0_1_2" is a 3d subvolume.
+    size          Size in voxels along each dimension specified in <dims>.
+    offset        Gives coordinate of first voxel using dimensionality of data.
+    format        Valid formats depend on the dimensionality of the request and formats
+                    available in server implementation.
+                  2D: "png", "jpg" (default: "png")
+                    jpg allows lossy quality setting, e.g., "jpg:80"
+                  nD: uses default "octet-stream".
+
+    Query-string Options:
+
+  	scale         Default is 0.  The index of the precomputed scale to read.
+    throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation
+    				(all API calls that can be throttled) are handled.  If the server can't initiate the API
+    				call right away, a 503 (Service Unavailable) status code is returned.
+
+
+GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format>][?queryopts]
+
+    Retrieves a 2d image like the "raw" endpoint but scaled so that pixels are isotropic using
+    the resolution of the requested scale.  Segmentation is resized by nearest neighbor.
+    Query-string options are the same as for "raw".
+
+
+GET  <api URL>/node/<UUID>/<data name>/subvolblocks/<size>/<offset>[?queryopts]
+
+    Retrieves blocks corresponding to the extents specified by the size and offset.  The
+    subvolume request must be block aligned using the instance's block size.  Blocks entirely
+    outside the volume are not returned.  The data is returned in the following format:
+
+    <block 0 byte array>
+    <block 1 byte array>
+    ...
+
+    Each byte array is in little-endian format and the structure is as follows:
+
+    int32  Block 1 coordinate X (Note that this may not be starting block coordinate if it is unset.)
+    int32  Block 1 coordinate Y
+    int32  Block 1 coordinate Z
+    int32  # bytes for this block - use to jump to next block
+    ...    block data
+
+    Example:
+
+    GET <api URL>/node/3f8c/grayscale/subvolblocks/128_128_64/0_0_64
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    size          Size in voxels along each dimension specified in <dims>.
+    offset        Gives coordinate of first voxel using dimensionality of data.
+
+    Query-string Options:
+
+    compression   "lz4" (default) returns the uncompressed size as a little-endian uint32 followed
+                    by the lz4-compressed voxels, as stored by DVID.  "uncompressed" returns the voxels.
+                    "jpeg" is only available for uint8 data and returns a grayscale JPEG with width
+                    of the block's x size and height of the block's y * z size.
+  	scale         Default is 0.  The index of the precomputed scale to read.
+    throttle      If "true", makes sure only N compute-intense operation (all API calls that can be
+                    throttled) are handled.  If the server can't initiate the API call right away,
+                    a 503 (Service Unavailable) status code is returned.
+
+
+GET  <api URL>/node/<UUID>/<data name>/tile/<dims>/<scaling>/<tile coord>[/<format>][?options]
+
+    Retrieves a tile of named data within a version node, compatible with the imagetile API
+    using the "Levels" tile specification given by the info endpoint.  The default tile size
+    is used unless the query string "tilesize" is provided.
+
+    Example:
+
+    GET <api URL>/node/3f8c/grayscale/tile/xy/0/10_10_20
+
+    Arguments:
+
+    UUID          Hexidecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    dims          The axes of data extraction.  Slice strings ("xy", "xz", or "yz") are accepted.
+    scaling       The index of the precomputed scale, from 0 (original resolution) to N.
+    tile coord    The tile coordinate in "x_y_z" format.  As with imagetile, the in-plane
+                    coordinates are tile indices at the given scale while the out-of-plane
+                    coordinate is a voxel coordinate at scale 0.
+    format        "png", "jpeg" (default: "png")
+                    jpeg allows lossy quality setting, e.g., "jpeg:80"  (0 <= quality <= 100)
+
+  	Query-string options:
+
+    tilesize      Size in pixels along one dimension of square tile.
+`
+
+func init() {
+	datastore.Register(NewType())
+
+	// Need to register types that will be used to fulfill interfaces.
+	gob.Register(&Type{})
+	gob.Register(&Data{})
+}
+
+var (
+	DefaultTileSize   int32  = 512
+	DefaultTileFormat string = "png"
+
+	// DefaultCacheSize is the default size budget in MB for cached chunks.
+	DefaultCacheSize int64 = 1024
+)
+
+// Type embeds the datastore's Type to create a unique type for precomputed functions.
+type Type struct {
+	datastore.Type
+}
+
+// NewType returns a pointer to a new precomputed Type with default values set.
+func NewType() *Type {
+	return &Type{
+		datastore.Type{
+			Name:    TypeName,
+			URL:     RepoURL,
+			Version: Version,
+			Requirements: &storage.Requirements{
+				Batcher: true,
+			},
+		},
+	}
+}
+
+// --- TypeService interface ---
+
+// NewDataService returns a pointer to new precomputed data after reading the source's info.
+func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.Config) (datastore.DataService, error) {
+	source, found, err := c.GetString("source")
+	if err != nil {
+		return nil, err
+	}
+	if !found || source == "" {
+		return nil, fmt.Errorf("Cannot make precomputed data without valid 'source' setting.")
+	}
+	infoData, err := fetchSource(normalizeSource(source), "info")
+	if err == errNotFound {
+		return nil, fmt.Errorf("No precomputed info file found in source %q", source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting precomputed info from source %q: %v", source, err)
+	}
+	values, scales, err := parseInfo(infoData)
+	if err != nil {
+		return nil, err
+	}
+	props := Properties{
+		Source:        source,
+		Values:        values,
+		Interpolable:  values[0].Label != "segmentation",
+		BlockSize:     scales[0].ChunkSize,
+		Scales:        scales,
+		TileSize:      DefaultTileSize,
+		CacheMaxBytes: DefaultCacheSize << 20,
+	}
+	props.VoxelSize = scales[0].Resolution
+	props.VoxelUnits = dvid.NdString{"nanometers", "nanometers", "nanometers"}
+	if err := props.setByConfig(c); err != nil {
+		return nil, err
+	}
+
+	basedata, err := datastore.NewDataService(dtype, uuid, id, name, c)
+	if err != nil {
+		return nil, err
+	}
+	return &Data{Data: basedata, Properties: props}, nil
+}
+
+func (dtype *Type) Help() string {
+	return HelpMessage
+}
+
+// Scaling is the index of a precomputed scale, where 0 is the highest resolution.
+type Scaling uint8
+
+// Properties are additional properties for precomputed data instances beyond those
+// in standard datastore.Data.  These will be persisted to metadata storage.
+type Properties struct {
+	// Source is the location of the precomputed volume as given at instance creation.
+	Source string
+
+	// Values describes the data type of the voxels.  The label is the precomputed
+	// volume type, i.e., "image" or "segmentation".
+	Values dvid.DataValues
+
+	// Interpolable is true if voxels can be interpolated when resizing.
+	Interpolable bool
+
+	// BlockSize is the size of blocks returned by the subvolblocks endpoint.
+	BlockSize dvid.Point3d
+
+	// Resolution of the highest resolution scale.
+	dvid.Resolution
+
+	// Scales are the available resolutions of the precomputed volume.
+	Scales []Scale
+
+	// TileSize is the default size in pixels along one dimension of square tile.
+	TileSize int32
+
+	// CacheMaxBytes is the size budget for chunks from HTTP sources cached in this instance's
+	// store.  If zero, no chunks are cached.
+	CacheMaxBytes int64
+
+	// CacheTTL is the time after which cached chunks are refetched.  If zero, cached chunks never expire.
+	CacheTTL time.Duration
+}
+
+func (p *Properties) setByConfig(c dvid.Config) error {
+	s, found, err := c.GetString("blocksize")
+	if err != nil {
+		return err
+	}
+	if found {
+		blockSize, err := dvid.StringToPoint3d(s, ",")
+		if err != nil {
+			return err
+		}
+		if blockSize[0] <= 0 || blockSize[1] <= 0 || blockSize[2] <= 0 {
+			return fmt.Errorf("Bad 'blocksize' setting: %s", s)
+		}
+		p.BlockSize = blockSize
+	}
+	s, found, err = c.GetString("tilesize")
+	if err != nil {
+		return err
+	}
+	if found {
+		tileSize, err := strconv.Atoi(s)
+		if err != nil || tileSize <= 0 {
+			return fmt.Errorf("Bad 'tilesize' setting: %s", s)
+		}
+		p.TileSize = int32(tileSize)
+	}
+	s, found, err = c.GetString("cachesize")
+	if err != nil {
+		return err
+	}
+	if found {
+		cacheSize, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Bad 'cachesize' setting (%s): %v", s, err)
+		}
+		p.CacheMaxBytes = cacheSize << 20
+	}
+	s, found, err = c.GetString("cachettl")
+	if err != nil {
+		return err
+	}
+	if found {
+		if p.CacheTTL, err = time.ParseDuration(s); err != nil {
+			return fmt.Errorf("Bad 'cachettl' setting (%s): %v", s, err)
+		}
+	}
+	return nil
+}
+
+// Data embeds the datastore's Data and extends it with precomputed properties.
+type Data struct {
+	*datastore.Data
+	Properties
+
+	cache   *proxy.Cache // read-through cache of chunks fetched from HTTP sources
+	cacheMu sync.Mutex
+}
+
+// CopyPropertiesFrom copies the data instance-specific properties from a given
+// data instance into the receiver's properties.  Fulfills the datastore.PropertyCopier interface.
+func (d *Data) CopyPropertiesFrom(src datastore.DataService, fs storage.FilterSpec) error {
+	d2, ok := src.(*Data)
+	if !ok {
+		return fmt.Errorf("unable to copy properties from non-precomputed data %q", src.DataName())
+	}
+	d.Source = d2.Source
+	d.Values = make(dvid.DataValues, len(d2.Values))
+	copy(d.Values, d2.Values)
+	d.Interpolable = d2.Interpolable
+	d.BlockSize = d2.BlockSize
+	d.Resolution.VoxelSize = make(dvid.NdFloat32, len(d2.Resolution.VoxelSize))
+	copy(d.Resolution.VoxelSize, d2.Resolution.VoxelSize)
+	d.Resolution.VoxelUnits = make(dvid.NdString, len(d2.Resolution.VoxelUnits))
+	copy(d.Resolution.VoxelUnits, d2.Resolution.VoxelUnits)
+	d.Scales = make([]Scale, len(d2.Scales))
+	copy(d.Scales, d2.Scales)
+	d.TileSize = d2.TileSize
+	d.CacheMaxBytes = d2.CacheMaxBytes
+	d.CacheTTL = d2.CacheTTL
+	return nil
+}
+
+// getCache returns the cache of chunks fetched from the source, creating it if necessary.
+func (d *Data) getCache() *proxy.Cache {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+	if d.cache == nil {
+		d.cache = proxy.NewCache(d, d.CacheTTL, d.CacheMaxBytes)
+	}
+	return d.cache
+}
+
+// tileSpec returns imagetile-style specifications for each scale so clients can treat the
+// tile API identically to imagetile.
+func (d *Data) tileSpec() imagetile.TileSpec {
+	spec := make(imagetile.TileSpec, len(d.Scales))
+	for i, s := range d.Scales {
+		levelSpec := imagetile.LevelSpec{
+			Resolution: make(dvid.NdFloat32, 3),
+			TileSize:   dvid.Point3d{d.TileSize, d.TileSize, d.TileSize},
+		}
+		copy(levelSpec.Resolution, s.Resolution)
+		spec[imagetile.Scaling(i)] = imagetile.TileScaleSpec{LevelSpec: levelSpec}
+	}
+	return spec
+}
+
+func (d *Data) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Base     *datastore.Data
+		Extended Properties
+		Extents  imageblk.ExtentsJSON
+		Levels   imagetile.TileSpec
+	}{
+		d.Data,
+		d.Properties,
+		imageblk.ExtentsJSON{
+			MinPoint: d.Scales[0].VoxelOffset,
+			MaxPoint: d.Scales[0].MaxPoint(),
+		},
+		d.tileSpec(),
+	})
+}
+
+func (d *Data) GobDecode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&(d.Data)); err != nil {
+		return err
+	}
+	if err := dec.Decode(&(d.Properties)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Data) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(d.Data); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.Properties); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// --- DataService interface ---
+
+func (d *Data) Help() string {
+	return HelpMessage
+}
+
+// GetImage returns a 2d image of an orthogonal slice at the given scale.
+func (d *Data) GetImage(scale Scaling, slice dvid.Geometry) (*dvid.Image, error) {
+	size2d, ok := slice.Size().(dvid.Point2d)
+	if !ok {
+		return nil, fmt.Errorf("expected 2d slice, got %s", slice)
+	}
+	size, err := dvid.GetPoint3dFrom2d(slice.DataShape(), size2d, 1)
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := slice.StartPoint().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("expected 3d offset for slice, got %s", slice.StartPoint())
+	}
+	data, err := d.readVolume(scale, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	vox := imageblk.NewVoxels(slice, d.Values, data, size2d[0]*d.Values.BytesPerElement())
+	img, err := vox.GetImage2d()
+	if err != nil {
+		return nil, err
+	}
+	if !d.Interpolable {
+		return dvid.ImageFromGoImage(img.Get(), d.Values, false)
+	}
+	return img, nil
+}
+
+// GetVolume returns the voxels of a 3d subvolume at the given scale in ZYX order.
+func (d *Data) GetVolume(scale Scaling, subvol *dvid.Subvolume) ([]byte, error) {
+	offset, ok := subvol.StartPoint().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("expected 3d subvolume offset, got %s", subvol.StartPoint())
+	}
+	size, ok := subvol.Size().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("expected 3d subvolume size, got %s", subvol.Size())
+	}
+	return d.readVolume(scale, offset, size)
+}
+
+// SendBlocks writes the blocks within a block-aligned subvolume at the given scale.
+func (d *Data) SendBlocks(w http.ResponseWriter, scale Scaling, subvol *dvid.Subvolume, compression string) error {
+	switch compression {
+	case "", "lz4", "uncompressed":
+	case "jpeg":
+		if d.Values[0].T != dvid.T_uint8 {
+			return fmt.Errorf("jpeg compression of blocks only available for uint8 data")
+		}
+	default:
+		return fmt.Errorf("don't understand 'compression' query string value: %s", compression)
+	}
+	if int(scale) >= len(d.Scales) {
+		return fmt.Errorf("precomputed data %q has no scale %d", d.DataName(), scale)
+	}
+	w.Header().Set("Content-type", "application/octet-stream")
+
+	s := d.Scales[scale]
+	maxPt := s.MaxPoint()
+	bsize := d.BlockSize
+	var blockBeg, blockEnd dvid.Point3d
+	for dim := uint8(0); dim < 3; dim++ {
+		blockBeg[dim] = subvol.StartPoint().Value(dim) / bsize[dim]
+		blockEnd[dim] = blockBeg[dim] + subvol.Size().Value(dim)/bsize[dim]
+	}
+
+	timedLog := dvid.NewTimeLog()
+	defer timedLog.Infof("SendBlocks %s -> %s, scale %d", blockBeg, blockEnd, scale)
+
+	for bz := blockBeg[2]; bz < blockEnd[2]; bz++ {
+		for by := blockBeg[1]; by < blockEnd[1]; by++ {
+			for bx := blockBeg[0]; bx < blockEnd[0]; bx++ {
+				bcoord := dvid.Point3d{bx, by, bz}
+				var outside bool
+				var offset dvid.Point3d
+				for dim := 0; dim < 3; dim++ {
+					offset[dim] = bcoord[dim] * bsize[dim]
+					if offset[dim] > maxPt[dim] || offset[dim]+bsize[dim] <= s.VoxelOffset[dim] {
+						outside = true
+					}
+				}
+				if outside {
+					continue
+				}
+				data, err := d.readVolume(scale, offset, bsize)
+				if err != nil {
+					return err
+				}
+				if err := writeBlock(w, bcoord, bsize, data, compression); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeBlock writes a block coordinate, the number of bytes of block data, and the
+// block data compressed as requested.
+func writeBlock(w http.ResponseWriter, bcoord, bsize dvid.Point3d, data []byte, compression string) error {
+	var out []byte
+	switch compression {
+	case "uncompressed":
+		out = data
+	case "jpeg":
+		img := &image.Gray{
+			Pix:    data,
+			Stride: int(bsize[0]),
+			Rect:   image.Rect(0, 0, int(bsize[0]), int(bsize[1]*bsize[2])),
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: dvid.DefaultJPEGQuality}); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	default:
+		out = make([]byte, lz4.CompressBound(data)+4)
+		binary.LittleEndian.PutUint32(out[0:4], uint32(len(data)))
+		outSize, err := lz4.Compress(data, out[4:])
+		if err != nil {
+			return err
+		}
+		out = out[:4+outSize]
+	}
+	for _, v := range []int32{bcoord[0], bcoord[1], bcoord[2], int32(len(out))} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// tileSlice returns the slice geometry at the given scale for a tile request where the
+// out-of-plane coordinate is a scale 0 voxel coordinate.
+func (d *Data) tileSlice(shape dvid.DataShape, scale Scaling, tileCoord dvid.Point3d, tileSize int32) (dvid.Geometry, error) {
+	if int(scale) >= len(d.Scales) {
+		return nil, fmt.Errorf("precomputed data %q has no scale %d", d.DataName(), scale)
+	}
+	var outDim int
+	switch {
+	case shape.Equals(dvid.XY):
+		outDim = 2
+	case shape.Equals(dvid.XZ):
+		outDim = 1
+	case shape.Equals(dvid.YZ):
+		outDim = 0
+	default:
+		return nil, fmt.Errorf("Unknown tile orientation: %s", shape)
+	}
+	var offset dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		if dim == outDim {
+			ratio := float64(d.Scales[0].Resolution[dim]) / float64(d.Scales[scale].Resolution[dim])
+			offset[dim] = int32(math.Floor(float64(tileCoord[dim]) * ratio))
+		} else {
+			offset[dim] = tileCoord[dim] * tileSize
+		}
+	}
+	return dvid.NewOrthogSlice(shape, offset, dvid.Point2d{tileSize, tileSize})
+}
+
+// getScale returns the scale specified in the query string, or 0 if unspecified.
+func getScale(r *http.Request) (Scaling, error) {
+	scaleStr := r.URL.Query().Get("scale")
+	if scaleStr == "" {
+		return 0, nil
+	}
+	scale, err := strconv.ParseUint(scaleStr, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("Illegal scale: %s (%v)", scaleStr, err)
+	}
+	return Scaling(scale), nil
+}
+
+// handleImageReq handles the raw and isotropic endpoints.
+func (d *Data) handleImageReq(w http.ResponseWriter, r *http.Request, parts []string) error {
+	if len(parts) < 7 {
+		return fmt.Errorf("%q must be followed by shape/size/offset", parts[3])
+	}
+	isotropic := (parts[3] == "isotropic")
+	shapeStr, sizeStr, offsetStr := parts[4], parts[5], parts[6]
+	planeStr := dvid.DataShapeString(shapeStr)
+	plane, err := planeStr.DataShape()
+	if err != nil {
+		return err
+	}
+	scale, err := getScale(r)
+	if err != nil {
+		return err
+	}
+	var formatStr string
+	if len(parts) >= 8 {
+		formatStr = parts[7]
+	}
+
+	switch plane.ShapeDimensions() {
+	case 2:
+		slice, err := dvid.NewSliceFromStrings(planeStr, offsetStr, sizeStr, "_")
+		if err != nil {
+			return err
+		}
+		if int(scale) >= len(d.Scales) {
+			return fmt.Errorf("precomputed data %q has no scale %d", d.DataName(), scale)
+		}
+		rawSlice, err := dvid.Isotropy2D(d.Scales[scale].Resolution, slice, isotropic)
+		if err != nil {
+			return err
+		}
+		img, err := d.GetImage(scale, rawSlice)
+		if err != nil {
+			return err
+		}
+		if isotropic {
+			dstW := int(slice.Size().Value(0))
+			dstH := int(slice.Size().Value(1))
+			if img, err = img.ScaleImage(dstW, dstH); err != nil {
+				return err
+			}
+		}
+		return dvid.WriteImageHttp(w, img.Get(), formatStr)
+	case 3:
+		if isotropic {
+			return fmt.Errorf("isotropic endpoint only supports 2d images")
+		}
+		subvol, err := dvid.NewSubvolumeFromStrings(offsetStr, sizeStr, "_")
+		if err != nil {
+			return err
+		}
+		data, err := d.GetVolume(scale, subvol)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-type", "application/octet-stream")
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("DVID currently supports shapes of only 2 and 3 dimensions")
+	}
+}
+
+// handleTileReq returns a tile with appropriate Content-Type set.
+func (d *Data) handleTileReq(w http.ResponseWriter, r *http.Request, parts []string) error {
+	if len(parts) < 7 {
+		return fmt.Errorf("'tile' request must be following by plane, scale level, and tile coordinate")
+	}
+	planeStr, scalingStr, coordStr := parts[4], parts[5], parts[6]
+
+	tileSize := d.TileSize
+	if tileSizeStr := r.URL.Query().Get("tilesize"); tileSizeStr != "" {
+		tileSizeInt, err := strconv.Atoi(tileSizeStr)
+		if err != nil || tileSizeInt <= 0 {
+			return fmt.Errorf("Illegal tile size: %s", tileSizeStr)
+		}
+		tileSize = int32(tileSizeInt)
+	}
+	formatStr := DefaultTileFormat
+	if len(parts) >= 8 && parts[7] != "" {
+		formatStr = parts[7]
+	}
+
+	shape, err := dvid.DataShapeString(planeStr).DataShape()
+	if err != nil {
+		return fmt.Errorf("Illegal tile plane: %s (%v)", planeStr, err)
+	}
+	scale, err := strconv.ParseUint(scalingStr, 10, 8)
+	if err != nil {
+		return fmt.Errorf("Illegal tile scale: %s (%v)", scalingStr, err)
+	}
+	tileCoord, err := dvid.StringToPoint3d(coordStr, "_")
+	if err != nil {
+		return fmt.Errorf("Illegal tile coordinate: %s (%v)", coordStr, err)
+	}
+	slice, err := d.tileSlice(shape, Scaling(scale), tileCoord, tileSize)
+	if err != nil {
+		return err
+	}
+	img, err := d.GetImage(Scaling(scale), slice)
+	if err != nil {
+		return err
+	}
+	return dvid.WriteImageHttp(w, img.Get(), formatStr)
+}
+
+// DoRPC handles command-line requests, none of which are supported.
+func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error {
+	return fmt.Errorf("Unknown command.  Data instance %q does not support any commands.  See API help.", d.DataName())
+}
+
+// ServeHTTP handles all incoming HTTP requests for this data.
+func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	timedLog := dvid.NewTimeLog()
+
+	action := strings.ToLower(r.Method)
+	if action != "get" {
+		server.BadRequest(w, r, "precomputed data is read-only and can only handle GET HTTP verbs")
+		return
+	}
+
+	// Break URL request into arguments
+	url := r.URL.Path[len(server.WebAPIPath):]
+	parts := strings.Split(url, "/")
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 4 {
+		server.BadRequest(w, r, "incomplete API request")
+		return
+	}
+	queryStrings := r.URL.Query()
+
+	switch parts[3] {
+	case "help":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, d.Help())
+
+	case "info":
+		jsonBytes, err := d.MarshalJSON()
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+
+	case "cache":
+		jsonBytes, err := json.Marshal(d.getCache().Stats())
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+
+	case "tile":
+		if err := d.handleTileReq(w, r, parts); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: tile (%s)", r.Method, r.URL)
+
+	case "raw", "isotropic":
+		if throttle := queryStrings.Get("throttle"); throttle == "on" || throttle == "true" {
+			if server.ThrottledHTTP(w) {
+				return
+			}
+			defer server.ThrottledOpDone()
+		}
+		if err := d.handleImageReq(w, r, parts); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %s (%s)", r.Method, parts[3], r.URL)
+
+	case "subvolblocks":
+		// GET <api URL>/node/<UUID>/<data name>/subvolblocks/<size>/<offset>[?compression=...]
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "%q must be followed by size/offset", parts[3])
+			return
+		}
+		if throttle := queryStrings.Get("throttle"); throttle == "on" || throttle == "true" {
+			if server.ThrottledHTTP(w) {
+				return
+			}
+			defer server.ThrottledOpDone()
+		}
+		subvol, err := dvid.NewSubvolumeFromStrings(parts[5], parts[4], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if subvol.StartPoint().NumDims() != 3 || subvol.Size().NumDims() != 3 {
+			server.BadRequest(w, r, "must specify 3D subvolumes", subvol.StartPoint(), subvol.EndPoint())
+			return
+		}
+		if !dvid.BlockAligned(subvol, d.BlockSize) {
+			server.BadRequest(w, r, "cannot use 'subvolblocks' endpoint in non-block aligned geometry %s -> %s", subvol.StartPoint(), subvol.EndPoint())
+			return
+		}
+		scale, err := getScale(r)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := d.SendBlocks(w, scale, subvol, queryStrings.Get("compression")); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %s (%s)", r.Method, subvol, r.URL)
+
+	default:
+		server.BadAPIRequest(w, r, d)
+	}
+}
@@ -0,0 +1,467 @@
+package precomputed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/proxy"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+
+	lz4 "github.com/janelia-flyem/go/golz4"
+)
+
+var (
+	pctype datastore.TypeService
+	testMu sync.Mutex
+)
+
+// Sets package-level testRepo and TestVersionID
+func initTestRepo() (dvid.UUID, dvid.VersionID) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	if pctype == nil {
+		var err error
+		pctype, err = datastore.TypeServiceByName(TypeName)
+		if err != nil {
+			log.Fatalf("Can't get precomputed type: %s\n", err)
+		}
+	}
+	return datastore.NewTestRepo()
+}
+
+// testVolume describes a single-scale precomputed volume written to disk for testing.
+type testVolume struct {
+	dataType  string
+	volType   string
+	encoding  string
+	size      dvid.Point3d
+	offset    dvid.Point3d
+	chunkSize dvid.Point3d
+	value     func(x, y, z int32) uint64
+}
+
+func (tv testVolume) info() string {
+	var csBlockSize string
+	if tv.encoding == "compressed_segmentation" {
+		csBlockSize = `, "compressed_segmentation_block_size": [8, 8, 8]`
+	}
+	return fmt.Sprintf(`{
+		"type": %q,
+		"data_type": %q,
+		"num_channels": 1,
+		"scales": [
+			{
+				"key": "8_8_40",
+				"size": [%d, %d, %d],
+				"voxel_offset": [%d, %d, %d],
+				"resolution": [8, 8, 40],
+				"chunk_sizes": [[%d, %d, %d]],
+				"encoding": %q%s
+			}
+		]
+	}`, tv.volType, tv.dataType, tv.size[0], tv.size[1], tv.size[2], tv.offset[0], tv.offset[1], tv.offset[2],
+		tv.chunkSize[0], tv.chunkSize[1], tv.chunkSize[2], tv.encoding, csBlockSize)
+}
+
+// write stores the info and all chunks except those rejected by the skip function,
+// gzipping chunks accepted by the gz function.
+func (tv testVolume) write(t *testing.T, dir string, skip, gz func(chunk dvid.Point3d) bool) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "info"), []byte(tv.info()), 0644); err != nil {
+		t.Fatalf("can't write info: %v\n", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "8_8_40"), 0755); err != nil {
+		t.Fatalf("can't make scale directory: %v\n", err)
+	}
+	bytesPerVoxel := map[string]int{"uint8": 1, "uint64": 8}[tv.dataType]
+	for cz := int32(0); cz*tv.chunkSize[2] < tv.size[2]; cz++ {
+		for cy := int32(0); cy*tv.chunkSize[1] < tv.size[1]; cy++ {
+			for cx := int32(0); cx*tv.chunkSize[0] < tv.size[0]; cx++ {
+				chunk := dvid.Point3d{cx, cy, cz}
+				if skip != nil && skip(chunk) {
+					continue
+				}
+				var minPt, maxPt, size dvid.Point3d
+				for dim := 0; dim < 3; dim++ {
+					minPt[dim] = tv.offset[dim] + chunk[dim]*tv.chunkSize[dim]
+					maxPt[dim] = minPt[dim] + tv.chunkSize[dim]
+					if maxPt[dim] > tv.offset[dim]+tv.size[dim] {
+						maxPt[dim] = tv.offset[dim] + tv.size[dim]
+					}
+					size[dim] = maxPt[dim] - minPt[dim]
+				}
+				labels := make([]uint64, 0, size.Prod())
+				data := make([]byte, 0, size.Prod()*int64(bytesPerVoxel))
+				for z := minPt[2]; z < maxPt[2]; z++ {
+					for y := minPt[1]; y < maxPt[1]; y++ {
+						for x := minPt[0]; x < maxPt[0]; x++ {
+							v := tv.value(x, y, z)
+							labels = append(labels, v)
+							if bytesPerVoxel == 1 {
+								data = append(data, byte(v))
+							} else {
+								var buf [8]byte
+								binary.LittleEndian.PutUint64(buf[:], v)
+								data = append(data, buf[:]...)
+							}
+						}
+					}
+				}
+				if tv.encoding == "compressed_segmentation" {
+					data = encodeCompressedSegmentation(labels, size, dvid.Point3d{8, 8, 8})
+				}
+				name := filepath.Join(dir, "8_8_40", fmt.Sprintf("%d-%d_%d-%d_%d-%d", minPt[0], maxPt[0], minPt[1], maxPt[1], minPt[2], maxPt[2]))
+				if gz != nil && gz(chunk) {
+					var buf bytes.Buffer
+					zw := gzip.NewWriter(&buf)
+					zw.Write(data)
+					zw.Close()
+					name += ".gz"
+					data = buf.Bytes()
+				}
+				if err := ioutil.WriteFile(name, data, 0644); err != nil {
+					t.Fatalf("can't write chunk %s: %v\n", name, err)
+				}
+			}
+		}
+	}
+}
+
+// encodeCompressedSegmentation encodes uint64 labels of a chunk in the neuroglancer
+// compressed_segmentation format with a single channel.
+func encodeCompressedSegmentation(labels []uint64, size, blockSize dvid.Point3d) []byte {
+	var grid dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		grid[dim] = (size[dim] + blockSize[dim] - 1) / blockSize[dim]
+	}
+	words := make([]uint32, 1+2*grid.Prod())
+	words[0] = 1
+	blockVoxels := blockSize.Prod()
+	for bz := int32(0); bz < grid[2]; bz++ {
+		for by := int32(0); by < grid[1]; by++ {
+			for bx := int32(0); bx < grid[0]; bx++ {
+				index := make(map[uint64]uint32)
+				var table []uint64
+				indices := make([]uint32, blockVoxels)
+				for vz := int32(0); vz < blockSize[2]; vz++ {
+					for vy := int32(0); vy < blockSize[1]; vy++ {
+						for vx := int32(0); vx < blockSize[0]; vx++ {
+							x, y, z := bx*blockSize[0]+vx, by*blockSize[1]+vy, bz*blockSize[2]+vz
+							if x >= size[0] || y >= size[1] || z >= size[2] {
+								continue
+							}
+							label := labels[(int64(z)*int64(size[1])+int64(y))*int64(size[0])+int64(x)]
+							i, found := index[label]
+							if !found {
+								i = uint32(len(table))
+								index[label] = i
+								table = append(table, label)
+							}
+							indices[vx+blockSize[0]*(vy+blockSize[1]*vz)] = i
+						}
+					}
+				}
+				var bits uint32
+				for (1 << bits) < len(table) {
+					if bits == 0 {
+						bits = 1
+					} else {
+						bits *= 2
+					}
+				}
+				header := 1 + 2*(bx+grid[0]*(by+grid[1]*bz))
+				valuesOffset := uint32(len(words) - 1)
+				if bits > 0 {
+					packed := make([]uint32, (uint32(blockVoxels)*bits+31)/32)
+					for i, idx := range indices {
+						pos := uint32(i) * bits
+						packed[pos/32] |= idx << (pos % 32)
+					}
+					words = append(words, packed...)
+				}
+				tableOffset := uint32(len(words) - 1)
+				for _, label := range table {
+					words = append(words, uint32(label), uint32(label>>32))
+				}
+				words[header] = tableOffset | bits<<24
+				words[header+1] = valuesOffset
+			}
+		}
+	}
+	data := make([]byte, 4*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(data[i*4:], w)
+	}
+	return data
+}
+
+func TestDecodeCompressedSegmentation(t *testing.T) {
+	size := dvid.Point3d{10, 9, 7}
+	for _, numLabels := range []uint64{1, 2, 3, 5, 20, 300} {
+		labels := make([]uint64, size.Prod())
+		for i := range labels {
+			labels[i] = (uint64(i*7919) % numLabels) * 0x100000001
+		}
+		encoded := encodeCompressedSegmentation(labels, size, dvid.Point3d{4, 4, 4})
+		decoded, err := decodeCompressedSegmentation(encoded, size, dvid.Point3d{4, 4, 4}, 8)
+		if err != nil {
+			t.Fatalf("error decoding %d labels: %v\n", numLabels, err)
+		}
+		for i, label := range labels {
+			if got := binary.LittleEndian.Uint64(decoded[i*8:]); got != label {
+				t.Fatalf("decoding %d labels, voxel %d expected label %d, got %d\n", numLabels, i, label, got)
+			}
+		}
+	}
+	if _, err := decodeCompressedSegmentation([]byte{1, 0, 0, 0}, size, dvid.Point3d{4, 4, 4}, 8); err == nil {
+		t.Errorf("expected error decoding truncated compressed_segmentation data\n")
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tv := testVolume{"uint8", "image", "jpeg", dvid.Point3d{100, 80, 40}, dvid.Point3d{10, 20, 0}, dvid.Point3d{32, 32, 16}, nil}
+	values, scales, err := parseInfo([]byte(tv.info()))
+	if err != nil {
+		t.Fatalf("error parsing info: %v\n", err)
+	}
+	if values[0].T != dvid.T_uint8 || values[0].Label != "image" || len(scales) != 1 {
+		t.Errorf("bad values %v or scales %v\n", values, scales)
+	}
+	if maxPt := scales[0].MaxPoint(); maxPt != (dvid.Point3d{109, 99, 39}) {
+		t.Errorf("bad max point %s\n", maxPt)
+	}
+	for _, bad := range []testVolume{
+		{"uint64", "segmentation", "jpeg", tv.size, tv.offset, tv.chunkSize, nil},
+		{"uint8", "image", "png", tv.size, tv.offset, tv.chunkSize, nil},
+		{"int8", "image", "raw", tv.size, tv.offset, tv.chunkSize, nil},
+	} {
+		if _, _, err := parseInfo([]byte(bad.info())); err == nil {
+			t.Errorf("expected error parsing %s %s info\n", bad.dataType, bad.encoding)
+		}
+	}
+}
+
+func grayValue(x, y, z int32) uint64 {
+	return uint64(x + 2*y + 3*z)
+}
+
+func TestLocalImageVolume(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	dir, err := ioutil.TempDir("", "precomputed-image")
+	if err != nil {
+		t.Fatalf("can't make temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Chunk (1,1,1) is missing and chunk (0,0,0) is gzipped.
+	tv := testVolume{"uint8", "image", "raw", dvid.Point3d{100, 80, 40}, dvid.Point3d{10, 20, 0}, dvid.Point3d{32, 32, 16}, grayValue}
+	missing := dvid.Point3d{1, 1, 1}
+	tv.write(t, dir, func(c dvid.Point3d) bool { return c == missing }, func(c dvid.Point3d) bool { return c == dvid.Point3d{} })
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("source", "file://"+dir)
+	config.Set("blocksize", "16,16,16")
+	server.CreateTestInstance(t, uuid, TypeName, "grayscale", config)
+
+	// Check info.
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/info", server.WebAPIPath, uuid)
+	var info struct {
+		Extended struct {
+			BlockSize dvid.Point3d
+			VoxelSize dvid.NdFloat32
+		}
+		Extents struct {
+			MinPoint dvid.Point3d
+			MaxPoint dvid.Point3d
+		}
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &info); err != nil {
+		t.Fatalf("can't decode info: %v\n", err)
+	}
+	if info.Extended.BlockSize != (dvid.Point3d{16, 16, 16}) || info.Extents.MinPoint != (dvid.Point3d{10, 20, 0}) || info.Extents.MaxPoint != (dvid.Point3d{109, 99, 39}) {
+		t.Errorf("bad info: %v\n", info)
+	}
+
+	// Get a subvolume spanning chunks and extending outside the volume.
+	offset, size := dvid.Point3d{0, 30, 10}, dvid.Point3d{60, 40, 20}
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/%d_%d_%d/%d_%d_%d", server.WebAPIPath, uuid,
+		size[0], size[1], size[2], offset[0], offset[1], offset[2])
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	if int64(len(data)) != size.Prod() {
+		t.Fatalf("expected %d bytes from raw GET, got %d\n", size.Prod(), len(data))
+	}
+	var i int
+	for z := offset[2]; z < offset[2]+size[2]; z++ {
+		for y := offset[1]; y < offset[1]+size[1]; y++ {
+			for x := offset[0]; x < offset[0]+size[0]; x++ {
+				var expected byte
+				chunk := dvid.Point3d{(x - 10) / 32, (y - 20) / 32, z / 16}
+				if x >= 10 && chunk != missing {
+					expected = byte(grayValue(x, y, z))
+				}
+				if data[i] != expected {
+					t.Fatalf("expected %d at (%d,%d,%d), got %d\n", expected, x, y, z, data[i])
+				}
+				i++
+			}
+		}
+	}
+
+	// Get an XZ image and a tile.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/raw/xz/20_10/15_25_5", server.WebAPIPath, uuid)
+	img, err := png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("can't decode png: %v\n", err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok || gray.Bounds().Dx() != 20 || gray.Bounds().Dy() != 10 {
+		t.Fatalf("expected 20 x 10 gray image, got %T\n", img)
+	}
+	if v := gray.GrayAt(3, 4).Y; v != byte(grayValue(18, 25, 9)) {
+		t.Errorf("expected %d in xz image, got %d\n", grayValue(18, 25, 9), v)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/tile/xy/0/1_1_7?tilesize=32", server.WebAPIPath, uuid)
+	img, err = png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("can't decode tile: %v\n", err)
+	}
+	if v := img.(*image.Gray).GrayAt(5, 6).Y; v != byte(grayValue(37, 38, 7)) {
+		t.Errorf("expected %d in tile, got %d\n", grayValue(37, 38, 7), v)
+	}
+
+	// Get blocks, which should skip blocks outside the volume.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/subvolblocks/32_16_16/96_16_16?compression=uncompressed", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", apiStr, nil)
+	if len(data) != 16+16*16*16 {
+		t.Fatalf("expected one block from subvolblocks, got %d bytes\n", len(data))
+	}
+	var header [4]int32
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+	if header != [4]int32{6, 1, 1, 16 * 16 * 16} {
+		t.Errorf("bad block header %v\n", header)
+	}
+	if data[16] != 0 || data[16+4*16] != byte(grayValue(96, 20, 16)) {
+		t.Errorf("bad block voxels %d, %d\n", data[16], data[16+4*16])
+	}
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/subvolblocks/16_16_16/16_16_16", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", apiStr, nil)
+	block := make([]byte, binary.LittleEndian.Uint32(data[16:20]))
+	if err := lz4.Uncompress(data[20:], block); err != nil {
+		t.Fatalf("can't uncompress lz4 block: %v\n", err)
+	}
+	if len(block) != 16*16*16 || block[4*16] != byte(grayValue(16, 20, 16)) {
+		t.Errorf("bad lz4 block of %d bytes\n", len(block))
+	}
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/subvolblocks/16_16_16/8_16_16", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// Data is read-only.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/32_32_32/0_0_0", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBuffer(make([]byte, 32*32*32)))
+}
+
+func segValue(x, y, z int32) uint64 {
+	return uint64(x/10+1) << 40
+}
+
+func TestHTTPSegmentation(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	dir, err := ioutil.TempDir("", "precomputed-seg")
+	if err != nil {
+		t.Fatalf("can't make temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	tv := testVolume{"uint64", "segmentation", "compressed_segmentation", dvid.Point3d{50, 50, 20}, dvid.Point3d{}, dvid.Point3d{32, 32, 32}, segValue}
+	tv.write(t, dir, nil, nil)
+
+	// Serve the volume over HTTP, counting requests.
+	var fetchMu sync.Mutex
+	var fetches int
+	fileServer := http.FileServer(http.Dir(dir))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetchMu.Lock()
+		fetches++
+		fetchMu.Unlock()
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	numFetches := func() int {
+		fetchMu.Lock()
+		defer fetchMu.Unlock()
+		return fetches
+	}
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("source", "precomputed://"+ts.URL+"/")
+	server.CreateTestInstance(t, uuid, TypeName, "segmentation", config)
+	if n := numFetches(); n != 1 {
+		t.Errorf("expected only info fetch on creation, got %d fetches\n", n)
+	}
+
+	apiStr := fmt.Sprintf("%snode/%s/segmentation/raw/0_1_2/40_10_5/5_28_10", server.WebAPIPath, uuid)
+	for trial := 0; trial < 2; trial++ {
+		data := server.TestHTTP(t, "GET", apiStr, nil)
+		if len(data) != 40*10*5*8 {
+			t.Fatalf("expected %d bytes, got %d\n", 40*10*5*8, len(data))
+		}
+		for i := 0; i < 40*10*5; i++ {
+			x := int32(5 + i%40)
+			if label := binary.LittleEndian.Uint64(data[i*8:]); label != segValue(x, 0, 0) {
+				t.Fatalf("expected label %d at x %d, got %d\n", segValue(x, 0, 0), x, label)
+			}
+		}
+	}
+	if n := numFetches(); n != 5 {
+		t.Errorf("expected 4 chunk fetches with cached second GET, got %d total fetches\n", n)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/segmentation/cache", server.WebAPIPath, uuid)
+	var stats proxy.Stats
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &stats); err != nil {
+		t.Fatalf("can't decode cache stats: %v\n", err)
+	}
+	if stats.Entries != 4 || stats.Hits != 4 || stats.Misses != 4 {
+		t.Errorf("bad cache stats: %v\n", stats)
+	}
+
+	// Isotropic XZ images of segmentation should not interpolate labels.
+	apiStr = fmt.Sprintf("%snode/%s/segmentation/isotropic/xz/50_50/0_10_0", server.WebAPIPath, uuid)
+	img, err := png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("can't decode png: %v\n", err)
+	}
+	labelImg, ok := img.(*image.NRGBA64)
+	if !ok || labelImg.Bounds().Dx() != 50 || labelImg.Bounds().Dy() != 50 {
+		t.Fatalf("expected 50 x 50 label image, got %T %s\n", img, img.Bounds())
+	}
+	for _, x := range []int{0, 9, 10, 25, 49} {
+		i := labelImg.PixOffset(x, 30)
+		label := binary.LittleEndian.Uint64(labelImg.Pix[i : i+8])
+		if label != segValue(int32(x), 0, 0) {
+			t.Errorf("expected label %d at x %d of isotropic image, got %d\n", segValue(int32(x), 0, 0), x, label)
+		}
+	}
+}
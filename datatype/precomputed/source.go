@@ -0,0 +1,359 @@
+/*
+	This file supports reading the info and chunks of a neuroglancer precomputed volume
+	from an HTTP server or local disk.
+*/
+
+package precomputed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// errNotFound is returned when a file is not present in the source.  Precomputed volumes
+// may omit chunks that are entirely background.
+var errNotFound = fmt.Errorf("not found in precomputed source")
+
+// sourceClient is used for all HTTP requests to precomputed sources.
+var sourceClient = &http.Client{Timeout: 2 * time.Minute}
+
+// maxChunkFetches is the maximum number of chunks fetched concurrently for a single request.
+const maxChunkFetches = 8
+
+// Scale describes one of the resolutions available in a precomputed volume.
+type Scale struct {
+	// Key is the directory of the scale's chunks relative to the source.
+	Key string
+
+	// Size is the size of the volume in voxels at this scale.
+	Size dvid.Point3d
+
+	// VoxelOffset is the voxel coordinate of the first voxel at this scale.
+	VoxelOffset dvid.Point3d
+
+	// Resolution is the size of a voxel in nanometers.
+	Resolution dvid.NdFloat32
+
+	// ChunkSize is the size in voxels of each chunk.  Only the first chunk size
+	// listed in the info is used.
+	ChunkSize dvid.Point3d
+
+	// Encoding is one of "raw", "jpeg", or "compressed_segmentation".
+	Encoding string
+
+	// CompressedSegmentationBlockSize is the size of blocks within compressed_segmentation chunks.
+	CompressedSegmentationBlockSize dvid.Point3d `json:",omitempty"`
+}
+
+// MaxPoint returns the last voxel coordinate of the volume at this scale.
+func (s Scale) MaxPoint() dvid.Point3d {
+	return dvid.Point3d{
+		s.VoxelOffset[0] + s.Size[0] - 1,
+		s.VoxelOffset[1] + s.Size[1] - 1,
+		s.VoxelOffset[2] + s.Size[2] - 1,
+	}
+}
+
+// sourceInfo is the JSON "info" file at the root of a precomputed volume.
+type sourceInfo struct {
+	Type        string `json:"type"`
+	DataType    string `json:"data_type"`
+	NumChannels int    `json:"num_channels"`
+	Scales      []struct {
+		Key                             string          `json:"key"`
+		Size                            [3]int32        `json:"size"`
+		VoxelOffset                     [3]int32        `json:"voxel_offset"`
+		Resolution                      [3]float32      `json:"resolution"`
+		ChunkSizes                      [][3]int32      `json:"chunk_sizes"`
+		Encoding                        string          `json:"encoding"`
+		CompressedSegmentationBlockSize [3]int32        `json:"compressed_segmentation_block_size"`
+		Sharding                        json.RawMessage `json:"sharding"`
+	} `json:"scales"`
+}
+
+// parseInfo returns the data values and scales described by a precomputed info file.
+func parseInfo(data []byte) (dvid.DataValues, []Scale, error) {
+	var info sourceInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode precomputed info: %v", err)
+	}
+	if info.NumChannels != 1 {
+		return nil, nil, fmt.Errorf("only single channel precomputed volumes are supported, not %d channels", info.NumChannels)
+	}
+	var t dvid.DataType
+	switch info.DataType {
+	case "uint8":
+		t = dvid.T_uint8
+	case "uint16":
+		t = dvid.T_uint16
+	case "uint32":
+		t = dvid.T_uint32
+	case "uint64":
+		t = dvid.T_uint64
+	case "float32":
+		t = dvid.T_float32
+	default:
+		return nil, nil, fmt.Errorf("unsupported precomputed data type %q", info.DataType)
+	}
+	values := dvid.DataValues{{T: t, Label: info.Type}}
+	if len(info.Scales) == 0 {
+		return nil, nil, fmt.Errorf("precomputed info has no scales")
+	}
+	scales := make([]Scale, len(info.Scales))
+	for i, s := range info.Scales {
+		if len(s.Sharding) != 0 && string(s.Sharding) != "null" {
+			return nil, nil, fmt.Errorf("scale %q is sharded, which is not supported", s.Key)
+		}
+		if len(s.ChunkSizes) == 0 {
+			return nil, nil, fmt.Errorf("scale %q has no chunk sizes", s.Key)
+		}
+		switch s.Encoding {
+		case "raw":
+		case "jpeg":
+			if t != dvid.T_uint8 {
+				return nil, nil, fmt.Errorf("scale %q has jpeg encoding for %s data", s.Key, info.DataType)
+			}
+		case "compressed_segmentation":
+			if t != dvid.T_uint32 && t != dvid.T_uint64 {
+				return nil, nil, fmt.Errorf("scale %q has compressed_segmentation encoding for %s data", s.Key, info.DataType)
+			}
+			bs := s.CompressedSegmentationBlockSize
+			if bs[0] <= 0 || bs[1] <= 0 || bs[2] <= 0 {
+				return nil, nil, fmt.Errorf("scale %q has bad compressed_segmentation block size %v", s.Key, bs)
+			}
+		default:
+			return nil, nil, fmt.Errorf("scale %q has unsupported encoding %q", s.Key, s.Encoding)
+		}
+		chunkSize := dvid.Point3d(s.ChunkSizes[0])
+		if chunkSize[0] <= 0 || chunkSize[1] <= 0 || chunkSize[2] <= 0 {
+			return nil, nil, fmt.Errorf("scale %q has bad chunk size %s", s.Key, chunkSize)
+		}
+		scales[i] = Scale{
+			Key:                             s.Key,
+			Size:                            dvid.Point3d(s.Size),
+			VoxelOffset:                     dvid.Point3d(s.VoxelOffset),
+			Resolution:                      dvid.NdFloat32{s.Resolution[0], s.Resolution[1], s.Resolution[2]},
+			ChunkSize:                       chunkSize,
+			Encoding:                        s.Encoding,
+			CompressedSegmentationBlockSize: dvid.Point3d(s.CompressedSegmentationBlockSize),
+		}
+	}
+	return values, scales, nil
+}
+
+// normalizeSource converts neuroglancer-style source strings into either an HTTP(S) URL
+// or a local directory path.
+func normalizeSource(source string) string {
+	source = strings.TrimPrefix(source, "precomputed://")
+	source = strings.TrimRight(source, "/")
+	switch {
+	case strings.HasPrefix(source, "gs://"):
+		return "https://storage.googleapis.com/" + strings.TrimPrefix(source, "gs://")
+	case strings.HasPrefix(source, "file://"):
+		return strings.TrimPrefix(source, "file://")
+	}
+	return source
+}
+
+func isHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetchSource returns the contents of a file relative to the source, returning errNotFound
+// if the file is not present.  Local files may be gzipped with a ".gz" suffix.
+func fetchSource(source, relpath string) ([]byte, error) {
+	if isHTTPSource(source) {
+		url := source + "/" + relpath
+		timedLog := dvid.NewTimeLog()
+		resp, err := sourceClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound, http.StatusForbidden:
+			return nil, errNotFound
+		default:
+			return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, url)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		timedLog.Debugf("PROXY HTTP to precomputed source: %s, returned %d bytes", url, len(data))
+		return data, nil
+	}
+
+	path := filepath.Join(source, filepath.FromSlash(relpath))
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return data, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	gzdata, err := ioutil.ReadFile(path + ".gz")
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewBuffer(gzdata))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// readSource returns the contents of a file relative to the source, using the cache
+// for HTTP sources.
+func (d *Data) readSource(relpath string) ([]byte, error) {
+	source := normalizeSource(d.Source)
+	if !isHTTPSource(source) {
+		return fetchSource(source, relpath)
+	}
+	return d.getCache().Fetch(source+"/"+relpath, func() ([]byte, error) {
+		return fetchSource(source, relpath)
+	})
+}
+
+// getChunk returns the decoded voxels of the chunk spanning [minPt, maxPt) at the given
+// scale, or nil if the chunk is missing from the source.
+func (d *Data) getChunk(scale Scaling, minPt, maxPt dvid.Point3d) ([]byte, error) {
+	s := d.Scales[scale]
+	name := fmt.Sprintf("%s/%d-%d_%d-%d_%d-%d", s.Key, minPt[0], maxPt[0], minPt[1], maxPt[1], minPt[2], maxPt[2])
+	data, err := d.readSource(name)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	size := dvid.Point3d{maxPt[0] - minPt[0], maxPt[1] - minPt[1], maxPt[2] - minPt[2]}
+	voxels, err := decodeChunk(data, s, size, d.Values.BytesPerElement())
+	if err != nil {
+		return nil, fmt.Errorf("bad chunk %q in precomputed source for %q: %v", name, d.DataName(), err)
+	}
+	return voxels, nil
+}
+
+// readVolume returns the voxels of a subvolume at the given scale in ZYX order.
+// Voxels outside the volume or in missing chunks are zero.
+func (d *Data) readVolume(scale Scaling, offset, size dvid.Point3d) ([]byte, error) {
+	if int(scale) >= len(d.Scales) {
+		return nil, fmt.Errorf("precomputed data %q has no scale %d", d.DataName(), scale)
+	}
+	if size[0] <= 0 || size[1] <= 0 || size[2] <= 0 {
+		return nil, fmt.Errorf("bad subvolume size %s", size)
+	}
+	s := d.Scales[scale]
+	bytesPerVoxel := d.Values.BytesPerElement()
+	out := make([]byte, size.Prod()*int64(bytesPerVoxel))
+
+	// Clip the request to the volume.
+	var lo, hi, chunkBeg, chunkEnd dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		lo[dim] = offset[dim]
+		if lo[dim] < s.VoxelOffset[dim] {
+			lo[dim] = s.VoxelOffset[dim]
+		}
+		hi[dim] = offset[dim] + size[dim]
+		if hi[dim] > s.VoxelOffset[dim]+s.Size[dim] {
+			hi[dim] = s.VoxelOffset[dim] + s.Size[dim]
+		}
+		if lo[dim] >= hi[dim] {
+			return out, nil
+		}
+		chunkBeg[dim] = (lo[dim] - s.VoxelOffset[dim]) / s.ChunkSize[dim]
+		chunkEnd[dim] = (hi[dim] - 1 - s.VoxelOffset[dim]) / s.ChunkSize[dim]
+	}
+
+	// Fetch the intersecting chunks concurrently and copy their overlap into the output.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	fetches := make(chan struct{}, maxChunkFetches)
+	for cz := chunkBeg[2]; cz <= chunkEnd[2]; cz++ {
+		for cy := chunkBeg[1]; cy <= chunkEnd[1]; cy++ {
+			for cx := chunkBeg[0]; cx <= chunkEnd[0]; cx++ {
+				var minPt, maxPt dvid.Point3d
+				chunkCoord := dvid.Point3d{cx, cy, cz}
+				for dim := 0; dim < 3; dim++ {
+					minPt[dim] = s.VoxelOffset[dim] + chunkCoord[dim]*s.ChunkSize[dim]
+					maxPt[dim] = minPt[dim] + s.ChunkSize[dim]
+					if maxPt[dim] > s.VoxelOffset[dim]+s.Size[dim] {
+						maxPt[dim] = s.VoxelOffset[dim] + s.Size[dim]
+					}
+				}
+				wg.Add(1)
+				fetches <- struct{}{}
+				go func(minPt, maxPt dvid.Point3d) {
+					defer func() {
+						<-fetches
+						wg.Done()
+					}()
+					voxels, err := d.getChunk(scale, minPt, maxPt)
+					if err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+						return
+					}
+					if voxels != nil {
+						copyOverlap(out, offset, size, voxels, minPt, maxPt, bytesPerVoxel)
+					}
+				}(minPt, maxPt)
+			}
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// copyOverlap copies the voxels of a chunk spanning [minPt, maxPt) that fall within the
+// destination subvolume.  Each chunk writes a disjoint part of the destination.
+func copyOverlap(dst []byte, offset, size dvid.Point3d, src []byte, minPt, maxPt dvid.Point3d, bytesPerVoxel int32) {
+	var beg, end dvid.Point3d
+	for dim := 0; dim < 3; dim++ {
+		beg[dim] = minPt[dim]
+		if beg[dim] < offset[dim] {
+			beg[dim] = offset[dim]
+		}
+		end[dim] = maxPt[dim]
+		if end[dim] > offset[dim]+size[dim] {
+			end[dim] = offset[dim] + size[dim]
+		}
+		if beg[dim] >= end[dim] {
+			return
+		}
+	}
+	chunkW := int64(maxPt[0] - minPt[0])
+	chunkH := int64(maxPt[1] - minPt[1])
+	rowBytes := int64(end[0]-beg[0]) * int64(bytesPerVoxel)
+	for z := beg[2]; z < end[2]; z++ {
+		for y := beg[1]; y < end[1]; y++ {
+			srcI := ((int64(z-minPt[2])*chunkH+int64(y-minPt[1]))*chunkW + int64(beg[0]-minPt[0])) * int64(bytesPerVoxel)
+			dstI := ((int64(z-offset[2])*int64(size[1])+int64(y-offset[1]))*int64(size[0]) + int64(beg[0]-offset[0])) * int64(bytesPerVoxel)
+			copy(dst[dstI:dstI+rowBytes], src[srcI:srcI+rowBytes])
+		}
+	}
+}
@@ -263,6 +263,18 @@ func (i Immutable) VoxelWithin(p dvid.Point3d) bool {
 	return found
 }
 
+// BlockWithin returns true if the given block coordinate, in the ROI's block size,
+// is within the ROI.
+func (i Immutable) BlockWithin(izyx dvid.IZYXString) bool {
+	_, found := i.blocks[izyx]
+	return found
+}
+
+// BlockSize returns the block size of the ROI.
+func (i Immutable) BlockSize() dvid.Point3d {
+	return i.blockSize
+}
+
 // ImmutableBySpec returns an Immutable ROI (or nil if not available) given
 // a name and uuid using string format "<roiname>,<uuid>"
 func ImmutableBySpec(spec string) (*Immutable, error) {
@@ -427,6 +439,27 @@ func GetByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
 	return data, nil
 }
 
+// GetOrCreateByUUIDName returns a pointer to ROI data given a version (UUID) and data name,
+// creating a new ROI data instance with default settings if the name isn't used.
+func GetOrCreateByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
+	if d, err := GetByUUIDName(uuid, name); err == nil {
+		return d, nil
+	}
+	typeservice, err := datastore.TypeServiceByName(TypeName)
+	if err != nil {
+		return nil, err
+	}
+	dataservice, err := datastore.NewData(uuid, typeservice, name, dvid.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	d, ok := dataservice.(*Data)
+	if !ok {
+		return nil, fmt.Errorf("Could not create ROI data instance %q", name)
+	}
+	return d, nil
+}
+
 func (d *Data) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Base     *datastore.Data
@@ -705,6 +738,40 @@ func (d *Data) PutJSON(v dvid.VersionID, jsonBytes []byte) error {
 	return nil
 }
 
+// returns floor(a/b) for positive b.
+func floorDiv(a, b int32) int32 {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+// BlockSpans returns normalized spans in this ROI's block coordinates that cover the given
+// blocks of a volume with a possibly different block size.  This allows block indices of
+// other data instances, e.g., the blocks of a label, to be stored as an ROI via PutSpans.
+func (d *Data) BlockSpans(blocks dvid.IZYXSlice, blockSize dvid.Point3d) (dvid.Spans, error) {
+	spans := make(dvid.Spans, 0, len(blocks))
+	for _, izyx := range blocks {
+		chunkPt, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		var beg, end [3]int32
+		for dim := 0; dim < 3; dim++ {
+			v0 := chunkPt[dim] * blockSize[dim]
+			v1 := v0 + blockSize[dim] - 1
+			beg[dim] = floorDiv(v0, d.BlockSize[dim])
+			end[dim] = floorDiv(v1, d.BlockSize[dim])
+		}
+		for z := beg[2]; z <= end[2]; z++ {
+			for y := beg[1]; y <= end[1]; y++ {
+				spans = append(spans, dvid.Span{z, y, beg[0], end[0]})
+			}
+		}
+	}
+	return spans.Normalize(), nil
+}
+
 // Returns the voxel range normalized to begVoxel offset and constrained by block span.
 func voxelRange(blockSize, begBlock, endBlock, begVoxel, endVoxel int32) (int32, int32) {
 	v0 := begBlock * blockSize
@@ -170,6 +170,37 @@ func TestTuples(t *testing.T) {
 	}
 }
 
+func TestBlockSpans(t *testing.T) {
+	d := &Data{Properties: Properties{BlockSize: dvid.Point3d{32, 32, 32}}}
+	blocks := dvid.IZYXSlice{
+		dvid.ChunkPoint3d{-1, 0, 0}.ToIZYXString(),
+		dvid.ChunkPoint3d{0, 0, 0}.ToIZYXString(),
+		dvid.ChunkPoint3d{1, 0, 0}.ToIZYXString(),
+	}
+	spans, err := d.BlockSpans(blocks, dvid.Point3d{64, 64, 64})
+	if err != nil {
+		t.Fatalf("couldn't get block spans: %v\n", err)
+	}
+	expected := dvid.Spans{
+		{0, 0, -2, 3},
+		{0, 1, -2, 3},
+		{1, 0, -2, 3},
+		{1, 1, -2, 3},
+	}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected spans %v, got %v\n", expected, spans)
+	}
+
+	spans, err = d.BlockSpans(blocks[1:2], dvid.Point3d{16, 16, 16})
+	if err != nil {
+		t.Fatalf("couldn't get block spans: %v\n", err)
+	}
+	expected = dvid.Spans{{0, 0, 0, 0}}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("expected spans %v, got %v\n", expected, spans)
+	}
+}
+
 func TestROIRequests(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -0,0 +1,368 @@
+/*
+	This file supports contrast transforms of grayscale images: window/level, gamma, and
+	contrast-limited adaptive histogram equalization (CLAHE).
+*/
+
+package dvid
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// DefaultCLAHEClipLimit is the CLAHE clip limit, as a multiple of the mean histogram bin
+// count, used if none is given.
+const DefaultCLAHEClipLimit = 2.0
+
+// MaxCLAHERegion is the maximum width in pixels of CLAHE regions.  Applying CLAHE requires
+// reading the regions around an image, so larger regions would require large reads.
+const MaxCLAHERegion = 1024
+
+// claheBins is the number of histogram bins used for CLAHE.  16-bit values are binned
+// and interpolated within each bin.
+const claheBins = 256
+
+// ContrastOptions give the contrast transforms applied to a grayscale image.  Window/level is
+// applied first, then gamma, then CLAHE.  Zero values mean no transform.
+type ContrastOptions struct {
+	// Window is the width of the value range, centered at Level, that is linearly mapped to
+	// the full range of output values.  Values outside the window are clamped.
+	Window float64
+	Level  float64
+
+	// Gamma maps each value v normalized to [0,1] to v^(1/Gamma).
+	Gamma float64
+
+	// CLAHE is the width in pixels of the square regions used for equalization.  Regions
+	// are aligned to a grid anchored at the global origin so adjacent images, e.g., tiles,
+	// are equalized identically.
+	CLAHE int32
+
+	// ClipLimit limits contrast enhancement for CLAHE as a multiple of the mean histogram
+	// bin count.  If zero, DefaultCLAHEClipLimit is used.
+	ClipLimit float64
+}
+
+// ContrastOptionsFromQuery returns contrast options from the query strings "window",
+// "level", "gamma", "clahe", and "cliplimit".
+func ContrastOptionsFromQuery(query url.Values) (opts ContrastOptions, err error) {
+	parse := func(key string) (float64, error) {
+		s := query.Get(key)
+		if s == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad %s %q: %v", key, s, err)
+		}
+		return f, nil
+	}
+	if opts.Window, err = parse("window"); err != nil {
+		return
+	}
+	if opts.Level, err = parse("level"); err != nil {
+		return
+	}
+	if opts.Gamma, err = parse("gamma"); err != nil {
+		return
+	}
+	if opts.ClipLimit, err = parse("cliplimit"); err != nil {
+		return
+	}
+	var clahe float64
+	if clahe, err = parse("clahe"); err != nil {
+		return
+	}
+	opts.CLAHE = int32(clahe)
+	if query.Get("level") != "" && opts.Window == 0 {
+		err = fmt.Errorf("level requires a non-zero window")
+		return
+	}
+	if opts.Window < 0 || opts.Gamma < 0 || opts.CLAHE < 0 || opts.ClipLimit < 0 || float64(opts.CLAHE) != clahe {
+		err = fmt.Errorf("window, gamma, clahe, and cliplimit must be non-negative and clahe an integer")
+		return
+	}
+	if opts.CLAHE > MaxCLAHERegion {
+		err = fmt.Errorf("clahe region width %d exceeds maximum of %d", opts.CLAHE, MaxCLAHERegion)
+	}
+	return
+}
+
+// IsSet returns true if any contrast transform is given.
+func (opts ContrastOptions) IsSet() bool {
+	return opts.Window != 0 || (opts.Gamma != 0 && opts.Gamma != 1) || opts.CLAHE != 0
+}
+
+// claheSize returns the CLAHE region width, limited to MaxCLAHERegion.
+func (opts ContrastOptions) claheSize() int {
+	if opts.CLAHE > MaxCLAHERegion {
+		return MaxCLAHERegion
+	}
+	return int(opts.CLAHE)
+}
+
+// ContextBounds returns the bounds, in the same global 2d coordinates as the given bounds,
+// of the pixels that must be read to apply the contrast options to the given bounds.
+// CLAHE regions wider than MaxCLAHERegion are limited to that width.
+func (opts ContrastOptions) ContextBounds(r image.Rectangle) image.Rectangle {
+	if opts.CLAHE == 0 || r.Empty() {
+		return r
+	}
+	size := opts.claheSize()
+	x0, x1 := claheRegionRange(r.Min.X, r.Max.X, size)
+	y0, y1 := claheRegionRange(r.Min.Y, r.Max.Y, size)
+	return image.Rect(x0*size, y0*size, (x1+1)*size, (y1+1)*size)
+}
+
+// ContextSlice returns the orthogonal slice that must be read to apply the contrast options
+// to the given slice, the global 2d coordinate of the context slice's top left pixel, and
+// the bounds of the given slice in global 2d coordinates.
+func (opts ContrastOptions) ContextSlice(slice Geometry) (context Geometry, offset image.Point, bounds image.Rectangle, err error) {
+	shape := slice.DataShape()
+	start, ok := slice.StartPoint().(Point3d)
+	if !ok || shape.ShapeDimensions() != 2 || shape.dims != 3 {
+		err = fmt.Errorf("contrast context requires a 2d slice in 3d, not %s", slice)
+		return
+	}
+	ax, ay := shape.shape[0], shape.shape[1]
+	w, h := slice.Size().Value(0), slice.Size().Value(1)
+	bounds = image.Rect(int(start[ax]), int(start[ay]), int(start[ax]+w), int(start[ay]+h))
+	ctxBounds := opts.ContextBounds(bounds)
+	ctxStart := start
+	ctxStart[ax] = int32(ctxBounds.Min.X)
+	ctxStart[ay] = int32(ctxBounds.Min.Y)
+	if context, err = NewOrthogSlice(shape, ctxStart, Point2d{int32(ctxBounds.Dx()), int32(ctxBounds.Dy())}); err != nil {
+		return
+	}
+	return context, ctxBounds.Min, bounds, nil
+}
+
+// Contrast returns a new image with the contrast options applied.  See ContrastGoImage.
+func (img *Image) Contrast(opts ContrastOptions, offset image.Point, crop image.Rectangle) (*Image, error) {
+	goImg, err := ContrastGoImage(img.Get(), opts, offset, crop)
+	if err != nil {
+		return nil, err
+	}
+	return ImageFromGoImage(goImg, img.DataFormat, img.Interpolable)
+}
+
+// ContrastGoImage returns a new image of the global bounds crop with the contrast options
+// applied to an 8-bit or 16-bit grayscale image whose top left pixel is at the global 2d
+// offset.  For CLAHE, the given image should include opts.ContextBounds(crop) so results
+// don't depend on the crop; regions outside the image use the nearest regions within it.
+func ContrastGoImage(src image.Image, opts ContrastOptions, offset image.Point, crop image.Rectangle) (image.Image, error) {
+	var vals []uint16
+	var maxVal int
+	srcBounds := src.Bounds()
+	w, h := srcBounds.Dx(), srcBounds.Dy()
+	switch s := src.(type) {
+	case *image.Gray:
+		maxVal = math.MaxUint8
+		vals = make([]uint16, w*h)
+		for y := 0; y < h; y++ {
+			row := s.Pix[y*s.Stride : y*s.Stride+w]
+			for x, v := range row {
+				vals[y*w+x] = uint16(v)
+			}
+		}
+	case *image.Gray16:
+		maxVal = math.MaxUint16
+		vals = make([]uint16, w*h)
+		for y := 0; y < h; y++ {
+			row := s.Pix[y*s.Stride : y*s.Stride+2*w]
+			for x := 0; x < w; x++ {
+				vals[y*w+x] = uint16(row[2*x])<<8 | uint16(row[2*x+1]) // big-endian
+			}
+		}
+	default:
+		return nil, fmt.Errorf("contrast can only be applied to 8-bit or 16-bit grayscale images, not %T", src)
+	}
+	global := image.Rectangle{offset, offset.Add(image.Pt(w, h))}
+	if !crop.In(global) {
+		return nil, fmt.Errorf("contrast crop %s is outside image bounds %s", crop, global)
+	}
+
+	// Apply any window/level and gamma through a lookup table.
+	if lut := contrastLUT(opts, maxVal); lut != nil {
+		for i, v := range vals {
+			vals[i] = lut[v]
+		}
+	}
+
+	// Compute output values within crop.
+	out := make([]uint16, crop.Dx()*crop.Dy())
+	if opts.CLAHE == 0 {
+		for y := crop.Min.Y; y < crop.Max.Y; y++ {
+			srcI := (y-offset.Y)*w + crop.Min.X - offset.X
+			copy(out[(y-crop.Min.Y)*crop.Dx():], vals[srcI:srcI+crop.Dx()])
+		}
+	} else {
+		clahe(vals, w, h, offset, crop, opts, maxVal, out)
+	}
+
+	r := image.Rect(0, 0, crop.Dx(), crop.Dy())
+	if maxVal == math.MaxUint8 {
+		dst := image.NewGray(r)
+		for i, v := range out {
+			dst.Pix[i] = uint8(v)
+		}
+		return dst, nil
+	}
+	dst := image.NewGray16(r)
+	for i, v := range out {
+		dst.Pix[2*i] = uint8(v >> 8)
+		dst.Pix[2*i+1] = uint8(v)
+	}
+	return dst, nil
+}
+
+// contrastLUT returns a lookup table for window/level and gamma or nil if neither is set.
+func contrastLUT(opts ContrastOptions, maxVal int) []uint16 {
+	useGamma := opts.Gamma != 0 && opts.Gamma != 1
+	if opts.Window == 0 && !useGamma {
+		return nil
+	}
+	lut := make([]uint16, maxVal+1)
+	lo := opts.Level - opts.Window/2
+	for v := range lut {
+		f := float64(v) / float64(maxVal)
+		if opts.Window != 0 {
+			f = (float64(v) - lo) / opts.Window
+		}
+		f = math.Max(0, math.Min(1, f))
+		if useGamma {
+			f = math.Pow(f, 1/opts.Gamma)
+		}
+		lut[v] = uint16(math.Floor(f*float64(maxVal) + 0.5))
+	}
+	return lut
+}
+
+// floorDiv returns the floor of a/b for positive b.
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+// claheRegionRange returns the range of CLAHE region indices along one axis needed to
+// interpolate pixels from coordinate x0 to x1 (exclusive).
+func claheRegionRange(x0, x1, size int) (int, int) {
+	// Pixel x is interpolated between regions floor((x + 0.5)/size - 0.5) and the next.
+	return floorDiv(2*x0+1-size, 2*size), floorDiv(2*(x1-1)+1-size, 2*size) + 1
+}
+
+// clahe writes the equalized values of pixels within crop into out, using the region
+// mappings computed from the full image.
+func clahe(vals []uint16, w, h int, offset image.Point, crop image.Rectangle, opts ContrastOptions, maxVal int, out []uint16) {
+	size := opts.claheSize()
+	clipLimit := opts.ClipLimit
+	if clipLimit == 0 {
+		clipLimit = DefaultCLAHEClipLimit
+	}
+	var shift uint
+	if maxVal > math.MaxUint8 {
+		shift = 8
+	}
+	binSize := 1 << shift
+
+	// Compute the cumulative distribution of each region that intersects the image.
+	rx0, ry0 := floorDiv(offset.X, size), floorDiv(offset.Y, size)
+	rx1, ry1 := floorDiv(offset.X+w-1, size), floorDiv(offset.Y+h-1, size)
+	nrx := rx1 - rx0 + 1
+	cdfs := make([][]float64, nrx*(ry1-ry0+1))
+	for ry := ry0; ry <= ry1; ry++ {
+		for rx := rx0; rx <= rx1; rx++ {
+			var hist [claheBins]float64
+			var n float64
+			x0, x1 := rx*size-offset.X, (rx+1)*size-offset.X
+			y0, y1 := ry*size-offset.Y, (ry+1)*size-offset.Y
+			if x0 < 0 {
+				x0 = 0
+			}
+			if y0 < 0 {
+				y0 = 0
+			}
+			if x1 > w {
+				x1 = w
+			}
+			if y1 > h {
+				y1 = h
+			}
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					hist[vals[y*w+x]>>shift]++
+					n++
+				}
+			}
+			cdfs[(ry-ry0)*nrx+rx-rx0] = clippedCDF(hist[:], n, clipLimit)
+		}
+	}
+
+	// Map a value using a region's distribution.
+	mapValue := func(rx, ry int, v uint16) float64 {
+		if rx < rx0 {
+			rx = rx0
+		} else if rx > rx1 {
+			rx = rx1
+		}
+		if ry < ry0 {
+			ry = ry0
+		} else if ry > ry1 {
+			ry = ry1
+		}
+		cdf := cdfs[(ry-ry0)*nrx+rx-rx0]
+		if cdf == nil {
+			return float64(v)
+		}
+		b := int(v >> shift)
+		frac := float64(int(v)&(binSize-1)+1) / float64(binSize)
+		return (cdf[b] + frac*(cdf[b+1]-cdf[b])) * float64(maxVal)
+	}
+
+	// Bilinearly interpolate the mappings of the four nearest regions.
+	i := 0
+	for gy := crop.Min.Y; gy < crop.Max.Y; gy++ {
+		fy := (float64(gy)+0.5)/float64(size) - 0.5
+		ry := int(math.Floor(fy))
+		ty := fy - float64(ry)
+		for gx := crop.Min.X; gx < crop.Max.X; gx++ {
+			fx := (float64(gx)+0.5)/float64(size) - 0.5
+			rx := int(math.Floor(fx))
+			tx := fx - float64(rx)
+			v := vals[(gy-offset.Y)*w+gx-offset.X]
+			top := (1-tx)*mapValue(rx, ry, v) + tx*mapValue(rx+1, ry, v)
+			bottom := (1-tx)*mapValue(rx, ry+1, v) + tx*mapValue(rx+1, ry+1, v)
+			mapped := math.Floor((1-ty)*top + ty*bottom + 0.5)
+			out[i] = uint16(math.Max(0, math.Min(float64(maxVal), mapped)))
+			i++
+		}
+	}
+}
+
+// clippedCDF returns the cumulative distribution, with len(hist)+1 entries starting at 0,
+// of a histogram after clipping bins to the clip limit and redistributing the excess
+// uniformly.  Returns nil for an empty histogram.
+func clippedCDF(hist []float64, n, clipLimit float64) []float64 {
+	if n == 0 {
+		return nil
+	}
+	limit := math.Max(1, clipLimit*n/float64(len(hist)))
+	var excess float64
+	for b, count := range hist {
+		if count > limit {
+			excess += count - limit
+			hist[b] = limit
+		}
+	}
+	redist := excess / float64(len(hist))
+	cdf := make([]float64, len(hist)+1)
+	for b, count := range hist {
+		cdf[b+1] = cdf[b] + (count+redist)/n
+	}
+	return cdf
+}
@@ -0,0 +1,100 @@
+package dvid
+
+import (
+	"image"
+	"net/url"
+	"testing"
+)
+
+func TestContrastWindowGamma(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 4, 1))
+	copy(src.Pix, []uint8{10, 50, 100, 200})
+
+	opts := ContrastOptions{Window: 100, Level: 100}
+	out, err := ContrastGoImage(src, opts, image.Point{}, src.Bounds())
+	if err != nil {
+		t.Fatalf("error on window/level: %v\n", err)
+	}
+	expected := []uint8{0, 0, 128, 255}
+	if got := out.(*image.Gray).Pix; string(got) != string(expected) {
+		t.Errorf("expected window/level %v, got %v\n", expected, got)
+	}
+
+	opts = ContrastOptions{Gamma: 2}
+	out, err = ContrastGoImage(src, opts, image.Point{}, image.Rect(1, 0, 3, 1))
+	if err != nil {
+		t.Fatalf("error on gamma: %v\n", err)
+	}
+	expected = []uint8{113, 160} // 255 * sqrt(v/255)
+	if got := out.(*image.Gray).Pix; string(got) != string(expected) {
+		t.Errorf("expected cropped gamma %v, got %v\n", expected, got)
+	}
+
+	if _, err := ContrastGoImage(image.NewRGBA(src.Bounds()), opts, image.Point{}, src.Bounds()); err == nil {
+		t.Errorf("expected error on contrast of color image\n")
+	}
+}
+
+func TestCLAHETileConsistency(t *testing.T) {
+	// Make a 256x256 image with a gradient and repeatable noise.
+	full := image.NewGray(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		copy(full.Pix[y*full.Stride:], makeSlice(Point3d{0, int32(y), 7}, Point2d{256, 1}))
+		for x := 0; x < 256; x++ {
+			full.Pix[y*full.Stride+x] = full.Pix[y*full.Stride+x]/4 + uint8(x/2)
+		}
+	}
+	opts := ContrastOptions{CLAHE: 32, Window: 200, Level: 110}
+	whole, err := ContrastGoImage(full, opts, image.Point{}, full.Bounds())
+	if err != nil {
+		t.Fatalf("error on CLAHE: %v\n", err)
+	}
+	wholeGray := whole.(*image.Gray)
+
+	// Each tile computed from just its context should match the whole image.
+	for _, tile := range []image.Rectangle{image.Rect(64, 64, 128, 128), image.Rect(70, 90, 134, 154)} {
+		ctx := opts.ContextBounds(tile)
+		if !ctx.In(full.Bounds()) {
+			t.Fatalf("tile %s context %s is outside test image\n", tile, ctx)
+		}
+		sub := full.SubImage(ctx)
+		out, err := ContrastGoImage(sub, opts, ctx.Min, tile)
+		if err != nil {
+			t.Fatalf("error on CLAHE of tile %s: %v\n", tile, err)
+		}
+		outGray := out.(*image.Gray)
+		for y := 0; y < tile.Dy(); y++ {
+			for x := 0; x < tile.Dx(); x++ {
+				if outGray.GrayAt(x, y) != wholeGray.GrayAt(tile.Min.X+x, tile.Min.Y+y) {
+					t.Fatalf("tile %s differs from whole image at (%d,%d)\n", tile, x, y)
+				}
+			}
+		}
+	}
+
+	ctx := opts.ContextBounds(image.Rect(-10, 0, 10, 32))
+	if expected := image.Rect(-32, -32, 32, 64); ctx != expected {
+		t.Errorf("expected context bounds %s, got %s\n", expected, ctx)
+	}
+}
+
+func TestContrastOptionsFromQuery(t *testing.T) {
+	query, _ := url.ParseQuery("window=100&level=50&gamma=1.5&clahe=64")
+	opts, err := ContrastOptionsFromQuery(query)
+	if err != nil {
+		t.Fatalf("error parsing contrast options: %v\n", err)
+	}
+	expected := ContrastOptions{Window: 100, Level: 50, Gamma: 1.5, CLAHE: 64}
+	if opts != expected || !opts.IsSet() {
+		t.Errorf("expected %v, got %v\n", expected, opts)
+	}
+	for _, bad := range []string{"level=30", "clahe=10.5", "clahe=4096", "gamma=-1", "window=abc"} {
+		query, _ = url.ParseQuery(bad)
+		if _, err := ContrastOptionsFromQuery(query); err == nil {
+			t.Errorf("expected error for contrast query %q\n", bad)
+		}
+	}
+	if opts, _ := ContrastOptionsFromQuery(url.Values{}); opts.IsSet() {
+		t.Errorf("expected no contrast options for empty query\n")
+	}
+}
@@ -1534,6 +1534,21 @@ func (vol *SparseVol) SurfaceSerialization(blockNz int32, res NdFloat32) ([]byte
 	return data, nil
 }
 
+// SparseVolSurface returns the surface serialization described in SurfaceSerialization
+// given a sparse volume encoding, e.g., as returned by the sparsevol endpoints.  The RLEs
+// of the encoding can be in any order, e.g., ordered by block, since they are sorted in
+// ZYX order before computing the surface.
+func SparseVolSurface(encoding []byte, blockNz int32, res NdFloat32) ([]byte, error) {
+	rles, err := ReadRLEs(bytes.NewReader(encoding))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(rles)
+	var vol SparseVol
+	vol.AddRLE(rles)
+	return vol.SurfaceSerialization(blockNz, res)
+}
+
 // BinaryVolume holds 3d binary data including a 3d offset.
 type BinaryVolume struct {
 	offset      Point3d
@@ -1,6 +1,8 @@
 package dvid
 
 import (
+	"encoding/binary"
+	"math"
 	"reflect"
 	"testing"
 
@@ -82,6 +84,46 @@ func (s *VolumeTest) TestSparseVol(c *C) {
 	c.Assert(vol.MaximumPoint3d(), Equals, Point3d{51, 44, 54})
 }
 
+func TestSparseVolSurface(t *testing.T) {
+	// 3x3x3 cube with RLEs in reverse order.
+	var rles RLEs
+	for z := int32(32); z >= 30; z-- {
+		for y := int32(22); y >= 20; y-- {
+			rles = append(rles, RLE{Point3d{10, y, z}, 3})
+		}
+	}
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoding := make([]byte, 12, 12+len(rleBytes))
+	encoding[0] = EncodingBinary
+	encoding[1] = 3
+	binary.LittleEndian.PutUint32(encoding[8:12], uint32(len(rles)))
+	encoding = append(encoding, rleBytes...)
+
+	surface, err := SparseVolSurface(encoding, 2, NdFloat32{8, 8, 8})
+	if err != nil {
+		t.Fatalf("error computing surface: %v\n", err)
+	}
+	numVoxels := binary.LittleEndian.Uint32(surface[0:4])
+	if numVoxels != 26 {
+		t.Errorf("expected 26 surface voxels for 3x3x3 cube, got %d\n", numVoxels)
+	}
+	if len(surface) != 4+int(numVoxels)*24 {
+		t.Errorf("expected surface serialization of %d bytes, got %d\n", 4+numVoxels*24, len(surface))
+	}
+	for i := uint32(0); i < numVoxels; i++ {
+		pos := 4 + i*12
+		x := math.Float32frombits(binary.LittleEndian.Uint32(surface[pos : pos+4]))
+		y := math.Float32frombits(binary.LittleEndian.Uint32(surface[pos+4 : pos+8]))
+		z := math.Float32frombits(binary.LittleEndian.Uint32(surface[pos+8 : pos+12]))
+		if x == 11 && y == 21 && z == 31 {
+			t.Errorf("center voxel of cube should not be a surface voxel\n")
+		}
+	}
+}
+
 func TestNormalization(t *testing.T) {
 	norm := denormRLEs.Normalize()
 	if !reflect.DeepEqual(norm, expectedNorm) {
@@ -0,0 +1,567 @@
+/*
+	This file implements per-client rate limiting and weighted fair queuing of data instance
+	requests.  Clients are identified by a client header, a "u" query string, a bearer token,
+	or their IP address, and each request falls into an "interactive" or "batch" class.  When
+	the server is at its concurrency limit, waiting requests are dispatched in proportion to
+	their class weights and round-robin across clients within a class, so a single batch job
+	cannot starve interactive users.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+const (
+	// ClientHeader is the HTTP header that can be used to identify a client for rate limiting.
+	ClientHeader = "X-DVID-Client"
+
+	// ClassHeader is the HTTP header that can be set to "batch" to mark a request as batch.
+	ClassHeader = "X-DVID-Class"
+
+	// clientIdleTime is how long a client must be idle before its state is discarded.
+	clientIdleTime = time.Minute
+)
+
+// rateLimitConfig holds the [server.ratelimit] settings of the TOML configuration.  The same
+// keys can be POSTed to /api/server/settings under a "ratelimit" key.  Zero values disable
+// the corresponding limit.
+type rateLimitConfig struct {
+	MaxConcurrent     int      `toml:"max_concurrent" json:"max_concurrent"`         // total running requests
+	MaxQueued         int      `toml:"max_queued" json:"max_queued"`                 // total waiting requests
+	ClientConcurrent  int      `toml:"client_concurrent" json:"client_concurrent"`   // running requests per client
+	ClientRate        float64  `toml:"client_rate" json:"client_rate"`               // requests/sec per client
+	ClientBurst       int      `toml:"client_burst" json:"client_burst"`             // bucket size per client
+	InteractiveWeight int      `toml:"interactive_weight" json:"interactive_weight"` // default 4
+	BatchWeight       int      `toml:"batch_weight" json:"batch_weight"`             // default 1
+	BatchClients      []string `toml:"batch_clients" json:"batch_clients"`           // always batch class
+}
+
+func (c rateLimitConfig) enabled() bool {
+	return c.MaxConcurrent > 0 || c.ClientConcurrent > 0 || c.ClientRate > 0
+}
+
+type requestClass uint8
+
+const (
+	classInteractive requestClass = iota
+	classBatch
+	numClasses
+)
+
+func (c requestClass) String() string {
+	if c == classBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// rateLimitError is returned when a client has exceeded its request rate.
+type rateLimitError struct {
+	client     string
+	retryAfter time.Duration
+}
+
+func (e rateLimitError) Error() string {
+	return fmt.Sprintf("client %q exceeded its request rate, retry after %s", e.client, e.retryAfter)
+}
+
+// queueFullError is returned when the maximum number of requests are already waiting.
+type queueFullError struct {
+	maxQueued int
+}
+
+func (e queueFullError) Error() string {
+	return fmt.Sprintf("server already has maximum of %d requests waiting", e.maxQueued)
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+type clientState struct {
+	tokens   float64
+	lastFill time.Time
+	lastSeen time.Time
+	active   int
+	waiting  [numClasses][]*waiter
+	served   uint64
+	rejected uint64
+}
+
+func (cs *clientState) numWaiting() int {
+	var n int
+	for _, q := range cs.waiting {
+		n += len(q)
+	}
+	return n
+}
+
+// refill adds tokens to the client's bucket for the time since the last refill.
+func (cs *clientState) refill(now time.Time, rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	cs.tokens += now.Sub(cs.lastFill).Seconds() * rate
+	if cs.tokens > float64(burst) {
+		cs.tokens = float64(burst)
+	}
+	cs.lastFill = now
+}
+
+type classQueue struct {
+	clients []string // clients with waiting requests in round-robin order
+	next    int
+	waiting int
+	active  int
+	served  uint64
+	vtime   float64 // virtual finish time for weighted fair queuing
+}
+
+func (q *classQueue) removeClient(i int) {
+	q.clients = append(q.clients[:i], q.clients[i+1:]...)
+	if i < q.next {
+		q.next--
+	}
+	if q.next >= len(q.clients) {
+		q.next = 0
+	}
+}
+
+type rateLimiter struct {
+	sync.Mutex
+	cfg       rateLimitConfig
+	batch     map[string]struct{}
+	active    int
+	waiting   int
+	vclock    float64
+	classes   [numClasses]classQueue
+	clients   map[string]*clientState
+	lastPrune time.Time
+
+	// changed is broadcast whenever requests are queued, started, or finished.
+	changed *sync.Cond
+}
+
+var limiter = newRateLimiter()
+
+func newRateLimiter() *rateLimiter {
+	l := &rateLimiter{
+		clients: make(map[string]*clientState),
+	}
+	l.changed = sync.NewCond(&l.Mutex)
+	l.setConfig(rateLimitConfig{})
+	return l
+}
+
+// setRateLimits changes the rate limiting configuration, immediately dispatching any
+// waiting requests allowed by the new limits.
+func setRateLimits(cfg rateLimitConfig) {
+	limiter.setConfig(cfg)
+}
+
+func (l *rateLimiter) setConfig(cfg rateLimitConfig) {
+	if cfg.InteractiveWeight <= 0 {
+		cfg.InteractiveWeight = 4
+	}
+	if cfg.BatchWeight <= 0 {
+		cfg.BatchWeight = 1
+	}
+	l.Lock()
+	l.cfg = cfg
+	l.batch = make(map[string]struct{}, len(cfg.BatchClients))
+	for _, client := range cfg.BatchClients {
+		l.batch[client] = struct{}{}
+	}
+	l.dispatch()
+	l.Unlock()
+}
+
+func (l *rateLimiter) config() rateLimitConfig {
+	l.Lock()
+	defer l.Unlock()
+	return l.cfg
+}
+
+func (l *rateLimiter) weight(class requestClass) float64 {
+	if class == classBatch {
+		return float64(l.cfg.BatchWeight)
+	}
+	return float64(l.cfg.InteractiveWeight)
+}
+
+// classify returns the class of a request, which is batch if requested or if the client
+// is configured as a batch client.
+func (l *rateLimiter) classify(client string, batch bool) requestClass {
+	if batch {
+		return classBatch
+	}
+	l.Lock()
+	_, found := l.batch[client]
+	l.Unlock()
+	if found {
+		return classBatch
+	}
+	return classInteractive
+}
+
+func (l *rateLimiter) client(id string, now time.Time) *clientState {
+	cs, found := l.clients[id]
+	if !found {
+		cs = &clientState{
+			tokens:   float64(l.cfg.ClientBurst),
+			lastFill: now,
+		}
+		if cs.tokens < 1 {
+			cs.tokens = 1
+		}
+		l.clients[id] = cs
+	}
+	cs.lastSeen = now
+	return cs
+}
+
+// prune removes state for clients that have been idle, at most once per idle period.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < clientIdleTime {
+		return
+	}
+	l.lastPrune = now
+	for id, cs := range l.clients {
+		if cs.active == 0 && cs.numWaiting() == 0 && now.Sub(cs.lastSeen) > clientIdleTime {
+			delete(l.clients, id)
+		}
+	}
+}
+
+func (l *rateLimiter) canRun(cs *clientState) bool {
+	if l.cfg.MaxConcurrent > 0 && l.active >= l.cfg.MaxConcurrent {
+		return false
+	}
+	return l.cfg.ClientConcurrent <= 0 || cs.active < l.cfg.ClientConcurrent
+}
+
+func (l *rateLimiter) start(cs *clientState, class requestClass) {
+	l.active++
+	l.classes[class].active++
+	l.classes[class].served++
+	cs.active++
+	cs.served++
+	l.changed.Broadcast()
+}
+
+// acquire admits a request from the given client, waiting if necessary until the request
+// can run under the concurrency limits or the context is done.  The returned function must
+// be called when the request completes.
+func (l *rateLimiter) acquire(ctx context.Context, client string, class requestClass) (func(), error) {
+	l.Lock()
+	if !l.cfg.enabled() {
+		l.Unlock()
+		return func() {}, nil
+	}
+	now := time.Now()
+	l.prune(now)
+	cs := l.client(client, now)
+	if l.cfg.ClientRate > 0 {
+		cs.refill(now, l.cfg.ClientRate, l.cfg.ClientBurst)
+		if cs.tokens < 1 {
+			cs.rejected++
+			retry := time.Duration((1 - cs.tokens) / l.cfg.ClientRate * float64(time.Second))
+			l.Unlock()
+			return nil, rateLimitError{client: client, retryAfter: retry}
+		}
+		cs.tokens--
+	}
+	release := func() { l.release(client, class) }
+	if l.canRun(cs) {
+		l.start(cs, class)
+		l.Unlock()
+		return release, nil
+	}
+	if l.cfg.MaxQueued > 0 && l.waiting >= l.cfg.MaxQueued {
+		cs.rejected++
+		l.Unlock()
+		return nil, queueFullError{l.cfg.MaxQueued}
+	}
+
+	// Queue the request.  A class that was idle starts at the current virtual clock so it
+	// cannot claim credit for the time it had no waiting requests.
+	w := &waiter{ready: make(chan struct{})}
+	q := &l.classes[class]
+	if q.waiting == 0 && q.vtime < l.vclock {
+		q.vtime = l.vclock
+	}
+	if len(cs.waiting[class]) == 0 {
+		q.clients = append(q.clients, client)
+	}
+	cs.waiting[class] = append(cs.waiting[class], w)
+	q.waiting++
+	l.waiting++
+	l.changed.Broadcast()
+	l.Unlock()
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		l.Lock()
+		if w.granted {
+			l.Unlock()
+			release()
+			return nil, ctx.Err()
+		}
+		l.removeWaiter(client, class, w)
+		l.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (l *rateLimiter) removeWaiter(client string, class requestClass, w *waiter) {
+	cs := l.clients[client]
+	waiters := cs.waiting[class]
+	for i, cw := range waiters {
+		if cw == w {
+			cs.waiting[class] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	q := &l.classes[class]
+	q.waiting--
+	l.waiting--
+	if len(cs.waiting[class]) == 0 {
+		for i, id := range q.clients {
+			if id == client {
+				q.removeClient(i)
+				break
+			}
+		}
+	}
+	l.changed.Broadcast()
+}
+
+func (l *rateLimiter) release(client string, class requestClass) {
+	l.Lock()
+	l.active--
+	l.classes[class].active--
+	if cs, found := l.clients[client]; found {
+		cs.active--
+		cs.lastSeen = time.Now()
+	}
+	l.dispatch()
+	l.changed.Broadcast()
+	l.Unlock()
+}
+
+// nextClient returns the index of the next client in round-robin order that has a waiting
+// request in the class and is under its concurrency limit, or -1 if there is none.
+func (l *rateLimiter) nextClient(class requestClass) int {
+	q := &l.classes[class]
+	for n := 0; n < len(q.clients); n++ {
+		i := (q.next + n) % len(q.clients)
+		if l.canRun(l.clients[q.clients[i]]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// dispatch starts waiting requests while there is capacity, choosing among classes by
+// least virtual finish time.  Must be called with the limiter locked.
+func (l *rateLimiter) dispatch() {
+	for l.waiting > 0 && (l.cfg.MaxConcurrent <= 0 || l.active < l.cfg.MaxConcurrent) {
+		var class requestClass
+		clientIndex := -1
+		for c := requestClass(0); c < numClasses; c++ {
+			if l.classes[c].waiting == 0 {
+				continue
+			}
+			i := l.nextClient(c)
+			if i < 0 {
+				continue
+			}
+			if clientIndex < 0 || l.classes[c].vtime < l.classes[class].vtime {
+				class, clientIndex = c, i
+			}
+		}
+		if clientIndex < 0 {
+			return
+		}
+
+		q := &l.classes[class]
+		client := q.clients[clientIndex]
+		cs := l.clients[client]
+		w := cs.waiting[class][0]
+		cs.waiting[class] = cs.waiting[class][1:]
+		q.waiting--
+		l.waiting--
+		if len(cs.waiting[class]) == 0 {
+			q.removeClient(clientIndex)
+			q.next = clientIndex
+			if q.next >= len(q.clients) {
+				q.next = 0
+			}
+		} else {
+			q.next = (clientIndex + 1) % len(q.clients)
+		}
+		q.vtime += 1 / l.weight(class)
+		l.vclock = q.vtime
+
+		w.granted = true
+		close(w.ready)
+		l.start(cs, class)
+	}
+}
+
+type classInfo struct {
+	Weight  int
+	Active  int
+	Waiting int
+	Served  uint64
+}
+
+type clientInfo struct {
+	Active   int
+	Waiting  map[string]int
+	Served   uint64
+	Rejected uint64
+}
+
+type queueInfo struct {
+	Config  rateLimitConfig
+	Active  int
+	Waiting int
+	Classes map[string]classInfo
+	Clients map[string]clientInfo
+}
+
+// state returns a snapshot of the current queue state.
+func (l *rateLimiter) state() queueInfo {
+	l.Lock()
+	defer l.Unlock()
+	return l.stateLocked()
+}
+
+// stateLocked returns a snapshot of the queue state.  Must be called with the limiter locked.
+func (l *rateLimiter) stateLocked() queueInfo {
+	info := queueInfo{
+		Config:  l.cfg,
+		Active:  l.active,
+		Waiting: l.waiting,
+		Classes: make(map[string]classInfo, numClasses),
+		Clients: make(map[string]clientInfo, len(l.clients)),
+	}
+	for c := requestClass(0); c < numClasses; c++ {
+		q := l.classes[c]
+		info.Classes[c.String()] = classInfo{
+			Weight:  int(l.weight(c)),
+			Active:  q.active,
+			Waiting: q.waiting,
+			Served:  q.served,
+		}
+	}
+	for id, cs := range l.clients {
+		ci := clientInfo{
+			Active:   cs.active,
+			Waiting:  make(map[string]int),
+			Served:   cs.served,
+			Rejected: cs.rejected,
+		}
+		for c := requestClass(0); c < numClasses; c++ {
+			if n := len(cs.waiting[c]); n != 0 {
+				ci.Waiting[c.String()] = n
+			}
+		}
+		info.Clients[id] = ci
+	}
+	return info
+}
+
+// requestClient returns the identity of the client making a request for rate limiting.
+// In order of precedence, this is the client header, the "u" query string, a hash of any
+// bearer token, or the remote IP address.
+func requestClient(r *http.Request) string {
+	if client := r.Header.Get(ClientHeader); client != "" {
+		return client
+	}
+	if user := r.URL.Query().Get("u"); user != "" {
+		return user
+	}
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		h := fnv.New32a()
+		h.Write([]byte(strings.TrimPrefix(auth, "Bearer ")))
+		return fmt.Sprintf("token-%08x", h.Sum32())
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// admitRequest waits until a data instance request can proceed under rate limiting.  The
+// returned function must be called when the request completes.  If the request cannot be
+// admitted, an error response is written and a nil function is returned.
+func admitRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, batch bool) func() {
+	client := requestClient(r)
+	if r.Header.Get(ClassHeader) == "batch" {
+		batch = true
+	}
+	release, err := limiter.acquire(ctx, client, limiter.classify(client, batch))
+	if err == nil {
+		return release
+	}
+	switch e := err.(type) {
+	case rateLimitError:
+		secs := int(e.retryAfter/time.Second) + 1
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", secs))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case queueFullError:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		// Client disconnected or request timed out while waiting.
+		dvid.Infof("HTTP %s %s from client %q abandoned while queued: %v\n", r.Method, r.URL, client, err)
+		http.Error(w, fmt.Sprintf("request abandoned while queued: %v", err), http.StatusServiceUnavailable)
+	}
+	return nil
+}
+
+// updateRateLimits applies a JSON object of rate limit settings on top of the current
+// configuration.
+func updateRateLimits(settings interface{}) (old, cur rateLimitConfig, err error) {
+	old = limiter.config()
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return
+	}
+	cur = old
+	cur.BatchClients = append([]string{}, old.BatchClients...)
+	if err = json.Unmarshal(data, &cur); err != nil {
+		return
+	}
+	setRateLimits(cur)
+	cur = limiter.config()
+	return
+}
+
+func serverQueueHandler(w http.ResponseWriter, r *http.Request) {
+	m, err := json.Marshal(limiter.state())
+	if err != nil {
+		BadRequest(w, r, fmt.Sprintf("Cannot marshal JSON queue state: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(m)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForState blocks until the limiter's queue state satisfies the given condition.
+func waitForState(l *rateLimiter, cond func(queueInfo) bool) {
+	l.Lock()
+	defer l.Unlock()
+	for !cond(l.stateLocked()) {
+		l.changed.Wait()
+	}
+}
+
+// queueWaiter acquires from the limiter in the background, sending its label when admitted and
+// releasing when done is closed.
+func queueWaiter(t *testing.T, l *rateLimiter, client string, class requestClass, label string, admitted chan string) chan struct{} {
+	done := make(chan struct{})
+	before := l.state().Waiting
+	go func() {
+		release, err := l.acquire(context.Background(), client, class)
+		if err != nil {
+			t.Errorf("unexpected error acquiring for %s: %v\n", label, err)
+			return
+		}
+		admitted <- label
+		<-done
+		release()
+	}()
+	waitForState(l, func(state queueInfo) bool { return state.Waiting > before })
+	return done
+}
+
+func TestFairQueuing(t *testing.T) {
+	l := newRateLimiter()
+	l.setConfig(rateLimitConfig{MaxConcurrent: 1, InteractiveWeight: 2, BatchWeight: 1})
+
+	release, err := l.acquire(context.Background(), "holder", classInteractive)
+	if err != nil {
+		t.Fatalf("couldn't acquire initial request: %v\n", err)
+	}
+
+	admitted := make(chan string)
+	done := make(map[string]chan struct{})
+	for i := 1; i <= 3; i++ {
+		label := fmt.Sprintf("bulk%d", i)
+		done[label] = queueWaiter(t, l, "bulk", classBatch, label, admitted)
+	}
+	for i := 1; i <= 3; i++ {
+		for _, client := range []string{"a", "b"} {
+			label := fmt.Sprintf("%s%d", client, i)
+			done[label] = queueWaiter(t, l, client, classInteractive, label, admitted)
+		}
+	}
+	state := l.state()
+	if state.Active != 1 || state.Waiting != 9 || state.Classes["batch"].Waiting != 3 || state.Clients["a"].Waiting["interactive"] != 3 {
+		t.Fatalf("bad queue state: %+v\n", state)
+	}
+
+	expected := []string{"a1", "bulk1", "b1", "a2", "bulk2", "b2", "a3", "bulk3", "b3"}
+	release()
+	for i, expect := range expected {
+		got := <-admitted
+		if got != expect {
+			t.Fatalf("expected request %d admitted to be %s, got %s\n", i, expect, got)
+		}
+		close(done[got])
+	}
+
+	waitForState(l, func(state queueInfo) bool { return state.Active == 0 })
+	state = l.state()
+	if state.Active != 0 || state.Waiting != 0 || state.Classes["interactive"].Served != 7 || state.Clients["bulk"].Served != 3 {
+		t.Errorf("bad final queue state: %+v\n", state)
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	l := newRateLimiter()
+	l.setConfig(rateLimitConfig{ClientRate: 0.01, ClientBurst: 2, ClientConcurrent: 1, MaxQueued: 1})
+
+	release, err := l.acquire(context.Background(), "a", classInteractive)
+	if err != nil {
+		t.Fatalf("couldn't acquire first request: %v\n", err)
+	}
+
+	// Second request from same client waits until its context is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "a", classInteractive); err != context.DeadlineExceeded {
+		t.Fatalf("expected queued request to time out, got %v\n", err)
+	}
+	if state := l.state(); state.Waiting != 0 || state.Clients["a"].Active != 1 {
+		t.Fatalf("abandoned request not removed from queue: %+v\n", state)
+	}
+
+	// Third request exceeds the burst for the client.
+	_, err = l.acquire(context.Background(), "a", classInteractive)
+	if rerr, ok := err.(rateLimitError); !ok || rerr.retryAfter <= 0 {
+		t.Fatalf("expected rate limit error, got %v\n", err)
+	}
+
+	// Other clients are unaffected.
+	releaseB, err := l.acquire(context.Background(), "b", classBatch)
+	if err != nil {
+		t.Fatalf("couldn't acquire request for other client: %v\n", err)
+	}
+	releaseB()
+	release()
+
+	// Queue limit is enforced across clients.
+	l.setConfig(rateLimitConfig{MaxConcurrent: 1, MaxQueued: 1})
+	release, err = l.acquire(context.Background(), "a", classInteractive)
+	if err != nil {
+		t.Fatalf("couldn't acquire request: %v\n", err)
+	}
+	admitted := make(chan string)
+	done := queueWaiter(t, l, "b", classInteractive, "b1", admitted)
+	if _, err = l.acquire(context.Background(), "c", classBatch); err == nil {
+		t.Fatalf("expected full queue error\n")
+	} else if _, ok := err.(queueFullError); !ok {
+		t.Fatalf("expected full queue error, got %v\n", err)
+	}
+	release()
+	if got := <-admitted; got != "b1" {
+		t.Errorf("expected b1 to be admitted, got %s\n", got)
+	}
+	close(done)
+}
+
+func TestRequestClient(t *testing.T) {
+	tests := []struct {
+		header map[string]string
+		url    string
+		client string
+	}{
+		{map[string]string{ClientHeader: "neutu-alice"}, "/api/node/abc/seg/raw?u=bob", "neutu-alice"},
+		{nil, "/api/node/abc/seg/raw?u=bob", "bob"},
+		{map[string]string{"Authorization": "Bearer sometoken"}, "/api/node/abc/seg/raw", ""},
+		{nil, "/api/node/abc/seg/raw", "10.0.0.5"},
+	}
+	for _, test := range tests {
+		r, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = "10.0.0.5:34567"
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		client := requestClient(r)
+		if test.client == "" {
+			if !strings.HasPrefix(client, "token-") || strings.Contains(client, "sometoken") {
+				t.Errorf("expected hashed token client, got %q\n", client)
+			}
+		} else if client != test.client {
+			t.Errorf("expected client %q for %s, got %q\n", test.client, test.url, client)
+		}
+	}
+}
+
+func TestRateLimitSettings(t *testing.T) {
+	if err := OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer CloseTest()
+
+	payload := bytes.NewBufferString(`{"ratelimit": {"max_concurrent": 8, "batch_clients": ["ingest-bot"]}}`)
+	TestHTTP(t, "POST", WebAPIPath+"server/settings", payload)
+	payload = bytes.NewBufferString(`{"ratelimit": {"client_rate": 25.5}}`)
+	TestHTTP(t, "POST", WebAPIPath+"server/settings", payload)
+
+	r := TestHTTP(t, "GET", WebAPIPath+"server/queue", nil)
+	var state queueInfo
+	if err := json.Unmarshal(r, &state); err != nil {
+		t.Fatalf("couldn't decode queue state %s: %v\n", string(r), err)
+	}
+	cfg := state.Config
+	if cfg.MaxConcurrent != 8 || cfg.ClientRate != 25.5 || len(cfg.BatchClients) != 1 || cfg.InteractiveWeight != 4 {
+		t.Errorf("bad rate limit config after settings: %+v\n", cfg)
+	}
+	if limiter.classify("ingest-bot", false) != classBatch || limiter.classify("alice", false) != classInteractive {
+		t.Errorf("bad classification of clients\n")
+	}
+	if _, found := state.Classes["batch"]; !found {
+		t.Errorf("expected batch class in queue state: %s\n", string(r))
+	}
+	setRateLimits(rateLimitConfig{})
+}
@@ -7,6 +7,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -24,6 +25,18 @@ Commands executed on the server (rpc address = %s):
 	help
 	shutdown
 
+	backup <directory>
+
+		Starts an online backup of all stores into the given server-side directory, which
+		must not exist or be empty.  Consistent snapshots of the stores are taken before
+		the command returns and are then written in the background while the server keeps
+		serving requests.  A manifest.json recording the repo versions covered is written
+		when the backup is complete.  Restore with the local "dvid restore" command.
+
+	backup status
+
+		Shows the state of the current or most recent backup.
+
 	repos new  <alias> <description> <settings...>
 		where <settings> are optional "key=value" strings:
 		
@@ -124,6 +137,35 @@ EXPERIMENTAL COMMANDS
 			A transmit "branch" will send just the ancestor path of the
 			version specified.
 
+	repo <UUID> export <server-side file> <settings...>
+
+        Writes the repo to a self-describing archive file holding the version DAG,
+		data instance configurations, and key-values, so the repo can be moved to
+		another server on disk.  Import it with "repos import".  The optional
+		"key=value" <settings> are the same as for push:
+
+		data=<data1>[,<data2>[,<data3>...]]
+
+			If supplied, the archive will be limited to the listed data instance names.
+
+		filter=<filter0>/<filter1>/...
+
+			Separate filters by the forward slash.  See datatype help
+            for the types of filters they will use for pushes.
+
+		transmit=[all | branch | flatten]
+
+			The default transmit "all" exports all versions of the repo.
+			A transmit "branch" exports the ancestor path of the version specified.
+			A transmit "flatten" exports just the version specified with the
+			key/values flattened so there is no history.
+
+	repos import <server-side file>
+
+		Adds a repo from an archive written by "repo <UUID> export".  Data instance
+		and version ids are remapped to new local ids while version UUIDs are kept,
+		so the repo must not already exist on this server.
+
 	repo <UUID> merge <UUID> [, <UUID>, ...]
 
 		This requires all UUIDs to be committed and generates a new
@@ -192,6 +234,22 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 		// launch goroutine shutdown so we can concurrently return shutdown message to client.
 		go Shutdown()
 
+	case "backup":
+		var dir string
+		cmd.CommandArgs(1, &dir)
+		if dir == "status" {
+			var status []byte
+			if status, err = json.MarshalIndent(datastore.GetBackupStatus(), "", "    "); err != nil {
+				return
+			}
+			reply.Text = string(status) + "\n"
+			return
+		}
+		if err = datastore.Backup(dir); err != nil {
+			return
+		}
+		reply.Text = fmt.Sprintf("Started backup to %s.  Use 'dvid backup status' to monitor progress.\n", dir)
+
 	case "types":
 		if len(cmd.Command) == 1 {
 			text := "\nData Types within this DVID Server\n"
@@ -257,6 +315,15 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 			}
 			reply.Text = fmt.Sprintf("New repo %q created with head node %s\n", alias, root)
 
+		case "import":
+			var filename string
+			cmd.CommandArgs(2, &filename)
+			var root dvid.UUID
+			if root, err = datastore.ImportRepo(filename); err != nil {
+				return
+			}
+			reply.Text = fmt.Sprintf("Imported repo with root %s from %q\n", root, filename)
+
 		case "delete":
 			// Apply a global lock (if relevant) and reloads meta
 			if err = datastore.MetadataUniversalLock(); err != nil {
@@ -443,6 +510,17 @@ func handleCommand(cmd *datastore.Request) (reply *datastore.Response, err error
 			}()
 			reply.Text = fmt.Sprintf("Started push of repo %s to %q...\n", uuid, target)
 
+		case "export":
+			var filename string
+			cmd.CommandArgs(3, &filename)
+			config := cmd.Settings()
+			go func() {
+				if err = datastore.ExportRepo(uuid, filename, config); err != nil {
+					dvid.Errorf("export error: %v\n", err)
+				}
+			}()
+			reply.Text = fmt.Sprintf("Started export of repo %s to %q...\n", uuid, filename)
+
 			/*
 				case "pull":
 					var target string
@@ -18,6 +18,7 @@ import (
 	"runtime"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
@@ -62,14 +63,19 @@ func init() {
 
 type TestConfig struct {
 	CacheSize map[string]int // MB for caches
+	Timeouts  map[string]int // seconds for request timeouts by endpoint
 }
 
 // OpenTest initializes the server for testing, setting up caching, datastore, etc.
 // Later configurations will override earlier ones.
 func OpenTest(configs ...TestConfig) error {
 	tc = tomlConfig{}
+	setRateLimits(tc.Server.RateLimit)
 	if len(configs) > 0 {
 		for _, c := range configs {
+			if len(c.Timeouts) != 0 {
+				tc.Server.Timeouts = c.Timeouts
+			}
 			if len(c.CacheSize) != 0 {
 				for id, size := range c.CacheSize {
 					if tc.Cache == nil {
@@ -187,6 +193,17 @@ func (c *tomlConfig) AllowTiming() bool {
 	return c.Server.AllowTiming
 }
 
+// RequestTimeout returns the maximum duration for a data instance request on the given
+// endpoint, e.g., "raw" or "sparsevol".  If there is no configured timeout for the endpoint,
+// the "default" timeout is used.  A returned duration of 0 means no timeout.
+func RequestTimeout(endpoint string) time.Duration {
+	secs, found := tc.Server.Timeouts[endpoint]
+	if !found {
+		secs = tc.Server.Timeouts["default"]
+	}
+	return time.Duration(secs) * time.Second
+}
+
 // CacheSize returns the number oF bytes reserved for the given identifier.
 // If unset, will return 0.
 func CacheSize(id string) int {
@@ -210,6 +227,13 @@ type serverConfig struct {
 
 	IIDGen   string `toml:"instance_id_gen"`
 	IIDStart uint32 `toml:"instance_id_start"`
+
+	// Timeouts gives the maximum seconds for requests by data instance endpoint,
+	// e.g., "raw" or "sparsevol", where "default" applies to all other endpoints.
+	Timeouts map[string]int
+
+	// RateLimit sets per-client quotas and fair queuing between interactive and batch requests.
+	RateLimit rateLimitConfig `toml:"ratelimit"`
 }
 
 type sizeConfig struct {
@@ -248,6 +272,7 @@ func LoadConfig(filename string) (*datastore.InstanceConfig, *dvid.LogConfig, *s
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("Could not convert relative paths to absolute paths in TOML config: %v\n", err)
 	}
+	setRateLimits(tc.Server.RateLimit)
 
 	// Get all defined stores.
 	backend := new(storage.Backend)
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/storage"
@@ -27,6 +28,16 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("bad TOML configuration: %v\n", err)
 	}
 
+	if RequestTimeout("raw") != 300*time.Second || RequestTimeout("keyvalue") != 600*time.Second {
+		t.Errorf("Bad request timeouts: raw %s, keyvalue %s\n", RequestTimeout("raw"), RequestTimeout("keyvalue"))
+	}
+
+	rl := limiter.config()
+	if rl.MaxConcurrent != 16 || rl.ClientRate != 50.0 || rl.InteractiveWeight != 4 || len(rl.BatchClients) != 1 || rl.BatchClients[0] != "ingest-bot" {
+		t.Errorf("Bad rate limit configuration: %+v\n", rl)
+	}
+	setRateLimits(rateLimitConfig{})
+
 	sz := CacheSize("labelarray")
 	if sz != 10*dvid.Mega {
 		t.Errorf("Expected labelarray cache to be set to 10 (MB), got %d bytes instead\n", sz)
@@ -6,6 +6,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -125,12 +126,23 @@ const WebHelp = `
  	Returns JSON for groupcache statistics for this server.  See github.com/golang/groupcache package
 	Stats and CacheStats for MainCache and HotCache.
 
+GET  /api/server/queue
+
+	Returns JSON for the current rate limiting configuration and request queue state, including
+	the number of active and waiting requests for each class ("interactive" and "batch") and
+	each client.  See "ratelimit" in the settings endpoint below.
+
 POST  /api/server/settings
 
 	Sets server parameters.  Expects JSON to be posted with optional keys denoting parameters:
 	{
 		"gc": 500,
-		"throttle": 2
+		"throttle": 2,
+		"ratelimit": {
+			"max_concurrent": 16,
+			"client_rate": 20,
+			"batch_clients": ["ingest-bot"]
+		}
 	}
 
 	 
@@ -143,6 +155,48 @@ POST  /api/server/settings
 	            See imageblk and labelblk GET 3d voxels and POST voxels.
 	            Default = 1.
 
+	ratelimit Object with rate limiting and fair queuing settings for data instance requests.
+	            Only given keys are changed and a value of 0 disables a limit.  These are the
+	            same keys as the [server.ratelimit] section of the TOML configuration:
+
+	            max_concurrent      Maximum number of requests running at once.  Requests
+	                                  beyond this wait in a queue for their class.
+	            max_queued          Maximum number of waiting requests.  Further requests
+	                                  receive a 503 (Service Unavailable) status.
+	            client_concurrent   Maximum number of running requests per client.
+	            client_rate         Requests per second allowed per client.  Requests beyond
+	                                  this receive a 429 (Too Many Requests) status.
+	            client_burst        Number of requests a client can make at once under client_rate.
+	            interactive_weight  Share of dispatched requests given to the interactive class.
+	                                  Default = 4.
+	            batch_weight        Share of dispatched requests given to the batch class.
+	                                  Default = 1.
+	            batch_clients       List of clients whose requests are always in the batch class.
+
+	            A client is identified by the "X-DVID-Client" header, the "u" query string, a
+	            bearer token, or its IP address, in that order.  Requests are in the batch class
+	            if they have an "interactive=false" query string, an "X-DVID-Class: batch" header,
+	            or come from a batch client.  Waiting requests are dispatched by weighted fair
+	            queuing between classes and round-robin between clients within a class.
+
+
+POST  /api/server/backup
+
+	Starts an online backup of all stores into a server-side directory given by the posted JSON:
+	{
+		"dir": "/path/to/backups/2017-10-18"
+	}
+
+	The directory must not exist or be empty.  Consistent point-in-time snapshots of all stores
+	are taken before the response is returned, and the snapshots are then written to the
+	directory in the background while the server continues to handle reads and writes.  When
+	complete, a "manifest.json" file is written with the repo versions covered by the backup.
+	A backup can be restored into empty stores using the "dvid restore" command.
+
+ GET  /api/server/backup
+
+	Returns JSON for the state of the current or most recent backup, including its manifest
+	if it completed successfully.
 
 POST  /api/server/reload-metadata
 
@@ -621,7 +675,11 @@ func initRoutes() {
 	mainMux.Get("/api/server/compiled-types/", serverCompiledTypesHandler)
 	mainMux.Get("/api/server/groupcache", serverGroupcacheHandler)
 	mainMux.Get("/api/server/groupcache/", serverGroupcacheHandler)
+	mainMux.Get("/api/server/queue", serverQueueHandler)
+	mainMux.Get("/api/server/queue/", serverQueueHandler)
 	mainMux.Post("/api/server/settings", serverSettingsHandler)
+	mainMux.Get("/api/server/backup", serverBackupStatusHandler)
+	mainMux.Post("/api/server/backup", serverBackupHandler)
 	mainMux.Post("/api/server/reload-metadata", serverReload)
 	mainMux.Post("/api/server/reload-metadata/", serverReload)
 
@@ -944,20 +1002,47 @@ func instanceSelector(c *web.C, h http.Handler) http.Handler {
 		// Also set the web request information in case logging needs it downstream.
 		ctx.SetRequestID(middleware.GetReqID(*c))
 
+		// Allow storage range scans and block pipelines to abandon work if the client
+		// disconnects or the request exceeds any configured timeout for this endpoint.
+		endpoint := c.URLParams["keyword"]
+		reqCtx := r.Context()
+		timeout := RequestTimeout(endpoint)
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithTimeout(reqCtx, timeout)
+			defer cancel()
+		}
+		ctx.SetRequestContext(reqCtx)
+
 		// Handle DVID-wide query string commands like non-interactive call designations
 		queryStrings := r.URL.Query()
 
 		// All HTTP requests are interactive so let server tally request.
 		interactive := queryStrings.Get("interactive")
-		if interactive == "" || (interactive != "false" && interactive != "0") {
+		batch := interactive == "false" || interactive == "0"
+		if !batch {
 			GotInteractiveRequest()
 		}
 
+		// Wait for this client's turn under any rate limits and fair queuing.
+		release := admitRequest(reqCtx, w, r, batch)
+		if release == nil {
+			return
+		}
+		defer release()
+
 		// TODO: setup routing for data instances as well.
 		if config != nil && config.AllowTiming() {
 			w.Header().Set("Timing-Allow-Origin", "*")
 		}
 		data.ServeHTTP(uuid, ctx, w, r)
+
+		switch reqCtx.Err() {
+		case context.Canceled:
+			dvid.Infof("HTTP %s on %q endpoint of data %q was cancelled by client disconnect (%s)\n", r.Method, endpoint, data.DataName(), r.URL)
+		case context.DeadlineExceeded:
+			dvid.Infof("HTTP %s on %q endpoint of data %q exceeded %s timeout (%s)\n", r.Method, endpoint, data.DataName(), timeout, r.URL)
+		}
 	}
 	return http.HandlerFunc(fn)
 }
@@ -1167,6 +1252,45 @@ func serverSettingsHandler(c web.C, w http.ResponseWriter, r *http.Request) {
 		SetMaxThrottleOps(maxOps)
 		fmt.Fprintf(w, "Maximum throttled ops set to %d from %d\n", maxOps, old)
 	}
+
+	// Handle rate limiting and fair queuing settings
+	if settings, found := config.Get("ratelimit"); found {
+		old, cur, err := updateRateLimits(settings)
+		if err != nil {
+			BadRequest(w, r, "POST on settings endpoint had bad 'ratelimit' settings: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "Rate limits set to %+v from %+v\n", cur, old)
+	}
+}
+
+func serverBackupHandler(w http.ResponseWriter, r *http.Request) {
+	config := dvid.NewConfig()
+	if err := config.SetByJSON(r.Body); err != nil {
+		BadRequest(w, r, fmt.Sprintf("Error decoding POSTed JSON config for backup: %v", err))
+		return
+	}
+	dir, found, err := config.GetString("dir")
+	if err != nil || !found {
+		BadRequest(w, r, "POST on backup endpoint requires 'dir' string giving backup directory")
+		return
+	}
+	if err := datastore.Backup(dir); err != nil {
+		BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "Started backup to %s\n", dir)
+}
+
+func serverBackupStatusHandler(w http.ResponseWriter, r *http.Request) {
+	m, err := json.Marshal(datastore.GetBackupStatus())
+	if err != nil {
+		BadRequest(w, r, fmt.Sprintf("Cannot marshal JSON backup status: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, string(m))
 }
 
 func serverReload(c web.C, w http.ResponseWriter, r *http.Request) {
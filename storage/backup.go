@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// backupMagic starts every stream written by WriteSnapshot.
+const backupMagic = "DVIDKV01"
+
+// BackupStats describes a stream of key-value pairs written by WriteSnapshot.
+type BackupStats struct {
+	KeyValues uint64 // number of key-value pairs
+	Bytes     uint64 // total bytes of the stream after the header
+	CRC32     uint32 // IEEE checksum of the stream after the header
+}
+
+// AllKeys returns a key range that spans every key in a store.
+func AllKeys() (kStart, kEnd Key) {
+	return Key{}, Key{0xFF}
+}
+
+type countingWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	n   uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc.Write(p[:n])
+	cw.n += uint64(n)
+	return n, err
+}
+
+// WriteSnapshot streams all key-value pairs of a snapshot to w.  Each pair is written as a
+// little-endian uint32 key length, the key, a uint32 value length, and the value.  A zero
+// key length marks the end of the stream so truncated streams can be detected.
+func WriteSnapshot(snap Snapshot, w io.Writer, cancel <-chan struct{}) (stats BackupStats, err error) {
+	bw := bufio.NewWriterSize(w, 4*1024*1024)
+	if _, err = bw.Write([]byte(backupMagic)); err != nil {
+		return
+	}
+	cw := &countingWriter{w: bw, crc: crc32.NewIEEE()}
+
+	ch := make(chan *KeyValue, 1000)
+	errCh := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		kStart, kEnd := AllKeys()
+		errCh <- snap.RawRangeQuery(kStart, kEnd, false, ch, done)
+	}()
+
+	lenBuf := make([]byte, 4)
+	for {
+		var kv *KeyValue
+		select {
+		case kv = <-ch:
+		case <-cancel:
+			return stats, fmt.Errorf("backup cancelled after %d key-values", stats.KeyValues)
+		}
+		if kv == nil {
+			break
+		}
+		binary.LittleEndian.PutUint32(lenBuf, uint32(len(kv.K)))
+		if _, err = cw.Write(lenBuf); err != nil {
+			return
+		}
+		if _, err = cw.Write(kv.K); err != nil {
+			return
+		}
+		binary.LittleEndian.PutUint32(lenBuf, uint32(len(kv.V)))
+		if _, err = cw.Write(lenBuf); err != nil {
+			return
+		}
+		if _, err = cw.Write(kv.V); err != nil {
+			return
+		}
+		stats.KeyValues++
+	}
+	if err = <-errCh; err != nil {
+		return
+	}
+	binary.LittleEndian.PutUint32(lenBuf, 0)
+	if _, err = cw.Write(lenBuf); err != nil {
+		return
+	}
+	if err = bw.Flush(); err != nil {
+		return
+	}
+	stats.Bytes = cw.n
+	stats.CRC32 = cw.crc.Sum32()
+	return
+}
+
+// ReadSnapshot reads a stream written by WriteSnapshot, calling f for each key-value pair.
+func ReadSnapshot(r io.Reader, f func(*KeyValue) error) (stats BackupStats, err error) {
+	br := bufio.NewReaderSize(r, 4*1024*1024)
+	magic := make([]byte, len(backupMagic))
+	if _, err = io.ReadFull(br, magic); err != nil {
+		return stats, fmt.Errorf("unable to read backup header: %v", err)
+	}
+	if !bytes.Equal(magic, []byte(backupMagic)) {
+		return stats, fmt.Errorf("not a DVID backup stream, got header %q", string(magic))
+	}
+	crc := crc32.NewIEEE()
+	tr := io.TeeReader(br, crc)
+
+	lenBuf := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(tr, lenBuf); err != nil {
+			return stats, fmt.Errorf("backup stream truncated after %d key-values: %v", stats.KeyValues, err)
+		}
+		stats.Bytes += 4
+		keyLen := binary.LittleEndian.Uint32(lenBuf)
+		if keyLen == 0 {
+			break
+		}
+		kv := &KeyValue{K: make(Key, keyLen)}
+		if _, err = io.ReadFull(tr, kv.K); err != nil {
+			return stats, fmt.Errorf("backup stream truncated in key %d: %v", stats.KeyValues, err)
+		}
+		if _, err = io.ReadFull(tr, lenBuf); err != nil {
+			return stats, fmt.Errorf("backup stream truncated in key %d: %v", stats.KeyValues, err)
+		}
+		valLen := binary.LittleEndian.Uint32(lenBuf)
+		kv.V = make([]byte, valLen)
+		if _, err = io.ReadFull(tr, kv.V); err != nil {
+			return stats, fmt.Errorf("backup stream truncated in value %d: %v", stats.KeyValues, err)
+		}
+		stats.Bytes += uint64(keyLen) + 4 + uint64(valLen)
+		if err = f(kv); err != nil {
+			return
+		}
+		stats.KeyValues++
+	}
+	stats.CRC32 = crc.Sum32()
+	return
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// memSnapshot is an in-memory snapshot of sorted key-value pairs.
+type memSnapshot []KeyValue
+
+func (s memSnapshot) RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error {
+	for i := range s {
+		if bytes.Compare(s[i].K, kStart) < 0 || bytes.Compare(s[i].K, kEnd) > 0 {
+			continue
+		}
+		select {
+		case out <- &s[i]:
+		case <-cancel:
+			return nil
+		}
+	}
+	out <- nil
+	return nil
+}
+
+func (s memSnapshot) Release() {}
+
+func TestSnapshotStream(t *testing.T) {
+	var snap memSnapshot
+	for i := 0; i < 100; i++ {
+		k := Key(fmt.Sprintf("%c-key-%03d", byte(i%3), i))
+		v := bytes.Repeat([]byte{byte(i)}, i*10)
+		snap = append(snap, KeyValue{k, v})
+	}
+
+	var buf bytes.Buffer
+	written, err := WriteSnapshot(snap, &buf, nil)
+	if err != nil {
+		t.Fatalf("error writing snapshot: %v\n", err)
+	}
+	if written.KeyValues != 100 || written.Bytes != uint64(buf.Len()-len(backupMagic)) {
+		t.Errorf("bad write stats: %+v for %d byte stream\n", written, buf.Len())
+	}
+
+	var got []KeyValue
+	read, err := ReadSnapshot(bytes.NewBuffer(buf.Bytes()), func(kv *KeyValue) error {
+		got = append(got, *kv)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error reading snapshot: %v\n", err)
+	}
+	if read != written {
+		t.Errorf("read stats %+v don't match written stats %+v\n", read, written)
+	}
+	if len(got) != len(snap) {
+		t.Fatalf("expected %d key-values, got %d\n", len(snap), len(got))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i].K, snap[i].K) || !bytes.Equal(got[i].V, snap[i].V) {
+			t.Fatalf("key-value %d doesn't match: got key %q\n", i, got[i].K)
+		}
+	}
+
+	// Truncated streams should fail.
+	truncated := buf.Bytes()[:buf.Len()-10]
+	if _, err := ReadSnapshot(bytes.NewBuffer(truncated), func(*KeyValue) error { return nil }); err == nil {
+		t.Errorf("expected error reading truncated stream\n")
+	}
+	if _, err := ReadSnapshot(bytes.NewBufferString("not a backup"), func(*KeyValue) error { return nil }); err == nil {
+		t.Errorf("expected error reading stream with bad header\n")
+	}
+}
+
+// failingWriter returns an error once more than limit bytes have been written.
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return 0, fmt.Errorf("write limit exceeded")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestSnapshotWriteError(t *testing.T) {
+	var snap memSnapshot
+	for i := 0; i < 10; i++ {
+		k := Key(fmt.Sprintf("key-%03d", i))
+		snap = append(snap, KeyValue{k, bytes.Repeat([]byte{byte(i)}, 1024*1024)})
+	}
+	if _, err := WriteSnapshot(snap, &failingWriter{limit: 1024}, nil); err == nil {
+		t.Errorf("expected error writing snapshot to failing writer\n")
+	}
+}
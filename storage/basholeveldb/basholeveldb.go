@@ -531,17 +531,40 @@ type errorableKV struct {
 	error
 }
 
-func sendKV(vctx storage.VersionedCtx, values []*storage.KeyValue, ch chan errorableKV) {
+func sendKV(vctx storage.VersionedCtx, values []*storage.KeyValue, ch chan errorableKV, done <-chan struct{}) bool {
 	if len(values) != 0 {
 		kv, err := vctx.VersionedKeyValue(values)
 		if err != nil {
-			ch <- errorableKV{nil, err}
-			return
+			sendResult(ch, done, errorableKV{nil, err})
+			return false
 		}
 		if kv != nil {
-			ch <- errorableKV{kv, nil}
+			return sendResult(ch, done, errorableKV{kv, nil})
 		}
 	}
+	return true
+}
+
+// sendResult sends a range result down the channel and returns false if the receiver
+// has stopped listening, in which case the range iteration should be abandoned.
+func sendResult(ch chan errorableKV, done <-chan struct{}, result errorableKV) bool {
+	select {
+	case ch <- result:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// receiveKV returns the next range result or an error if the request associated with
+// the context has been cancelled or timed out.
+func receiveKV(ctx storage.Context, ch chan errorableKV) errorableKV {
+	select {
+	case result := <-ch:
+		return result
+	case <-storage.ContextDone(ctx):
+		return errorableKV{nil, storage.ContextErr(ctx)}
+	}
 }
 
 // versionedRange sends a range of key-value pairs for a particular version down a channel.
@@ -556,19 +579,19 @@ func (db *LevelDB) versionedRange(vctx storage.VersionedCtx, begTKey, endTKey st
 
 	minKey, err := vctx.MinVersionKey(begTKey)
 	if err != nil {
-		ch <- errorableKV{nil, err}
+		sendResult(ch, done, errorableKV{nil, err})
 		return
 	}
 	maxKey, err := vctx.MaxVersionKey(endTKey)
 	if err != nil {
-		ch <- errorableKV{nil, err}
+		sendResult(ch, done, errorableKV{nil, err})
 		return
 	}
 
 	values := []*storage.KeyValue{}
 	maxVersionKey, err := vctx.MaxVersionKey(begTKey)
 	if err != nil {
-		ch <- errorableKV{nil, err}
+		sendResult(ch, done, errorableKV{nil, err})
 		return
 	}
 
@@ -577,7 +600,6 @@ func (db *LevelDB) versionedRange(vctx storage.VersionedCtx, begTKey, endTKey st
 	for {
 		select {
 		case <-done: // only happens if we don't care about rest of data.
-			ch <- errorableKV{nil, nil}
 			return
 		default:
 		}
@@ -594,34 +616,37 @@ func (db *LevelDB) versionedRange(vctx storage.VersionedCtx, begTKey, endTKey st
 				if storage.Key(itKey).IsDataKey() {
 					indexBytes, err := storage.TKeyFromKey(itKey)
 					if err != nil {
-						ch <- errorableKV{nil, err}
+						sendResult(ch, done, errorableKV{nil, err})
 						return
 					}
 					maxVersionKey, err = vctx.MaxVersionKey(indexBytes)
 					if err != nil {
-						ch <- errorableKV{nil, err}
+						sendResult(ch, done, errorableKV{nil, err})
 						return
 					}
 				}
-				sendKV(vctx, values, ch)
+				if !sendKV(vctx, values, ch, done) {
+					return
+				}
 				values = []*storage.KeyValue{}
 			}
 			// Did we pass the final key?
 			if bytes.Compare(itKey, maxKey) > 0 {
-				if len(values) > 0 {
-					sendKV(vctx, values, ch)
+				if len(values) > 0 && !sendKV(vctx, values, ch, done) {
+					return
 				}
-				ch <- errorableKV{nil, nil}
+				sendResult(ch, done, errorableKV{nil, nil})
 				return
 			}
 			values = append(values, &storage.KeyValue{K: itKey, V: itValue})
 			it.Next()
 		} else {
 			if err = it.GetError(); err != nil {
-				ch <- errorableKV{nil, err}
+				sendResult(ch, done, errorableKV{nil, err})
 			} else {
-				sendKV(vctx, values, ch)
-				ch <- errorableKV{nil, nil}
+				if sendKV(vctx, values, ch, done) {
+					sendResult(ch, done, errorableKV{nil, nil})
+				}
 			}
 			return
 		}
@@ -658,7 +683,6 @@ func (db *LevelDB) unversionedRange(ctx storage.Context, begTKey, endTKey storag
 			}
 			select {
 			case <-done:
-				ch <- errorableKV{nil, nil}
 				return
 			case ch <- errorableKV{&storage.KeyValue{K: itKey, V: itValue}, nil}:
 				it.Next()
@@ -668,9 +692,9 @@ func (db *LevelDB) unversionedRange(ctx storage.Context, begTKey, endTKey storag
 		}
 	}
 	if err := it.GetError(); err != nil {
-		ch <- errorableKV{nil, err}
+		sendResult(ch, done, errorableKV{nil, err})
 	} else {
-		ch <- errorableKV{nil, nil}
+		sendResult(ch, done, errorableKV{nil, nil})
 	}
 	return
 }
@@ -701,7 +725,7 @@ func (db *LevelDB) KeysInRange(ctx storage.Context, kStart, kEnd storage.TKey) (
 	// Consume the keys.
 	values := []storage.TKey{}
 	for {
-		result := <-ch
+		result := receiveKV(ctx, ch)
 		if result.error != nil {
 			return nil, result.error
 		}
@@ -742,7 +766,7 @@ func (db *LevelDB) SendKeysInRange(ctx storage.Context, kStart, kEnd storage.TKe
 
 	// Consume the keys.
 	for {
-		result := <-ch
+		result := receiveKV(ctx, ch)
 		if result.error != nil {
 			kch <- nil
 			return result.error
@@ -781,7 +805,7 @@ func (db *LevelDB) GetRange(ctx storage.Context, kStart, kEnd storage.TKey) ([]*
 	// Consume the key-value pairs.
 	values := []*storage.TKeyValue{}
 	for {
-		result := <-ch
+		result := receiveKV(ctx, ch)
 		if result.error != nil {
 			return nil, result.error
 		}
@@ -822,7 +846,7 @@ func (db *LevelDB) ProcessRange(ctx storage.Context, kStart, kEnd storage.TKey,
 
 	// Consume the key-value pairs.
 	for {
-		result := <-ch
+		result := receiveKV(ctx, ch)
 		if result.error != nil {
 			return result.error
 		}
@@ -893,6 +917,63 @@ func (db *LevelDB) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out ch
 	return nil
 }
 
+// ---- SnapshotDB interface ------
+
+type snapshot struct {
+	db   *LevelDB
+	snap *levigo.Snapshot
+}
+
+// NewSnapshot returns a consistent, point-in-time view of the database that is not
+// affected by later writes.
+func (db *LevelDB) NewSnapshot() (storage.Snapshot, error) {
+	if db == nil {
+		return nil, fmt.Errorf("Can't call NewSnapshot on nil LevelDB")
+	}
+	return &snapshot{db: db, snap: db.ldb.NewSnapshot()}, nil
+}
+
+// Release frees the leveldb snapshot.
+func (s *snapshot) Release() {
+	s.db.ldb.ReleaseSnapshot(s.snap)
+}
+
+// RawRangeQuery sends a range of full keys as of the snapshot.  A nil is sent down the
+// channel when the range is complete.
+func (s *snapshot) RawRangeQuery(kStart, kEnd storage.Key, keysOnly bool, out chan *storage.KeyValue, cancel <-chan struct{}) error {
+	dvid.StartCgo()
+	ro := levigo.NewReadOptions()
+	ro.SetSnapshot(s.snap)
+	ro.SetFillCache(false)
+	it := s.db.ldb.NewIterator(ro)
+	defer func() {
+		it.Close()
+		ro.Close()
+		dvid.StopCgo()
+	}()
+
+	var itValue []byte
+	for it.Seek(kStart); it.Valid(); it.Next() {
+		itKey := it.Key()
+		if bytes.Compare(itKey, kEnd) > 0 {
+			break
+		}
+		storage.StoreKeyBytesRead <- len(itKey)
+		if !keysOnly {
+			itValue = it.Value()
+			storage.StoreValueBytesRead <- len(itValue)
+		}
+		kv := storage.KeyValue{itKey, itValue}
+		select {
+		case out <- &kv:
+		case <-cancel:
+			return nil
+		}
+	}
+	out <- nil
+	return it.GetError()
+}
+
 // ---- KeyValueSetter interface ------
 
 // Put writes a value with given key.
@@ -6,6 +6,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -112,6 +113,34 @@ type RequestCtx interface {
 
 	// SetRequestID sets a string identifier.
 	SetRequestID(id string)
+
+	// RequestContext returns the context.Context for the request, which signals
+	// cancellation when the client disconnects or the request times out.
+	RequestContext() context.Context
+
+	// SetRequestContext associates a context.Context with the request.
+	SetRequestContext(c context.Context)
+}
+
+// ContextDone returns a channel that is closed when the request associated with the
+// given Context has been cancelled or has timed out.  If there is no associated request,
+// a nil channel is returned, which never receives.
+func ContextDone(ctx Context) <-chan struct{} {
+	rctx, ok := ctx.(RequestCtx)
+	if !ok {
+		return nil
+	}
+	return rctx.RequestContext().Done()
+}
+
+// ContextErr returns a non-nil error, either context.Canceled or context.DeadlineExceeded,
+// if the request associated with the given Context should no longer be processed.
+func ContextErr(ctx Context) error {
+	rctx, ok := ctx.(RequestCtx)
+	if !ok {
+		return nil
+	}
+	return rctx.RequestContext().Err()
 }
 
 const (
@@ -304,6 +333,7 @@ type DataContext struct {
 	version dvid.VersionID
 	client  dvid.ClientID
 	reqID   string
+	reqCtx  context.Context
 }
 
 // NewDataContext provides a way for datatypes to create a Context that adheres to DVID
@@ -311,7 +341,7 @@ type DataContext struct {
 // only be implemented within package storage, we force compatible implementations to embed
 // DataContext and initialize it via this function.
 func NewDataContext(data dvid.Data, versionID dvid.VersionID) *DataContext {
-	return &DataContext{data, versionID, 0, ""}
+	return &DataContext{data, versionID, 0, "", nil}
 }
 
 func (ctx *DataContext) UpdateInstance(k Key) error {
@@ -354,6 +384,20 @@ func (ctx *DataContext) SetRequestID(id string) {
 	ctx.reqID = id
 }
 
+// RequestContext returns the context.Context for the request or context.Background()
+// if none has been set.
+func (ctx *DataContext) RequestContext() context.Context {
+	if ctx.reqCtx == nil {
+		return context.Background()
+	}
+	return ctx.reqCtx
+}
+
+// SetRequestContext associates a context.Context with the request.
+func (ctx *DataContext) SetRequestContext(c context.Context) {
+	ctx.reqCtx = c
+}
+
 // ---- storage.Context implementation
 
 func (ctx *DataContext) implementsOpaque() {}
@@ -2,8 +2,10 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/janelia-flyem/dvid/dvid"
 )
@@ -175,3 +177,32 @@ func TestUnversionedKey(t *testing.T) {
 		t.Errorf("Expected version id of data key from using context to be 3, got %d\n", v3)
 	}
 }
+
+func TestRequestContext(t *testing.T) {
+	var mctx MetadataContext
+	if ContextDone(mctx) != nil || ContextErr(mctx) != nil {
+		t.Errorf("expected no cancellation signals for metadata context\n")
+	}
+
+	dctx := GetTestDataContext(TestUUID1, "mydata", 13)
+	if ContextDone(dctx) != nil || ContextErr(dctx) != nil {
+		t.Errorf("expected no cancellation signals for data context without request\n")
+	}
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	dctx.SetRequestContext(reqCtx)
+	select {
+	case <-ContextDone(dctx):
+		t.Errorf("request context should not be done before cancellation\n")
+	default:
+	}
+	cancel()
+	select {
+	case <-ContextDone(dctx):
+	case <-time.After(time.Second):
+		t.Fatalf("request context not done after cancellation\n")
+	}
+	if ContextErr(dctx) != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v\n", ContextErr(dctx))
+	}
+}
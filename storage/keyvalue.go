@@ -231,7 +231,8 @@ type OrderedKeyValueGetter interface {
 	// implementations if possible because each version's key-value pairs are sent
 	// without filtering by the current version and its ancestor graph.  A nil is sent
 	// down the channel when the range is complete.  The query can be cancelled by sending
-	// a value down the cancel channel.
+	// a value down the cancel channel or closing it, e.g., passing ContextDone(ctx) will
+	// abandon the query when the request associated with ctx is cancelled or times out.
 	RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error
 }
 
@@ -293,6 +294,23 @@ type KeyValueBatcher interface {
 	NewBatch(ctx Context) Batch
 }
 
+// SnapshotDB is a store that can provide a consistent, point-in-time view of all its
+// key-value pairs while continuing to serve reads and writes, e.g., for online backups.
+type SnapshotDB interface {
+	NewSnapshot() (Snapshot, error)
+}
+
+// Snapshot is a read-only, point-in-time view of a store.  It must be released when no
+// longer needed so the store can reclaim space held for the snapshot.
+type Snapshot interface {
+	// RawRangeQuery is like OrderedKeyValueGetter.RawRangeQuery except the key-value
+	// pairs are those present at the time of the snapshot.
+	RawRangeQuery(kStart, kEnd Key, keysOnly bool, out chan *KeyValue, cancel <-chan struct{}) error
+
+	// Release frees the snapshot.
+	Release()
+}
+
 // KeyValueRequester allows operations to be queued so that
 // they can be handled as a batch job.  (See RequestBuffer for
 // more information.)